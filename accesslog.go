@@ -0,0 +1,146 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// AccessLogOption is used to configure the AccessLog middleware.
+type AccessLogOption func(*accessLogger)
+
+// AccessLogSample returns an access log option to only log one in every n
+// successful requests, but all the failed requests are always logged.
+func AccessLogSample(n int) AccessLogOption {
+	return func(l *accessLogger) { l.sample = uint64(n) }
+}
+
+// AccessLogSkip returns an access log option to skip the request
+// if skip returns true, such as the health check.
+func AccessLogSkip(skip func(*Context) bool) AccessLogOption {
+	return func(l *accessLogger) { l.skip = skip }
+}
+
+// AccessLogHeaders returns an access log option to log the given request
+// headers additionally.
+func AccessLogHeaders(headers ...string) AccessLogOption {
+	return func(l *accessLogger) { l.headers = append(l.headers, headers...) }
+}
+
+// AccessLogBodyDump returns an access log option to dump the request body
+// up to maxSize bytes instead of only logging the size of the body.
+func AccessLogBodyDump(maxSize int) AccessLogOption {
+	return func(l *accessLogger) { l.bodyDump = maxSize }
+}
+
+type accessLogger struct {
+	count    uint64 // Must be first to be 64-bit aligned by the atomic.
+	sample   uint64
+	logger   *slog.Logger
+	skip     func(*Context) bool
+	headers  []string
+	bodyDump int
+}
+
+// AccessLog returns a middleware to log one line for each request,
+// which contains the action, version, request id, client ip, method,
+// status code, response size and latency.
+//
+// If the handler has not responded, the middleware will respond
+// by c.Respond before logging, so the status code and response size
+// are always final. If the client has gone away, the request is logged
+// at the warn level with the status code StatusClientClosedRequest.
+func AccessLog(logger *slog.Logger, opts ...AccessLogOption) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	l := &accessLogger{logger: logger}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if l.skip != nil && l.skip(c) {
+				return next(c)
+			}
+
+			var body []byte
+			if l.bodyDump > 0 {
+				body, _ = c.BodyBytes()
+				if len(body) > l.bodyDump {
+					body = body[:l.bodyDump]
+				}
+			}
+
+			start := time.Now()
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+			l.log(c, err, time.Since(start), body)
+			return
+		}
+	}
+}
+
+func (l *accessLogger) log(c *Context, err error, latency time.Duration, body []byte) {
+	failed := err != nil || c.StatusCode() >= 400
+	if !failed && l.sample > 1 && atomic.AddUint64(&l.count, 1)%l.sample != 1 {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 12+len(l.headers))
+	attrs = append(attrs,
+		slog.String("action", c.Action),
+		slog.String("version", c.GetVersion()),
+		slog.String("requestid", c.GetRequestID()),
+		slog.String("tenant", c.Tenant),
+		slog.String("clientip", c.ClientIP()),
+		slog.String("method", c.req.Method),
+		slog.Int("status", c.observedStatus()),
+		slog.Int64("size", c.ResponseSize()),
+		slog.Duration("latency", latency),
+	)
+
+	if l.bodyDump > 0 {
+		attrs = append(attrs, slog.String("body", string(body)))
+	} else {
+		attrs = append(attrs, slog.Int64("bodysize", c.RequestSize()))
+	}
+
+	for _, header := range l.headers {
+		attrs = append(attrs, slog.String(header, c.GetReqHeader(header)))
+	}
+
+	level := slog.LevelInfo
+	if c.ClientGone() {
+		// The client has gone away, which is not the server error.
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Bool("clientgone", true))
+	} else if err != nil {
+		level = slog.LevelError
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("err", err.Error()))
+	}
+
+	l.logger.LogAttrs(c.req.Context(), level, "access", attrs...)
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+	svc := NewService()
+	svc.Use(AccessLog(logger, AccessLogSample(2), AccessLogHeaders("X-Test"),
+		AccessLogBodyDump(4), AccessLogSkip(func(c *Context) bool {
+			return c.Action == "health"
+		})))
+	svc.Register("health", func(c *Context) error { return c.Success(nil) })
+	svc.Register("svc", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		} else if req.Name == "" {
+			return ErrInvalidParameter
+		}
+		return c.Success(req.Name)
+	})
+
+	call := func(action, body string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.Header.Set("X-Test", "abc")
+		svc.ServeHTTP(rec, req)
+	}
+
+	call("health", "")
+	call("svc", `{"Name":"a"}`)
+	call("svc", `{"Name":"b"}`) // Skipped by sampling.
+	call("svc", `{}`)
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, m)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expect %d log lines, but got %d: %s", 2, len(lines), buf.String())
+	}
+
+	if lines[0]["action"] != "svc" || lines[0]["X-Test"] != "abc" ||
+		lines[0]["body"] != `{"Na` || lines[0]["status"] != float64(200) {
+		t.Errorf("unexpected log line: %v", lines[0])
+	}
+
+	if lines[1]["level"] != "ERROR" || lines[1]["size"].(float64) == 0 {
+		t.Errorf("unexpected log line: %v", lines[1])
+	}
+}
+
+func TestAccessLogChunkedBodySize(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	svc := NewService()
+	svc.Use(AccessLog(slog.New(slog.NewJSONHandler(buf, nil))))
+	svc.Register("svc", func(c *Context) error {
+		body, err := c.BodyBytes()
+		if err != nil {
+			return err
+		}
+		return c.Success(string(body))
+	})
+
+	body := `{"Name":"a"}`
+	req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=svc", strings.NewReader(body))
+	req.ContentLength = -1 // Chunked
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	} else if line["bodysize"] != float64(len(body)) {
+		t.Errorf("expect bodysize %d, but got %v", len(body), line["bodysize"])
+	}
+}
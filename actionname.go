@@ -0,0 +1,63 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxActionNameLength is the maximum length of the service name
+// by ValidateActionName.
+const MaxActionNameLength = 128
+
+// ValidateActionName is the default validator of the service name,
+// which must only consist of the ASCII letters, the digits,
+// '.', '_' and '-', and must not be longer than MaxActionNameLength.
+func ValidateActionName(name string) error {
+	if len(name) > MaxActionNameLength {
+		return fmt.Errorf("the name is longer than %d", MaxActionNameLength)
+	}
+
+	for i, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return fmt.Errorf("invalid character %+q at offset %d", r, i)
+		}
+	}
+	return nil
+}
+
+// validateName panics if the service name is invalid, which must not have
+// the leading or trailing whitespaces whatever the validator is.
+func (s *Service) validateName(fn, name string) {
+	var err error
+	if name == "" {
+		err = fmt.Errorf("the name must not be empty")
+	} else if strings.TrimSpace(name) != name {
+		err = fmt.Errorf("the name must not have the leading or trailing whitespaces")
+	} else if s.ActionNameValidator != nil {
+		err = s.ActionNameValidator(name)
+	} else {
+		err = ValidateActionName(name)
+	}
+
+	if err != nil {
+		panic(fmt.Errorf("%s: invalid service name %s: %v", fn, strconv.QuoteToASCII(name), err))
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateActionName(t *testing.T) {
+	for _, name := range []string{"CreateUser", "user.Create", "create_user-v2"} {
+		if err := ValidateActionName(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"Create User", "Create/User", "Gеt", strings.Repeat("a", MaxActionNameLength+1)} {
+		if err := ValidateActionName(name); err == nil {
+			t.Errorf("%s: expect an error", name)
+		}
+	}
+}
+
+func TestServiceRegisterInvalidName(t *testing.T) {
+	register := func(svc *Service, name string) (panicValue string) {
+		defer func() {
+			if r := recover(); r != nil {
+				panicValue = fmt.Sprint(r)
+			}
+		}()
+		svc.Register(name, func(c *Context) error { return nil })
+		return
+	}
+
+	svc := NewService()
+	if s := register(svc, "GetUser "); !strings.Contains(s, `"GetUser "`) {
+		t.Errorf("unexpected the panic: %s", s)
+	}
+	if s := register(svc, "Gеt"); !strings.HasPrefix(s, "Service.Register:") ||
+		!strings.Contains(s, `"G\u0435t"`) {
+		t.Errorf("unexpected the panic: %s", s)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expect a panic for the invalid alias")
+			}
+		}()
+		svc.Mapping("Get\tUser", "GetUser")
+	}()
+
+	svc.ActionNameValidator = func(name string) error {
+		if strings.HasPrefix(name, "/") {
+			return nil
+		}
+		return errors.New("must start with '/'")
+	}
+	if s := register(svc, "/user/get"); s != "" {
+		t.Errorf("unexpected the panic: %s", s)
+	} else if s = register(svc, "GetUser"); !strings.Contains(s, "must start with '/'") {
+		t.Errorf("unexpected the panic: %s", s)
+	} else if s = register(svc, " /user/get"); s == "" {
+		t.Error("expect a panic for the leading whitespace")
+	}
+}
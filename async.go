@@ -0,0 +1,465 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DescribeJobAction is the name of the built-in service to describe
+// the job of the asynchronous service, which is registered by RegisterAsync
+// and only describes the job submitted by the same tenant and principal.
+const DescribeJobAction = "DescribeJob"
+
+// JobStatus is the status of the job.
+type JobStatus string
+
+// Predefine some job statuses.
+const (
+	JobPending   JobStatus = "Pending"
+	JobRunning   JobStatus = "Running"
+	JobSucceeded JobStatus = "Succeeded"
+	JobFailed    JobStatus = "Failed"
+)
+
+// Job is the job of the asynchronous service.
+type Job struct {
+	ID        string `json:"JobId"`
+	Action    string
+	Status    JobStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Tenant and Principal are the tenant and the principal of the submitter,
+	// and only the same submitter can describe the job by DescribeJobAction,
+	// which does not respond them.
+	Tenant    string `json:",omitempty"`
+	Principal string `json:",omitempty"`
+
+	// Result is the response envelope captured when the job is finished.
+	Result json.RawMessage `json:",omitempty"`
+}
+
+// Finished reports whether the job is finished.
+func (j Job) Finished() bool { return j.Status == JobSucceeded || j.Status == JobFailed }
+
+// JobStore is used to store the jobs of the asynchronous services.
+type JobStore interface {
+	Save(job Job) error
+	Load(id string) (job Job, ok bool, err error)
+	Delete(id string) error
+}
+
+// MemoryJobStore is an in-memory JobStore, which expires the job after ttl
+// since it is saved last time and cleans up the expired ones periodically.
+type MemoryJobStore struct {
+	ttl  time.Duration
+	lock sync.RWMutex
+	jobs map[string]memoryJob
+	stop chan struct{}
+	once sync.Once
+}
+
+type memoryJob struct {
+	Job
+	expire time.Time
+}
+
+// NewMemoryJobStore returns a new MemoryJobStore, which keeps the job
+// for ttl and cleans up the expired ones every interval.
+//
+// If ttl is equal to or less than 0, it is 1h by default.
+// If interval is equal to or less than 0, it is 1m by default.
+func NewMemoryJobStore(ttl, interval time.Duration) *MemoryJobStore {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &MemoryJobStore{
+		ttl:  ttl,
+		jobs: make(map[string]memoryJob, 64),
+		stop: make(chan struct{}),
+	}
+	go s.loop(interval)
+	return s
+}
+
+// Close stops the cleanup goroutine.
+func (s *MemoryJobStore) Close() { s.once.Do(func() { close(s.stop) }) }
+
+// Len returns the number of the stored jobs.
+func (s *MemoryJobStore) Len() (n int) {
+	s.lock.RLock()
+	n = len(s.jobs)
+	s.lock.RUnlock()
+	return
+}
+
+func (s *MemoryJobStore) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			for id, job := range s.jobs {
+				if !now.Before(job.expire) {
+					delete(s.jobs, id)
+				}
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// Save implements the interface JobStore.
+func (s *MemoryJobStore) Save(job Job) error {
+	s.lock.Lock()
+	s.jobs[job.ID] = memoryJob{Job: job, expire: time.Now().Add(s.ttl)}
+	s.lock.Unlock()
+	return nil
+}
+
+// Load implements the interface JobStore.
+func (s *MemoryJobStore) Load(id string) (job Job, ok bool, err error) {
+	s.lock.RLock()
+	mjob, ok := s.jobs[id]
+	s.lock.RUnlock()
+	if ok && time.Now().Before(mjob.expire) {
+		return mjob.Job, true, nil
+	}
+	return Job{}, false, nil
+}
+
+// Delete implements the interface JobStore.
+func (s *MemoryJobStore) Delete(id string) error {
+	s.lock.Lock()
+	delete(s.jobs, id)
+	s.lock.Unlock()
+	return nil
+}
+
+// AsyncExecutor is the bounded worker pool to execute the jobs
+// of the asynchronous services.
+type AsyncExecutor struct {
+	store JobStore
+	tasks chan asyncTask
+	stop  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+type asyncTask struct {
+	job     Job
+	ctx     *Context
+	buf     *bufferResponseWriter // The response writer of ctx.
+	handler Handler
+}
+
+// NewAsyncExecutor returns a new AsyncExecutor with the number of workers
+// and the size of the queue, which stores the jobs into store.
+//
+// If workers is equal to or less than 0, it is 4 by default.
+// If queueSize is less than 0, it is 0, that's, no queue.
+// If store is nil, it is NewMemoryJobStore(0, 0) by default.
+func NewAsyncExecutor(workers, queueSize int, store JobStore) *AsyncExecutor {
+	if workers <= 0 {
+		workers = 4
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	if store == nil {
+		store = NewMemoryJobStore(0, 0)
+	}
+
+	e := &AsyncExecutor{
+		store: store,
+		tasks: make(chan asyncTask, queueSize),
+		stop:  make(chan struct{}),
+	}
+
+	e.wg.Add(workers)
+	for ; workers > 0; workers-- {
+		go e.work()
+	}
+	return e
+}
+
+// Store returns the store of the jobs.
+func (e *AsyncExecutor) Store() JobStore { return e.store }
+
+// Close stops all the workers and waits for the running jobs to finish.
+// The jobs still in the queue are abandoned and kept as pending.
+func (e *AsyncExecutor) Close() {
+	e.once.Do(func() { close(e.stop) })
+	e.wg.Wait()
+}
+
+func (e *AsyncExecutor) work() {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case task := <-e.tasks:
+			e.run(task)
+		}
+	}
+}
+
+// submit saves the job as pending and enqueues it, which deletes the job
+// from the store if failing to enqueue it, so no job is kept pending forever.
+//
+// The job is saved before being enqueued, or the worker may update it
+// to be running before it is saved as pending.
+func (e *AsyncExecutor) submit(task asyncTask) (err error) {
+	if err = e.store.Save(task.job); err != nil {
+		return
+	}
+
+	select {
+	case <-e.stop:
+		err = ErrServiceUnavailable.WithMessage("the async executor is closed")
+	case e.tasks <- task:
+	default:
+		err = ErrServiceUnavailable.WithMessage("too many pending jobs")
+	}
+
+	if err != nil {
+		e.store.Delete(task.job.ID)
+	}
+	return
+}
+
+func (e *AsyncExecutor) run(task asyncTask) {
+	job := task.job
+	job.Status, job.UpdatedAt = JobRunning, time.Now()
+	e.store.Save(job)
+
+	job.Status, job.Result = e.execute(task)
+	job.UpdatedAt = time.Now()
+	e.store.Save(job)
+}
+
+// execute executes the job and returns its status and result, which
+// recovers the panic of the whole execution, including responding the result.
+func (e *AsyncExecutor) execute(task asyncTask) (status JobStatus, result json.RawMessage) {
+	c := task.ctx
+	defer func() {
+		if r := recover(); r != nil {
+			c.svc.handlePanic(c, r)
+			err := ErrServerError.WithMessage("the job panics")
+			status = JobFailed
+			result, _ = json.Marshal(jsonResponse{RequestID: c.RequestID, Error: &err})
+		}
+	}()
+
+	err := task.handler(c)
+	if !c.res.Wrote {
+		c.Respond(nil, err)
+	}
+
+	if err == nil {
+		status = JobSucceeded
+	} else {
+		status = JobFailed
+	}
+
+	if body := task.buf.body.Bytes(); json.Valid(body) {
+		result = json.RawMessage(body)
+	} else {
+		result, _ = json.Marshal(string(body))
+	}
+	return
+}
+
+// detach returns a new Context detached from the pool, which copies
+// the request of c and buffers the response in memory by the returned
+// response writer, so that it can be used after c is released.
+func (c *Context) detach() (*Context, *bufferResponseWriter, error) {
+	body, err := c.BodyBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := c.req.WithContext(context.Background())
+	u := *c.req.URL
+	req.URL = &u
+	req.Header = cloneHeader(c.req.Header)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var dc *Context
+	if c.svc.NewContext != nil {
+		dc = c.svc.NewContext()
+	} else {
+		dc = NewContext()
+	}
+
+	dc.svc = c.svc
+	dc.Action, dc.Version, dc.RequestID = c.Action, c.GetVersion(), c.GetRequestID()
+	dc.Tenant = c.Tenant
+	dc.Binder, dc.SetDefault, dc.Validate = c.Binder, c.SetDefault, c.Validate
+	dc.Render, dc.principal = c.Render, c.principal
+	dc.body, dc.bodyb = body, true
+
+	w := newBufferResponseWriter()
+	dc.SetReqResp(req, w)
+	return dc, w, nil
+}
+
+// AsyncOption is used to configure the asynchronous service.
+type AsyncOption func(*asyncConfig)
+
+// AsyncActionOptions returns an async option to set the action options
+// of the registered service, such as the middlewares, which act on
+// the request to submit the job, not the job itself.
+func AsyncActionOptions(opts ...ActionOption) AsyncOption {
+	return func(c *asyncConfig) { c.opts = append(c.opts, opts...) }
+}
+
+// AsyncTimeout returns an async option to set the timeout of the job,
+// which is set as the deadline of the context of the request.
+//
+// Default: 0, which has no timeout.
+func AsyncTimeout(timeout time.Duration) AsyncOption {
+	return func(c *asyncConfig) { c.timeout = timeout }
+}
+
+type asyncConfig struct {
+	opts    []ActionOption
+	timeout time.Duration
+}
+
+func (s *Service) asyncExecutor() *AsyncExecutor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.AsyncExecutor == nil {
+		s.AsyncExecutor = NewAsyncExecutor(0, 128, nil)
+	}
+	return s.AsyncExecutor
+}
+
+// RegisterAsync registers an asynchronous service with the name and
+// the handler, which submits the job executing the handler to AsyncExecutor
+// of the service and responds the status code 202 with the data
+// {"JobId": "...", "Status": "Pending"} immediately.
+//
+// If AsyncExecutor is nil, it is created with 4 workers and 128 queue size.
+// The service named DescribeJobAction is registered as well if not,
+// which takes {"JobId": "..."} and returns the job, containing
+// the captured response envelope as Result once finished.
+//
+// The job is executed with a detached Context, which buffers the response
+// in memory, so the handler may use it as usual.
+func (s *Service) RegisterAsync(name string, handler Handler, opts ...AsyncOption) {
+	if handler == nil {
+		panic("Service.RegisterAsync: the service handler must not be empty")
+	}
+
+	var conf asyncConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	executor := s.asyncExecutor()
+	if conf.timeout > 0 {
+		timeout, next := conf.timeout, handler
+		handler = func(c *Context) error {
+			ctx, cancel := context.WithTimeout(c.req.Context(), timeout)
+			defer cancel()
+			c.req = c.req.WithContext(ctx)
+			return next(c)
+		}
+	}
+
+	s.RegisterWithOptions(name, func(c *Context) (err error) {
+		dc, w, err := c.detach()
+		if err != nil {
+			return ErrInvalidParameter.WithMessage(err.Error())
+		}
+
+		now := time.Now()
+		job := Job{
+			ID:        generateRequestID(),
+			Action:    c.Action,
+			Status:    JobPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Tenant:    c.Tenant,
+			Principal: jobPrincipal(c),
+		}
+
+		task := asyncTask{job: job, ctx: dc, buf: w, handler: handler}
+		if err = executor.submit(task); err != nil {
+			return
+		}
+
+		c.WriteHeader(http.StatusAccepted)
+		return c.Success(map[string]interface{}{"JobId": job.ID, "Status": job.Status})
+	}, conf.opts...)
+
+	if _, ok := s.getAction(DescribeJobAction); !ok {
+		s.Register(DescribeJobAction, s.describeJob)
+	}
+}
+
+func (s *Service) describeJob(c *Context) (err error) {
+	var req struct {
+		JobID string `json:"JobId" query:"JobId"`
+	}
+	if err = c.Bind(&req); err != nil {
+		return
+	} else if req.JobID == "" {
+		return ErrInvalidParameter.WithMessage("missing JobId")
+	}
+
+	s.lock.RLock()
+	executor := s.AsyncExecutor
+	s.lock.RUnlock()
+	if executor == nil {
+		return ErrResourceNotFound.WithMessage("no job '%s'", req.JobID)
+	}
+
+	job, ok, err := executor.Store().Load(req.JobID)
+	if err != nil {
+		return ErrServerError.WithMessage(err.Error())
+	} else if !ok || job.Tenant != c.Tenant || job.Principal != jobPrincipal(c) {
+		// Do not reveal the existence of the job of the other submitters.
+		return ErrResourceNotFound.WithMessage("no job '%s'", req.JobID)
+	}
+
+	job.Tenant, job.Principal = "", ""
+	return c.Success(job)
+}
+
+func jobPrincipal(c *Context) string {
+	if p := c.Principal(); p != nil {
+		return fmt.Sprint(p)
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceRegisterAsync(t *testing.T) {
+	store := NewMemoryJobStore(time.Minute, time.Minute)
+	defer store.Close()
+
+	svc := NewService()
+	svc.AsyncExecutor = NewAsyncExecutor(1, 1, store)
+	defer svc.AsyncExecutor.Close()
+
+	release := make(chan struct{})
+	svc.RegisterAsync("Report", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		<-release
+		return c.Success("report:" + req.Name)
+	})
+	svc.RegisterAsync("Fail", func(c *Context) error { return ErrFailedOperation })
+
+	call := func(action, body string) (*httptest.ResponseRecorder, Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec, resp
+	}
+
+	rec, resp := call("Report", `{"Name":"abc"}`)
+	if rec.Code != 202 {
+		t.Errorf("expect status code %d, but got %d", 202, rec.Code)
+	}
+	data := resp.Data.(map[string]interface{})
+	if data["Status"] != string(JobPending) {
+		t.Errorf("expect status '%s', but got '%v'", JobPending, data["Status"])
+	}
+
+	describe := func(id string) (job Job) {
+		_, resp := call(DescribeJobAction, `{"JobId":"`+id+`"}`)
+		if resp.Error.Code != "" {
+			t.Fatal(resp.Error)
+		}
+		buf, _ := json.Marshal(resp.Data)
+		json.Unmarshal(buf, &job)
+		return
+	}
+
+	wait := func(id string) (job Job) {
+		for i := 0; i < 100; i++ {
+			if job = describe(id); job.Finished() {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatalf("the job '%s' is not finished", id)
+		return
+	}
+
+	id := data["JobId"].(string)
+	if job := describe(id); job.Finished() {
+		t.Errorf("unexpected the finished job: %+v", job)
+	}
+
+	close(release)
+	job := wait(id)
+	if job.Status != JobSucceeded || job.Action != "Report" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	var result Response
+	if err := json.Unmarshal(job.Result, &result); err != nil {
+		t.Fatal(err)
+	} else if result.Data != "report:abc" {
+		t.Errorf("unexpected the job result: %s", string(job.Result))
+	}
+
+	_, resp = call("Fail", "")
+	job = wait(resp.Data.(map[string]interface{})["JobId"].(string))
+	if json.Unmarshal(job.Result, &result); job.Status != JobFailed ||
+		result.Error.Code != ErrFailedOperation.Code {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	if _, resp = call(DescribeJobAction, `{"JobId":"none"}`); resp.Error.Code != ErrResourceNotFound.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrResourceNotFound.Code, resp.Error.Code)
+	}
+}
+
+func TestServiceRegisterAsyncPanic(t *testing.T) {
+	store := NewMemoryJobStore(time.Minute, time.Minute)
+	defer store.Close()
+
+	var panics int32
+	svc := NewService()
+	svc.AsyncExecutor = NewAsyncExecutor(1, 1, store)
+	svc.PanicHandler = func(c *Context, r interface{}) { atomic.AddInt32(&panics, 1) }
+	svc.RegisterAsync("Panic", func(c *Context) error { panic("job") })
+
+	call := func(action, body string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	id := call("Panic", "").Data.(map[string]interface{})["JobId"].(string)
+	var job Job
+	for i := 0; i < 100 && !job.Finished(); i++ {
+		time.Sleep(time.Millisecond * 10)
+		job, _, _ = store.Load(id)
+	}
+
+	var result Response
+	if json.Unmarshal(job.Result, &result); job.Status != JobFailed ||
+		result.Error.Code != ErrServerError.Code {
+		t.Errorf("unexpected job: %+v", job)
+	} else if n := atomic.LoadInt32(&panics); n != 1 {
+		t.Errorf("expect %d panic, but got %d", 1, n)
+	}
+
+	svc.AsyncExecutor.Close()
+
+	// The job failing to be submitted is not kept in the store.
+	svc = NewService()
+	svc.AsyncExecutor = NewAsyncExecutor(1, 0, store)
+	svc.AsyncExecutor.Close()
+	svc.RegisterAsync("Closed", func(c *Context) error { return nil })
+	if resp := call("Closed", ""); resp.Error.Code != ErrServiceUnavailable.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrServiceUnavailable.Code, resp.Error.Code)
+	} else if n := store.Len(); n != 1 {
+		t.Errorf("expect %d job, but got %d", 1, n)
+	}
+}
+
+func TestServiceRegisterAsyncOwner(t *testing.T) {
+	store := NewMemoryJobStore(time.Minute, time.Minute)
+	defer store.Close()
+
+	svc := NewService()
+	svc.AsyncExecutor = NewAsyncExecutor(1, 1, store)
+	defer svc.AsyncExecutor.Close()
+	svc.Authenticate = func(c *Context) (interface{}, error) {
+		if user := c.GetReqHeader("X-User"); user != "" {
+			return user, nil
+		}
+		return nil, ErrUnauthorized
+	}
+	svc.RegisterAsync("Report", func(c *Context) error { return c.Success(nil) })
+
+	call := func(action, tenant, user, body string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("X-Tenant-Id", tenant)
+		req.Header.Set("X-User", user)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	resp := call("Report", "t1", "u1", "")
+	body := `{"JobId":"` + resp.Data.(map[string]interface{})["JobId"].(string) + `"}`
+	for _, owner := range [][2]string{{"t1", "u2"}, {"t2", "u1"}, {"", "u1"}} {
+		if resp := call(DescribeJobAction, owner[0], owner[1], body); resp.Error.Code != ErrResourceNotFound.Code {
+			t.Errorf("%v: expect error '%s', but got '%s'", owner, ErrResourceNotFound.Code, resp.Error.Code)
+		}
+	}
+
+	if resp := call(DescribeJobAction, "t1", "u1", body); resp.Error.Code != "" {
+		t.Errorf("unexpected error: %+v", resp.Error)
+	} else if data := resp.Data.(map[string]interface{}); data["Tenant"] != nil || data["Principal"] != nil {
+		t.Errorf("unexpected the owner of the job: %+v", data)
+	}
+}
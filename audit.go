@@ -0,0 +1,200 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuditRecord is the record of a request for auditing.
+type AuditRecord struct {
+	Timestamp time.Time
+	Action    string
+	Version   string
+	RequestID string
+	Tenant    string
+	Principal interface{}
+	ClientIP  string
+	Latency   time.Duration
+
+	Status       int
+	ErrorCode    string
+	RequestBody  string
+	ResponseBody string
+}
+
+// AuditOption is used to configure the Audit middleware.
+type AuditOption func(*auditConfig)
+
+// AuditMaxBodySize returns an audit option to set the maximum size
+// of the request and response bodies recorded, which are truncated
+// if exceeding it.
+//
+// Default: 4096
+func AuditMaxBodySize(size int) AuditOption {
+	return func(c *auditConfig) { c.maxBody = size }
+}
+
+// AuditRedactKeys returns an audit option to redact the values of the given
+// keys, which are matched case-insensitively, in the JSON request
+// and response bodies, such as "Password".
+//
+// Notice: the whole response body is captured in memory if redacting.
+func AuditRedactKeys(keys ...string) AuditOption {
+	return func(c *auditConfig) {
+		for _, key := range keys {
+			c.redacts[strings.ToLower(key)] = struct{}{}
+		}
+	}
+}
+
+type auditConfig struct {
+	maxBody int
+	redacts map[string]struct{}
+}
+
+// Audit returns a middleware to fill an AuditRecord for each request,
+// and call the hook Service.Audit in a new goroutine after the response
+// is written. It does nothing if Service.Audit is nil.
+//
+// If the handler has not responded, the middleware will respond
+// by c.Respond before auditing.
+func Audit(opts ...AuditOption) Middleware {
+	conf := auditConfig{maxBody: 4096, redacts: make(map[string]struct{})}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			audit := c.svc.Audit
+			if audit == nil {
+				return next(c)
+			}
+
+			start := time.Now()
+			reqBody, _ := c.BodyBytes()
+
+			// The whole response body must be captured to be redacted,
+			// since the truncated JSON cannot be parsed.
+			resp := c.ResponseWriter()
+			tee := &teeResponseWriter{ResponseWriter: resp, max: conf.maxBody}
+			if len(conf.redacts) > 0 {
+				tee.max = 0
+			}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			rec := AuditRecord{
+				Timestamp:    start,
+				Action:       c.Action,
+				Version:      c.GetVersion(),
+				RequestID:    c.GetRequestID(),
+				Tenant:       c.Tenant,
+				Principal:    c.Principal(),
+				ClientIP:     c.ClientIP(),
+				Latency:      time.Since(start),
+				Status:       c.StatusCode(),
+				ErrorCode:    errorCode(err),
+				RequestBody:  conf.redact(reqBody),
+				ResponseBody: conf.redact(tee.buf),
+			}
+
+			go audit(rec)
+			return
+		}
+	}
+}
+
+// redact redacts the keys in the JSON data and truncates it
+// to the maximum size, and returns the copy.
+func (c *auditConfig) redact(data []byte) string {
+	if len(c.redacts) > 0 && len(data) > 0 {
+		var v interface{}
+		if json.Unmarshal(data, &v) == nil && c.redactValue(v) {
+			if _data, err := json.Marshal(v); err == nil {
+				data = _data
+			}
+		}
+	}
+
+	if c.maxBody > 0 && len(data) > c.maxBody {
+		data = data[:c.maxBody]
+	}
+	return string(data)
+}
+
+func (c *auditConfig) redactValue(v interface{}) (redacted bool) {
+	switch vs := v.(type) {
+	case map[string]interface{}:
+		for key, value := range vs {
+			if _, ok := c.redacts[strings.ToLower(key)]; ok {
+				vs[key], redacted = "***", true
+			} else if c.redactValue(value) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, value := range vs {
+			if c.redactValue(value) {
+				redacted = true
+			}
+		}
+	}
+	return
+}
+
+func errorCode(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case Error:
+		return e.Code
+	case interface{ CodeError() Error }:
+		return e.CodeError().Code
+	default:
+		return ErrServerError.Code
+	}
+}
+
+// teeResponseWriter is a http.ResponseWriter to copy the first max bytes
+// of the response body into the buffer.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	max int
+	buf []byte
+}
+
+// Unwrap returns the underlying response writer.
+func (w *teeResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *teeResponseWriter) Write(p []byte) (int, error) {
+	if w.max <= 0 {
+		w.buf = append(w.buf, p...)
+	} else if n := w.max - len(w.buf); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+	}
+	return w.ResponseWriter.Write(p)
+}
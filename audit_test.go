@@ -0,0 +1,70 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	records := make(chan AuditRecord, 2)
+	svc := NewService()
+	svc.Audit = func(rec AuditRecord) { records <- rec }
+	svc.Use(Audit(AuditMaxBodySize(64), AuditRedactKeys("password", "Token")))
+	svc.Register("Login", func(c *Context) error {
+		c.SetPrincipal("user")
+		return c.Success(map[string]string{"Token": "secret", "Name": "abc"})
+	})
+	svc.Register("Fail", func(c *Context) error { return ErrFailedOperation })
+
+	call := func(action, body string) AuditRecord {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.Header.Set("X-Request-Id", "1")
+		req.RemoteAddr = "1.2.3.4:1234"
+		svc.ServeHTTP(rec, req)
+
+		select {
+		case r := <-records:
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("no audit record")
+			return AuditRecord{}
+		}
+	}
+
+	r := call("Login", `{"Name":"abc","Password":"123456"}`)
+	if r.Action != "Login" || r.RequestID != "1" || r.Principal != "user" ||
+		r.ClientIP != "1.2.3.4" || r.Status != 200 || r.ErrorCode != "" {
+		t.Errorf("unexpected audit record: %+v", r)
+	}
+	if expect := `{"Name":"abc","Password":"***"}`; r.RequestBody != expect {
+		t.Errorf("expect request body '%s', but got '%s'", expect, r.RequestBody)
+	}
+	if expect := `{"Data":{"Name":"abc","Token":"***"},"RequestId":"1"}`; r.ResponseBody != expect {
+		t.Errorf("expect response body '%s', but got '%s'", expect, r.ResponseBody)
+	}
+
+	r = call("Fail", strings.Repeat("a", 100))
+	if r.ErrorCode != ErrFailedOperation.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrFailedOperation.Code, r.ErrorCode)
+	} else if len(r.RequestBody) != 64 {
+		t.Errorf("expect the request body truncated to %d, but got %d", 64, len(r.RequestBody))
+	}
+}
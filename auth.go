@@ -0,0 +1,68 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+type authMode uint8
+
+const (
+	authDefault authMode = iota
+	authRequired
+	authOptional
+)
+
+// WithAuthRequired returns an action option to require that the request
+// of the service must be authenticated by Service.Authenticate successfully
+// with a non-nil principal, which is the default behavior.
+func WithAuthRequired() ActionOption {
+	return func(a *action) { a.auth = authRequired }
+}
+
+// WithAuthOptional returns an action option to allow the request
+// of the service to be unauthenticated, that's, the principal may be nil.
+func WithAuthOptional() ActionOption {
+	return func(a *action) { a.auth = authOptional }
+}
+
+func (s *Service) authenticate(c *Context, mode authMode) error {
+	if s.Authenticate == nil {
+		return nil
+	}
+
+	principal, err := s.Authenticate(c)
+	if mode == authOptional {
+		if err == nil {
+			c.SetPrincipal(principal)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return err
+	} else if principal == nil {
+		return ErrUnauthorized
+	}
+
+	c.SetPrincipal(principal)
+	return nil
+}
+
+// APIKey returns the API key of the request from the header "X-Api-Key",
+// or the query parameter "ApiKey" instead.
+func APIKey(c *Context) string {
+	if key := c.req.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	return c.Query().Get("ApiKey")
+}
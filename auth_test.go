@@ -0,0 +1,78 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceAuthenticate(t *testing.T) {
+	handler := func(c *Context) error {
+		user, _ := c.Principal().(string)
+		return c.Success(user)
+	}
+
+	svc := NewService()
+	svc.Authenticate = func(c *Context) (interface{}, error) {
+		switch token := c.GetReqHeader("X-Token"); token {
+		case "":
+			return nil, nil
+		case "bad":
+			return nil, ErrAuthFailureTokenFailure
+		default:
+			return token, nil
+		}
+	}
+	svc.Register("default", handler)
+	svc.RegisterWithOptions("required", handler, WithAuthRequired())
+	svc.RegisterWithOptions("optional", handler, WithAuthOptional())
+
+	call := func(action, token string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		req.Header.Set("X-Token", token)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	for _, action := range []string{"default", "required"} {
+		if resp := call(action, "user"); resp.Data != "user" {
+			t.Errorf("%s: unexpected response %+v", action, resp)
+		}
+		if resp := call(action, ""); resp.Error.Code != ErrUnauthorized.Code {
+			t.Errorf("%s: expect error code '%s', but got '%s'", action,
+				ErrUnauthorized.Code, resp.Error.Code)
+		}
+		if resp := call(action, "bad"); resp.Error.Code != ErrAuthFailureTokenFailure.Code {
+			t.Errorf("%s: expect error code '%s', but got '%s'", action,
+				ErrAuthFailureTokenFailure.Code, resp.Error.Code)
+		}
+	}
+
+	for _, token := range []string{"", "bad"} {
+		if resp := call("optional", token); resp.Error.Code != "" || resp.Data != "" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	}
+	if resp := call("optional", "user"); resp.Data != "user" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// BatchItem is an item of the batch request.
+type BatchItem struct {
+	Action    string
+	Version   string          `json:",omitempty"`
+	RequestID string          `json:"RequestId,omitempty"`
+	Payload   json.RawMessage `json:",omitempty"`
+
+	// Request and Response are only used by Client.InvokeBatch.
+	// If Payload is nil, Request is marshaled as the payload,
+	// and the data of the item response is decoded into Response.
+	Request  interface{} `json:"-"`
+	Response interface{} `json:"-"`
+}
+
+// BatchOption is used to configure the batch service.
+type BatchOption func(*batchConfig)
+
+// BatchConcurrently returns a batch option to handle the items concurrently.
+func BatchConcurrently() BatchOption {
+	return func(c *batchConfig) { c.concurrent = true }
+}
+
+// BatchMaxConcurrency returns a batch option to set the maximum number
+// of the items handled concurrently, which is only used with BatchConcurrently.
+//
+// Default: maxBatch if it is greater than 0, or DefaultBatchConcurrency.
+func BatchMaxConcurrency(n int) BatchOption {
+	return func(c *batchConfig) { c.concurrency = n }
+}
+
+// DefaultBatchConcurrency is the default maximum number of the batch items
+// handled concurrently when no maxBatch is given.
+var DefaultBatchConcurrency = 16
+
+type batchConfig struct {
+	concurrent  bool
+	concurrency int
+}
+
+// EnableBatch registers a service named name to handle several actions
+// in one request, whose body is the JSON array of BatchItem and which
+// responds the array of the response envelopes of all the items
+// in the original order.
+//
+// Each item is dispatched through the normal middlewares and handler,
+// with the payload as the request body, and its action, version and request id
+// are set on the context directly instead of being extracted. The failure of one item does not
+// abort the others. If the number of the items exceeds maxBatch and
+// maxBatch is greater than 0, the request is rejected. And maxBatch is
+// advertised by the response header "X-Max-Batch" for the client to split
+// the items.
+func (s *Service) EnableBatch(name string, maxBatch int, opts ...BatchOption) {
+	var conf batchConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.concurrency <= 0 {
+		if conf.concurrency = maxBatch; conf.concurrency <= 0 {
+			conf.concurrency = DefaultBatchConcurrency
+		}
+	}
+
+	s.Register(name, func(c *Context) (err error) {
+		if maxBatch > 0 {
+			c.SetRespHeader("X-Max-Batch", strconv.Itoa(maxBatch))
+		}
+
+		body, err := c.BodyBytes()
+		if err != nil {
+			return ErrInvalidParameter.WithMessage(err.Error())
+		}
+
+		var items []BatchItem
+		if err = json.Unmarshal(body, &items); err != nil {
+			return ErrInvalidParameter.WithMessage(err.Error())
+		} else if maxBatch > 0 && len(items) > maxBatch {
+			return ErrInvalidParameter.WithMessage(
+				"the number of the batch items must not exceed %d", maxBatch)
+		}
+
+		results := make([]json.RawMessage, len(items))
+		if conf.concurrent {
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, conf.concurrency)
+			for i := range items {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func(i int) {
+					defer func() { <-sem; wg.Done() }()
+					results[i] = s.handleBatchItem(c, name, i, items[i])
+				}(i)
+			}
+			wg.Wait()
+		} else {
+			for i := range items {
+				results[i] = s.handleBatchItem(c, name, i, items[i])
+			}
+		}
+
+		return c.Success(results)
+	})
+}
+
+func (s *Service) handleBatchItem(c *Context, batch string, index int,
+	item BatchItem) json.RawMessage {
+	if item.RequestID == "" {
+		item.RequestID = c.GetRequestID() + "-" + strconv.Itoa(index)
+	}
+
+	var err Error
+	if item.Action == "" {
+		err = ErrInvalidAction.WithMessage("no action")
+	} else if s.isBatchAction(batch, item.Action) {
+		err = ErrInvalidAction.WithMessage("batch action must not be nested")
+	}
+	if err.Code != "" {
+		data, _ := json.Marshal(jsonResponse{RequestID: item.RequestID, Error: &err})
+		return data
+	}
+
+	url := *c.req.URL
+	url.RawQuery = ""
+
+	req := c.req.WithContext(c.req.Context())
+	req.URL = &url
+	req.Method = http.MethodPost
+	req.Header = cloneHeader(c.req.Header)
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Encoding")
+	req.Header.Del("Transfer-Encoding")
+	req.Header.Set("Content-Type", MIMEApplicationJSON)
+	req.TransferEncoding = nil
+	req.ContentLength = int64(len(item.Payload))
+	req.Body = ioutil.NopCloser(bytes.NewReader(item.Payload))
+
+	// Set the action and others of the item on the context directly,
+	// so that they do not depend on GetAction or ActionExtractors.
+	w := newBufferResponseWriter()
+	sc := s.AcquireContext(req, w)
+	sc.Action, sc.Version, sc.RequestID = item.Action, item.Version, item.RequestID
+	sc.Tenant, sc.DryRun, sc.extracted = c.Tenant, c.DryRun, true
+	s.HandleRequest(sc)
+	s.ReleaseContext(sc)
+
+	data := bytes.TrimSpace(w.body.Bytes())
+	if json.Valid(data) {
+		return data
+	}
+
+	data, _ = json.Marshal(jsonResponse{RequestID: item.RequestID, Data: string(data)})
+	return data
+}
+
+// isBatchAction reports whether the action lands at the batch service finally,
+// which is resolved in the same way as dispatching it.
+func (s *Service) isBatchAction(batch, action string) bool {
+	r := s.loadRegistry()
+	key, ok := r.resolve(s.normalize(action))
+	return ok && key == s.normalize(batch)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	nh := make(http.Header, len(h))
+	for k, v := range h {
+		nh[k] = append([]string(nil), v...)
+	}
+	return nh
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEnableBatch(t *testing.T) {
+	svc := NewService()
+	svc.EnableBatch("Batch", 3)
+	svc.EnableBatch("ConcurrentBatch", 3, BatchConcurrently())
+	svc.Mapping("BatchAlias", "Batch")
+	svc.Register("Echo", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(req.Name + c.Version)
+	})
+
+	call := func(action, body string) (resp struct {
+		Error Error
+		Data  []Response
+	}) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.Header.Set("X-Request-Id", "id")
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	body := `[
+		{"Action": "Echo", "Payload": {"Name": "a"}},
+		{"Action": "Unknown"},
+		{"Action": "Echo", "Version": "v2", "RequestId": "rid", "Payload": {"Name": "b"}}
+	]`
+	for _, action := range []string{"Batch", "ConcurrentBatch"} {
+		resp := call(action, body)
+		if resp.Error.Code != "" {
+			t.Errorf("%s: unexpected error: %v", action, resp.Error)
+		} else if len(resp.Data) != 3 {
+			t.Errorf("%s: expect %d results, but got %d", action, 3, len(resp.Data))
+		} else {
+			if r := resp.Data[0]; r.RequestID != "id-0" || r.Data != "a" {
+				t.Errorf("%s: unexpected the first result: %+v", action, r)
+			}
+			if r := resp.Data[1]; r.Error.Code != ErrInvalidAction.Code {
+				t.Errorf("%s: unexpected the second result: %+v", action, r)
+			}
+			if r := resp.Data[2]; r.RequestID != "rid" || r.Data != "bv2" {
+				t.Errorf("%s: unexpected the third result: %+v", action, r)
+			}
+		}
+	}
+
+	for _, nested := range []string{"Batch", "BatchAlias"} {
+		resp := call("Batch", `[{"Action":"`+nested+`"}]`)
+		if r := resp.Data[0]; r.Error.Code != ErrInvalidAction.Code ||
+			!strings.Contains(r.Error.Message, "nested") {
+			t.Errorf("%s: expect the nested batch to be rejected, but got %+v", nested, r)
+		}
+	}
+
+	if resp := call("Batch", `[{},{},{},{}]`); resp.Error.Code != ErrInvalidParameter.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrInvalidParameter.Code, resp.Error.Code)
+	}
+}
+
+func TestEnableBatchWithGetAction(t *testing.T) {
+	var running, maxRunning int32
+	svc := NewService()
+	svc.GetAction = func(r *http.Request) string { return r.URL.Query().Get("Action") }
+	svc.EnableBatch("Batch", 0, BatchConcurrently(), BatchMaxConcurrency(2))
+	svc.Register("Echo", func(c *Context) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+		return c.Success(c.Action + c.Version)
+	})
+
+	body := `[{"Action":"Echo"},{"Action":"Echo","Version":"v2"},{"Action":"Echo"},{"Action":"Echo"}]`
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=Batch", strings.NewReader(body))
+	svc.ServeHTTP(rec, req)
+
+	var resp struct{ Data []Response }
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Data) != 4 {
+		t.Fatalf("expect %d results, but got %d", 4, len(resp.Data))
+	} else if r := resp.Data[1]; r.Data != "Echov2" {
+		t.Errorf("unexpected the second result: %+v", r)
+	}
+
+	if max := atomic.LoadInt32(&maxRunning); max > 2 {
+		t.Errorf("expect at most %d items concurrently, but got %d", 2, max)
+	}
+}
+
+func TestEnableBatchLazyRequestID(t *testing.T) {
+	svc := NewService()
+	svc.LazyRequestID = true
+	svc.EnableBatch("Batch", 0)
+	svc.Register("Echo", func(c *Context) error { return c.Success(nil) })
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=Batch", strings.NewReader(`[{"Action":"Echo"}]`))
+	req.Header.Set("X-Request-Id", "parent")
+	svc.ServeHTTP(rec, req)
+
+	var resp struct {
+		RequestID string `json:"RequestId"`
+		Data      []Response
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if resp.RequestID != "parent" || len(resp.Data) != 1 || resp.Data[0].RequestID != "parent-0" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestEnableBatchBodyHeaders(t *testing.T) {
+	svc := NewService()
+	svc.EnableBatch("Batch", 0)
+	svc.Register("Echo", func(c *Context) error {
+		for _, key := range []string{"Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+			if value := c.GetReqHeader(key); value != "" {
+				return ErrInvalidParameter.WithMessage("unexpected header %s: %s", key, value)
+			}
+		}
+		return c.Success(nil)
+	})
+
+	body := `[{"Action":"Echo","Payload":{"Name":"a"}}]`
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=Batch", strings.NewReader(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header.Set("Content-Encoding", "identity")
+	req.Header.Set("Transfer-Encoding", "chunked")
+	svc.ServeHTTP(rec, req)
+
+	var resp struct{ Data []Response }
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Data) != 1 || resp.Data[0].Error.Code != "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -15,9 +15,11 @@
 package httpsvc
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func BenchmarkServiceText(b *testing.B) {
@@ -47,6 +49,50 @@ func BenchmarkServiceText(b *testing.B) {
 	}
 }
 
+func BenchmarkServiceJSONEscapedRequestID(b *testing.B) {
+	svc := NewService()
+	svc.Register("service", func(c *Context) error { return c.Success(nil) })
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://127.0.0.1", nil)
+	req.Header.Set("X-Action", "service")
+	req.Header.Set("X-Request-Id", `id-"中文"\`)
+
+	// The request id is spliced into the precomputed body without encoding.
+	if n := testing.AllocsPerRun(100, func() { rec.Body.Reset(); svc.ServeHTTP(rec, req) }); n != 0 {
+		b.Fatalf("expect no allocation, but got %v", n)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.Body.Reset()
+		svc.ServeHTTP(rec, req)
+	}
+}
+
+func benchmarkServiceTextDirect(b *testing.B, lazy bool) {
+	svc := NewService()
+	svc.LazyVersion, svc.LazyRequestID = lazy, lazy
+	svc.Register("service", func(c *Context) error { return c.Text(200, "text/plain", "") })
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://127.0.0.1", nil)
+	req.Header.Set("X-Action", "service")
+	if err != nil {
+		panic(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		svc.ServeHTTP(rec, req)
+	}
+}
+
+func BenchmarkServiceTextDirect(b *testing.B)     { benchmarkServiceTextDirect(b, false) }
+func BenchmarkServiceTextDirectLazy(b *testing.B) { benchmarkServiceTextDirect(b, true) }
+
 func BenchmarkServiceJSON(b *testing.B) {
 	svc := NewService()
 	svc.Register("service", func(c *Context) error { return c.Success(nil) })
@@ -58,9 +104,135 @@ func BenchmarkServiceJSON(b *testing.B) {
 		panic(err)
 	}
 
+	// Only the generated request id is allocated.
+	if n := testing.AllocsPerRun(100, func() { svc.ServeHTTP(rec, req) }); n > 1 {
+		b.Fatalf("expect at most 1 allocation, but got %v", n)
+	}
+
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		svc.ServeHTTP(rec, req)
 	}
 }
+
+type discardResponseWriter struct{ header http.Header }
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) WriteHeader(int)             {}
+func (w discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func benchmarkJSONPayloads() map[string]interface{} {
+	type item struct {
+		Id   int
+		Name string
+	}
+
+	large := make([]item, 10000)
+	for i := range large {
+		large[i] = item{Id: i, Name: fmt.Sprintf("name-%d", i)}
+	}
+	return map[string]interface{}{
+		"Small": map[string]interface{}{"Id": 1, "Name": "name"},
+		"Large": large,
+	}
+}
+
+func BenchmarkContextJSON(b *testing.B) {
+	for name, data := range benchmarkJSONPayloads() {
+		data := data
+		b.Run(name, func(b *testing.B) {
+			c := NewService().AcquireContext(httptest.NewRequest("GET", "/", nil),
+				discardResponseWriter{http.Header{}})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.JSON(data)
+				c.res.Wrote = false
+			}
+		})
+	}
+}
+
+func BenchmarkContextJSONDirect(b *testing.B) {
+	for name, data := range benchmarkJSONPayloads() {
+		data := data
+		b.Run(name, func(b *testing.B) {
+			c := NewService().AcquireContext(httptest.NewRequest("GET", "/", nil),
+				discardResponseWriter{http.Header{}})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.JSONDirect(200, data)
+				c.res.Wrote = false
+			}
+		})
+	}
+}
+
+func BenchmarkServiceParallelRegister(b *testing.B) {
+	svc := NewService()
+	svc.Register("service", func(c *Context) error { return c.Success(nil) })
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler := func(c *Context) error { return nil }
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				svc.Register(fmt.Sprintf("service%d", i%100), handler)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://127.0.0.1", nil)
+		req.Header.Set("X-Action", "service")
+		for pb.Next() {
+			rec.Body.Reset()
+			svc.ServeHTTP(rec, req)
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	<-done
+}
+
+func BenchmarkRateLimit(b *testing.B) {
+	svc := NewService()
+	svc.Use(RateLimit(1e8, 1<<30, nil))
+	svc.Register("service", func(c *Context) error { return nil })
+	c := svc.AcquireContext(httptest.NewRequest("GET", "http://127.0.0.1", nil), httptest.NewRecorder())
+	c.Action = "service"
+	handler := svc.handler.Load().(Handler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(c)
+	}
+}
+
+func BenchmarkRateLimiterParallel(b *testing.B) {
+	l := newRateLimiter(1e8, 1<<30)
+	keys := []string{"127.0.0.1@a", "127.0.0.2@a", "127.0.0.3@a", "127.0.0.4@a"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		now := time.Now()
+		for i := 0; pb.Next(); i++ {
+			l.allow(keys[i&3], now)
+		}
+	})
+}
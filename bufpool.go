@@ -0,0 +1,71 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// BufferStats is the statistics of the buffer pool.
+type BufferStats struct {
+	Gets     uint64 // The number of the acquired buffers.
+	Puts     uint64 // The number of the buffers returned into the pool.
+	Discards uint64 // The number of the released buffers which are too large.
+}
+
+// BufferPoolStats returns the statistics of the buffer pool, which is used
+// to tune BufferInitialSize and BufferMaxRecycleSize.
+func (s *Service) BufferPoolStats() BufferStats {
+	return BufferStats{
+		Gets:     atomic.LoadUint64(&s.bufstats.Gets),
+		Puts:     atomic.LoadUint64(&s.bufstats.Puts),
+		Discards: atomic.LoadUint64(&s.bufstats.Discards),
+	}
+}
+
+func (s *Service) bufferInitialSize() int {
+	if s.BufferInitialSize > 0 {
+		return s.BufferInitialSize
+	}
+	return 2048
+}
+
+func (s *Service) newBuffer() interface{} {
+	return bytes.NewBuffer(make([]byte, 0, s.bufferInitialSize()))
+}
+
+// newCopyBuffer returns the scratch space to copy the stream, such as
+// for c.Stream, which has the same size as the buffer of the pool.
+func (s *Service) newCopyBuffer() interface{} {
+	buf := make([]byte, s.bufferInitialSize())
+	return &buf
+}
+
+func (s *Service) acquireBuffer() *bytes.Buffer {
+	atomic.AddUint64(&s.bufstats.Gets, 1)
+	return s.bufpool.Get().(*bytes.Buffer)
+}
+
+func (s *Service) releaseBuffer(buf *bytes.Buffer) {
+	if s.BufferMaxRecycleSize > 0 && buf.Cap() > s.BufferMaxRecycleSize {
+		atomic.AddUint64(&s.bufstats.Discards, 1)
+		return
+	}
+
+	buf.Reset()
+	atomic.AddUint64(&s.bufstats.Puts, 1)
+	s.bufpool.Put(buf)
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import "testing"
+
+func TestServiceBufferPool(t *testing.T) {
+	svc := NewService()
+	c := NewContext()
+	c.svc = svc
+
+	buf := c.AcquireBuffer()
+	if buf.Cap() != 2048 {
+		t.Errorf("expect the default capacity 2048, but got %d", buf.Cap())
+	}
+	buf.Write(make([]byte, 4096))
+	c.ReleaseBuffer(buf) // No limit by default.
+	if stats := svc.BufferPoolStats(); stats != (BufferStats{Gets: 1, Puts: 1}) {
+		t.Errorf("unexpected the buffer stats: %+v", stats)
+	}
+
+	svc = NewService()
+	svc.BufferInitialSize = 64
+	svc.BufferMaxRecycleSize = 1024
+	c.svc = svc
+
+	buf = c.AcquireBuffer()
+	if buf.Cap() != 64 {
+		t.Errorf("expect the capacity 64, but got %d", buf.Cap())
+	}
+	buf.Write(make([]byte, 2048))
+	c.ReleaseBuffer(buf)
+
+	for i := 0; i < 10; i++ {
+		if b := c.AcquireBuffer(); b == buf {
+			t.Fatal("unexpected the oversized buffer is reused")
+		} else {
+			c.ReleaseBuffer(b)
+		}
+	}
+
+	if stats := svc.BufferPoolStats(); stats != (BufferStats{Gets: 11, Puts: 10, Discards: 1}) {
+		t.Errorf("unexpected the buffer stats: %+v", stats)
+	}
+}
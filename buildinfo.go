@@ -0,0 +1,83 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsvc
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+var processStartTime = time.Now()
+
+// BuildInfo is the build information of the running program.
+type BuildInfo struct {
+	Path      string `json:",omitempty"` // The main module path
+	Version   string `json:",omitempty"` // The main module version
+	Revision  string `json:",omitempty"` // The VCS revision
+	BuildTime string `json:",omitempty"` // The VCS commit time, such as "2021-01-01T00:00:00Z"
+	Modified  bool   `json:",omitempty"` // Whether the VCS working tree is modified
+	GoVersion string
+
+	StartTime time.Time
+	Uptime    string
+
+	Extra map[string]string `json:",omitempty"`
+}
+
+// ReadBuildInfo returns the build information of the running program
+// from runtime/debug.ReadBuildInfo, but Uptime is empty.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version(), StartTime: processStartTime}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path = bi.Main.Path
+		info.Version = bi.Main.Version
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.BuildTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// EnableBuildInfo registers a service named name, such as "DescribeBuildInfo",
+// to return the build information of the running program with the extra
+// key-values, such as the deployment environment, which is computed once
+// when registering it, except Uptime.
+func (s *Service) EnableBuildInfo(name string, extra map[string]string) {
+	info := ReadBuildInfo()
+	if len(extra) > 0 {
+		info.Extra = make(map[string]string, len(extra))
+		for key, value := range extra {
+			info.Extra[key] = value
+		}
+	}
+
+	s.RegisterWithOptions(name, func(c *Context) error {
+		resp := info
+		resp.Uptime = time.Since(info.StartTime).Truncate(time.Second).String()
+		return c.Success(resp)
+	}, WithDescription("Describe the build information of the running program"),
+		WithResponseType(BuildInfo{}))
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestEnableBuildInfo(t *testing.T) {
+	extra := map[string]string{"Env": "test"}
+	svc := NewService()
+	svc.EnableBuildInfo("DescribeBuildInfo", extra)
+	extra["Env"] = "prod"
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=DescribeBuildInfo", nil))
+
+	var resp struct {
+		RequestID string `json:"RequestId"`
+		Data      BuildInfo
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.RequestID == "" {
+		t.Errorf("missing the request id")
+	}
+	if info := resp.Data; info.GoVersion != runtime.Version() || info.Uptime == "" ||
+		info.StartTime.IsZero() || info.Extra["Env"] != "test" {
+		t.Errorf("unexpected build info: %+v", info)
+	}
+}
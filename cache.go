@@ -0,0 +1,278 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is the cached response.
+type CacheEntry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// CacheStore is used to store the cached responses.
+type CacheStore interface {
+	Get(key string) (entry CacheEntry, ok bool, err error)
+	Set(key string, entry CacheEntry, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// MemoryCacheStore is an in-memory LRU CacheStore.
+type MemoryCacheStore struct {
+	lock  sync.Mutex
+	cap   int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key    string
+	entry  CacheEntry
+	expire time.Time
+}
+
+// NewMemoryCacheStore returns a new MemoryCacheStore, which holds
+// the capacity entries at most and evicts the least recently used one.
+//
+// If capacity is equal to or less than 0, it is 1024 by default.
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &MemoryCacheStore{
+		cap:   capacity,
+		list:  list.New(),
+		items: make(map[string]*list.Element, capacity),
+	}
+}
+
+// Len returns the number of the cached entries, including the expired ones
+// not evicted yet.
+func (s *MemoryCacheStore) Len() (n int) {
+	s.lock.Lock()
+	n = s.list.Len()
+	s.lock.Unlock()
+	return
+}
+
+// Get implements the interface CacheStore.
+func (s *MemoryCacheStore) Get(key string) (entry CacheEntry, ok bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	item := elem.Value.(*memoryCacheItem)
+	if !time.Now().Before(item.expire) {
+		s.remove(elem)
+		return CacheEntry{}, false, nil
+	}
+
+	s.list.MoveToFront(elem)
+	return item.entry, true, nil
+}
+
+// Set implements the interface CacheStore.
+func (s *MemoryCacheStore) Set(key string, entry CacheEntry, ttl time.Duration) error {
+	item := &memoryCacheItem{key: key, entry: entry, expire: time.Now().Add(ttl)}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		elem.Value = item
+		s.list.MoveToFront(elem)
+		return nil
+	}
+
+	s.items[key] = s.list.PushFront(item)
+	for s.list.Len() > s.cap {
+		s.remove(s.list.Back())
+	}
+	return nil
+}
+
+// Delete implements the interface CacheStore.
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.lock.Lock()
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+// Invalidate deletes all the entries whose keys have the prefix,
+// and returns the number of the deleted entries.
+//
+// For the default cache key, the prefix may be the action name,
+// such as "DescribeUser", which evicts all its entries.
+func (s *MemoryCacheStore) Invalidate(prefix string) (n int) {
+	s.lock.Lock()
+	for key, elem := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(elem)
+			n++
+		}
+	}
+	s.lock.Unlock()
+	return
+}
+
+func (s *MemoryCacheStore) remove(elem *list.Element) {
+	delete(s.items, elem.Value.(*memoryCacheItem).key)
+	s.list.Remove(elem)
+}
+
+// CacheOption is used to configure the Cache middleware.
+type CacheOption func(*cacheConfig)
+
+// CacheMethods returns a cache option to set the methods of the requests
+// whose responses may be cached.
+//
+// Default: GET
+func CacheMethods(methods ...string) CacheOption {
+	return func(c *cacheConfig) { c.methods = methods }
+}
+
+// CacheHeaders returns a cache option to set the response headers cached
+// with the body.
+//
+// Default: Content-Type
+func CacheHeaders(headers ...string) CacheOption {
+	return func(c *cacheConfig) { c.headers = headers }
+}
+
+type cacheConfig struct {
+	methods []string
+	headers []string
+}
+
+func (c *cacheConfig) cacheable(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultCacheKey returns the default cache key of the request, which is
+// the action, the version, the canonicalized query, the tenant and
+// the principal if existing, such as
+// "DescribeUser@v1?Action=DescribeUser&Id=1#tenant@principal",
+// so that the response of a user is not served to the others.
+func DefaultCacheKey(c *Context) string {
+	key := c.Action
+	if version := c.GetVersion(); version != "" {
+		key += "@" + version
+	}
+	key += "?" + c.Query().Encode()
+	if c.Tenant != "" {
+		key += "#" + c.Tenant
+	}
+	if p := c.Principal(); p != nil {
+		key += "@" + fmt.Sprint(p)
+	}
+	return key
+}
+
+// Cache returns a middleware to cache the successful responses with
+// the status code 200 into store for ttl, which adds the response header
+// "X-Cache: HIT" if serving from the cache, or "X-Cache: MISS" instead.
+//
+// If keyFunc is nil, it is DefaultCacheKey by default. If keyFunc returns
+// an empty string, the request is not cached.
+//
+// Notice: the errors of the store are ignored, and the request is handled
+// as if it is not cached. And the cached body is responded as it is,
+// including the request id in the response envelope.
+func Cache(store CacheStore, ttl time.Duration, keyFunc func(*Context) string,
+	opts ...CacheOption) Middleware {
+	if store == nil {
+		panic("Cache: the cache store must not be nil")
+	} else if ttl <= 0 {
+		panic("Cache: the ttl must be greater than 0")
+	}
+	if keyFunc == nil {
+		keyFunc = DefaultCacheKey
+	}
+
+	conf := cacheConfig{
+		methods: []string{http.MethodGet},
+		headers: []string{"Content-Type"},
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if !conf.cacheable(c.req.Method) {
+				return next(c)
+			}
+
+			key := keyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+
+			if entry, ok, _ := store.Get(key); ok {
+				header := c.res.Header()
+				for k, v := range entry.Header {
+					header[k] = append([]string(nil), v...)
+				}
+				header.Set("X-Cache", "HIT")
+				c.res.WriteHeader(entry.Status)
+				_, err = c.res.Write(entry.Body)
+				return
+			}
+
+			resp := c.ResponseWriter()
+			resp.Header().Set("X-Cache", "MISS")
+			tee := &teeResponseWriter{ResponseWriter: resp}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			if err == nil && c.StatusCode() == http.StatusOK {
+				entry := CacheEntry{Status: http.StatusOK, Body: tee.buf}
+				entry.Header = make(http.Header, len(conf.headers))
+				for _, name := range conf.headers {
+					name = http.CanonicalHeaderKey(name)
+					if values := resp.Header()[name]; len(values) > 0 {
+						entry.Header[name] = append([]string(nil), values...)
+					}
+				}
+				store.Set(key, entry, ttl)
+			}
+			return
+		}
+	}
+}
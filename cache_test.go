@@ -0,0 +1,129 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := NewMemoryCacheStore(2)
+	store.Set("a", CacheEntry{Status: 200}, time.Minute)
+	store.Set("b", CacheEntry{Status: 200}, time.Minute)
+	store.Get("a")
+	store.Set("c", CacheEntry{Status: 200}, time.Minute)
+
+	if _, ok, _ := store.Get("b"); ok {
+		t.Errorf("the least recently used entry is not evicted")
+	}
+	if _, ok, _ := store.Get("a"); !ok {
+		t.Errorf("missing the entry 'a'")
+	}
+
+	store.Set("x", CacheEntry{Status: 200}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := store.Get("x"); ok {
+		t.Errorf("the expired entry is not removed")
+	}
+
+	store.Set("ab", CacheEntry{Status: 200}, time.Minute)
+	if n := store.Invalidate("a"); n != 2 || store.Len() != 0 {
+		t.Errorf("expect to invalidate 2 entries, but got %d and left %d", n, store.Len())
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls int
+	store := NewMemoryCacheStore(0)
+	svc := NewService()
+	svc.RegisterWithOptions("DescribeUser", func(c *Context) error {
+		calls++
+		if c.Query().Get("Id") == "" {
+			return ErrInvalidParameter
+		}
+		return c.Success(c.Query().Get("Id"))
+	}, WithMiddlewares(Cache(store, time.Minute, nil)))
+	svc.Register("UpdateUser", func(c *Context) error {
+		store.Invalidate("DescribeUser")
+		return nil
+	})
+
+	call := func(method, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(method, "/?"+query, nil))
+		return rec
+	}
+
+	if rec := call(http.MethodGet, "Id=1&Action=DescribeUser"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expect the cache miss, but got '%s'", rec.Header().Get("X-Cache"))
+	}
+	rec := call(http.MethodGet, "Action=DescribeUser&Id=1")
+	if rec.Header().Get("X-Cache") != "HIT" || calls != 1 {
+		t.Errorf("expect the cache hit, but got '%s' with %d calls", rec.Header().Get("X-Cache"), calls)
+	} else if !strings.Contains(rec.Body.String(), `"Data":"1"`) {
+		t.Errorf("unexpected cached body: %s", rec.Body.String())
+	} else if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("unexpected Content-Type '%s'", ct)
+	}
+
+	// The failures and the not-GET requests are not cached.
+	call(http.MethodGet, "Action=DescribeUser")
+	call(http.MethodGet, "Action=DescribeUser")
+	call(http.MethodPost, "Action=DescribeUser&Id=1")
+	if calls != 4 {
+		t.Errorf("expect 4 calls, but got %d", calls)
+	}
+
+	call(http.MethodPost, "Action=UpdateUser")
+	if call(http.MethodGet, "Action=DescribeUser&Id=1"); calls != 5 {
+		t.Errorf("the cache is not invalidated")
+	}
+}
+
+func TestCachePrincipal(t *testing.T) {
+	var calls int
+	svc := NewService()
+	svc.RegisterWithOptions("DescribeMe", func(c *Context) error {
+		calls++
+		return c.Success(c.Principal())
+	}, WithMiddlewares(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetPrincipal(c.GetReqHeader("X-User"))
+			return next(c)
+		}
+	}, Cache(NewMemoryCacheStore(0), time.Minute, nil)))
+
+	call := func(user string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action=DescribeMe", nil)
+		req.Header.Set("X-User", user)
+		svc.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call("alice"); !strings.Contains(body, `"Data":"alice"`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if body := call("bob"); !strings.Contains(body, `"Data":"bob"`) || calls != 2 {
+		t.Errorf("expect the response of the other user not to be served: %s", body)
+	}
+	if call("alice"); calls != 2 {
+		t.Errorf("expect the cache hit, but got %d calls", calls)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ClientOption is used to configure the client.
+type ClientOption func(*Client)
+
+// ClientHTTPClient returns a client option to set the http client.
+//
+// Default: http.DefaultClient
+func ClientHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) { c.client = client }
+}
+
+// ClientHeaders returns a client option to add the headers
+// into every request.
+func ClientHeaders(header http.Header) ClientOption {
+	return func(c *Client) {
+		for key, values := range header {
+			c.header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+}
+
+// ClientActionHeaders returns a client option to set the header names
+// of the action, the version and the request id, which should match
+// the extractors of the service.
+//
+// Default: "X-Action", "X-Version", "X-Request-Id"
+func ClientActionHeaders(action, version, requestID string) ClientOption {
+	return func(c *Client) {
+		c.actionHeader = action
+		c.versionHeader = version
+		c.requestIDHeader = requestID
+	}
+}
+
+// ClientDeadlineHeader returns a client option to set the header name
+// carrying the remaining budget of the context deadline in milliseconds,
+// which should match Service.DeadlineHeader. The empty disables it.
+//
+// Default: DefaultDeadlineHeader
+func ClientDeadlineHeader(name string) ClientOption {
+	return func(c *Client) { c.deadlineHeader = name }
+}
+
+// ClientEnvelopeFields returns a client option to set the field names
+// of the response envelope.
+//
+// Default: "Error", "Data"
+func ClientEnvelopeFields(err, data string) ClientOption {
+	return func(c *Client) {
+		c.errorField = err
+		c.dataField = data
+	}
+}
+
+// ClientSigner returns a client option to sign the requests by SignRequest
+// with the access key id and secret, which also sets the headers
+// "X-Timestamp" and "X-Nonce" required by ReplayProtection.
+//
+// The request is signed after all the other headers are set, and opts
+// must be the same as those of SignatureAuth of the service. The timestamp
+// and the nonce are always signed.
+func ClientSigner(accessKeyID, secret string, opts ...SigOption) ClientOption {
+	signer := &clientSigner{accessKeyID: accessKeyID, secret: secret, conf: newSigConfig(opts)}
+	return func(c *Client) { c.signer = signer }
+}
+
+type clientSigner struct {
+	accessKeyID string
+	secret      string
+	conf        *sigConfig
+}
+
+func (s *clientSigner) sign(req *http.Request, body []byte) {
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Nonce", generateRequestID())
+	s.conf.authorize(req, s.accessKeyID, s.secret, body)
+}
+
+// ClientBatch returns a client option to set the name of the batch service
+// enabled by Service.EnableBatch, and the maximum number of the items
+// in a batch request, which is also learned from the response header
+// "X-Max-Batch" of the batch service.
+//
+// Default: "Batch", 0
+func ClientBatch(action string, maxBatch int) ClientOption {
+	return func(c *Client) {
+		c.batchAction = action
+		c.maxBatch = int64(maxBatch)
+	}
+}
+
+// Client is the client to call the action services.
+type Client struct {
+	baseURL string
+	client  *http.Client
+	header  http.Header
+
+	actionHeader    string
+	versionHeader   string
+	requestIDHeader string
+	deadlineHeader  string
+
+	errorField string
+	dataField  string
+
+	retry  *RetryPolicy
+	signer *clientSigner
+
+	batchAction string
+	maxBatch    int64 // atomic
+}
+
+// NewClient returns a new client calling the service at baseURL,
+// such as "http://127.0.0.1/api".
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	if baseURL == "" {
+		panic("NewClient: the base url must not be empty")
+	}
+
+	c := &Client{
+		baseURL: baseURL,
+		client:  http.DefaultClient,
+		header:  make(http.Header, 4),
+
+		actionHeader:    "X-Action",
+		versionHeader:   "X-Version",
+		requestIDHeader: "X-Request-Id",
+		deadlineHeader:  DefaultDeadlineHeader,
+
+		errorField: "Error",
+		dataField:  "Data",
+
+		batchAction: "Batch",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// clientError is the error decoded from the response envelope,
+// whose causes are not decoded.
+type clientError struct {
+	Code      string
+	Message   string
+	Component string
+	Details   []ErrorDetail
+	Debug     string
+	Retriable bool
+}
+
+// Invoke calls the action of the version, which may be empty, with req
+// as the JSON body by the method POST, and decodes the data of the response
+// envelope into resp if it is not nil.
+//
+// The outgoing headers carried by ctx, such as by Context.OutgoingContext,
+// are attached to the request. If no request id is carried, a new one is
+// generated.
+//
+// If the response envelope contains the error, it is returned as Error,
+// which matches the predefined errors by errors.Is with the same code.
+// The failed call is retried if the option ClientRetry is given.
+func (c *Client) Invoke(ctx context.Context, action, version string, req, resp interface{}) (err error) {
+	if action == "" {
+		panic("Client.Invoke: the action must not be empty")
+	}
+
+	var body []byte
+	if req != nil {
+		if body, err = json.Marshal(req); err != nil {
+			return ErrInvalidParameter.WithMessage(err.Error()).WithCause(err)
+		}
+	}
+
+	header := make(http.Header, len(c.header)+4)
+	c.setHeaders(ctx, header, action, version)
+	_, err = c.call(ctx, action, header, body, resp)
+	return
+}
+
+// call invokes the action, and retries it by the retry policy if existing.
+func (c *Client) call(ctx context.Context, action string, header http.Header,
+	body []byte, resp interface{}) (rheader http.Header, err error) {
+	if c.retry == nil {
+		return c.invoke(ctx, header, body, resp)
+	}
+
+	err = c.retry.do(ctx, action, func() (err error) {
+		rheader, err = c.invoke(ctx, header, body, resp)
+		return
+	})
+	return
+}
+
+func (c *Client) invoke(ctx context.Context, header http.Header, body []byte,
+	resp interface{}) (rheader http.Header, err error) {
+	hresp, err := c.send(ctx, header, body)
+	if err != nil {
+		return
+	}
+	defer hresp.Body.Close()
+
+	rheader = hresp.Header
+	data, err := ioutil.ReadAll(hresp.Body)
+	if err != nil {
+		return
+	}
+
+	err = c.decode(hresp.StatusCode, data, resp)
+	if e, ok := err.(Error); ok && e.RetryAfter == 0 {
+		if seconds, _ := strconv.Atoi(hresp.Header.Get("Retry-After")); seconds > 0 {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+			err = e
+		}
+	}
+	return
+}
+
+func (c *Client) send(ctx context.Context, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	hreq, err := http.NewRequest(http.MethodPost, c.baseURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	hreq = hreq.WithContext(ctx)
+	for key, values := range header {
+		hreq.Header[key] = values
+	}
+	setDeadlineHeader(ctx, hreq.Header, c.deadlineHeader) // Per attempt.
+	if c.signer != nil {
+		c.signer.sign(hreq, body)
+	}
+	return c.client.Do(hreq)
+}
+
+func (c *Client) setHeaders(ctx context.Context, header http.Header, action, version string) {
+	for key, values := range OutgoingHeadersFromContext(ctx) {
+		header[key] = values
+	}
+	for key, values := range c.header {
+		header[key] = values
+	}
+
+	header.Set("Content-Type", MIMEApplicationJSONCharsetUTF8)
+	header.Set(c.actionHeader, action)
+	if version != "" {
+		header.Set(c.versionHeader, version)
+	}
+	if header.Get(c.requestIDHeader) == "" {
+		header.Set(c.requestIDHeader, generateRequestID())
+	}
+}
+
+func (c *Client) decode(status int, data []byte, resp interface{}) error {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		e := ErrServerError.WithMessage("invalid response envelope").WithCause(err)
+		if status >= 400 {
+			e.Status = status
+		}
+		return e
+	}
+
+	if raw := envelope[c.errorField]; len(raw) > 0 && string(raw) != "null" {
+		var ce clientError
+		if err := json.Unmarshal(raw, &ce); err != nil {
+			return ErrServerError.WithMessage("invalid response error").WithCause(err)
+		} else if ce.Code != "" {
+			e := Error{Code: ce.Code, Message: ce.Message, Component: ce.Component,
+				Details: ce.Details, Debug: ce.Debug, Retriable: ce.Retriable}
+			if status >= 400 {
+				e.Status = status
+			}
+			return e
+		}
+	}
+
+	if raw := envelope[c.dataField]; resp != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, resp); err != nil {
+			return ErrServerError.WithMessage("invalid response data").WithCause(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientInvoke(t *testing.T) {
+	type User struct {
+		Name    string
+		Version string
+		Trace   string
+	}
+
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.Register("CreateUser", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(User{Name: req.Name, Version: c.GetVersion(), Trace: c.GetRequestID()})
+	})
+	svc.Register("GetUser", func(c *Context) error {
+		return ErrResourceNotFound.WithMessage("no user '%s'", c.GetReqHeader("X-User"))
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	client := NewClient(server.URL, ClientHeaders(http.Header{"X-User": []string{"bob"}}))
+	ctx := ContextWithOutgoingHeaders(context.Background(), http.Header{"X-Request-Id": []string{"abc"}})
+
+	var user User
+	if err := client.Invoke(ctx, "CreateUser", "v1", map[string]string{"Name": "alice"}, &user); err != nil {
+		t.Fatal(err)
+	} else if user != (User{Name: "alice", Version: "v1", Trace: "abc"}) {
+		t.Errorf("unexpected the user: %+v", user)
+	}
+
+	user = User{}
+	if err := client.Invoke(context.Background(), "CreateUser", "", nil, &user); err != nil {
+		t.Fatal(err)
+	} else if user.Trace == "" {
+		t.Error("expect the generated request id")
+	}
+
+	err := client.Invoke(context.Background(), "GetUser", "", nil, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrResourceNotFound) ||
+		e.Message != "no user 'bob'" || e.Status != http.StatusNotFound {
+		t.Errorf("unexpected the error: %#v", err)
+	}
+
+	err = client.Invoke(context.Background(), "NoAction", "", nil, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrInvalidAction) {
+		t.Errorf("unexpected the error: %v", err)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Action") {
+		case "Get":
+			w.Write([]byte(`{"Result":{"Name":"alice"}}`))
+		case "Fail":
+			w.Write([]byte(`{"Err":{"Code":"Throttling","Message":"slow down","Retriable":true}}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, ClientHTTPClient(server.Client()),
+		ClientActionHeaders("Action", "Version", "Request-Id"),
+		ClientEnvelopeFields("Err", "Result"))
+
+	var resp struct{ Name string }
+	if err := client.Invoke(context.Background(), "Get", "", nil, &resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Name != "alice" {
+		t.Errorf("expect the name '%s', but got '%s'", "alice", resp.Name)
+	}
+
+	err := client.Invoke(context.Background(), "Fail", "", nil, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrThrottling) || !e.Retriable {
+		t.Errorf("unexpected the error: %#v", err)
+	}
+
+	err = client.Invoke(context.Background(), "Other", "", nil, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrServerError) || e.Status != http.StatusBadGateway {
+		t.Errorf("unexpected the error: %#v", err)
+	}
+}
+
+type tamperTransport struct{ body string }
+
+func (t tamperTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.body != "" {
+		req.Body = ioutil.NopCloser(strings.NewReader(t.body))
+		req.ContentLength = int64(len(t.body))
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientSigner(t *testing.T) {
+	store := NewMemoryNonceStore(0, 0)
+	defer store.Close()
+
+	lookup := func(ak string) (string, error) {
+		if ak == "ak" {
+			return "sk", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	var opts []SigOption
+	svc := NewService()
+	svc.Use(SignatureAuth(lookup, opts...), ReplayProtection(store))
+	svc.Register("Echo", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(req.Name)
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	client := NewClient(server.URL, ClientSigner("ak", "sk", opts...),
+		ClientHeaders(http.Header{"X-Nonce": []string{"overridden"}}))
+	for i := 0; i < 2; i++ {
+		var name string
+		if err := client.Invoke(context.Background(), "Echo", "", map[string]string{"Name": "abc"}, &name); err != nil {
+			t.Fatal(err)
+		} else if name != "abc" {
+			t.Errorf("expect the name '%s', but got '%s'", "abc", name)
+		}
+	}
+
+	client = NewClient(server.URL, ClientSigner("ak", "sk", opts...),
+		ClientHTTPClient(&http.Client{Transport: tamperTransport{body: `{"Name":"xyz"}`}}))
+	err := client.Invoke(context.Background(), "Echo", "", map[string]string{"Name": "abc"}, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrSignatureDoesNotMatch) {
+		t.Errorf("expect the error '%s', but got '%v'", ErrSignatureDoesNotMatch.Code, err)
+	}
+
+	client = NewClient(server.URL, ClientSigner("ak", "wrong", opts...))
+	err = client.Invoke(context.Background(), "Echo", "", map[string]string{"Name": "abc"}, nil)
+	if e, ok := err.(Error); !ok || !e.Is(ErrSignatureDoesNotMatch) {
+		t.Errorf("expect the error '%s', but got '%v'", ErrSignatureDoesNotMatch.Code, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// BatchResult is the result of an item of the batch request.
+type BatchResult struct {
+	RequestID string
+	Err       error // nil, Error, or the error to decode the response data.
+}
+
+// InvokeBatch calls the batch service with the items in one request,
+// and decodes the data of the response of each item into its Response
+// if it is not nil. The results are in the same order as items.
+//
+// The item without the request id is assigned to a request id derived
+// from that of the batch request. The failure of an item is returned as
+// the error of its result, and err is only the failure of the whole call.
+//
+// If the number of the items exceeds the maximum number of the batch
+// service, they are split into several batch requests.
+func (c *Client) InvokeBatch(ctx context.Context, items []BatchItem) (results []BatchResult, err error) {
+	if len(items) == 0 {
+		return
+	}
+
+	header := make(http.Header, len(c.header)+4)
+	c.setHeaders(ctx, header, c.batchAction, "")
+	requestID := header.Get(c.requestIDHeader)
+
+	items = append([]BatchItem(nil), items...)
+	for i := range items {
+		if items[i].RequestID == "" {
+			items[i].RequestID = requestID + "-" + strconv.Itoa(i)
+		}
+		if items[i].Payload == nil && items[i].Request != nil {
+			if items[i].Payload, err = json.Marshal(items[i].Request); err != nil {
+				return nil, ErrInvalidParameter.WithMessage(err.Error()).WithCause(err)
+			}
+		}
+	}
+
+	results = make([]BatchResult, len(items))
+	for start := 0; start < len(items); {
+		end := len(items)
+		if max := int(atomic.LoadInt64(&c.maxBatch)); max > 0 && start+max < end {
+			end = start + max
+		}
+
+		chunk := items[start:end]
+		body, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, ErrInvalidParameter.WithMessage(err.Error()).WithCause(err)
+		}
+
+		var resps []json.RawMessage
+		rheader, err := c.call(ctx, c.batchAction, header, body, &resps)
+		max, _ := strconv.Atoi(rheader.Get("X-Max-Batch"))
+		if max > 0 {
+			atomic.StoreInt64(&c.maxBatch, int64(max))
+		}
+
+		if err != nil {
+			if max > 0 && max < len(chunk) {
+				continue // Split the items by the advertised maximum number.
+			}
+			return nil, err
+		} else if len(resps) != len(chunk) {
+			return nil, ErrServerError.WithMessage("expect %d batch results, but got %d",
+				len(chunk), len(resps))
+		}
+
+		for i, resp := range resps {
+			item := chunk[i]
+			results[start+i] = BatchResult{
+				RequestID: item.RequestID,
+				Err:       c.decode(http.StatusOK, resp, item.Response),
+			}
+		}
+		start = end
+	}
+
+	return
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClientInvokeBatch(t *testing.T) {
+	var batches int
+	svc := NewService()
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.Action == "Batch" {
+				batches++
+			}
+			return next(c)
+		}
+	})
+	svc.EnableBatch("Batch", 2)
+	svc.Register("Echo", func(c *Context) error {
+		var req struct{ Id int }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		if req.Id%2 == 1 {
+			return ErrResourceNotFound.WithMessage("no %d", req.Id)
+		}
+		return c.Success(req.Id * 10)
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	resps := make([]int, 5)
+	items := make([]BatchItem, len(resps))
+	for i := range items {
+		items[i] = BatchItem{Action: "Echo", Request: map[string]int{"Id": i}, Response: &resps[i]}
+	}
+	items[4].RequestID = "last"
+
+	results, err := client.InvokeBatch(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != len(items) {
+		t.Fatalf("expect %d results, but got %d", len(items), len(results))
+	}
+
+	// The first request is rejected, then split into 3 requests.
+	if batches != 4 {
+		t.Errorf("expect 4 batch requests, but got %d", batches)
+	}
+
+	for i, result := range results {
+		if i%2 == 1 {
+			if e, ok := result.Err.(Error); !ok || !e.Is(ErrResourceNotFound) ||
+				e.Message != "no "+strconv.Itoa(i) {
+				t.Errorf("%d: unexpected the error: %v", i, result.Err)
+			}
+		} else if result.Err != nil {
+			t.Errorf("%d: unexpected the error: %v", i, result.Err)
+		} else if resps[i] != i*10 {
+			t.Errorf("%d: expect the response %d, but got %d", i, i*10, resps[i])
+		}
+	}
+
+	if results[4].RequestID != "last" || !strings.HasSuffix(results[1].RequestID, "-1") {
+		t.Errorf("unexpected the request ids: %s, %s", results[1].RequestID, results[4].RequestID)
+	}
+
+	batches = 0
+	if _, err = client.InvokeBatch(context.Background(), items); err != nil {
+		t.Fatal(err)
+	} else if batches != 3 {
+		t.Errorf("expect 3 batch requests by the learned maximum, but got %d", batches)
+	}
+}
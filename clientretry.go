@@ -0,0 +1,143 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy is the policy to retry the failed calls of the client.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of the attempts of a call,
+	// including the first one.
+	//
+	// Default: 3
+	MaxAttempts int
+
+	// BaseDelay and MaxDelay are the base and maximum delays of the
+	// exponential backoff with the jitter, that's, the delay before
+	// the n-th retry is a random duration in [d/2, d], d = BaseDelay*2^(n-1),
+	// which is not more than MaxDelay. But the delay is at least
+	// the hint of Retry-After of the error.
+	//
+	// Default: 100ms, 10s
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// ShouldRetry reports whether to retry the call after the attempt fails
+	// with the transport error or the decoded Error.
+	//
+	// Default: DefaultShouldRetry
+	ShouldRetry func(attempt int, err error) bool
+
+	// Safe reports whether the action is safe to be retried, such as it is
+	// idempotent, because the failed call may have been executed.
+	//
+	// Default: nil, that's, all the actions are safe.
+	Safe func(action string) bool
+
+	// OnRetry is called before retrying, such as for the metrics.
+	OnRetry func(action string, attempt int, err error, delay time.Duration)
+}
+
+// ClientRetry returns a client option to retry the failed calls by the policy.
+//
+// The request body is buffered, so it is replayed on every attempt with
+// the same request id. The retry is given up if the delay exceeds
+// the deadline of the context.
+func ClientRetry(policy RetryPolicy) ClientOption {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 100 * time.Millisecond
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = 10 * time.Second
+	}
+	if policy.ShouldRetry == nil {
+		policy.ShouldRetry = DefaultShouldRetry
+	}
+	return func(c *Client) { c.retry = &policy }
+}
+
+// DefaultShouldRetry is the default function to decide whether to retry,
+// which retries the transport errors except the context errors,
+// the retriable Error and the Error with the status code 502, 503 or 504.
+func DefaultShouldRetry(attempt int, err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case Error:
+		switch e.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return e.Retriable || e.RetryAfter > 0
+	default:
+		return !isContextError(err)
+	}
+}
+
+func isContextError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	if e, ok := err.(Error); ok && e.RetryAfter > d {
+		d = e.RetryAfter
+	}
+	return d
+}
+
+func (p *RetryPolicy) do(ctx context.Context, action string, call func() error) (err error) {
+	safe := p.Safe == nil || p.Safe(action)
+	for attempt := 1; ; attempt++ {
+		if err = call(); err == nil || !safe || attempt >= p.MaxAttempts ||
+			ctx.Err() != nil || !p.ShouldRetry(attempt, err) {
+			return
+		}
+
+		delay := p.delay(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(action, attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	var requestIDs []string
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.Register("Get", func(c *Context) error {
+		requestIDs = append(requestIDs, c.GetRequestID())
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return ErrServiceUnavailable
+		}
+		return c.Success("ok")
+	})
+	svc.Register("Invalid", func(c *Context) error {
+		atomic.AddInt32(&calls, 1)
+		return ErrInvalidParameter
+	})
+	svc.Register("Throttle", func(c *Context) error {
+		atomic.AddInt32(&calls, 1)
+		c.SetRespHeader("Retry-After", "1")
+		return ErrThrottling
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	var retries []int
+	client := NewClient(server.URL, ClientRetry(RetryPolicy{
+		BaseDelay: time.Millisecond,
+		Safe:      func(action string) bool { return action != "Create" },
+		OnRetry: func(action string, attempt int, err error, delay time.Duration) {
+			retries = append(retries, attempt)
+		},
+	}))
+
+	var resp string
+	if err := client.Invoke(context.Background(), "Get", "", map[string]int{"Id": 1}, &resp); err != nil {
+		t.Fatal(err)
+	} else if resp != "ok" || calls != 3 || len(retries) != 2 {
+		t.Errorf("unexpected the result: resp=%s, calls=%d, retries=%v", resp, calls, retries)
+	}
+	if len(requestIDs) != 3 || requestIDs[0] != requestIDs[1] || requestIDs[1] != requestIDs[2] {
+		t.Errorf("expect the same request id, but got %v", requestIDs)
+	}
+
+	calls, retries = 0, nil
+	if err := client.Invoke(context.Background(), "Invalid", "", nil, nil); err == nil {
+		t.Error("expect an error")
+	} else if calls != 1 || len(retries) != 0 {
+		t.Errorf("unexpect the retries of the non-retriable error: %d", calls)
+	}
+
+	calls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := client.Invoke(ctx, "Throttle", "", nil, nil); err.(Error).RetryAfter != time.Second {
+		t.Errorf("expect the retry hint 1s, but got %v", err.(Error).RetryAfter)
+	} else if calls != 1 {
+		t.Errorf("expect to give up retrying out of the deadline, but got %d calls", calls)
+	}
+
+	unsafe := NewClient(server.URL, ClientRetry(RetryPolicy{
+		BaseDelay: time.Millisecond,
+		Safe:      func(action string) bool { return false },
+	}))
+	calls = 0
+	if err := unsafe.Invoke(context.Background(), "Get", "", nil, nil); err == nil || calls != 1 {
+		t.Errorf("unexpect the retries of the unsafe action: %d", calls)
+	}
+}
+
+func TestClientRetryTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	var retries int
+	client := NewClient(server.URL, ClientRetry(RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Millisecond,
+		OnRetry:     func(string, int, error, time.Duration) { retries++ },
+	}))
+	if err := client.Invoke(context.Background(), "Get", "", nil, nil); err == nil {
+		t.Error("expect the transport error")
+	} else if retries != 3 {
+		t.Errorf("expect 3 retries, but got %d", retries)
+	}
+}
+
+func TestDefaultShouldRetry(t *testing.T) {
+	for _, test := range []struct {
+		err   error
+		retry bool
+	}{
+		{nil, false},
+		{ErrThrottling, true},
+		{ErrInvalidParameter, false},
+		{ErrServerError.WithStatus(http.StatusBadGateway), true},
+		{ErrServerError, false},
+		{&url.Error{Op: "Post", Err: context.Canceled}, false},
+		{&url.Error{Op: "Post", Err: context.DeadlineExceeded}, false},
+		{&url.Error{Op: "Post", Err: ErrServerError}, true},
+	} {
+		if retry := DefaultShouldRetry(1, test.err); retry != test.retry {
+			t.Errorf("%v: expect %v, but got %v", test.err, test.retry, retry)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// InvokeStream is the same as Invoke, but returns the raw response body
+// as the stream, such as the large file responded by Context.Stream,
+// which must be closed by the caller. The stream is aborted if ctx is done.
+//
+// If the response is the JSON envelope with the error, it is decoded
+// and returned as Error. The JSON envelope without the error is returned
+// as the stream as it is.
+//
+// The call is not retried even if the option ClientRetry is given,
+// since the response stream cannot be replayed.
+func (c *Client) InvokeStream(ctx context.Context, action, version string, req interface{}) (
+	body io.ReadCloser, header http.Header, err error) {
+	if action == "" {
+		panic("Client.InvokeStream: the action must not be empty")
+	}
+
+	var data []byte
+	if req != nil {
+		if data, err = json.Marshal(req); err != nil {
+			return nil, nil, ErrInvalidParameter.WithMessage(err.Error()).WithCause(err)
+		}
+	}
+
+	reqHeader := make(http.Header, len(c.header)+4)
+	c.setHeaders(ctx, reqHeader, action, version)
+	hresp, err := c.send(ctx, reqHeader, data)
+	if err != nil {
+		return
+	}
+
+	if !strings.HasPrefix(hresp.Header.Get("Content-Type"), MIMEApplicationJSON) {
+		return hresp.Body, hresp.Header, nil
+	}
+
+	data, err = ioutil.ReadAll(hresp.Body)
+	hresp.Body.Close()
+	if err != nil {
+		return
+	} else if err = c.decode(hresp.StatusCode, data, nil); err != nil {
+		return nil, hresp.Header, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), hresp.Header, nil
+}
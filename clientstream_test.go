@@ -0,0 +1,81 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientInvokeStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 256*1024) // 4MB
+
+	svc := NewService()
+	svc.Register("Export", func(c *Context) error {
+		return c.Stream(200, "application/octet-stream", bytes.NewReader(payload))
+	})
+	svc.Register("Missing", func(c *Context) error { return ErrNotFound })
+	svc.Register("Block", func(c *Context) error {
+		c.Text(200, "text/plain", "chunk")
+		c.res.Flush()
+		<-c.Request().Context().Done()
+		return nil
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	body, header, err := client.InvokeStream(context.Background(), "Export", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if sha256.Sum256(data) != sha256.Sum256(payload) {
+		t.Errorf("the downloaded %d bytes do not match", len(data))
+	} else if ct := header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("unexpected the content type '%s'", ct)
+	}
+
+	if _, _, err = client.InvokeStream(context.Background(), "Missing", "", nil); err == nil {
+		t.Error("expect the error")
+	} else if e, ok := err.(Error); !ok || !e.Is(ErrNotFound) {
+		t.Errorf("unexpected the error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body, _, err = client.InvokeStream(ctx, "Block", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(body, buf); err != nil || string(buf) != "chunk" {
+		t.Fatalf("unexpected the first chunk '%s': %v", buf, err)
+	}
+	cancel()
+	if _, err = body.Read(buf); err == nil {
+		t.Error("expect the read to be aborted by the canceled context")
+	}
+}
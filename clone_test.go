@@ -0,0 +1,90 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestServiceClone(t *testing.T) {
+	var events []string
+	record := func(event string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error { events = append(events, event); return next(c) }
+		}
+	}
+
+	svc := NewService()
+	svc.Use(record("global"))
+	svc.OnRequest(func(c *Context) error { events = append(events, "hook"); return nil })
+	svc.Register("a", func(c *Context) error { return c.Success("a") }, record("a"))
+	svc.Mapping("alias", "a")
+
+	clone := svc.Clone()
+	clone.Use(record("auth"))
+	clone.OnRequest(func(c *Context) error { events = append(events, "clonehook"); return nil })
+	clone.Register("b", func(c *Context) error { return c.Success("b") })
+	svc.Register("c", func(c *Context) error { return c.Success("c") })
+	clone.Unregister("a")
+	clone.Register("a", func(c *Context) error { return c.Success("clone-a") })
+
+	call := func(s *Service, action string) (data interface{}) {
+		events = events[:0]
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		s.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Code != "" {
+			return resp.Error.Code
+		}
+		return resp.Data
+	}
+
+	if data := call(svc, "alias"); data != "a" {
+		t.Errorf("expect '%s', but got '%v'", "a", data)
+	} else if expect := "hook global a"; strings.Join(events, " ") != expect {
+		t.Errorf("expect events '%s', but got '%s'", expect, strings.Join(events, " "))
+	}
+
+	if data := call(clone, "alias"); data != "clone-a" {
+		t.Errorf("expect '%s', but got '%v'", "clone-a", data)
+	} else if expect := "hook clonehook global auth"; strings.Join(events, " ") != expect {
+		t.Errorf("expect events '%s', but got '%s'", expect, strings.Join(events, " "))
+	}
+
+	if data := call(svc, "b"); data != ErrInvalidAction.Code {
+		t.Errorf("unexpected the service 'b' registered into the clone: %v", data)
+	}
+	if data := call(clone, "c"); data != ErrInvalidAction.Code {
+		t.Errorf("unexpected the service 'c' registered after cloning: %v", data)
+	}
+
+	names := svc.Services()
+	sort.Strings(names)
+	if s := strings.Join(names, ","); s != "a,c" {
+		t.Errorf("unexpected the services of the original: %s", s)
+	}
+	if svc.Stats()["a"].Calls != 1 || clone.Stats()["a"].Calls != 1 {
+		t.Errorf("expect the independent stats")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CoalesceOption is used to configure the Coalesce middleware.
+type CoalesceOption func(*coalesceConfig)
+
+// CoalescePredicate returns a coalesce option to decide whether the request
+// participates in the coalescing.
+//
+// Default: only the GET and HEAD requests.
+func CoalescePredicate(predicate func(*Context) bool) CoalesceOption {
+	return func(c *coalesceConfig) { c.predicate = predicate }
+}
+
+type coalesceConfig struct {
+	predicate func(*Context) bool
+}
+
+func isSafeMethod(c *Context) bool {
+	return c.req.Method == http.MethodGet || c.req.Method == http.MethodHead
+}
+
+type coalesceCall struct {
+	done chan struct{}
+
+	err    error
+	status int
+	header http.Header
+	body   []byte
+}
+
+type coalesceGroup struct {
+	lock  sync.Mutex
+	calls map[string]*coalesceCall
+}
+
+// Coalesce returns a middleware to coalesce the concurrent requests
+// with the same key, that's, only the first one executes the handler,
+// and the rest wait for it and receive a copy of its response,
+// including the status code, the headers and the body.
+//
+// If the first one fails, the rest return the same error, which is
+// responded as the error envelope of their own. The waiting request
+// returns ErrGatewayTimeout if its context is done.
+//
+// If keyFunc is nil, it is DefaultCacheKey by default, which is scoped
+// by the tenant and the principal, so the requests of the different users
+// are not coalesced. If keyFunc returns an empty string, the request
+// is not coalesced.
+//
+// Notice: the copied body is responded as it is, including the request id
+// of the first request in the response envelope.
+func Coalesce(keyFunc func(*Context) string, opts ...CoalesceOption) Middleware {
+	conf := coalesceConfig{predicate: isSafeMethod}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if keyFunc == nil {
+		keyFunc = DefaultCacheKey
+	}
+
+	group := &coalesceGroup{calls: make(map[string]*coalesceCall)}
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if !conf.predicate(c) {
+				return next(c)
+			}
+
+			key := keyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+
+			group.lock.Lock()
+			if call, ok := group.calls[key]; ok {
+				group.lock.Unlock()
+				return call.wait(c)
+			}
+			call := &coalesceCall{done: make(chan struct{}), err: ErrServerError}
+			group.calls[key] = call
+			group.lock.Unlock()
+
+			defer func() {
+				group.lock.Lock()
+				delete(group.calls, key)
+				group.lock.Unlock()
+				close(call.done)
+			}()
+
+			resp := c.ResponseWriter()
+			tee := &teeResponseWriter{ResponseWriter: resp}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			call.err, call.status, call.body = err, c.StatusCode(), tee.buf
+			call.header = cloneHeader(resp.Header())
+			return
+		}
+	}
+}
+
+func (call *coalesceCall) wait(c *Context) (err error) {
+	select {
+	case <-c.req.Context().Done():
+		return ErrGatewayTimeout.WithMessage(c.req.Context().Err().Error())
+	case <-call.done:
+	}
+
+	if call.err != nil {
+		return call.err
+	}
+
+	header := c.res.Header()
+	for k, v := range call.header {
+		if _, ok := header[k]; !ok {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	c.res.WriteHeader(call.status)
+	_, err = c.res.Write(call.body)
+	return
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	svc := NewService()
+	svc.Use(Coalesce(nil))
+	svc.Register("Action", func(c *Context) error {
+		atomic.AddInt32(&calls, 1)
+		entered <- struct{}{}
+		<-release
+		if c.Query().Get("Fail") != "" {
+			return ErrResourceNotFound
+		}
+		c.ResponseWriter().Header().Set("X-Leader", "1")
+		return c.Success("result")
+	})
+
+	run := func(query string, n int) []*httptest.ResponseRecorder {
+		recs := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			recs[i] = httptest.NewRecorder()
+			go func(rec *httptest.ResponseRecorder) {
+				defer wg.Done()
+				svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action"+query, nil))
+			}(recs[i])
+			if i == 0 {
+				<-entered
+			}
+		}
+		time.Sleep(time.Millisecond * 50)
+		release <- struct{}{}
+		wg.Wait()
+		return recs
+	}
+
+	recs := run("", 5)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expect 1 call, but got %d", n)
+	}
+	for i, rec := range recs {
+		if rec.Header().Get("X-Leader") != "1" || !strings.Contains(rec.Body.String(), `"Data":"result"`) {
+			t.Errorf("%d: unexpected response: %v, %s", i, rec.Header(), rec.Body.String())
+		}
+	}
+
+	recs = run("&Fail=1", 3)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expect 2 calls, but got %d", n)
+	}
+	for i, rec := range recs {
+		if !strings.Contains(rec.Body.String(), ErrResourceNotFound.Code) {
+			t.Errorf("%d: unexpected response: %s", i, rec.Body.String())
+		}
+	}
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	svc := NewService()
+	svc.Use(Coalesce(func(c *Context) string { return "key" }))
+	svc.Register("Action", func(c *Context) error {
+		close(entered)
+		<-release
+		return nil
+	})
+
+	go svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?Action=Action", nil).WithContext(ctx)
+	svc.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), ErrGatewayTimeout.Code) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestCoalescePrincipal(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	svc := NewService()
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetPrincipal(c.GetReqHeader("X-User"))
+			return next(c)
+		}
+	}, Coalesce(nil))
+	svc.Register("Action", func(c *Context) error {
+		atomic.AddInt32(&calls, 1)
+		entered <- struct{}{}
+		<-release
+		return c.Success(c.Principal())
+	})
+
+	users := []string{"alice", "bob"}
+	recs := make([]*httptest.ResponseRecorder, len(users))
+	var wg sync.WaitGroup
+	for i, user := range users {
+		wg.Add(1)
+		recs[i] = httptest.NewRecorder()
+		go func(rec *httptest.ResponseRecorder, user string) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/?Action=Action", nil)
+			req.Header.Set("X-User", user)
+			svc.ServeHTTP(rec, req)
+		}(recs[i], user)
+	}
+
+	// The requests of the different users are not coalesced.
+	for range users {
+		select {
+		case <-entered:
+		case <-time.After(time.Second):
+			t.Fatal("the requests of the different users are coalesced")
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	for i, rec := range recs {
+		if !strings.Contains(rec.Body.String(), `"Data":"`+users[i]+`"`) {
+			t.Errorf("%d: unexpected response: %s", i, rec.Body.String())
+		}
+	}
+}
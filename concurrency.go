@@ -0,0 +1,113 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MaxConcurrent is equal to NewConcurrencyLimiter(n, queue, wait).Middleware().
+func MaxConcurrent(n int, queue int, wait time.Duration) Middleware {
+	return NewConcurrencyLimiter(n, queue, wait).Middleware()
+}
+
+// ConcurrencyLimiter is used to limit the number of the handlers
+// running concurrently.
+type ConcurrencyLimiter struct {
+	sem   chan struct{}
+	queue int32
+	wait  time.Duration
+
+	inflight int32
+	queued   int32
+}
+
+// NewConcurrencyLimiter returns a new ConcurrencyLimiter, which admits
+// at most n handlers at once, and queues up to queue additional requests
+// for at most wait.
+func NewConcurrencyLimiter(n int, queue int, wait time.Duration) *ConcurrencyLimiter {
+	if n <= 0 {
+		panic("NewConcurrencyLimiter: n must be greater than 0")
+	} else if queue < 0 {
+		queue = 0
+	}
+
+	return &ConcurrencyLimiter{
+		sem:   make(chan struct{}, n),
+		queue: int32(queue),
+		wait:  wait,
+	}
+}
+
+// InFlight returns the number of the running handlers.
+func (l *ConcurrencyLimiter) InFlight() int { return int(atomic.LoadInt32(&l.inflight)) }
+
+// Queued returns the number of the queued requests.
+func (l *ConcurrencyLimiter) Queued() int { return int(atomic.LoadInt32(&l.queued)) }
+
+// Middleware returns a middleware to limit the concurrency of the handlers,
+// which sheds the requests exceeding the queue or waiting too long
+// with ErrServiceUnavailable and the header "Retry-After".
+func (l *ConcurrencyLimiter) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if !l.acquire(c) {
+				seconds := int64(math.Ceil(l.wait.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				c.SetRespHeader("Retry-After", strconv.FormatInt(seconds, 10))
+				return ErrServiceUnavailable.WithMessage("too many concurrent requests")
+			}
+
+			atomic.AddInt32(&l.inflight, 1)
+			defer l.release()
+			return next(c)
+		}
+	}
+}
+
+func (l *ConcurrencyLimiter) release() {
+	atomic.AddInt32(&l.inflight, -1)
+	<-l.sem
+}
+
+func (l *ConcurrencyLimiter) acquire(c *Context) bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	defer atomic.AddInt32(&l.queued, -1)
+	if atomic.AddInt32(&l.queued, 1) > l.queue || l.wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-c.req.Context().Done():
+		return false
+	}
+}
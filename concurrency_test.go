@@ -0,0 +1,77 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	release := make(chan struct{})
+	limiter := NewConcurrencyLimiter(1, 1, time.Millisecond*50)
+
+	svc := NewService()
+	svc.Use(limiter.Middleware())
+	svc.Register("block", func(c *Context) error { <-release; return c.Success(nil) })
+	svc.Register("panic", func(c *Context) error { panic("crash") })
+
+	call := func(action string) (code string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error.Code != "" && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("expect the header Retry-After")
+		}
+		return resp.Error.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); call("block") }()
+	for limiter.InFlight() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queued request waits too long.
+	if code := call("block"); code != ErrServiceUnavailable.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrServiceUnavailable.Code, code)
+	} else if n := limiter.Queued(); n != 0 {
+		t.Errorf("expect no queued requests, but got %d", n)
+	}
+
+	close(release)
+	wg.Wait()
+
+	func() {
+		defer func() { recover() }()
+		call("panic")
+	}()
+
+	if n := limiter.InFlight(); n != 0 {
+		t.Errorf("expect no in-flight requests, but got %d", n)
+	} else if code := call("block"); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+}
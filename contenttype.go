@@ -0,0 +1,64 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ctlock    sync.Mutex
+	ctinterns atomic.Value // map[string][]string
+)
+
+func init() { ctinterns.Store(map[string][]string{}) }
+
+// RegisterContentType interns the custom content type, such as
+// "application/vnd.api+json", so that setting it as the response header
+// Content-Type does not allocate, like the predefined MIME types.
+//
+// Notice: only the registered content types are interned, not those
+// passed to Context.Blob, Text and Stream, which may vary per request,
+// such as the multipart boundary.
+func RegisterContentType(ct string) {
+	if ct == "" {
+		panic("RegisterContentType: the content type must not be empty")
+	}
+
+	ctlock.Lock()
+	internContentType(ct)
+	ctlock.Unlock()
+}
+
+// internContentType must be called with ctlock held.
+func internContentType(ct string) {
+	old := ctinterns.Load().(map[string][]string)
+	if _, ok := old[ct]; ok {
+		return
+	}
+
+	interns := make(map[string][]string, len(old)+1)
+	for k, v := range old {
+		interns[k] = v
+	}
+	interns[ct] = []string{ct}
+	ctinterns.Store(interns)
+}
+
+func lookupContentType(ct string) (values []string, ok bool) {
+	values, ok = ctinterns.Load().(map[string][]string)[ct]
+	return
+}
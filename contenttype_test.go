@@ -0,0 +1,92 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// saveContentTypes saves the global interned content types and returns
+// the function to restore them, so that the test can be run repeatedly.
+func saveContentTypes() (restore func()) {
+	ctlock.Lock()
+	interns := ctinterns.Load()
+	ctlock.Unlock()
+
+	return func() {
+		ctlock.Lock()
+		ctinterns.Store(interns)
+		ctlock.Unlock()
+	}
+}
+
+func TestRegisterContentType(t *testing.T) {
+	defer saveContentTypes()()
+
+	const ct = "application/vnd.registered+json"
+	header := http.Header{}
+	if n := testing.AllocsPerRun(10, func() { setContentType(header, ct) }); n == 0 {
+		t.Error("expect the allocation for the unregistered content type")
+	}
+
+	RegisterContentType(ct)
+	if n := testing.AllocsPerRun(10, func() { setContentType(header, ct) }); n != 0 {
+		t.Errorf("expect no allocation for the registered content type, but got %v", n)
+	} else if v := header.Get("Content-Type"); v != ct {
+		t.Errorf("expect the content type '%s', but got '%s'", ct, v)
+	}
+}
+
+func TestCustomContentTypeNotInterned(t *testing.T) {
+	defer saveContentTypes()()
+
+	const ct = "multipart/form-data; boundary=abc"
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		c := NewContext()
+		c.SetReqResp(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.Text(200, ct, "")
+
+		if v := rec.Header().Get("Content-Type"); v != ct {
+			t.Errorf("expect the content type '%s', but got '%s'", ct, v)
+		}
+	}
+
+	if _, ok := lookupContentType(ct); ok {
+		t.Error("unexpected the unregistered content type to be interned")
+	}
+}
+
+func BenchmarkSetContentTypeCustom(b *testing.B) {
+	header := http.Header{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		setContentType(header, "application/vnd.unregistered+json")
+	}
+}
+
+func BenchmarkSetContentTypeRegistered(b *testing.B) {
+	const ct = "application/vnd.benchmark+json"
+	RegisterContentType(ct)
+
+	header := http.Header{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		setContentType(header, ct)
+	}
+}
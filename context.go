@@ -15,37 +15,65 @@
 package httpsvc
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// ErrAlreadyResponded is returned by Context.Respond when the response
+// has been sent.
+var ErrAlreadyResponded = errors.New("the response has already been sent")
+
 func setContentType(header http.Header, ct string) {
 	if ct != "" {
-		switch ct {
-		case MIMEApplicationJSON:
-			header["Content-Type"] = mimeApplicationJSONs
-		case MIMEApplicationJSONCharsetUTF8:
-			header["Content-Type"] = mimeApplicationJSONCharsetUTF8s
-		case MIMEApplicationXML:
-			header["Content-Type"] = mimeApplicationXMLs
-		case MIMEApplicationXMLCharsetUTF8:
-			header["Content-Type"] = mimeApplicationXMLCharsetUTF8s
-		case MIMEApplicationForm:
-			header["Content-Type"] = mimeApplicationForms
-		case MIMEMultipartForm:
-			header["Content-Type"] = mimeMultipartForms
-		case "text/plain":
-			header["Content-Type"] = mimeTextPlains
-		default:
+		if values := contentTypeValues(ct); values != nil {
+			header["Content-Type"] = values
+		} else {
 			header.Set("Content-Type", ct)
 		}
 	}
 }
 
+// contentTypeValues returns the preallocated header values of the content
+// type, which is predefined or registered by RegisterContentType, or nil.
+func contentTypeValues(ct string) (values []string) {
+	switch ct {
+	case MIMEApplicationJSON:
+		return mimeApplicationJSONs
+	case MIMEApplicationJSONCharsetUTF8:
+		return mimeApplicationJSONCharsetUTF8s
+	case MIMEApplicationXML:
+		return mimeApplicationXMLs
+	case MIMEApplicationXMLCharsetUTF8:
+		return mimeApplicationXMLCharsetUTF8s
+	case MIMEApplicationForm:
+		return mimeApplicationForms
+	case MIMEMultipartForm:
+		return mimeMultipartForms
+	case "text/plain":
+		return mimeTextPlains
+	default:
+		values, _ = lookupContentType(ct)
+		return
+	}
+}
+
 // Response represents a response result.
 type Response struct {
 	RequestID string      `json:"RequestId,omitempty" xml:"RequestId,omitempty"`
@@ -53,6 +81,88 @@ type Response struct {
 	Data      interface{} `json:",omitempty" xml:",omitempty"`
 }
 
+// jsonResponse is the default envelope of Response rendered by JSON.
+type jsonResponse struct {
+	RequestID string      `json:"RequestId,omitempty"`
+	Error     *Error      `json:",omitempty"`
+	Data      interface{} `json:",omitempty"`
+}
+
+// The precomputed parts of the response without the error and data.
+const (
+	emptyResponse       = "{}\n"
+	emptyResponsePrefix = `{"RequestId":"`
+	emptyResponseSuffix = "\"}\n"
+)
+
+// canSpliceJSON reports whether s can be written by writeJSONString,
+// that's, s is the valid UTF-8 without the control characters except
+// '\n', '\r' and '\t', whose escapes vary with the versions of Go.
+func canSpliceJSON(s string) bool {
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+				return false
+			}
+			i++
+		} else if r, size := utf8.DecodeRuneInString(s[i:]); r == utf8.RuneError && size == 1 {
+			return false
+		} else {
+			i += size
+		}
+	}
+	return true
+}
+
+// writeJSONString writes s into buf without the quotes as the json encoder
+// does, including escaping the html characters, which must be checked
+// by canSpliceJSON first.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	start := 0
+	for i := 0; i < len(s); {
+		var escape string
+		switch s[i] {
+		case '"':
+			escape = `\"`
+		case '\\':
+			escape = `\\`
+		case '\n':
+			escape = `\n`
+		case '\r':
+			escape = `\r`
+		case '\t':
+			escape = `\t`
+		case '<':
+			escape = `\u003c`
+		case '>':
+			escape = `\u003e`
+		case '&':
+			escape = `\u0026`
+		case 0xe2: // The first byte of U+2028 and U+2029.
+			if strings.HasPrefix(s[i:], "\u2028") {
+				escape = `\u2028`
+			} else if strings.HasPrefix(s[i:], "\u2029") {
+				escape = `\u2029`
+			}
+		}
+
+		if escape == "" {
+			i++
+			continue
+		}
+
+		buf.WriteString(s[start:i])
+		buf.WriteString(escape)
+		if s[i] == 0xe2 {
+			i += 3
+		} else {
+			i++
+		}
+		start = i
+	}
+	buf.WriteString(s[start:])
+}
+
 // Context is the context of the request.
 type Context struct {
 	// Action is the name of the service.
@@ -64,6 +174,13 @@ type Context struct {
 	// RequestID is the unique id indicating the request.
 	RequestID string
 
+	// Tenant is the tenant of the request, which may be empty.
+	Tenant string
+
+	// DryRun indicates whether the request only validates the parameters
+	// without executing it, which is decided by Service.GetDryRun.
+	DryRun bool
+
 	// Data is used to store the context data during handling the request,
 	// and it is the responsibility of the user to manage its lifecycle.
 	//
@@ -99,38 +216,120 @@ type Context struct {
 	req *http.Request
 	res *responseWriter
 
+	principal interface{}
+	session   *Session
+	action    *action   // The resolved action, which is used by the stats.
+	start     time.Time // The time when starting to call the action.
+
 	query url.Values
+	body  []byte
+	bodyb bool // Indicate whether the body has been buffered.
+
+	// envelope and enverr are reused by Respond to avoid the allocation.
+	envelope jsonResponse
+	enverr   Error
+
+	lazy uint8 // The bits of the fields to be extracted on the first access.
+
+	// Indicate whether the action, version, request id and tenant have been
+	// set before HandleRequest, such as the batch item, not to extract them.
+	extracted bool
+
+	staticfn func(int) // The cached method value of writeStaticHeaders.
+	reqbody  sizeReader
+
+	errhandling bool // Indicate whether Service.ErrorHandler is running.
+	responded   bool // Indicate whether Respond has sent the response.
+	resperr     bool // Indicate whether an error has been responded.
+
+	// For the action events.
+	boundReq interface{} // The request bound by the typed registration.
+	respData interface{}
+	respErr  error
 }
 
+const (
+	lazyVersion uint8 = 1 << iota
+	lazyRequestID
+)
+
 // NewContext returns a new Context.
-func NewContext() *Context { return &Context{res: newResponseWriter(nil)} }
+func NewContext() *Context {
+	c := &Context{res: newResponseWriter(nil)}
+	c.res.superfluous = c.superfluousWriteHeader
+	return c
+}
+
+func (c *Context) superfluousWriteHeader(code int) {
+	if c.svc != nil && c.svc.OnSuperfluousWrite != nil {
+		c.svc.OnSuperfluousWrite(c, code, debug.Stack())
+	}
+}
+
+func (c *Context) superfluousError(err error) {
+	if c.svc != nil && c.svc.OnSuperfluousError != nil {
+		c.svc.OnSuperfluousError(c, err)
+	} else {
+		log.Printf("superfluous error: action=%s, requestid=%s, err=%v",
+			c.Action, c.GetRequestID(), err)
+	}
+}
 
 func (c *Context) reset() {
 	if reset, ok := c.Data.(interface{ Reset() }); ok {
 		reset.Reset()
 	}
 
-	c.req, c.query = nil, nil
+	c.Action, c.Version, c.RequestID, c.Tenant, c.lazy = "", "", "", "", 0
+	c.extracted = false
+	c.DryRun = false
+	c.errhandling, c.responded, c.resperr = false, false, false
+	c.boundReq, c.respData, c.respErr = nil, nil, nil
+	if c.req != nil && c.req.Body == &c.reqbody {
+		c.req.Body = c.reqbody.ReadCloser // Not refer to the pooled context.
+	}
+	c.req, c.query, c.principal, c.action = nil, nil, nil, nil
+	c.session = nil
+	c.reqbody = sizeReader{}
+	c.body, c.bodyb = nil, false
+	if c.res.capture != nil {
+		c.ReleaseBuffer(c.res.capture)
+	}
 	c.res.Reset(nil)
 }
 
 // AcquireBuffer acquires a buffer from the pool.
-func (c *Context) AcquireBuffer() *bytes.Buffer {
-	return c.svc.bufpool.Get().(*bytes.Buffer)
-}
+func (c *Context) AcquireBuffer() *bytes.Buffer { return c.svc.acquireBuffer() }
 
-// ReleaseBuffer releases the buffer to the pool.
-func (c *Context) ReleaseBuffer(buf *bytes.Buffer) {
-	buf.Reset()
-	c.svc.bufpool.Put(buf)
-}
+// ReleaseBuffer releases the buffer to the pool, which is discarded
+// if its capacity exceeds Service.BufferMaxRecycleSize.
+func (c *Context) ReleaseBuffer(buf *bytes.Buffer) { c.svc.releaseBuffer(buf) }
 
 // StatusCode returns the status code of the response.
 func (c *Context) StatusCode() int { return c.res.Status }
 
+// WroteStatus returns the status code of the response and whether it is sent.
+func (c *Context) WroteStatus() (status int, wrote bool) { return c.res.Status, c.res.Wrote }
+
 // IsResponded reports whether the response is sent.
 func (c *Context) IsResponded() bool { return c.res.Wrote }
 
+// MustNotHaveResponded panics if the response header has been written,
+// which is used by the middleware to guard that nothing is responded
+// before it, such as the one to set the response headers.
+func (c *Context) MustNotHaveResponded() {
+	if c.res.Wrote {
+		panic(fmt.Sprintf("Context.MustNotHaveResponded: the response of the action '%s' has been sent", c.Action))
+	}
+}
+
+// ResponseHeaderWritten reports whether the response header has been written,
+// which may be true even if no body is written, such as only WriteHeader.
+func (c *Context) ResponseHeaderWritten() bool { return c.res.Wrote }
+
+// ResponseSize returns the number of the bytes of the written response body.
+func (c *Context) ResponseSize() int64 { return c.res.Size }
+
 // Request returns the inner Request.
 func (c *Context) Request() *http.Request { return c.req }
 
@@ -152,7 +351,10 @@ func (c *Context) SetReqResp(req *http.Request, resp http.ResponseWriter) {
 	c.req, c.res.ResponseWriter = req, resp
 }
 
-var _ http.ResponseWriter = &Context{}
+var (
+	_ http.ResponseWriter = &Context{}
+	_ http.Hijacker       = &Context{}
+)
 
 // Header implements the interface http.ResponseWriter.
 func (c *Context) Header() http.Header { return c.res.Header() }
@@ -166,6 +368,70 @@ func (c *Context) Write(p []byte) (int, error) { return c.res.Write(p) }
 // WriteString implements the interface io.StringWriter.
 func (c *Context) WriteString(s string) (int, error) { return c.res.WriteString(s) }
 
+// Unwrap returns the proxy of the underlying response writer,
+// so that http.NewResponseController(c) works.
+func (c *Context) Unwrap() http.ResponseWriter { return c.res }
+
+// Hijack implements the interface http.Hijacker, which returns
+// http.ErrNotSupported if the underlying response writer does not support it.
+func (c *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) { return c.res.Hijack() }
+
+// CaptureResponse starts to capture at most limit bytes of the response body
+// written later, which may be got by CapturedResponse. If limit is equal to
+// or less than 0, there is no limit.
+//
+// The body is captured before being passed to the underlying response writer,
+// so it is not compressed even if a compression middleware is used.
+// If called again, the limit is extended to the larger one.
+func (c *Context) CaptureResponse(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+
+	if c.res.capture == nil {
+		c.res.capture, c.res.limit = c.AcquireBuffer(), limit
+	} else if c.res.limit > 0 && (limit == 0 || limit > c.res.limit) {
+		c.res.limit = limit
+	}
+}
+
+// CapturedResponse returns the response body captured since CaptureResponse
+// is called, which is nil if not capturing.
+//
+// Notice: the returned bytes are only valid before the context is released.
+func (c *Context) CapturedResponse() []byte {
+	if c.res.capture == nil {
+		return nil
+	}
+	return c.res.capture.Bytes()
+}
+
+// BeforeWriteHeader registers the callback, which is called with the status
+// code exactly once immediately before the response header is written
+// to the underlying response writer, so it may set the response headers
+// late, such as the timing, but cannot change the status code.
+//
+// The callbacks are called in the LIFO order. A panic in a callback is
+// reported by Service.PanicHandler and does not prevent the header
+// from being written.
+func (c *Context) BeforeWriteHeader(fn func(status int)) {
+	if fn == nil {
+		panic("Context.BeforeWriteHeader: the callback must not be nil")
+	}
+
+	c.res.before = append(c.res.before, func(status int) {
+		defer func() {
+			if r := recover(); r != nil {
+				c.svc.handlePanic(c, r)
+			}
+		}()
+		fn(status)
+	})
+}
+
+// IsHijacked reports whether the connection has been hijacked.
+func (c *Context) IsHijacked() bool { return c.res.Hijacked }
+
 // Blob sends the binary data to the client with status code and content type.
 func (c *Context) Blob(code int, contentType string, data []byte) (err error) {
 	setContentType(c.res.Header(), contentType)
@@ -188,37 +454,121 @@ func (c *Context) Text(code int, contentType string, data string) (err error) {
 
 // Stream sends the data from the stream to the client with status code
 // and content type.
+//
+// If the client has gone away, it returns ErrClientClosedRequest
+// and stops sending the rest.
 func (c *Context) Stream(code int, contentType string, r io.Reader) (err error) {
+	if c.ClientGone() {
+		return ErrClientClosedRequest
+	}
+
 	setContentType(c.res.Header(), contentType)
 	c.res.WriteHeader(code)
+	if err = c.copyBody(r); err != nil && c.ClientGone() {
+		err = ErrClientClosedRequest.WithCauses(err)
+	}
+	return
+}
 
+func (c *Context) copyBody(r io.Reader) (err error) {
 	switch v := r.(type) {
 	case interface{ Bytes() []byte }:
 		_, err = c.res.Write(v.Bytes())
 	case io.WriterTo:
 		_, err = v.WriteTo(c.res)
 	default:
-		_, err = io.CopyBuffer(c.res, r, make([]byte, 2048))
+		_, err = c.res.ReadFrom(r)
 	}
 
 	return
 }
 
+// File sends the content of the file by http.ServeContent, which handles
+// the requests of Range, If-Modified-Since, etc, and may use the sendfile
+// optimization of net/http.
+//
+// It returns ErrResourceNotFound if the file does not exist or is a directory.
+func (c *Context) File(path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrResourceNotFound.WithMessage("no file '%s'", filepath.Base(path))
+		}
+		return ErrServerError.WithCauses(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return ErrServerError.WithCauses(err)
+	} else if fi.IsDir() {
+		return ErrResourceNotFound.WithMessage("no file '%s'", filepath.Base(path))
+	}
+
+	http.ServeContent(c.res, c.req, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
 // JSON encodes the data with the json encoder, then responds to the client
 // with the status code 200.
 func (c *Context) JSON(data interface{}) (err error) {
 	buf := c.AcquireBuffer()
-	if err = json.NewEncoder(buf).Encode(data); err == nil {
-		err = c.Stream(200, MIMEApplicationJSONCharsetUTF8, buf)
+	if err = json.NewEncoder(buf).Encode(data); err == nil && c.res.exceed(int64(buf.Len())) {
+		err = ErrResponseTooLarge
+	} else if err == nil {
+		// Use the default status code, which may have been set by WriteHeader.
+		setContentType(c.res.Header(), MIMEApplicationJSONCharsetUTF8)
+		c.res.writeHeader(http.StatusOK)
+		err = c.copyBody(buf)
 	}
 	c.ReleaseBuffer(buf)
 	return
 }
 
+// JSONDirect is the same as JSON, but writes the header with the status code
+// and encodes the data straight into the response without the intermediate
+// buffer, which is suitable for the large data.
+//
+// Notice: since the header has been sent, the encoding error in the middle
+// cannot be converted into the error response, and the client receives
+// the truncated body. So use JSON instead if the data may fail to encode.
+func (c *Context) JSONDirect(code int, data interface{}) error {
+	setContentType(c.res.Header(), MIMEApplicationJSONCharsetUTF8)
+	c.res.WriteHeader(code)
+	return json.NewEncoder(c.res).Encode(data)
+}
+
 // Respond sends the response as Response.
 //
+// If err is not nil and Service.ErrorHandler is set, it is handed over to
+// the error handler, and Respond called in the error handler responds it.
+//
 // If Render isn't nil, use it to render the response. Or use c.JSON instead.
+//
+// Respond sends the response only once. If the response has been sent,
+// such as by the former Respond or the written body, it returns
+// ErrAlreadyResponded, and err, if not nil, is passed to
+// Service.OnSuperfluousError instead of being dropped silently.
+// But if only the response header is written, such as WriteHeader(202),
+// Respond still sends the body with the written status code.
 func (c *Context) Respond(data interface{}, err error) error {
+	if c.responded || c.res.Size > 0 || c.res.Hijacked {
+		if err != nil {
+			c.superfluousError(err)
+		}
+		return ErrAlreadyResponded
+	}
+
+	if err != nil && !c.errhandling && c.svc != nil && c.svc.ErrorHandler != nil {
+		c.errhandling = true
+		c.svc.ErrorHandler(c, err)
+		c.errhandling = false
+		return nil
+	}
+
+	c.responded = true
+	c.resperr = err != nil
+
 	var e Error
 	switch _err := err.(type) {
 	case nil:
@@ -227,23 +577,97 @@ func (c *Context) Respond(data interface{}, err error) error {
 	case interface{ CodeError() Error }:
 		e = _err.CodeError()
 	default:
-		e = ErrServerError.WithCauses(err)
+		e = ErrServerError.WithCauses(err).WithCause(err)
+	}
+
+	if c.svc != nil && c.svc.ValidateResponses && e.Code == "" && data != nil && c.action != nil {
+		if e = c.svc.checkResponse(c, data); e.Code != "" {
+			c.res.WriteHeader(http.StatusInternalServerError)
+			data = nil
+		}
+	}
+
+	if c.respData = data; e.Code != "" {
+		c.respErr = e
+	}
+
+	if e.Code != "" && (e.Status == 0 || e.Message == "") && c.svc != nil {
+		if info, ok := c.svc.lookupErrorCode(e.Code); ok {
+			if e.Status == 0 {
+				e.Status = info.Status
+			}
+			if e.Message == "" {
+				e.Message = info.Message
+			}
+		}
+	}
+	if c.svc != nil && c.svc.GRPCCodeHeader {
+		if e.Code == "" {
+			c.setGRPCCodeHeader(grpcOK)
+		} else {
+			c.setGRPCCodeHeader(GRPCCode(e))
+		}
+	}
+	if e.Status > 0 && !c.res.Wrote && c.svc != nil && c.svc.MapErrorStatus {
+		c.res.WriteHeader(e.Status)
+	}
+	if e.Code != "" && c.svc != nil {
+		if msg, ok := c.svc.localizeError(c, e); ok {
+			e.Message = msg
+		}
+	}
+	if e.RetryAfter > 0 && !c.res.Wrote && c.res.Header().Get("Retry-After") == "" {
+		seconds := int64(math.Ceil(e.RetryAfter.Seconds()))
+		c.res.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	if e.Retriable && (c.svc == nil || !c.svc.RenderRetriable) {
+		e.Retriable = false
+	}
+	if e.cause != nil && c.svc != nil && c.svc.DebugErrors {
+		e.Debug = e.cause.Error()
+	}
+	if e.Code != "" {
+		c.res.max = 0 // The error response is not limited.
 	}
 
 	if c.Render != nil {
-		return c.Render(c, Response{RequestID: c.RequestID, Error: e, Data: data})
+		return c.Render(c, Response{RequestID: c.GetRequestID(), Error: e, Data: data})
 	}
 
-	type Resp struct {
-		RequestID string      `json:"RequestId,omitempty"`
-		Error     error       `json:",omitempty"`
-		Data      interface{} `json:",omitempty"`
+	if e.Code == "" && data == nil && canSpliceJSON(c.GetRequestID()) {
+		return c.respondEmpty()
+	}
+
+	c.envelope = jsonResponse{RequestID: c.GetRequestID(), Data: data}
+	if e.Code != "" {
+		c.enverr = e
+		c.envelope.Error = &c.enverr
+	}
+	err = c.JSON(&c.envelope)
+	c.envelope, c.enverr = jsonResponse{}, Error{}
+	if err == ErrResponseTooLarge && !c.res.Wrote {
+		c.responded, c.resperr = false, false // Allow to respond the error.
 	}
+	return err
+}
 
-	if e.Code == "" {
-		return c.JSON(Resp{RequestID: c.RequestID, Data: data})
+// respondEmpty is the same as c.JSON(jsonResponse{RequestID: c.RequestID}),
+// but splices the request id into the precomputed body without encoding.
+func (c *Context) respondEmpty() (err error) {
+	buf := c.AcquireBuffer()
+	if c.RequestID == "" {
+		buf.WriteString(emptyResponse)
+	} else {
+		buf.WriteString(emptyResponsePrefix)
+		writeJSONString(buf, c.RequestID)
+		buf.WriteString(emptyResponseSuffix)
 	}
-	return c.JSON(Resp{RequestID: c.RequestID, Error: e, Data: data})
+
+	setContentType(c.res.Header(), MIMEApplicationJSONCharsetUTF8)
+	c.res.writeHeader(http.StatusOK)
+	err = c.copyBody(buf)
+	c.ReleaseBuffer(buf)
+	return
 }
 
 // Success is equal to c.Respond("", data, nil).
@@ -260,6 +684,51 @@ func (c *Context) Query() url.Values {
 	return c.query
 }
 
+// BodyBytes reads and returns the whole body of the request, which is
+// buffered so that it can be read again later, such as by Bind.
+func (c *Context) BodyBytes() (body []byte, err error) {
+	if !c.bodyb {
+		if c.req.Body != nil {
+			if c.body, err = ioutil.ReadAll(c.req.Body); err != nil {
+				return
+			}
+			c.req.Body.Close()
+		}
+		c.bodyb = true
+	}
+
+	if c.req.Body != nil {
+		c.req.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	}
+	return c.body, nil
+}
+
+// GetVersion returns the version of the request, which is extracted
+// on the first call if Service.LazyVersion is enabled.
+func (c *Context) GetVersion() string {
+	if c.lazy&lazyVersion != 0 {
+		c.lazy &^= lazyVersion
+		if c.Version == "" {
+			c.Version, _ = c.svc.extractVersion(c)
+		}
+	}
+	return c.Version
+}
+
+// GetRequestID returns the request id, which is extracted or generated
+// on the first call if Service.LazyRequestID is enabled.
+func (c *Context) GetRequestID() string {
+	if c.lazy&lazyRequestID != 0 {
+		c.lazy &^= lazyRequestID
+		if c.RequestID == "" {
+			if c.RequestID, _ = c.svc.extractRequestID(c); c.RequestID == "" {
+				c.RequestID = c.svc.newRequestID()
+			}
+		}
+	}
+	return c.RequestID
+}
+
 // GetQuery is equal to c.Query().Get(key).
 func (c *Context) GetQuery(key string) string { return c.Query().Get(key) }
 
@@ -275,7 +744,34 @@ func (c *Context) SetRespHeader(key, value string) {
 	}
 }
 
+// AddRespHeader is equal to c.ResponseWriter().Header().Add(key, value).
+func (c *Context) AddRespHeader(key, value string) { c.res.Header().Add(key, value) }
+
+// DelRespHeader is equal to c.ResponseWriter().Header().Del(key).
+func (c *Context) DelRespHeader(key string) { c.res.Header().Del(key) }
+
+// SentHeaders returns the snapshot of the response headers when the header
+// is written, which is immutable and not affected by the later changes.
+//
+// The snapshot is only taken if Service.SnapshotSentHeaders is true
+// or SentHeaders has been called before the header is written,
+// such as in the middleware. Or, it returns nil.
+func (c *Context) SentHeaders() http.Header {
+	if !c.res.Wrote {
+		c.res.snapshot = true
+	}
+	return c.res.sent
+}
+
 // Bind is used to bind the request to v, set the default and validate the data.
+// Between binding and setting the default, the struct tag "mod" is applied
+// by ModifyStruct, which returns ErrServerError for the unknown modifier.
+//
+// If the body exceeds the limit of http.MaxBytesReader, it returns
+// ErrRequestEntityTooLarge. If the error is not Error, it is converted
+// into ErrInvalidParameter, whose details are populated from the error
+// implementing the interface { ErrorDetails() []ErrorDetail } or joining
+// the errors by Unwrap() []error.
 func (c *Context) Bind(v interface{}) (err error) {
 	if c.Binder != nil {
 		err = c.Binder(c, v)
@@ -294,6 +790,10 @@ func (c *Context) Bind(v interface{}) (err error) {
 	}
 
 	if err == nil {
+		if merr := modifyValue(v); merr != nil {
+			return ErrServerError.WithCauses(merr)
+		}
+
 		if c.SetDefault != nil {
 			err = c.SetDefault(v)
 		}
@@ -307,12 +807,27 @@ func (c *Context) Bind(v interface{}) (err error) {
 	case nil:
 	case Error:
 	default:
-		err = ErrInvalidParameter.WithMessage(err.Error())
+		// http.MaxBytesError is only available since Go 1.19.
+		if err.Error() == "http: request body too large" {
+			return ErrRequestEntityTooLarge.WithCause(err)
+		}
+
+		e := ErrInvalidParameter.WithMessage(err.Error()).WithCause(err)
+		if details := errorDetails(err); len(details) > 0 {
+			e.Details = details
+		}
+		err = e
 	}
 
 	return
 }
 
+// Principal returns the principal of the authenticated request.
+func (c *Context) Principal() interface{} { return c.principal }
+
+// SetPrincipal sets the principal of the authenticated request.
+func (c *Context) SetPrincipal(principal interface{}) { c.principal = principal }
+
 // IsWebSocket reports whether HTTP connection is WebSocket or not.
 func (c *Context) IsWebSocket() bool {
 	if c.req.Method == "GET" &&
@@ -323,6 +838,34 @@ func (c *Context) IsWebSocket() bool {
 	return false
 }
 
+// ClientIP returns the ip of the client, which is extracted from
+// the header "X-Forwarded-For" or "X-Real-Ip" firstly, then RemoteAddr.
+func (c *Context) ClientIP() string {
+	if xff := c.req.Header.Get("X-Forwarded-For"); xff != "" {
+		if index := strings.IndexByte(xff, ','); index > 0 {
+			xff = xff[:index]
+		}
+		if xff = strings.TrimSpace(xff); xff != "" {
+			return xff
+		}
+	}
+
+	if xrip := strings.TrimSpace(c.req.Header.Get("X-Real-Ip")); xrip != "" {
+		return xrip
+	}
+
+	return remoteIP(c.req.RemoteAddr)
+}
+
+// remoteIP returns the host of the remote address, or itself if no port.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
 // ContentLength return the length of the request body.
 func (c *Context) ContentLength() int64 { return c.req.ContentLength }
 
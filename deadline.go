@@ -0,0 +1,91 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultDeadlineHeader is the default request header carrying
+// the remaining budget of the caller in milliseconds.
+const DefaultDeadlineHeader = "X-Timeout-Ms"
+
+// RemainingBudget returns the remaining duration until the deadline
+// of the request context, which returns 0 if the deadline has passed,
+// or -1 if there is no deadline.
+func (c *Context) RemainingBudget() time.Duration {
+	deadline, ok := c.req.Context().Deadline()
+	if !ok {
+		return -1
+	} else if budget := time.Until(deadline); budget > 0 {
+		return budget
+	}
+	return 0
+}
+
+// deadlineTimeout returns the timeout from the deadline header
+// of the request, which is clamped to Service.MaxPropagatedTimeout.
+func (s *Service) deadlineTimeout(c *Context) (timeout time.Duration, ok bool) {
+	header := s.DeadlineHeader
+	if header == "" {
+		header = DefaultDeadlineHeader
+	}
+
+	value := c.req.Header.Get(header)
+	if value == "" {
+		return
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return
+	}
+
+	if maxms := int64(math.MaxInt64 / time.Millisecond); ms > maxms {
+		ms = maxms
+	}
+
+	timeout = time.Duration(ms) * time.Millisecond
+	if s.MaxPropagatedTimeout > 0 && timeout > s.MaxPropagatedTimeout {
+		timeout = s.MaxPropagatedTimeout
+	}
+	return timeout, true
+}
+
+func (s *Service) handleWithDeadline(c *Context, handler Handler) error {
+	timeout, ok := s.deadlineTimeout(c)
+	if !ok {
+		return handler(c)
+	} else if timeout <= 0 {
+		return ErrGatewayTimeout.WithMessage("the deadline of the caller has passed")
+	}
+	return c.runTimeout(timeout, handler)
+}
+
+// setDeadlineHeader sets the deadline header to the remaining budget
+// of the context in milliseconds if it has the deadline.
+func setDeadlineHeader(ctx context.Context, header http.Header, name string) {
+	if deadline, ok := ctx.Deadline(); ok && name != "" {
+		ms := int64(time.Until(deadline) / time.Millisecond)
+		if ms < 0 {
+			ms = 0
+		}
+		header.Set(name, strconv.FormatInt(ms, 10))
+	}
+}
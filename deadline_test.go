@@ -0,0 +1,109 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServicePropagateDeadline(t *testing.T) {
+	budgets := make(chan time.Duration, 1)
+	svc := NewService()
+	svc.PropagateDeadline = true
+	svc.MaxPropagatedTimeout = time.Second
+	svc.Register("Action", func(c *Context) error {
+		budgets <- c.RemainingBudget()
+		if c.Query().Get("Slow") != "" {
+			<-c.Request().Context().Done()
+			time.Sleep(time.Millisecond * 10)
+			return c.Success("slow")
+		}
+		return c.Success("fast")
+	})
+
+	call := func(query, timeout string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action=Action"+query, nil)
+		if timeout != "" {
+			req.Header.Set(DefaultDeadlineHeader, timeout)
+		}
+		svc.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call("", ""); !strings.Contains(body, `"Data":"fast"`) {
+		t.Errorf("unexpected response: %s", body)
+	} else if budget := <-budgets; budget != -1 {
+		t.Errorf("expect no budget, but got %s", budget)
+	}
+
+	if body := call("", "500"); !strings.Contains(body, `"Data":"fast"`) {
+		t.Errorf("unexpected response: %s", body)
+	} else if budget := <-budgets; budget <= 0 || budget > time.Millisecond*500 {
+		t.Errorf("unexpected budget %s", budget)
+	}
+
+	// Clamp to MaxPropagatedTimeout.
+	call("", "60000")
+	if budget := <-budgets; budget <= time.Millisecond*500 || budget > time.Second {
+		t.Errorf("unexpected budget %s", budget)
+	}
+
+	if body := call("&Slow=1", "20"); !strings.Contains(body, ErrGatewayTimeout.Code) ||
+		strings.Contains(body, "slow") {
+		t.Errorf("unexpected response: %s", body)
+	}
+	<-budgets
+
+	if body := call("", "0"); !strings.Contains(body, ErrGatewayTimeout.Code) {
+		t.Errorf("unexpected response: %s", body)
+	}
+	select {
+	case <-budgets:
+		t.Errorf("the handler should not be called after the deadline")
+	default:
+	}
+}
+
+func TestClientDeadlineHeader(t *testing.T) {
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error {
+		return c.Success(c.GetReqHeader(DefaultDeadlineHeader))
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	var timeout string
+	if err := client.Invoke(context.Background(), "Action", "", nil, &timeout); err != nil {
+		t.Fatal(err)
+	} else if timeout != "" {
+		t.Errorf("unexpected the deadline header '%s'", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := client.Invoke(ctx, "Action", "", nil, &timeout); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(timeout, "9") || len(timeout) != 4 {
+		t.Errorf("unexpected the deadline header '%s'", timeout)
+	}
+}
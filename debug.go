@@ -0,0 +1,72 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// EnableDebug registers the debug services with the name prefix,
+// such as "debug", which wrap the handlers of net/http/pprof and expvar
+// by HTTPHandler and must be guarded by mws, such as the authentication
+// and the IP filter. The registered services are
+//
+//	<prefix>.pprof.profile      // CPU profile, such as "?seconds=30"
+//	<prefix>.pprof.trace        // Execution trace, such as "?seconds=5"
+//	<prefix>.pprof.cmdline
+//	<prefix>.pprof.symbol
+//	<prefix>.pprof.heap
+//	<prefix>.pprof.allocs
+//	<prefix>.pprof.goroutine    // Such as "?debug=2"
+//	<prefix>.pprof.block
+//	<prefix>.pprof.mutex
+//	<prefix>.pprof.threadcreate
+//	<prefix>.expvar
+//
+// and the query parameters are passed to the handlers unchanged.
+//
+// It panics if no middlewares are given. Use EnableInsecureDebug instead
+// to register them without any guard.
+//
+// Notice: importing net/http/pprof and expvar also registers their handlers
+// into http.DefaultServeMux, which should not be exposed if used.
+func (s *Service) EnableDebug(prefix string, mws ...Middleware) {
+	if len(mws) == 0 {
+		panic("Service.EnableDebug: the debug services must be guarded by middlewares")
+	}
+	s.enableDebug(prefix, mws)
+}
+
+// EnableInsecureDebug is the same as EnableDebug, but registers the debug
+// services without any guard, which should be used only in development.
+func (s *Service) EnableInsecureDebug(prefix string) { s.enableDebug(prefix, nil) }
+
+func (s *Service) enableDebug(prefix string, mws []Middleware) {
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	s.RegisterHTTP(prefix+"pprof.profile", http.HandlerFunc(pprof.Profile), mws...)
+	s.RegisterHTTP(prefix+"pprof.trace", http.HandlerFunc(pprof.Trace), mws...)
+	s.RegisterHTTP(prefix+"pprof.cmdline", http.HandlerFunc(pprof.Cmdline), mws...)
+	s.RegisterHTTP(prefix+"pprof.symbol", http.HandlerFunc(pprof.Symbol), mws...)
+	for _, name := range []string{"heap", "allocs", "goroutine", "block", "mutex", "threadcreate"} {
+		s.RegisterHTTP(prefix+"pprof."+name, pprof.Handler(name), mws...)
+	}
+	s.RegisterHTTP(prefix+"expvar", expvar.Handler(), mws...)
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnableDebug(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expect a panic without the guards")
+			}
+		}()
+		NewService().EnableDebug("debug")
+	}()
+
+	var guarded int
+	svc := NewService()
+	svc.EnableDebug("debug", func(next Handler) Handler {
+		return func(c *Context) error { guarded++; return next(c) }
+	})
+
+	call := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec
+	}
+
+	rec := call("Action=debug.pprof.goroutine&debug=2")
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "goroutine ") {
+		t.Errorf("unexpected goroutine profile: %d, %.100s", rec.Code, rec.Body.String())
+	}
+	if rec = call("Action=debug.expvar"); !strings.Contains(rec.Body.String(), `"memstats"`) {
+		t.Errorf("unexpected expvar: %.100s", rec.Body.String())
+	}
+	if guarded != 2 {
+		t.Errorf("expect 2 guarded calls, but got %d", guarded)
+	}
+
+	svc = NewService()
+	svc.EnableInsecureDebug("")
+	if _, ok := svc.ActionInfo("pprof.heap"); !ok {
+		t.Errorf("missing the service 'pprof.heap'")
+	}
+}
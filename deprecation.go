@@ -0,0 +1,59 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type deprecation struct {
+	calls   uint64 // Must be first to be 64-bit aligned by the atomic.
+	message string
+	sunset  time.Time
+	warning string
+}
+
+// Deprecated returns an action option to mark the service as deprecated,
+// which sets the response headers "Deprecation: true", "Sunset" if sunset
+// is not ZERO, and "Warning: 299 - MESSAGE" if message is not empty.
+//
+// The number of the calls is counted, which can be acquired by Service.Stats.
+func Deprecated(message string, sunset time.Time) ActionOption {
+	d := &deprecation{message: message, sunset: sunset}
+	if message != "" {
+		d.warning = "299 - " + strconv.Quote(message)
+	}
+	return func(a *action) { a.deprecation = d }
+}
+
+func (s *Service) handleDeprecation(c *Context, d *deprecation) {
+	atomic.AddUint64(&d.calls, 1)
+
+	header := c.res.Header()
+	header.Set("Deprecation", "true")
+	if !d.sunset.IsZero() {
+		header.Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.warning != "" {
+		header.Set("Warning", d.warning)
+	}
+
+	if s.OnDeprecatedCall != nil {
+		s.OnDeprecatedCall(c, d.message)
+	}
+}
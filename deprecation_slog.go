@@ -0,0 +1,37 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import "log/slog"
+
+// LogDeprecatedCall returns a function used by Service.OnDeprecatedCall
+// to log the call of the deprecated service at the warn level.
+func LogDeprecatedCall(logger *slog.Logger) func(*Context, string) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(c *Context, message string) {
+		logger.LogAttrs(c.req.Context(), slog.LevelWarn, "call the deprecated action",
+			slog.String("action", c.Action),
+			slog.String("requestid", c.GetRequestID()),
+			slog.String("clientip", c.ClientIP()),
+			slog.String("msg", message),
+		)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	var messages []string
+	sunset := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	svc := NewService()
+	svc.OnDeprecatedCall = func(c *Context, msg string) { messages = append(messages, msg) }
+	svc.RegisterWithOptions("old", func(c *Context) error { return c.Success(nil) },
+		Deprecated("use new instead", sunset))
+	svc.Register("new", func(c *Context) error { return c.Success(nil) })
+	svc.Mapping("older", "old")
+
+	for _, action := range []string{"old", "older", "new"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		svc.ServeHTTP(rec, req)
+
+		if action == "new" {
+			if v := rec.Header().Get("Deprecation"); v != "" {
+				t.Errorf("unexpected the header Deprecation '%s'", v)
+			}
+			continue
+		}
+
+		if v := rec.Header().Get("Deprecation"); v != "true" {
+			t.Errorf("expect the header Deprecation 'true', but got '%s'", v)
+		}
+		if v := rec.Header().Get("Sunset"); v != "Wed, 02 Jan 2030 03:04:05 GMT" {
+			t.Errorf("unexpected the header Sunset '%s'", v)
+		}
+		if v := rec.Header().Get("Warning"); v != `299 - "use new instead"` {
+			t.Errorf("unexpected the header Warning '%s'", v)
+		}
+	}
+
+	if len(messages) != 2 {
+		t.Errorf("expect %d deprecated calls, but got %d", 2, len(messages))
+	}
+
+	if stats := svc.Stats(); stats["old"].DeprecatedCalls != 2 {
+		t.Errorf("expect %d deprecated calls, but got %d", 2, stats["old"].DeprecatedCalls)
+	}
+
+	infos := svc.DescribeServices("old")
+	if len(infos) != 1 || infos[0].Deprecation == nil ||
+		infos[0].Deprecation.Message != "use new instead" ||
+		!infos[0].Deprecation.Sunset.Equal(sunset) {
+		t.Errorf("unexpected services: %+v", infos)
+	}
+}
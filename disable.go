@@ -0,0 +1,111 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// DisabledInfo is the information of the disabled service.
+type DisabledInfo struct {
+	Reason     string        `json:",omitempty" xml:",omitempty"`
+	RetryAfter time.Duration `json:",omitempty" xml:",omitempty"`
+}
+
+func (a *action) disabledInfo() *DisabledInfo {
+	info, _ := a.disabled.Load().(*DisabledInfo)
+	return info
+}
+
+// DisableAction disables the service named name, which may be an alias
+// by Mapping, so that the later calls to it return ErrServiceUnavailable
+// with the reason, and the header "Retry-After" if retryAfter is given.
+// But the service is not unregistered, and may be restored by EnableAction.
+//
+// Return false if the service does not exist.
+func (s *Service) DisableAction(name, reason string, retryAfter ...time.Duration) bool {
+	a, ok := s.getAction(name)
+	if ok {
+		info := &DisabledInfo{Reason: reason}
+		if len(retryAfter) > 0 {
+			info.RetryAfter = retryAfter[0]
+		}
+		a.disabled.Store(info)
+	}
+	return ok
+}
+
+// EnableAction restores the service disabled by DisableAction.
+//
+// Return false if the service does not exist.
+func (s *Service) EnableAction(name string) bool {
+	a, ok := s.getAction(name)
+	if ok {
+		a.disabled.Store((*DisabledInfo)(nil))
+	}
+	return ok
+}
+
+func (s *Service) handleDisabled(c *Context, info *DisabledInfo) error {
+	if info.RetryAfter > 0 {
+		seconds := int64(math.Ceil(info.RetryAfter.Seconds()))
+		c.SetRespHeader("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	if info.Reason == "" {
+		return ErrServiceUnavailable.WithMessage("service '%s' is disabled", c.Action)
+	}
+	return ErrServiceUnavailable.WithMessage("service '%s' is disabled: %s", c.Action, info.Reason)
+}
+
+// EnableActionStatus registers a service named name, such as "SetActionStatus",
+// to disable or enable the service by the parameters "Name", "Enabled",
+// "Reason" and "RetryAfter" in seconds, which must be guarded by mws,
+// such as the authentication and authorization.
+//
+// It panics if no middlewares are given.
+func (s *Service) EnableActionStatus(name string, mws ...Middleware) {
+	if len(mws) == 0 {
+		panic("Service.EnableActionStatus: the service must be guarded by middlewares")
+	}
+
+	s.RegisterWithOptions(name, func(c *Context) (err error) {
+		var req struct {
+			Name       string `json:"Name" query:"Name"`
+			Enabled    bool   `json:"Enabled" query:"Enabled"`
+			Reason     string `json:"Reason" query:"Reason"`
+			RetryAfter int    `json:"RetryAfter" query:"RetryAfter"`
+		}
+		if err = c.Bind(&req); err != nil {
+			return
+		} else if req.Name == "" {
+			return ErrInvalidParameter.WithMessage("missing Name")
+		}
+
+		var ok bool
+		if req.Enabled {
+			ok = s.EnableAction(req.Name)
+		} else {
+			ok = s.DisableAction(req.Name, req.Reason, time.Duration(req.RetryAfter)*time.Second)
+		}
+		if !ok {
+			return ErrResourceNotFound.WithMessage("no service '%s'", req.Name)
+		}
+		return c.Success(nil)
+	}, WithMiddlewares(mws...),
+		WithDescription("Disable or enable the service"))
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisableAction(t *testing.T) {
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error { return c.Success("ok") })
+	svc.Mapping("Alias", "Action")
+
+	call := func(action string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action="+action, nil))
+		return rec
+	}
+
+	if svc.DisableAction("Missing", "") {
+		t.Errorf("expect false for the missing service")
+	}
+	if !svc.DisableAction("Alias", "upgrading", time.Second*30) {
+		t.Fatal("fail to disable the service")
+	}
+
+	rec := call("Action")
+	if !strings.Contains(rec.Body.String(), ErrServiceUnavailable.Code) ||
+		!strings.Contains(rec.Body.String(), "upgrading") {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	} else if retry := rec.Header().Get("Retry-After"); retry != "30" {
+		t.Errorf("expect Retry-After '30', but got '%s'", retry)
+	}
+
+	if info, _ := svc.ActionInfo("Action"); info.Disabled == nil || info.Disabled.Reason != "upgrading" {
+		t.Errorf("unexpected disabled info: %+v", info.Disabled)
+	}
+	if stats := svc.Stats()["Action"]; !stats.Disabled || stats.Calls != 1 || stats.ErrorCount != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	svc.EnableAction("Action")
+	if rec = call("Action"); !strings.Contains(rec.Body.String(), `"Data":"ok"`) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+	if svc.Stats()["Action"].Disabled {
+		t.Errorf("the service is still disabled")
+	}
+}
+
+func TestEnableActionStatus(t *testing.T) {
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error { return c.Success("ok") })
+	svc.EnableActionStatus("SetActionStatus", func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.Query().Get("Token") != "admin" {
+				return ErrUnauthorized
+			}
+			return next(c)
+		}
+	})
+
+	call := func(query string) string {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec.Body.String()
+	}
+
+	if body := call("Action=SetActionStatus&Name=Action"); !strings.Contains(body, ErrUnauthorized.Code) {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if body := call("Action=SetActionStatus&Token=admin&Name=Action&Reason=test"); strings.Contains(body, "Error") {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if body := call("Action=Action"); !strings.Contains(body, "test") {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if body := call("Action=SetActionStatus&Token=admin&Name=Action&Enabled=true"); strings.Contains(body, "Error") {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if body := call("Action=Action"); !strings.Contains(body, `"Data":"ok"`) {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expect a panic without the guards")
+		}
+	}()
+	svc.EnableActionStatus("SetActionStatus2")
+}
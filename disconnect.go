@@ -0,0 +1,54 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import "context"
+
+// StatusClientClosedRequest is the non-standard status code reported
+// to the statistics, the observer and the access log instead of the written
+// one when the client has gone away, so that it is not taken as the server
+// error.
+const StatusClientClosedRequest = 499
+
+// WriteError returns the first error returned by writing the response body,
+// which is nil if no error occurs.
+func (c *Context) WriteError() error { return c.res.Err }
+
+// ClientGone reports whether the client has gone away, that's, either
+// writing the response body failed or the request context is canceled,
+// so the handler may stop the expensive work early.
+//
+// Notice: the request context exceeding the deadline, such as by the Timeout
+// middleware, is not taken as that the client has gone away.
+func (c *Context) ClientGone() bool {
+	if c.res.Err != nil {
+		return true
+	}
+
+	select {
+	case <-c.req.Context().Done():
+		return c.req.Context().Err() == context.Canceled
+	default:
+		return false
+	}
+}
+
+// observedStatus returns the status code reported to the statistics.
+func (c *Context) observedStatus() int {
+	if c.ClientGone() {
+		return StatusClientClosedRequest
+	}
+	return c.res.Status
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBrokenPipe = errors.New("broken pipe")
+
+type brokenResponseWriter struct{ *httptest.ResponseRecorder }
+
+func (w brokenResponseWriter) Write(p []byte) (int, error) { return 0, errBrokenPipe }
+
+func TestContextClientGone(t *testing.T) {
+	svc := NewService()
+
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), brokenResponseWriter{httptest.NewRecorder()})
+	if c.ClientGone() {
+		t.Error("unexpected the client has gone away")
+	}
+	if _, err := c.Write([]byte("abc")); err != errBrokenPipe {
+		t.Errorf("expect the error '%v', but got '%v'", errBrokenPipe, err)
+	}
+	if err := c.WriteError(); err != errBrokenPipe {
+		t.Errorf("expect the write error '%v', but got '%v'", errBrokenPipe, err)
+	} else if !c.ClientGone() {
+		t.Error("expect the client has gone away")
+	} else if status := c.observedStatus(); status != StatusClientClosedRequest {
+		t.Errorf("expect the status code %d, but got %d", StatusClientClosedRequest, status)
+	}
+
+	err := c.Stream(200, "text/plain", strings.NewReader("abc"))
+	if e, ok := err.(Error); !ok || e.Code != ErrClientClosedRequest.Code {
+		t.Errorf("expect the error ErrClientClosedRequest, but got '%v'", err)
+	}
+	svc.ReleaseContext(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	c = svc.AcquireContext(req, httptest.NewRecorder())
+	if c.ClientGone() {
+		t.Error("unexpected the client has gone away when the deadline exceeds")
+	}
+	svc.ReleaseContext(c)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	c = svc.AcquireContext(req.WithContext(ctx), httptest.NewRecorder())
+	if !c.ClientGone() {
+		t.Error("expect the client has gone away when the context is canceled")
+	}
+	svc.ReleaseContext(c)
+}
+
+func TestServiceClientGone(t *testing.T) {
+	statuses := make(chan int, 1)
+	svc := NewService()
+	svc.Observer = ObserverFunc(func(action, version string, status int,
+		latency time.Duration, respSize int64) {
+		statuses <- status
+	})
+	svc.Register("Action", func(c *Context) error {
+		return c.Stream(200, "text/plain", strings.NewReader("abc"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/?Action=Action", nil).WithContext(ctx)
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	if status := <-statuses; status != StatusClientClosedRequest {
+		t.Errorf("expect the status code %d, but got %d", StatusClientClosedRequest, status)
+	}
+
+	stats := svc.Stats()["Action"]
+	if code := ErrClientClosedRequest.Code; stats.Errors[code] != 1 {
+		t.Errorf("expect one error '%s', but got %v", code, stats.Errors)
+	}
+}
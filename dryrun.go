@@ -0,0 +1,85 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrDryRunOperation is returned by RejectDryRun when the dry-run request
+// would have succeeded, which is responded with the status code 200.
+var ErrDryRunOperation = NewError("DryRunOperation",
+	"request would have succeeded, but the DryRun flag is set").WithStatus(http.StatusOK)
+
+// WithDryRunHandler returns an action option to set the handler called
+// instead of the registered one for the dry-run request, which should only
+// validate the request without executing it.
+func WithDryRunHandler(handler Handler) ActionOption {
+	return func(a *action) { a.dryRun = handler }
+}
+
+// DefaultGetDryRun is the default function to decide whether the request
+// is a dry run, which checks the header "X-Dry-Run" and the query "DryRun".
+func DefaultGetDryRun(r *http.Request) bool {
+	if v := r.Header.Get("X-Dry-Run"); v != "" {
+		dryRun, _ := strconv.ParseBool(v)
+		return dryRun
+	}
+
+	if strings.Contains(r.URL.RawQuery, "DryRun") {
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("DryRun"))
+		return dryRun
+	}
+	return false
+}
+
+func (s *Service) isDryRun(r *http.Request) bool {
+	if s.GetDryRun != nil {
+		return s.GetDryRun(r)
+	}
+	return DefaultGetDryRun(r)
+}
+
+// RejectDryRun returns a middleware to reject the dry-run request
+// to the service without the handler set by WithDryRunHandler,
+// which binds and validates the request of the type set by WithRequestType
+// if existing, then returns ErrDryRunOperation if succeeding.
+func RejectDryRun() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			if !c.DryRun {
+				return next(c)
+			}
+
+			a := c.action
+			if a == nil {
+				a, _ = c.svc.getAction(c.Action)
+			}
+			if a == nil || a.dryRun != nil {
+				return next(c)
+			}
+
+			if a.reqType != nil {
+				if err := c.Bind(reflect.New(a.reqType).Interface()); err != nil {
+					return err
+				}
+			}
+			return ErrDryRunOperation
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceDryRun(t *testing.T) {
+	type CreateUserRequest struct{ Name string }
+
+	var executed int
+	svc := NewService()
+	svc.EnableBatch("Batch", 0)
+	svc.RegisterWithOptions("CreateUser", func(c *Context) error {
+		executed++
+		return c.Success("created")
+	}, WithRequestType(CreateUserRequest{}), WithMiddlewares(RejectDryRun()))
+	svc.RegisterWithOptions("DeleteUser", func(c *Context) error {
+		executed++
+		return c.Success("deleted")
+	}, WithDryRunHandler(func(c *Context) error { return c.Success("validated") }),
+		WithMiddlewares(RejectDryRun()))
+
+	call := func(target, dryRun, body string) (resp Response) {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		if dryRun != "" {
+			req.Header.Set("X-Dry-Run", dryRun)
+		}
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call("/?Action=CreateUser", "true", `{"Name":"a"}`); resp.Error.Code != ErrDryRunOperation.Code {
+		t.Errorf("expect the error '%s', but got '%s'", ErrDryRunOperation.Code, resp.Error.Code)
+	}
+	if resp := call("/?Action=CreateUser&DryRun=true", "", `{"Name":`); resp.Error.Code != ErrInvalidParameter.Code {
+		t.Errorf("expect the error '%s', but got '%s'", ErrInvalidParameter.Code, resp.Error.Code)
+	}
+	if resp := call("/?Action=DeleteUser&DryRun=1", "", ``); resp.Data != "validated" {
+		t.Errorf("expect the dry-run handler, but got %v", resp.Data)
+	}
+	if executed != 0 {
+		t.Errorf("unexpected the executed handlers: %d", executed)
+	}
+
+	if resp := call("/?Action=DeleteUser&DryRun=false", "", ``); resp.Data != "deleted" {
+		t.Errorf("expect the handler, but got %v", resp.Data)
+	}
+
+	var results struct{ Data []Response }
+	req := httptest.NewRequest(http.MethodPost, "/?Action=Batch&DryRun=true",
+		strings.NewReader(`[{"Action":"DeleteUser"},{"Action":"CreateUser","Payload":{"Name":"a"}}]`))
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	} else if len(results.Data) != 2 {
+		t.Fatalf("unexpected the batch response: %s", rec.Body.String())
+	} else if results.Data[0].Data != "validated" || results.Data[1].Error.Code != ErrDryRunOperation.Code {
+		t.Errorf("unexpected the batch response: %s", rec.Body.String())
+	}
+	if executed != 1 {
+		t.Errorf("unexpected the executed handlers: %d", executed)
+	}
+}
@@ -16,32 +16,59 @@ package httpsvc
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // Predefine some errors.
 var (
-	ErrInvalidAction        = NewError("InvalidAction", "invalid action")
-	ErrInvalidVersion       = NewError("InvalidVersion", "invalid version")
-	ErrInvalidParameter     = NewError("InvalidParams", "invalid parameter")
-	ErrUnsupportedProtocol  = NewError("UnsupportedProtocol", "protocol is unsupported")
-	ErrUnsupportedOperation = NewError("UnsupportedOperation", "operation is unsupported")
-
-	ErrAuthFailureTokenFailure     = NewError("AuthFailure.TokenFailure", "token verification failed")
-	ErrAuthFailureSignatureFailure = NewError("AuthFailure.SignatureFailure", "signature verification failed")
-	ErrAuthFailureSignatureExpire  = NewError("AuthFailure.SignatureExpire", "signature is expired")
-	ErrUnauthorizedOperation       = NewError("UnauthorizedOperation", "operation is unauthorized")
-
-	ErrFailedOperation = NewError("FailedOperation", "operation failed")
-	ErrServerError     = NewError("ServerError", "server error")
-
-	ErrQuotaLimitExceeded   = NewError("QuotaLimitExceeded", "exceed the quota limit")
-	ErrRequestLimitExceeded = NewError("RequestLimitExceeded", "exceed the request limit")
-
-	ErrResourceInUse        = NewError("ResourceInUse", "resource is in use")
-	ErrResourceNotFound     = NewError("ResourceNotFound", "resource is not found")
-	ErrResourceUnavailable  = NewError("ResourceUnavailable", "resource is unavailable")
-	ErrResourceInsufficient = NewError("ResourceInsufficient", "resource is insufficient")
+	ErrInvalidAction        = NewError("InvalidAction", "invalid action").WithStatus(http.StatusNotFound)
+	ErrInvalidVersion       = NewError("InvalidVersion", "invalid version").WithStatus(http.StatusBadRequest)
+	ErrInvalidParameter     = NewError("InvalidParams", "invalid parameter").WithStatus(http.StatusBadRequest)
+	ErrUnsupportedProtocol  = NewError("UnsupportedProtocol", "protocol is unsupported").WithStatus(http.StatusUnsupportedMediaType)
+	ErrUnsupportedOperation = NewError("UnsupportedOperation", "operation is unsupported").WithStatus(http.StatusBadRequest)
+	ErrUnsupportedMediaType = NewError("UnsupportedMediaType", "media type is unsupported").WithStatus(http.StatusUnsupportedMediaType)
+	ErrMethodNotAllowed     = NewError("MethodNotAllowed", "method is not allowed").WithStatus(http.StatusMethodNotAllowed)
+
+	ErrRequestEntityTooLarge = NewError("RequestEntityTooLarge", "request entity is too large").WithStatus(http.StatusRequestEntityTooLarge)
+
+	ErrAuthFailureTokenFailure       = NewError("AuthFailure.TokenFailure", "token verification failed").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureSignatureFailure   = NewError("AuthFailure.SignatureFailure", "signature verification failed").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureSignatureExpire    = NewError("AuthFailure.SignatureExpire", "signature is expired").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureTokenExpired       = NewError("AuthFailure.TokenExpired", "token is expired").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureTokenNotYetValid   = NewError("AuthFailure.TokenNotYetValid", "token is not valid yet").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureTokenInvalidClaims = NewError("AuthFailure.TokenInvalidClaims", "token claims are invalid").WithStatus(http.StatusUnauthorized)
+	ErrAuthFailureNonceUsed          = NewError("AuthFailure.NonceUsed", "nonce has been used").WithStatus(http.StatusUnauthorized)
+	ErrUnauthorizedOperation         = NewError("UnauthorizedOperation", "operation is unauthorized").WithStatus(http.StatusForbidden)
+	ErrUnauthorized                  = NewError("Unauthorized", "unauthorized").WithStatus(http.StatusUnauthorized)
+	ErrForbidden                     = NewError("Forbidden", "forbidden").WithStatus(http.StatusForbidden)
+	ErrSignatureDoesNotMatch         = NewError("SignatureDoesNotMatch", "signature does not match").WithStatus(http.StatusUnauthorized)
+	ErrMissingTenant                 = NewError("MissingTenant", "missing tenant").WithStatus(http.StatusBadRequest)
+
+	ErrFailedOperation = NewError("FailedOperation", "operation failed").WithStatus(http.StatusInternalServerError)
+	ErrServerError     = NewError("ServerError", "server error").WithStatus(http.StatusInternalServerError)
+	ErrGatewayTimeout  = NewError("GatewayTimeout", "gateway timeout").WithStatus(http.StatusGatewayTimeout).WithRetriable(true)
+
+	ErrClientClosedRequest = NewError("ClientClosedRequest", "client closed request").WithStatus(StatusClientClosedRequest)
+
+	ErrServiceUnavailable = NewError("ServiceUnavailable", "service is unavailable").WithStatus(http.StatusServiceUnavailable).WithRetriable(true)
+
+	ErrQuotaLimitExceeded   = NewError("QuotaLimitExceeded", "exceed the quota limit").WithStatus(http.StatusTooManyRequests)
+	ErrQuotaExceeded        = NewError("QuotaExceeded", "exceed the quota").WithStatus(http.StatusTooManyRequests)
+	ErrRequestLimitExceeded = NewError("RequestLimitExceeded", "exceed the request limit").WithStatus(http.StatusTooManyRequests).WithRetriable(true)
+	ErrTooManyRequests      = NewError("TooManyRequests", "too many requests").WithStatus(http.StatusTooManyRequests).WithRetriable(true)
+	ErrThrottling           = NewError("Throttling", "request is throttled").WithStatus(http.StatusTooManyRequests).WithRetriable(true)
+
+	ErrConflict           = NewError("Conflict", "request conflicts").WithStatus(http.StatusConflict)
+	ErrPreconditionFailed = NewError("PreconditionFailed", "precondition failed").WithStatus(http.StatusPreconditionFailed)
+
+	ErrNotFound             = NewError("NotFound", "not found").WithStatus(http.StatusNotFound)
+	ErrResourceInUse        = NewError("ResourceInUse", "resource is in use").WithStatus(http.StatusConflict)
+	ErrResourceNotFound     = NewError("ResourceNotFound", "resource is not found").WithStatus(http.StatusNotFound)
+	ErrResourceUnavailable  = NewError("ResourceUnavailable", "resource is unavailable").WithStatus(http.StatusServiceUnavailable).WithRetriable(true)
+	ErrResourceInsufficient = NewError("ResourceInsufficient", "resource is insufficient").WithStatus(http.StatusServiceUnavailable)
 )
 
 // Error represents an error.
@@ -50,16 +77,63 @@ type Error struct {
 	Message   string  `json:",omitempty" xml:",omitempty"`
 	Component string  `json:",omitempty" xml:",omitempty"`
 	Causes    []error `json:",omitempty" xml:",omitempty"`
+
+	// Details is the machine-readable details of the error,
+	// such as which field is invalid.
+	Details []ErrorDetail `json:",omitempty" xml:"Details>Detail,omitempty"`
+
+	// Debug is the message of the cause set by WithCause, which is only
+	// rendered by Respond if Service.DebugErrors is enabled.
+	Debug string `json:",omitempty" xml:",omitempty"`
+
+	// Retriable reports whether the request may be retried, which is only
+	// rendered if Service.RenderRetriable is enabled.
+	Retriable bool `json:",omitempty" xml:",omitempty"`
+
+	// RetryAfter is the duration to wait before retrying, which is responded
+	// as the header "Retry-After" in seconds by Respond if not set.
+	// 0 means no hint.
+	RetryAfter time.Duration `json:"-" xml:"-"`
+
+	// Status is the HTTP status code of the error, which is the metadata
+	// of the transport and not rendered into the response body.
+	// 0 means no status code.
+	Status int `json:"-" xml:"-"`
+
+	cause error
+	stack []uintptr
+}
+
+// ErrorDetail is a machine-readable detail of the error.
+type ErrorDetail struct {
+	Field  string      `json:",omitempty" xml:",omitempty"` // Such as "Name" or "/a/0".
+	Reason string      `json:",omitempty" xml:",omitempty"`
+	Value  interface{} `json:",omitempty" xml:",omitempty"` // Such as the limit.
 }
 
 // NewError returns a new Error.
-func NewError(code, msg string) Error { return Error{Code: code, Message: msg} }
+//
+// If the code has been registered by RegisterError, the registered status
+// code is used, and so is the default message if msg is empty.
+func NewError(code, msg string) Error {
+	e := Error{Code: code, Message: msg}
+	if info, ok := DefaultErrorRegistry.Lookup(code); ok {
+		e.Status = info.Status
+		if msg == "" {
+			e.Message = info.Message
+		}
+	}
+	return e
+}
 
 // Clone clones itself to a new one.
 func (e Error) Clone() Error {
 	ne := e
-	if len(e.Causes) == 0 {
-		ne.Causes = append([]error{}, e.Causes...)
+	if len(e.Causes) > 0 {
+		ne.Causes = append([]error(nil), e.Causes...)
+	}
+	if len(e.Details) > 0 {
+		ne.Details = append([]ErrorDetail(nil), e.Details...)
 	}
 	return ne
 }
@@ -88,6 +162,85 @@ func (e Error) Error() string {
 		e.Component, e.Code, e.Message, causes)
 }
 
+// maxFormatCauseDepth is the maximum depth of the cause chain printed by
+// the format "%+v", which avoids the endless loop of the cyclic causes.
+const maxFormatCauseDepth = 16
+
+// String implements the interface fmt.Stringer, which returns "Code: Message",
+// or "" for the zero value.
+func (e Error) String() string {
+	switch {
+	case e.Code == "":
+		return e.Message
+	case e.Message == "":
+		return e.Code
+	default:
+		return e.Code + ": " + e.Message
+	}
+}
+
+// Format implements the interface fmt.Formatter.
+//
+// The formats "%s" and "%v" print the same as String, and "%+v" prints
+// the code and message, the component, the details, the causes, the cause
+// chain set by WithCause and the captured stack, one section per line.
+func (e Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		io.WriteString(s, e.String())
+		if s.Flag('+') {
+			e.formatDetail(s)
+		}
+	case 's':
+		io.WriteString(s, e.String())
+	case 'q':
+		fmt.Fprintf(s, "%q", e.String())
+	default:
+		fmt.Fprintf(s, "%%!%c(httpsvc.Error=%s)", verb, e.String())
+	}
+}
+
+func (e Error) formatDetail(w io.Writer) {
+	if e.Component != "" {
+		fmt.Fprintf(w, "\ncomponent: %s", e.Component)
+	}
+
+	if len(e.Details) > 0 {
+		io.WriteString(w, "\ndetails:")
+		for i, d := range e.Details {
+			if i > 0 {
+				io.WriteString(w, ";")
+			}
+			if d.Field != "" {
+				fmt.Fprintf(w, " %s:", d.Field)
+			}
+			fmt.Fprintf(w, " %s", d.Reason)
+			if d.Value != nil {
+				fmt.Fprintf(w, " (%v)", d.Value)
+			}
+		}
+	}
+
+	for _, cause := range e.Causes {
+		fmt.Fprintf(w, "\ncauses: %s", cause.Error())
+	}
+
+	cause := e.cause
+	for depth := 0; cause != nil && depth < maxFormatCauseDepth; depth++ {
+		fmt.Fprintf(w, "\ncause: %s", cause.Error())
+		u, ok := cause.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		cause = u.Unwrap()
+	}
+
+	if len(e.stack) > 0 {
+		io.WriteString(w, "\nstack:\n")
+		io.WriteString(w, e.Stack())
+	}
+}
+
 // WithCode clones itself and returns a new Error with the code.
 func (e Error) WithCode(code string) Error {
 	ne := e.Clone()
@@ -95,6 +248,29 @@ func (e Error) WithCode(code string) Error {
 	return ne
 }
 
+// WithStatus clones itself and returns a new Error with the HTTP status code.
+func (e Error) WithStatus(status int) Error {
+	ne := e.Clone()
+	ne.Status = status
+	return ne
+}
+
+// WithRetriable clones itself and returns a new Error with the retriable flag.
+func (e Error) WithRetriable(retriable bool) Error {
+	ne := e.Clone()
+	ne.Retriable = retriable
+	return ne
+}
+
+// WithRetryAfter clones itself and returns a new retriable Error
+// with the duration to wait before retrying.
+func (e Error) WithRetryAfter(d time.Duration) Error {
+	ne := e.Clone()
+	ne.Retriable = true
+	ne.RetryAfter = d
+	return ne
+}
+
 // WithMessage clones itself and returns a new Error with the message.
 func (e Error) WithMessage(msgfmt string, msgargs ...interface{}) Error {
 	ne := e.Clone()
@@ -113,11 +289,61 @@ func (e Error) WithComponent(component string) Error {
 	return ne
 }
 
+// WithCause clones itself and returns a new Error wrapping the cause,
+// which is returned by Unwrap but not rendered into the response body.
+func (e Error) WithCause(cause error) Error {
+	ne := e.Clone()
+	ne.cause = cause
+	return ne.withStack()
+}
+
+// Unwrap returns the cause set by WithCause, which is used by errors.Is
+// and errors.As.
+func (e Error) Unwrap() error { return e.cause }
+
+// Is reports whether target is an Error with the same code, so that
+// errors.Is(err, ErrInvalidParameter) is true whatever the message is.
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Error:
+		return t.Code == e.Code
+	case *Error:
+		return t != nil && t.Code == e.Code
+	default:
+		return false
+	}
+}
+
+// WithDetails clones itself and returns a new Error appending the details.
+func (e Error) WithDetails(details ...ErrorDetail) Error {
+	ne := e.Clone()
+	ne.Details = append(ne.Details, details...)
+	return ne
+}
+
+// errorDetails returns the details of err, which may implement the interface
+// { ErrorDetails() []ErrorDetail }, or join the errors by Unwrap() []error.
+func errorDetails(err error) (details []ErrorDetail) {
+	switch e := err.(type) {
+	case interface{ ErrorDetails() []ErrorDetail }:
+		return e.ErrorDetails()
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			if ds := errorDetails(err); len(ds) > 0 {
+				details = append(details, ds...)
+			} else {
+				details = append(details, ErrorDetail{Reason: err.Error()})
+			}
+		}
+	}
+	return
+}
+
 // WithCauses clones itself and returns a new Error appending the errors.
 func (e Error) WithCauses(errs ...error) Error {
 	ne := e.Clone()
 	ne.Causes = append(ne.Causes, errs...)
-	return ne
+	return ne.withStack()
 }
 
 // AppendCauses appends the error causes into the original causes,
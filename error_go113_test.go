@@ -0,0 +1,66 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.13
+// +build go1.13
+
+package httpsvc
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorIsAs(t *testing.T) {
+	err := error(ErrInvalidParameter.WithMessage("missing id"))
+	if !errors.Is(err, ErrInvalidParameter) {
+		t.Error("expect the error to be ErrInvalidParameter")
+	}
+	if errors.Is(err, ErrServerError) {
+		t.Error("unexpect the error to be ErrServerError")
+	}
+
+	err = ErrServerError.WithCause(io.ErrUnexpectedEOF)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expect the cause to be io.ErrUnexpectedEOF")
+	}
+
+	var e Error
+	if !errors.As(err, &e) || e.Code != ErrServerError.Code {
+		t.Errorf("expect the Error '%s', but got '%s'", ErrServerError.Code, e.Code)
+	}
+}
+
+func TestBindCause(t *testing.T) {
+	svc := NewService()
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/?Name=a", nil), httptest.NewRecorder())
+	defer svc.ReleaseContext(c)
+
+	cause := errors.New("the name is too short")
+	c.Validate = func(v interface{}) error { return cause }
+
+	var req struct {
+		Name string `query:"Name"`
+	}
+	err := c.Bind(&req)
+	if !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("expect ErrInvalidParameter, but got '%v'", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expect the cause '%v' to be kept", cause)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codeError struct{ err Error }
+
+func (e codeError) Error() string    { return e.err.Error() }
+func (e codeError) CodeError() Error { return e.err }
+
+func TestErrorStatus(t *testing.T) {
+	e := ErrInvalidParameter.WithMessage("missing id")
+	if e.Status != http.StatusBadRequest {
+		t.Errorf("expect the status code %d, but got %d", http.StatusBadRequest, e.Status)
+	}
+
+	data, _ := json.Marshal(e)
+	if strings.Contains(string(data), "Status") {
+		t.Errorf("unexpected the status in json: %s", data)
+	}
+	data, _ = xml.Marshal(Response{Error: e})
+	if strings.Contains(string(data), "Status") {
+		t.Errorf("unexpected the status in xml: %s", data)
+	}
+
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error {
+		return codeError{ErrConflict.WithStatus(http.StatusPreconditionFailed)}
+	})
+
+	call := func(action string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action="+action, nil))
+		return rec
+	}
+
+	if rec := call("Missing"); rec.Code != http.StatusOK {
+		t.Errorf("expect the status code 200 by default, but got %d", rec.Code)
+	}
+
+	svc.MapErrorStatus = true
+	if rec := call("Missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("expect the status code %d, but got %d", http.StatusNotFound, rec.Code)
+	} else if strings.Contains(rec.Body.String(), "Status") {
+		t.Errorf("unexpected the status in the body: %s", rec.Body.String())
+	}
+	if rec := call("Action"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("expect the status code %d, but got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+}
+
+type joinedErrors []error
+
+func (es joinedErrors) Error() string   { return "joined errors" }
+func (es joinedErrors) Unwrap() []error { return es }
+
+type fieldError struct{ field, reason string }
+
+func (e fieldError) Error() string { return e.field + ": " + e.reason }
+func (e fieldError) ErrorDetails() []ErrorDetail {
+	return []ErrorDetail{{Field: e.field, Reason: e.reason}}
+}
+
+func TestErrorDetails(t *testing.T) {
+	data, _ := json.Marshal(Response{RequestID: "id", Error: ErrInvalidParameter})
+	if expect := `{"RequestId":"id","Error":{"Code":"InvalidParams","Message":"invalid parameter"}}`; string(data) != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, data)
+	}
+
+	e := ErrInvalidParameter.WithDetails(ErrorDetail{Field: "Size", Reason: "too large", Value: 10})
+	if len(ErrInvalidParameter.Details) != 0 {
+		t.Errorf("unexpected the details of the original error: %v", ErrInvalidParameter.Details)
+	}
+
+	data, _ = json.Marshal(e)
+	if expect := `{"Code":"InvalidParams","Message":"invalid parameter","Details":[{"Field":"Size","Reason":"too large","Value":10}]}`; string(data) != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, data)
+	}
+
+	data, _ = xml.Marshal(Response{Error: e})
+	if expect := "<Details><Detail><Field>Size</Field><Reason>too large</Reason><Value>10</Value></Detail></Details>"; !strings.Contains(string(data), expect) {
+		t.Errorf("expect to contain '%s', but got '%s'", expect, data)
+	}
+
+	svc := NewService()
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/?Name=a", nil), httptest.NewRecorder())
+	defer svc.ReleaseContext(c)
+	c.Validate = func(v interface{}) error {
+		return joinedErrors{fieldError{"Name", "too short"}, fieldError{"Age", "missing"}}
+	}
+
+	var req struct {
+		Name string `query:"Name"`
+		Age  int    `query:"Age"`
+	}
+	err := c.Bind(&req).(Error)
+	if err.Code != ErrInvalidParameter.Code || len(err.Details) != 2 ||
+		err.Details[0] != (ErrorDetail{Field: "Name", Reason: "too short"}) ||
+		err.Details[1] != (ErrorDetail{Field: "Age", Reason: "missing"}) {
+		t.Errorf("unexpected the error: %+v", err)
+	}
+}
+
+func TestErrorCause(t *testing.T) {
+	cause := errors.New("connection refused")
+	e := ErrServerError.WithMessage("failed to query the user").WithCause(cause)
+	if e.Unwrap() != cause {
+		t.Errorf("expect the cause '%v', but got '%v'", cause, e.Unwrap())
+	}
+	if !e.Is(ErrServerError) || !e.Is(&ErrServerError) {
+		t.Error("expect the error to match ErrServerError")
+	}
+	if e.Is(ErrInvalidParameter) || e.Is(cause) {
+		t.Error("unexpect the error to match the other errors")
+	}
+
+	for _, debug := range []bool{false, true} {
+		svc := NewService()
+		svc.DebugErrors = debug
+		svc.Register("GetUser", func(c *Context) error { return e })
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=GetUser", nil))
+		if body := rec.Body.String(); strings.Contains(body, cause.Error()) != debug {
+			t.Errorf("debug=%v: unexpected body: %s", debug, body)
+		}
+	}
+}
+
+func TestErrorCloneCauses(t *testing.T) {
+	a, b, c := errors.New("a"), errors.New("b"), errors.New("c")
+	base := ErrServerError.WithCauses(a)
+	base.Causes = append(make([]error, 0, 4), base.Causes...) // Have the spare capacity.
+
+	eb, ec := base.WithCauses(b), base.WithCauses(c)
+	if len(eb.Causes) != 2 || eb.Causes[1] != b {
+		t.Errorf("expect the causes [a b], but got %v", eb.Causes)
+	}
+	if len(ec.Causes) != 2 || ec.Causes[1] != c {
+		t.Errorf("expect the causes [a c], but got %v", ec.Causes)
+	}
+	if len(base.Causes) != 1 || base.Causes[0] != a {
+		t.Errorf("expect the causes [a], but got %v", base.Causes)
+	}
+}
+
+func TestPredefinedErrorCodes(t *testing.T) {
+	// The codes are the protocol with the clients, so never change them.
+	for _, test := range []struct {
+		err    Error
+		code   string
+		status int
+	}{
+		{ErrUnauthorized, "Unauthorized", http.StatusUnauthorized},
+		{ErrForbidden, "Forbidden", http.StatusForbidden},
+		{ErrNotFound, "NotFound", http.StatusNotFound},
+		{ErrConflict, "Conflict", http.StatusConflict},
+		{ErrMethodNotAllowed, "MethodNotAllowed", http.StatusMethodNotAllowed},
+		{ErrRequestEntityTooLarge, "RequestEntityTooLarge", http.StatusRequestEntityTooLarge},
+		{ErrUnsupportedMediaType, "UnsupportedMediaType", http.StatusUnsupportedMediaType},
+		{ErrTooManyRequests, "TooManyRequests", http.StatusTooManyRequests},
+		{ErrServiceUnavailable, "ServiceUnavailable", http.StatusServiceUnavailable},
+		{ErrGatewayTimeout, "GatewayTimeout", http.StatusGatewayTimeout},
+		{ErrThrottling, "Throttling", http.StatusTooManyRequests},
+		{ErrSignatureDoesNotMatch, "SignatureDoesNotMatch", http.StatusUnauthorized},
+		{ErrInvalidAction, "InvalidAction", http.StatusNotFound},
+		{ErrInvalidParameter, "InvalidParams", http.StatusBadRequest},
+		{ErrServerError, "ServerError", http.StatusInternalServerError},
+		{ErrUnsupportedProtocol, "UnsupportedProtocol", http.StatusUnsupportedMediaType},
+	} {
+		if test.err.Code != test.code || test.err.Status != test.status || test.err.Message == "" {
+			t.Errorf("%s: unexpected the error %+v", test.code, test.err)
+		}
+	}
+}
+
+func TestBindRequestEntityTooLarge(t *testing.T) {
+	svc := NewService()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"Name":"abcdefghijklmn"}`))
+	req.Body = http.MaxBytesReader(rec, req.Body, 8)
+	c := svc.AcquireContext(req, rec)
+	defer svc.ReleaseContext(c)
+
+	var v struct{ Name string }
+	if err := c.Bind(&v); err.(Error).Code != ErrRequestEntityTooLarge.Code {
+		t.Errorf("expect the error '%s', but got '%v'", ErrRequestEntityTooLarge.Code, err)
+	}
+}
+
+func TestErrorRetriable(t *testing.T) {
+	for _, e := range []Error{ErrThrottling, ErrTooManyRequests, ErrServiceUnavailable, ErrGatewayTimeout} {
+		if !e.Retriable {
+			t.Errorf("expect the error '%s' to be retriable", e.Code)
+		}
+	}
+	if ErrInvalidParameter.Retriable || ErrServerError.Retriable {
+		t.Error("unexpect the client and server errors to be retriable")
+	}
+
+	for _, render := range []bool{false, true} {
+		svc := NewService()
+		svc.RenderRetriable = render
+		svc.Register("Throttle", func(c *Context) error {
+			return ErrThrottling.WithRetryAfter(1500 * time.Millisecond)
+		})
+		svc.Register("Limit", func(c *Context) error {
+			c.SetRespHeader("Retry-After", "10")
+			return ErrTooManyRequests.WithRetryAfter(time.Second)
+		})
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Throttle", nil))
+		if v := rec.Header().Get("Retry-After"); v != "2" {
+			t.Errorf("expect the header Retry-After '2', but got '%s'", v)
+		}
+		if body := rec.Body.String(); strings.Contains(body, `"Retriable":true`) != render {
+			t.Errorf("render=%v: unexpected the body: %s", render, body)
+		}
+
+		rec = httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Limit", nil))
+		if v := rec.Header().Get("Retry-After"); v != "10" {
+			t.Errorf("expect the header Retry-After '10', but got '%s'", v)
+		}
+	}
+}
+
+type loopError struct{}
+
+func (e loopError) Error() string { return "loop" }
+func (e loopError) Unwrap() error { return e }
+
+func TestErrorFormat(t *testing.T) {
+	for _, format := range []string{"%v", "%s", "%+v"} {
+		if s := fmt.Sprintf(format, Error{}); s != "" {
+			t.Errorf("%s: expect the empty string for the zero value, but got '%s'", format, s)
+		}
+	}
+
+	e := ErrInvalidParameter.WithMessage("missing id")
+	if s := fmt.Sprintf("%v", e); s != "InvalidParams: missing id" {
+		t.Errorf("unexpected the format '%%v': %s", s)
+	}
+	if s := fmt.Sprint(e); s != "InvalidParams: missing id" {
+		t.Errorf("unexpected the string: %s", s)
+	}
+
+	e = e.WithDetails(ErrorDetail{Field: "Id", Reason: "missing", Value: 1}).
+		WithCause(errors.New("no id"))
+	expect := "InvalidParams: missing id\ndetails: Id: missing (1)\ncause: no id"
+	if s := fmt.Sprintf("%+v", e); s != expect {
+		t.Errorf("expect the format '%%+v':\n%s\nbut got:\n%s", expect, s)
+	}
+
+	e = ErrServerError.WithCause(ErrServerError.WithCause(ErrServerError))
+	if s := fmt.Sprintf("%+v", e); strings.Count(s, "\ncause: ") != 2 {
+		t.Errorf("unexpected the format '%%+v': %s", s)
+	}
+
+	e = ErrServerError.WithCause(loopError{})
+	if s := fmt.Sprintf("%+v", e); strings.Count(s, "\ncause: loop") != maxFormatCauseDepth {
+		t.Errorf("unexpected the format '%%+v': %s", s)
+	}
+}
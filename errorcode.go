@@ -0,0 +1,113 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrorCode is the registered information of an error code.
+type ErrorCode struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+// ErrorRegistry is the registry of the error codes, which maps the code
+// to the HTTP status code and the default message.
+type ErrorRegistry struct {
+	lock  sync.RWMutex
+	codes map[string]ErrorCode
+}
+
+// DefaultErrorRegistry is the default global error registry.
+var DefaultErrorRegistry = NewErrorRegistry()
+
+// NewErrorRegistry returns a new ErrorRegistry.
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{codes: make(map[string]ErrorCode, 16)}
+}
+
+// RegisterError is equal to DefaultErrorRegistry.Register(code, status, defaultMessage).
+func RegisterError(code string, status int, defaultMessage string) error {
+	return DefaultErrorRegistry.Register(code, status, defaultMessage)
+}
+
+// Register registers the error code with the HTTP status code
+// and the default message.
+//
+// Registering the same code again is a no-op if the status code and
+// the message are the same, or returns an error.
+func (r *ErrorRegistry) Register(code string, status int, defaultMessage string) error {
+	if code == "" {
+		panic("ErrorRegistry.Register: the error code must not be empty")
+	}
+
+	info := ErrorCode{Code: code, Status: status, Message: defaultMessage}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if old, ok := r.codes[code]; ok {
+		if old != info {
+			return fmt.Errorf("the error code '%s' has been registered with status %d and message '%s'",
+				code, old.Status, old.Message)
+		}
+		return nil
+	}
+
+	r.codes[code] = info
+	return nil
+}
+
+// Lookup returns the registered information of the error code.
+func (r *ErrorRegistry) Lookup(code string) (info ErrorCode, ok bool) {
+	r.lock.RLock()
+	info, ok = r.codes[code]
+	r.lock.RUnlock()
+	return
+}
+
+// NewError returns a new Error with the status code and the default message
+// registered for the code.
+func (r *ErrorRegistry) NewError(code string) Error {
+	info, _ := r.Lookup(code)
+	return Error{Code: code, Message: info.Message, Status: info.Status}
+}
+
+// ErrorCodes returns all the registered error codes sorted by the code,
+// which may be used to generate the documentation.
+func (r *ErrorRegistry) ErrorCodes() []ErrorCode {
+	r.lock.RLock()
+	codes := make([]ErrorCode, 0, len(r.codes))
+	for _, info := range r.codes {
+		codes = append(codes, info)
+	}
+	r.lock.RUnlock()
+
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// lookupErrorCode looks up the error code from the registry of the service,
+// then DefaultErrorRegistry.
+func (s *Service) lookupErrorCode(code string) (info ErrorCode, ok bool) {
+	if s.ErrorRegistry != nil {
+		if info, ok = s.ErrorRegistry.Lookup(code); ok {
+			return
+		}
+	}
+	return DefaultErrorRegistry.Lookup(code)
+}
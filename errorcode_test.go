@@ -0,0 +1,69 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorRegistry(t *testing.T) {
+	r := NewErrorRegistry()
+	if err := r.Register("Throttling", http.StatusTooManyRequests, "too many requests"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("Throttling", http.StatusTooManyRequests, "too many requests"); err != nil {
+		t.Errorf("unexpected the error of the same registration: %v", err)
+	}
+	if err := r.Register("Throttling", http.StatusServiceUnavailable, "too many requests"); err == nil {
+		t.Error("expect the error of the conflicting registration")
+	}
+	r.Register("Archived", http.StatusGone, "resource is archived")
+
+	e := r.NewError("Throttling")
+	if e.Status != http.StatusTooManyRequests || e.Message != "too many requests" {
+		t.Errorf("unexpected the error: %+v", e)
+	}
+
+	codes := r.ErrorCodes()
+	if len(codes) != 2 || codes[0].Code != "Archived" || codes[1].Code != "Throttling" {
+		t.Errorf("unexpected the error codes: %+v", codes)
+	}
+}
+
+func TestServiceErrorRegistry(t *testing.T) {
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.ErrorRegistry = NewErrorRegistry()
+	svc.ErrorRegistry.Register("Throttling", http.StatusTooManyRequests, "too many requests")
+	svc.Register("Get", func(c *Context) error { return Error{Code: "Throttling"} })
+	svc.Register("Other", func(c *Context) error { return Error{Code: "Other", Message: "other"} })
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Get", nil))
+	var resp Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusTooManyRequests || resp.Error.Message != "too many requests" {
+		t.Errorf("unexpected the response: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Other", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect the status code %d, but got %d", http.StatusOK, rec.Code)
+	}
+}
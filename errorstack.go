@@ -0,0 +1,80 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+const maxErrorStackDepth = 32
+
+var captureErrorStacks int32
+
+// CaptureErrorStacks enables or disables to capture the stack trace
+// when wrapping an error into the server error, whose status code is 5xx,
+// by Error.WithCause or Error.WithCauses, such as the error returned
+// by the handler and converted by Context.Respond.
+//
+// The stack trace is never rendered into the response body, but may be got
+// by Error.Stack or printed by the format "%+v", such as in the OnResponse
+// hooks or the logs.
+//
+// Default: false
+func CaptureErrorStacks(enable bool) {
+	if enable {
+		atomic.StoreInt32(&captureErrorStacks, 1)
+	} else {
+		atomic.StoreInt32(&captureErrorStacks, 0)
+	}
+}
+
+// withStack captures the stack trace from the caller of the caller.
+func (e Error) withStack() Error {
+	if e.stack != nil || e.Status < 500 || atomic.LoadInt32(&captureErrorStacks) == 0 {
+		return e
+	}
+
+	var pcs [maxErrorStackDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	e.stack = append([]uintptr(nil), pcs[:n]...)
+	return e
+}
+
+// Stack returns the stack trace captured when CaptureErrorStacks is enabled,
+// which is empty if not captured.
+func (e Error) Stack() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		buf.WriteString(frame.Function)
+		buf.WriteString("\n\t")
+		buf.WriteString(frame.File)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(frame.Line))
+		buf.WriteByte('\n')
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func queryUser() error {
+	return ErrServerError.WithCause(errors.New("connection refused"))
+}
+
+func TestErrorStack(t *testing.T) {
+	if stack := queryUser().(Error).Stack(); stack != "" {
+		t.Errorf("unexpected the stack when disabled: %s", stack)
+	}
+
+	CaptureErrorStacks(true)
+	defer CaptureErrorStacks(false)
+
+	e := queryUser().(Error)
+	if stack := e.Stack(); !strings.Contains(stack, "queryUser") {
+		t.Errorf("expect the stack containing queryUser, but got: %s", stack)
+	}
+	if s := fmt.Sprintf("%+v", e); !strings.HasPrefix(s, e.String()+"\n") ||
+		!strings.Contains(s, "queryUser") {
+		t.Errorf("unexpected the format '%%+v': %s", s)
+	}
+	if stack := ErrInvalidParameter.WithCause(errors.New("bad")).Stack(); stack != "" {
+		t.Errorf("unexpected the stack of the client error: %s", stack)
+	}
+
+	var hookStack string
+	svc := NewService()
+	svc.DebugErrors = true
+	svc.OnResponse(func(c *Context, err error) { hookStack = err.(Error).Stack() })
+	svc.Register("GetUser", func(c *Context) error { return queryUser() })
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=GetUser", nil))
+	if !strings.Contains(hookStack, "queryUser") {
+		t.Errorf("expect the stack in the hook, but got: %s", hookStack)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "queryUser") {
+		t.Errorf("unexpected the stack in the body: %s", body)
+	}
+}
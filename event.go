@@ -0,0 +1,311 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ActionEvent is the event of the action dispatched after responding,
+// which is registered by OnActionSuccess or OnActionFailure.
+type ActionEvent struct {
+	Action    string
+	Version   string
+	RequestID string
+	Principal interface{}
+
+	// Request is the bound request value if the service is registered
+	// by RegisterFunc or RegisterStruct. Or, it is nil.
+	Request interface{}
+
+	Data interface{} // The responded data if succeeding.
+	Err  error       // The error if failing.
+}
+
+// EventOverflowPolicy is the policy when the event queue is full.
+type EventOverflowPolicy uint8
+
+// Predefine some event overflow policies.
+const (
+	// EventDrop drops the event, which is reported to Service.OnEventDropped.
+	EventDrop EventOverflowPolicy = iota
+
+	// EventBlock blocks until the queue has room or the request is canceled,
+	// which does not delay the response, but holds the connection.
+	EventBlock
+)
+
+// EventStats is the statistics of the action events.
+type EventStats struct {
+	Queued     int    // The number of the events waiting in the queue.
+	Dispatched uint64 // The number of the events dispatched to the hooks.
+	Dropped    uint64 // The number of the events dropped as the queue is full.
+}
+
+type actionEventHooks struct {
+	success []func(context.Context, ActionEvent)
+	failure []func(context.Context, ActionEvent)
+}
+
+type actionEventTask struct {
+	svc   *Service // The service emitting the event.
+	hooks []func(context.Context, ActionEvent)
+	event ActionEvent
+}
+
+type eventRegistry struct {
+	hooks      map[string]actionEventHooks
+	dispatcher *eventDispatcher
+}
+
+type eventDispatcher struct {
+	dispatched uint64
+	dropped    uint64
+	pending    int64 // The number of the queued and dispatching events.
+	closed     int32
+	block      bool
+	queue      chan actionEventTask
+	stop       chan struct{}
+	once       sync.Once
+}
+
+func newEventDispatcher(size, workers int, policy EventOverflowPolicy) *eventDispatcher {
+	if size <= 0 {
+		size = 1024
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	d := &eventDispatcher{
+		block: policy == EventBlock,
+		queue: make(chan actionEventTask, size),
+		stop:  make(chan struct{}),
+	}
+	for ; workers > 0; workers-- {
+		go d.work()
+	}
+	return d
+}
+
+func (d *eventDispatcher) work() {
+	for {
+		select {
+		case <-d.stop:
+			return
+		case task := <-d.queue:
+			for _, hook := range task.hooks {
+				task.svc.runEventHook(hook, task.event)
+			}
+			atomic.AddUint64(&d.dispatched, 1)
+			atomic.AddInt64(&d.pending, -1)
+		}
+	}
+}
+
+// close stops accepting the new events, waits for the queued events
+// to be dispatched until timeout or ctx is done, then stops the workers
+// and drops the events left in the queue.
+func (d *eventDispatcher) close(ctx context.Context, timeout time.Duration) {
+	if !atomic.CompareAndSwapInt32(&d.closed, 0, 1) {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+
+wait:
+	for atomic.LoadInt64(&d.pending) > 0 {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-timer.C:
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	d.once.Do(func() { close(d.stop) })
+	for {
+		select {
+		case task := <-d.queue:
+			atomic.AddInt64(&d.pending, -1)
+			task.svc.dropEvent(d, task.event)
+		default:
+			return
+		}
+	}
+}
+
+// drainEvents closes the event dispatcher, if any, for Shutdown.
+func (s *Service) drainEvents(ctx context.Context) {
+	if r, ok := s.events.Load().(*eventRegistry); ok {
+		timeout := s.EventDrainTimeout
+		if timeout <= 0 {
+			timeout = time.Second * 5
+		}
+		r.dispatcher.close(ctx, timeout)
+	}
+}
+
+func (s *Service) dropEvent(d *eventDispatcher, ev ActionEvent) {
+	atomic.AddUint64(&d.dropped, 1)
+	if s.OnEventDropped != nil {
+		s.OnEventDropped(ev)
+	}
+}
+
+// runEventHook runs the event hook, whose panic is reported by PanicHandler
+// with a new context only carrying the action, version, request id
+// and principal of the event, since the request has been finished.
+func (s *Service) runEventHook(hook func(context.Context, ActionEvent), ev ActionEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			c := NewContext()
+			c.svc, c.principal = s, ev.Principal
+			c.Action, c.Version, c.RequestID = ev.Action, ev.Version, ev.RequestID
+			s.handlePanic(c, r)
+		}
+	}()
+	hook(context.Background(), ev)
+}
+
+// OnActionSuccess registers the hook called asynchronously with the event
+// after the service named action succeeds and the response is written.
+//
+// The events are dispatched by a bounded queue, which is created by
+// Service.EventQueueSize, EventWorkers and EventOverflow when registering
+// the first event hook. A panic in a hook is reported by Service.PanicHandler
+// and does not affect the others.
+func (s *Service) OnActionSuccess(action string, hook func(ctx context.Context, ev ActionEvent)) {
+	s.addEventHook("Service.OnActionSuccess", action, hook, false)
+}
+
+// OnActionFailure is the same as OnActionSuccess, but called after
+// the service named action fails, which is not called by default.
+func (s *Service) OnActionFailure(action string, hook func(ctx context.Context, ev ActionEvent)) {
+	s.addEventHook("Service.OnActionFailure", action, hook, true)
+}
+
+func (s *Service) addEventHook(fn, action string, hook func(context.Context, ActionEvent), failure bool) {
+	if action == "" {
+		panic(fn + ": the service name must not be empty")
+	} else if hook == nil {
+		panic(fn + ": the hook must not be nil")
+	}
+
+	key := s.normalize(action)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := &eventRegistry{hooks: make(map[string]actionEventHooks)}
+	if old, ok := s.events.Load().(*eventRegistry); ok {
+		for k, v := range old.hooks {
+			r.hooks[k] = v
+		}
+		r.dispatcher = old.dispatcher
+	} else {
+		r.dispatcher = newEventDispatcher(s.EventQueueSize, s.EventWorkers, s.EventOverflow)
+	}
+
+	hooks := r.hooks[key]
+	if failure {
+		hooks.failure = append(append([]func(context.Context, ActionEvent){}, hooks.failure...), hook)
+	} else {
+		hooks.success = append(append([]func(context.Context, ActionEvent){}, hooks.success...), hook)
+	}
+	r.hooks[key] = hooks
+	s.events.Store(r)
+}
+
+// EventStats returns the statistics of the action events.
+func (s *Service) EventStats() (stats EventStats) {
+	if r, ok := s.events.Load().(*eventRegistry); ok {
+		stats.Queued = len(r.dispatcher.queue)
+		stats.Dispatched = atomic.LoadUint64(&r.dispatcher.dispatched)
+		stats.Dropped = atomic.LoadUint64(&r.dispatcher.dropped)
+	}
+	return
+}
+
+func (s *Service) hasEventHooks() bool {
+	_, ok := s.events.Load().(*eventRegistry)
+	return ok
+}
+
+// emitEvent dispatches the event of the resolved action of c, if any hook.
+func (s *Service) emitEvent(c *Context, herr error) {
+	r, ok := s.events.Load().(*eventRegistry)
+	if !ok || c.action == nil {
+		return
+	}
+
+	hooks, ok := r.hooks[s.normalize(c.action.name)]
+	if !ok {
+		return
+	}
+
+	err := herr
+	if err == nil {
+		err = c.respErr
+	}
+
+	task := actionEventTask{svc: s, hooks: hooks.success}
+	if err != nil {
+		task.hooks = hooks.failure
+	}
+	if len(task.hooks) == 0 {
+		return
+	}
+
+	task.event = ActionEvent{
+		Action:    c.action.name,
+		Version:   c.GetVersion(),
+		RequestID: c.GetRequestID(),
+		Principal: c.principal,
+		Request:   c.boundReq,
+		Err:       err,
+	}
+	if err == nil {
+		task.event.Data = c.respData
+	}
+
+	d := r.dispatcher
+	if atomic.LoadInt32(&d.closed) == 0 {
+		atomic.AddInt64(&d.pending, 1)
+		if d.block {
+			select {
+			case d.queue <- task:
+				return
+			case <-d.stop:
+			case <-c.req.Context().Done():
+			}
+		} else {
+			select {
+			case d.queue <- task:
+				return
+			default:
+			}
+		}
+		atomic.AddInt64(&d.pending, -1)
+	}
+
+	s.dropEvent(d, task.event)
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type eventRequest struct{ Name string }
+
+type eventService struct{}
+
+func (eventService) Create(c *Context, req *eventRequest) (*string, error) {
+	if req.Name == "" {
+		return nil, ErrInvalidParameter.WithMessage("missing Name")
+	}
+	resp := "created:" + req.Name
+	return &resp, nil
+}
+
+func TestServiceActionEvent(t *testing.T) {
+	panics := make(chan string, 4)
+	svc := NewService()
+	svc.PanicHandler = func(c *Context, r interface{}) { panics <- c.Action + "@" + c.RequestID }
+	svc.RegisterStruct("", eventService{})
+	svc.Register("Other", func(c *Context) error { return c.Success(nil) })
+
+	events := make(chan ActionEvent, 4)
+	svc.OnActionSuccess("Create", func(ctx context.Context, ev ActionEvent) { events <- ev })
+	svc.OnActionSuccess("Create", func(ctx context.Context, ev ActionEvent) { panic("hook") })
+
+	call := func(action, body string) {
+		req := httptest.NewRequest(http.MethodPost, "/?Action="+action, strings.NewReader(body))
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		req.Header.Set("X-Request-Id", "rid")
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	expect := func() (ev ActionEvent) {
+		t.Helper()
+		select {
+		case ev = <-events:
+		case <-time.After(time.Second):
+			t.Fatal("no action event")
+		}
+		return
+	}
+
+	call("Create", `{"Name":"abc"}`)
+	ev := expect()
+	if data, _ := ev.Data.(*string); ev.Action != "Create" || ev.RequestID != "rid" ||
+		data == nil || *data != "created:abc" || ev.Err != nil {
+		t.Errorf("unexpected event: %+v", ev)
+	} else if req, ok := ev.Request.(*eventRequest); !ok || req.Name != "abc" {
+		t.Errorf("unexpected request: %#v", ev.Request)
+	}
+	select {
+	case p := <-panics:
+		if p != "Create@rid" {
+			t.Errorf("unexpected the panic of the action '%s'", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the panic of the event hook is not reported")
+	}
+
+	// The failed and unhooked calls do not emit the success events.
+	call("Create", `{}`)
+	call("Other", `{}`)
+
+	svc.OnActionFailure("Create", func(ctx context.Context, ev ActionEvent) { events <- ev })
+	call("Create", `{}`)
+	if ev = expect(); ev.Data != nil || ev.Err == nil || errorCode(ev.Err) != ErrInvalidParameter.Code {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	select {
+	case ev = <-events:
+		t.Errorf("unexpected event: %+v", ev)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if stats := svc.EventStats(); stats.Dispatched != 2 || stats.Dropped != 0 {
+		t.Errorf("unexpected event stats: %+v", stats)
+	}
+}
+
+func TestServiceActionEventOverflow(t *testing.T) {
+	release := make(chan struct{})
+	var dropped int32
+
+	svc := NewService()
+	svc.EventQueueSize = 1
+	svc.OnEventDropped = func(ev ActionEvent) { atomic.AddInt32(&dropped, 1) }
+	svc.Register("Action", func(c *Context) error { return c.Success(nil) })
+	svc.OnActionSuccess("Action", func(ctx context.Context, ev ActionEvent) { <-release })
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/?Action=Action", nil)
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// One is being dispatched, one is queued, and the rest are dropped.
+	if stats := svc.EventStats(); stats.Queued != 1 || stats.Dropped != 3 {
+		t.Errorf("unexpected event stats: %+v", stats)
+	} else if n := atomic.LoadInt32(&dropped); n != 3 {
+		t.Errorf("expect %d dropped events, but got %d", 3, n)
+	}
+	close(release)
+}
+
+func TestServiceActionEventDrain(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	svc := NewService()
+	svc.EventQueueSize = 4
+	svc.EventDrainTimeout = time.Millisecond * 50
+	svc.Register("Fast", func(c *Context) error { return c.Success(nil) })
+	svc.Register("Slow", func(c *Context) error { return c.Success(nil) })
+	svc.OnActionSuccess("Fast", func(ctx context.Context, ev ActionEvent) {
+		time.Sleep(time.Millisecond * 5)
+	})
+	svc.OnActionSuccess("Slow", func(ctx context.Context, ev ActionEvent) { <-release })
+
+	call := func(action string) {
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The queued events are dispatched before Shutdown returns.
+	for i := 0; i < 3; i++ {
+		call("Fast")
+	}
+
+	// One is being dispatched, and the rest are left in the queue.
+	for i := 0; i < 3; i++ {
+		call("Slow")
+	}
+
+	if err := svc.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if stats := svc.EventStats(); stats.Dispatched != 3 || stats.Dropped != 2 || stats.Queued != 0 {
+		t.Errorf("unexpected event stats: %+v", stats)
+	}
+}
@@ -77,17 +77,17 @@ func ExampleService() {
 	//
 	// ### Run Client:
 	// $ curl -XGET 'http://127.0.0.1:8080/?Action=service1'
-	// {"Data":"service1"}
+	// {"RequestId":"2d7b3cbe34a1f5b4c1b4b2e0e0d4c8a9","Data":"service1"}
 	//
 	// $ curl -XGET 'http://127.0.0.1:8080/?Action=old_service1'
-	// {"Data":"service1"}
+	// {"RequestId":"8c1e4fa4b7d24b3c9d1dd4b1f2a7f3c1","Data":"service1"}
 	//
 	// $ curl -XGET 'http://127.0.0.1:8080/?Action=service2&Name=Aaron'
-	// {"Data":"Aaron"}
+	// {"RequestId":"0a9b3e6f1c2d4e5f8a7b6c5d4e3f2a1b","Data":"Aaron"}
 	//
 	// $ curl -XPOST 'http://127.0.0.1:8080/?Action=service2' -d '{"Name": "Aaron"}'
-	// {"Data":"Aaron"}
+	// {"RequestId":"5f4e3d2c1b0a49382716a5b4c3d2e1f0","Data":"Aaron"}
 	//
-	// $ curl -XPOST 'http://127.0.0.1:8080/' -H 'X-Action: service2' -d '{"Name": "Aaron"}'
-	// {"Data":"Aaron"}
+	// $ curl -XPOST 'http://127.0.0.1:8080/' -H 'X-Action: service2' -H 'X-Request-Id: abc' -d '{"Name": "Aaron"}'
+	// {"RequestId":"abc","Data":"Aaron"}
 }
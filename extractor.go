@@ -0,0 +1,180 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Extractor is used to extract a value from the request, such as the action,
+// version or request id, which returns "" if not found.
+type Extractor func(c *Context) (value string, err error)
+
+// FromHeader returns an extractor to extract the value from the request
+// header named key.
+func FromHeader(key string) Extractor {
+	return func(c *Context) (string, error) { return c.GetReqHeader(key), nil }
+}
+
+// FromQuery returns an extractor to extract the value from the request
+// query named key.
+//
+// If the query has not been parsed by c.Query, the value is scanned from
+// the raw query instead of parsing the whole.
+func FromQuery(key string) Extractor {
+	return func(c *Context) (string, error) {
+		if c.query != nil {
+			return c.query.Get(key), nil
+		}
+		value, _ := queryValue(c.req.URL.RawQuery, key)
+		return value, nil
+	}
+}
+
+// queryValue scans the first value of key from the raw query, which is
+// the same as url.ParseQuery(query).Get(key), but does not allocate
+// unless the key or value is escaped.
+func queryValue(query, key string) (value string, ok bool) {
+	for query != "" {
+		pair := query
+		if i := strings.IndexByte(query, '&'); i >= 0 {
+			pair, query = query[:i], query[i+1:]
+		} else {
+			query = ""
+		}
+
+		// url.ParseQuery rejects the pair containing the semicolon.
+		if pair == "" || strings.IndexByte(pair, ';') >= 0 {
+			continue
+		}
+
+		name := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		} else {
+			value = ""
+		}
+
+		var err error
+		if name, err = unescapeQuery(name); err != nil || name != key {
+			continue
+		} else if value, err = unescapeQuery(value); err != nil {
+			continue
+		}
+		return value, true
+	}
+	return "", false
+}
+
+func unescapeQuery(s string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 && strings.IndexByte(s, '+') < 0 {
+		return s, nil
+	}
+	return url.QueryUnescape(s)
+}
+
+// FromPathSegment returns an extractor to extract the value from the index
+// segment of the request path, which starts with 0 and is separated by "/".
+// If index is negative, it counts from the end, that's, -1 is the last.
+//
+// For example, FromPathSegment(1) extracts "CreateUser" from "/v1/CreateUser".
+func FromPathSegment(index int) Extractor {
+	return func(c *Context) (string, error) {
+		segments := strings.Split(strings.Trim(c.req.URL.Path, "/"), "/")
+		if index < 0 {
+			index += len(segments)
+		}
+		if index < 0 || index >= len(segments) {
+			return "", nil
+		}
+		return segments[index], nil
+	}
+}
+
+// FromJSONBodyField returns an extractor to extract the string value
+// from the top-level field named key of the JSON request body, which is
+// buffered by c.BodyBytes so that it can still be bound later.
+//
+// The body is scanned by the tokens until the field is found instead of
+// decoding the whole document. If Content-Type of the request is not JSON,
+// or the body has no such field, return "". If the body is malformed,
+// return ErrInvalidParameter.
+func FromJSONBodyField(key string) Extractor {
+	return func(c *Context) (value string, err error) {
+		if !isJSONContentType(c.ContentType()) {
+			return
+		}
+
+		body, err := c.BodyBytes()
+		if err != nil {
+			return "", ErrInvalidParameter.WithMessage(err.Error())
+		} else if len(body) == 0 {
+			return
+		}
+
+		if value, err = scanJSONField(body, key); err != nil {
+			err = ErrInvalidParameter.WithMessage("malformed json body: %s", err.Error())
+		}
+		return
+	}
+}
+
+func isJSONContentType(ct string) bool {
+	return ct == MIMEApplicationJSON || strings.HasSuffix(ct, "+json")
+}
+
+// scanJSONField scans the top-level field named key of the JSON object
+// in data, and returns its string value.
+func scanJSONField(data []byte, key string) (value string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token, err := dec.Token()
+	if err != nil {
+		return
+	} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return "", nil // Not an object.
+	}
+
+	var raw json.RawMessage
+	for dec.More() {
+		if token, err = dec.Token(); err != nil {
+			return
+		}
+
+		if name, _ := token.(string); name == key {
+			if err = dec.Decode(&raw); err == nil {
+				if json.Unmarshal(raw, &value) != nil {
+					err = fmt.Errorf("the field '%s' is not a string", key)
+				}
+			}
+			return
+		} else if err = dec.Decode(&raw); err != nil { // Skip the value.
+			return
+		}
+	}
+
+	_, err = dec.Token() // Ensure the object is closed.
+	return
+}
+
+func extract(c *Context, extractors []Extractor) (value string, err error) {
+	for i, _len := 0, len(extractors); i < _len && value == "" && err == nil; i++ {
+		value, err = extractors[i](c)
+	}
+	return
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsvc
+
+import (
+	"net/url"
+	"testing"
+)
+
+func FuzzQueryValue(f *testing.F) {
+	for _, query := range queryValueTests {
+		f.Add(query, "Action")
+	}
+
+	f.Fuzz(func(t *testing.T, query, key string) {
+		values, _ := url.ParseQuery(query)
+		expect, exist := values.Get(key), values[key] != nil
+		if value, ok := queryValue(query, key); value != expect || ok != exist {
+			t.Errorf("%q/%q: expect %q and %v, but got %q and %v", query, key, expect, exist, value, ok)
+		}
+	})
+}
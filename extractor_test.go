@@ -0,0 +1,155 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServiceExtractors(t *testing.T) {
+	svc := NewService()
+	svc.ActionExtractors = []Extractor{FromHeader("X-Action"), FromQuery("Action"),
+		FromJSONBodyField("Action"), FromPathSegment(1)}
+	svc.VersionExtractors = []Extractor{FromQuery("Version"), FromPathSegment(0)}
+	svc.RequestIDExtractors = []Extractor{FromHeader("X-Trace-Id")}
+	svc.Register("CreateUser", func(c *Context) (err error) {
+		var req struct{ Name string }
+		if err = c.Bind(&req); err == nil {
+			err = c.Success(c.Version + ":" + req.Name)
+		}
+		return
+	})
+
+	tests := []struct {
+		path   string
+		header string
+		body   string
+		expect string
+	}{
+		{path: "/v1/CreateUser", expect: "v1:"},
+		{path: "/v1?Action=CreateUser&Version=v2", expect: "v2:"},
+		{path: "/v1", header: "CreateUser", body: `{"Name":"abc"}`, expect: "v1:abc"},
+		{path: "/v1", body: `{"Name":"abc","Action":"CreateUser"}`, expect: "v1:abc"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1"+test.path, strings.NewReader(test.body))
+		req.Header.Set("X-Trace-Id", "abc")
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		if test.header != "" {
+			req.Header.Set("X-Action", test.header)
+		}
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Code != "" {
+			t.Errorf("%s: %s", test.path, resp.Error)
+		} else if resp.Data != test.expect {
+			t.Errorf("%s: expect '%s', but got '%v'", test.path, test.expect, resp.Data)
+		} else if resp.RequestID != "abc" {
+			t.Errorf("%s: expect request id '%s', but got '%s'", test.path, "abc", resp.RequestID)
+		}
+	}
+}
+
+func TestFromPathSegment(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/a/b/c", nil)
+	c := NewContext()
+	c.SetRequest(req)
+
+	for index, expect := range map[int]string{0: "a", 2: "c", 3: "", -1: "c", -3: "a", -4: ""} {
+		if value, _ := FromPathSegment(index)(c); value != expect {
+			t.Errorf("%d: expect '%s', but got '%s'", index, expect, value)
+		}
+	}
+}
+
+func TestServiceActionBodyField(t *testing.T) {
+	svc := NewService()
+	svc.ActionBodyField = "Action"
+	svc.Register("CreateUser", func(c *Context) (err error) {
+		var req struct{ Name string }
+		if err = c.Bind(&req); err == nil {
+			err = c.Success(req.Name)
+		}
+		return
+	})
+
+	tests := []struct {
+		ct     string
+		body   string
+		data   string
+		errmsg string
+	}{
+		{ct: MIMEApplicationJSONCharsetUTF8, body: `{"Name":"abc","Action":"CreateUser"}`, data: "abc"},
+		{ct: "application/vnd.api+json", body: `{"Extra":{"Action":"x"},"Action":"CreateUser"}`},
+		{ct: "text/plain", body: `{"Action":"CreateUser"}`, errmsg: ErrInvalidAction.Code},
+		{ct: MIMEApplicationJSON, body: `{"Action":`, errmsg: ErrInvalidParameter.Code},
+		{ct: MIMEApplicationJSON, body: `{"Action":1}`, errmsg: ErrInvalidParameter.Code},
+		{ct: MIMEApplicationJSON, body: `[1, 2]`, errmsg: ErrInvalidAction.Code},
+	}
+
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.ct)
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Code != test.errmsg {
+			t.Errorf("%d: expect error '%s', but got '%s'", i, test.errmsg, resp.Error.Code)
+		} else if test.data != "" && resp.Data != test.data {
+			t.Errorf("%d: expect data '%s', but got '%v'", i, test.data, resp.Data)
+		}
+	}
+}
+
+var queryValueTests = []string{
+	"",
+	"Action=A",
+	"Action=A&Action=B",
+	"Id=1&Action=A+B",
+	"Ac%74ion=%41",
+	"Action",
+	"Action=&Action=B",
+	"Action=%zz&Action=B",
+	"Action=A;B&Action=C",
+	"&&Action=A&",
+	"Action%3D=A&Action=B%3D",
+}
+
+func TestQueryValue(t *testing.T) {
+	for _, query := range queryValueTests {
+		values, _ := url.ParseQuery(query)
+		expect, exist := values.Get("Action"), values["Action"] != nil
+		if value, ok := queryValue(query, "Action"); value != expect || ok != exist {
+			t.Errorf("%s: expect '%s' and %v, but got '%s' and %v", query, expect, exist, value, ok)
+		}
+	}
+
+	if n := testing.AllocsPerRun(100, func() { queryValue("Id=1&Action=A", "Action") }); n != 0 {
+		t.Errorf("expect no allocation, but got %v", n)
+	}
+}
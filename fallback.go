@@ -0,0 +1,82 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import "context"
+
+// Predefine the handlers which serve the request by Fallback.
+const (
+	FallbackPrimary   = "primary"
+	FallbackSecondary = "secondary"
+)
+
+type fallbackKey struct{}
+
+// FallbackServedBy returns which handler by Fallback serves the request,
+// that's, FallbackPrimary or FallbackSecondary, from the request context,
+// such as c.Request().Context(), which is used to log it after handling.
+func FallbackServedBy(ctx context.Context) (servedBy string, ok bool) {
+	servedBy, ok = ctx.Value(fallbackKey{}).(string)
+	return
+}
+
+// Fallback returns a handler to try primary, such as a new one,
+// and then secondary, such as the old one, if primary returns the error
+// that shouldFallback reports true, such as ErrNotFound.
+//
+// It only falls back if primary has not written the response. Or,
+// the error of primary is returned. The response headers set by primary
+// are discarded when falling back. If shouldFallback is nil, fall back
+// on any error.
+//
+// The served handler is stored in the request context,
+// which can be got by FallbackServedBy.
+func Fallback(primary, secondary Handler, shouldFallback func(error) bool) Handler {
+	if primary == nil {
+		panic("Fallback: the primary handler must not be nil")
+	} else if secondary == nil {
+		panic("Fallback: the secondary handler must not be nil")
+	}
+
+	return func(c *Context) (err error) {
+		// Buffer the body so that secondary can read it again.
+		if _, err = c.BodyBytes(); err != nil {
+			return ErrInvalidParameter.WithMessage(err.Error())
+		}
+
+		header := cloneHeader(c.res.Header())
+		c.setServedBy(FallbackPrimary)
+		err = primary(c)
+		if err == nil || c.IsResponded() || (shouldFallback != nil && !shouldFallback(err)) {
+			return
+		}
+
+		resetHeader := c.res.Header()
+		for k := range resetHeader {
+			delete(resetHeader, k)
+		}
+		for k, v := range header {
+			resetHeader[k] = v
+		}
+
+		c.BodyBytes() // Rewind the body.
+		c.setServedBy(FallbackSecondary)
+		return secondary(c)
+	}
+}
+
+func (c *Context) setServedBy(servedBy string) {
+	c.req = c.req.WithContext(context.WithValue(c.req.Context(), fallbackKey{}, servedBy))
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFallback(t *testing.T) {
+	errNotMigrated := NewError("NotMigrated", "not migrated")
+
+	var servedBy string
+	svc := NewService()
+	svc.OnResponse(func(c *Context, err error) {
+		servedBy, _ = FallbackServedBy(c.Request().Context())
+	})
+
+	primary := func(c *Context) error {
+		c.SetRespHeader("X-Primary", "1")
+		switch c.Query().Get("Case") {
+		case "NotMigrated":
+			return errNotMigrated
+		case "Partial":
+			c.WriteHeader(http.StatusAccepted)
+			c.ResponseWriter().Write([]byte("partial"))
+			return errNotMigrated
+		case "Failed":
+			return ErrFailedOperation
+		}
+		return c.Success("primary")
+	}
+	secondary := func(c *Context) error {
+		body, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.Success("secondary:" + string(body))
+	}
+	shouldFallback := func(err error) bool {
+		e, ok := err.(Error)
+		return ok && e.Code == errNotMigrated.Code
+	}
+	svc.Register("Action", Fallback(primary, secondary, shouldFallback))
+
+	tests := []struct {
+		name     string
+		body     string
+		servedBy string
+		primaryH string
+	}{
+		{"", `"Data":"primary"`, FallbackPrimary, "1"},
+		{"NotMigrated", `"Data":"secondary:body"`, FallbackSecondary, ""},
+		{"Partial", "partial", FallbackPrimary, "1"},
+		{"Failed", `"Code":"FailedOperation"`, FallbackPrimary, "1"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?Action=Action&Case="+test.name, strings.NewReader("body"))
+		svc.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); !strings.Contains(body, test.body) {
+			t.Errorf("%s: expect the body containing '%s', but got '%s'", test.name, test.body, body)
+		}
+		if servedBy != test.servedBy {
+			t.Errorf("%s: expect to be served by '%s', but got '%s'", test.name, test.servedBy, servedBy)
+		}
+		if h := rec.Header().Get("X-Primary"); h != test.primaryH {
+			t.Errorf("%s: expect the header X-Primary '%s', but got '%s'", test.name, test.primaryH, h)
+		}
+	}
+
+	// Fall back on any error if shouldFallback is nil.
+	handler := Fallback(func(c *Context) error { return errors.New("error") },
+		func(c *Context) error { return c.Success("secondary") }, nil)
+	svc.Register("Any", handler)
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Any", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"Data":"secondary"`) {
+		t.Errorf("unexpected response: %s", body)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FieldsOption is used to configure FieldsRender.
+type FieldsOption func(*fieldsConfig)
+
+// FieldsQuery returns a fields option to set the query name of the fields.
+//
+// Default: "Fields"
+func FieldsQuery(name string) FieldsOption {
+	return func(c *fieldsConfig) { c.query = name }
+}
+
+// FieldsStrict returns a fields option to respond ErrInvalidParameter
+// for the field path not existing in the data.
+//
+// Default: the nonexistent field paths are ignored.
+func FieldsStrict() FieldsOption {
+	return func(c *fieldsConfig) { c.strict = true }
+}
+
+type fieldsConfig struct {
+	query  string
+	strict bool
+}
+
+// FieldsRender returns a render to filter the data of the successful
+// response by the comma-separated field paths of the query "Fields",
+// such as "?Fields=Name,Items.Id", before calling render, which may be
+// set as Context.Render, such as by Service.NewContext.
+//
+// The paths apply to the elements of the slices, and the fields of
+// the structs are named by the struct tag "json". The projection of
+// the data is rendered, so the original data is not modified.
+//
+// If render is nil, it renders the response by c.JSON.
+func FieldsRender(render func(c *Context, r Response) error, opts ...FieldsOption) func(c *Context, r Response) error {
+	conf := fieldsConfig{query: "Fields"}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if render == nil {
+		render = renderJSONResponse
+	}
+
+	return func(c *Context, r Response) error {
+		if r.Error.Code != "" || r.Data == nil {
+			return render(c, r)
+		}
+
+		fields := c.Query().Get(conf.query)
+		if fields == "" {
+			return render(c, r)
+		}
+
+		data, err := projectFields(reflect.ValueOf(r.Data), parseFieldPaths(fields), "", conf.strict)
+		if err != nil {
+			e := err.(Error)
+			if c.svc != nil && c.svc.MapErrorStatus {
+				c.res.WriteHeader(e.Status)
+			}
+			c.resperr, c.respErr = true, e
+			r.Error, r.Data = e, nil
+		} else {
+			r.Data = data
+		}
+		return render(c, r)
+	}
+}
+
+func renderJSONResponse(c *Context, r Response) error {
+	resp := jsonResponse{RequestID: r.RequestID, Data: r.Data}
+	if r.Error.Code != "" {
+		resp.Error = &r.Error
+	}
+	return c.JSON(resp)
+}
+
+// fieldPaths is the tree of the field paths, and nil means the whole value.
+type fieldPaths map[string]fieldPaths
+
+func parseFieldPaths(fields string) fieldPaths {
+	root := make(fieldPaths)
+	for _, path := range strings.Split(fields, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		node := root
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			child, ok := node[name]
+			if ok && child == nil {
+				break // The whole value has been selected.
+			} else if i == len(names)-1 {
+				node[name] = nil
+				break
+			} else if !ok {
+				child = make(fieldPaths)
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func isJSONMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// projectFields returns the projection of v only containing the paths.
+func projectFields(v reflect.Value, paths fieldPaths, prefix string, strict bool) (interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	info := cachedProjection(v.Type())
+	switch kind := v.Kind(); {
+	case info.leaf:
+	case kind == reflect.Struct:
+		return projectStruct(v, info.fields, paths, prefix, strict)
+	case kind == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		return projectMap(v, paths, prefix, strict)
+	case (kind == reflect.Slice || kind == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8:
+		if kind == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			value, err := projectFields(v.Index(i), paths, prefix, strict)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	if strict {
+		return nil, unknownFieldPath(prefix, paths)
+	}
+	return v.Interface(), nil
+}
+
+func projectStruct(v reflect.Value, fields map[string]projectionField,
+	paths fieldPaths, prefix string, strict bool) (interface{}, error) {
+	values := make(map[string]interface{}, len(paths))
+	for name, sub := range paths {
+		field, ok := fields[name]
+		if !ok {
+			if strict {
+				return nil, unknownFieldPath(prefix, fieldPaths{name: sub})
+			}
+			continue
+		}
+
+		fv, ok := fieldByIndex(v, field.index)
+		if !ok || (field.omitempty && isEmptyValue(fv)) {
+			continue
+		}
+
+		if sub == nil {
+			values[name] = fv.Interface()
+		} else {
+			value, err := projectFields(fv, sub, joinFieldPath(prefix, name), strict)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+func projectMap(v reflect.Value, paths fieldPaths, prefix string, strict bool) (interface{}, error) {
+	keyType := v.Type().Key()
+	values := make(map[string]interface{}, len(paths))
+	for name, sub := range paths {
+		mv := v.MapIndex(reflect.ValueOf(name).Convert(keyType))
+		if !mv.IsValid() {
+			if strict {
+				return nil, unknownFieldPath(prefix, fieldPaths{name: sub})
+			}
+			continue
+		}
+
+		if sub == nil {
+			values[name] = mv.Interface()
+		} else {
+			value, err := projectFields(mv, sub, joinFieldPath(prefix, name), strict)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+func joinFieldPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// unknownFieldPath returns the error of the first sorted path in paths.
+func unknownFieldPath(prefix string, paths fieldPaths) error {
+	for len(paths) > 0 {
+		names := make([]string, 0, len(paths))
+		for name := range paths {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		prefix = joinFieldPath(prefix, names[0])
+		paths = paths[names[0]]
+	}
+	return ErrInvalidParameter.WithMessage("the field path '%s' does not exist", prefix)
+}
+
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type projectionField struct {
+	index     []int
+	omitempty bool
+}
+
+// projection is the cached metadata of the type to be projected.
+type projection struct {
+	leaf   bool // Encoded by itself, such as time.Time.
+	fields map[string]projectionField
+}
+
+var projections sync.Map // reflect.Type -> *projection
+
+func cachedProjection(t reflect.Type) *projection {
+	if p, ok := projections.Load(t); ok {
+		return p.(*projection)
+	}
+
+	p := &projection{leaf: isJSONMarshaler(t)}
+	if !p.leaf && t.Kind() == reflect.Struct {
+		p.fields = make(map[string]projectionField, t.NumField())
+		collectProjectionFields(t, nil, p.fields)
+	}
+	projections.Store(t, p)
+	return p
+}
+
+// collectProjectionFields collects the JSON fields of the struct type,
+// and the direct fields take precedence over the embedded ones.
+func collectProjectionFields(t reflect.Type, index []int, fields map[string]projectionField) {
+	var embedded []reflect.StructField
+	for i, _len := 0, t.NumField(); i < _len; i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, sf)
+			continue
+		} else if sf.PkgPath != "" { // Unexported
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = projectionField{
+				index:     append(append([]int(nil), index...), i),
+				omitempty: strings.Contains(opts, ",omitempty"),
+			}
+		}
+	}
+
+	for _, sf := range embedded {
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectProjectionFields(ft, append(append([]int(nil), index...), sf.Index...), fields)
+	}
+}
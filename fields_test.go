@@ -0,0 +1,143 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fieldsBase struct {
+	ID string `json:"Id"`
+}
+
+type fieldsItem struct {
+	*fieldsBase
+	Name  string
+	Price int `json:",omitempty"`
+}
+
+type fieldsOrder struct {
+	fieldsBase
+	Name    string `json:"name"`
+	Items   []fieldsItem
+	Created time.Time
+	Extra   map[string]interface{}
+	Secret  string `json:"-"`
+}
+
+func TestParseFieldPaths(t *testing.T) {
+	paths := parseFieldPaths(" Name, Items.Id,Items.Name ,Extra,Extra.A,,")
+	expect := fieldPaths{
+		"Name":  nil,
+		"Items": fieldPaths{"Id": nil, "Name": nil},
+		"Extra": nil,
+	}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("expect %v, but got %v", expect, paths)
+	}
+}
+
+func TestFieldsRender(t *testing.T) {
+	order := &fieldsOrder{
+		fieldsBase: fieldsBase{ID: "o1"},
+		Name:       "order",
+		Items: []fieldsItem{
+			{fieldsBase: &fieldsBase{ID: "i1"}, Name: "a", Price: 1},
+			{Name: "b"},
+		},
+		Created: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Extra:   map[string]interface{}{"A": map[string]interface{}{"B": 1, "C": 2}},
+		Secret:  "secret",
+	}
+
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.NewContext = func() *Context {
+		c := NewContext()
+		c.Render = FieldsRender(nil, FieldsStrict())
+		return c
+	}
+	svc.Register("Order", func(c *Context) error { return c.Success(order) })
+	svc.Register("List", func(c *Context) error { return c.Success([]*fieldsOrder{order, nil}) })
+	svc.Register("Fail", func(c *Context) error { return ErrResourceNotFound })
+
+	call := func(action, fields string) (int, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action+"&Fields="+fields, nil)
+		svc.ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+	data := func(body string) string {
+		var resp struct{ Data json.RawMessage }
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return string(resp.Data)
+	}
+
+	tests := []struct {
+		action string
+		fields string
+		data   string
+	}{
+		{"Order", "Id,name", `{"Id":"o1","name":"order"}`},
+		{"Order", "Items.Id,Items.Price", `{"Items":[{"Id":"i1","Price":1},{}]}`},
+		{"Order", "Created,Extra.A.B", `{"Created":"2021-01-02T03:04:05Z","Extra":{"A":{"B":1}}}`},
+		{"List", "Id", `[{"Id":"o1"},null]`},
+	}
+	for _, test := range tests {
+		code, body := call(test.action, test.fields)
+		if code != 200 || data(body) != test.data {
+			t.Errorf("%s?Fields=%s: expect data %s, but got %d %s", test.action, test.fields, test.data, code, body)
+		}
+	}
+
+	// The original data is not modified.
+	if order.Name != "order" || len(order.Items) != 2 || order.Items[0].Price != 1 ||
+		len(order.Extra["A"].(map[string]interface{})) != 2 {
+		t.Errorf("the original data is modified: %+v", order)
+	}
+
+	for _, fields := range []string{"Secret", "Items.Unknown", "Name.Id", "Extra.X"} {
+		if code, body := call("Order", fields); code != 400 || !strings.Contains(body, ErrInvalidParameter.Code) {
+			t.Errorf("Fields=%s: expect the invalid parameter, but got %d %s", fields, code, body)
+		}
+	}
+
+	if code, body := call("Fail", "Id"); code != 404 || !strings.Contains(body, ErrResourceNotFound.Code) {
+		t.Errorf("unexpected response: %d %s", code, body)
+	}
+	if _, body := call("Order", ""); !strings.Contains(body, `"name":"order"`) || strings.Contains(body, "secret") {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	// Ignore the nonexistent paths if not strict.
+	svc = NewService()
+	svc.NewContext = func() *Context {
+		c := NewContext()
+		c.Render = FieldsRender(nil)
+		return c
+	}
+	svc.Register("Order", func(c *Context) error { return c.Success(order) })
+	if code, body := call("Order", "Id,Unknown,name.X"); code != 200 || data(body) != `{"Id":"o1","name":"order"}` {
+		t.Errorf("unexpected response: %d %s", code, body)
+	}
+}
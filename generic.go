@@ -0,0 +1,67 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsvc
+
+import (
+	"reflect"
+	"sync"
+)
+
+// RegisterFunc registers a typed function as the service named name,
+// which binds the request into a new Req by c.Bind, calls fn with it,
+// then responds the result by c.Respond.
+//
+// The types of Req and Resp are registered as the metadata automatically,
+// like WithRequestType and WithResponseType.
+//
+// Notice: the request value is reused by a pool after fn returns,
+// so fn must not retain it.
+func RegisterFunc[Req any, Resp any](svc *Service, name string,
+	fn func(c *Context, req *Req) (Resp, error), opts ...ActionOption) {
+	if fn == nil {
+		panic("RegisterFunc: the function must not be empty")
+	}
+
+	pool := sync.Pool{New: func() interface{} { return new(Req) }}
+	handler := func(c *Context) (err error) {
+		req := pool.Get().(*Req)
+		defer func() {
+			var zero Req
+			*req = zero
+			pool.Put(req)
+		}()
+
+		if err = c.Bind(req); err != nil {
+			return
+		} else if c.svc != nil && c.svc.hasEventHooks() {
+			bound := *req // The pooled request is reset after fn returns.
+			c.boundReq = &bound
+		}
+
+		resp, err := fn(c, req)
+		if err != nil {
+			return c.Respond(nil, err)
+		}
+		return c.Respond(resp, nil)
+	}
+
+	_opts := make([]ActionOption, 0, len(opts)+2)
+	_opts = append(_opts, WithRequestType(reflect.TypeOf((*Req)(nil)).Elem()),
+		WithResponseType(reflect.TypeOf((*Resp)(nil)).Elem()))
+	svc.RegisterWithOptions(name, handler, append(_opts, opts...)...)
+}
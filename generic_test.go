@@ -0,0 +1,85 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	type Request struct {
+		Name string `json:"Name"`
+	}
+	type Response struct {
+		Greeting string
+	}
+
+	svc := NewService()
+	svc.NewContext = func() *Context {
+		c := NewContext()
+		c.Validate = func(v interface{}) error {
+			if v.(*Request).Name == "" {
+				return errors.New("missing Name")
+			}
+			return nil
+		}
+		return c
+	}
+	RegisterFunc(svc, "Greet", func(c *Context, req *Request) (Response, error) {
+		if req.Name == "error" {
+			return Response{}, ErrFailedOperation
+		}
+		return Response{Greeting: "hello " + req.Name}, nil
+	}, WithDescription("greet"))
+
+	call := func(body string) (resp struct {
+		Error Error
+		Data  *Response
+	}) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=Greet", strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call(`{"Name":"world"}`); resp.Data == nil || resp.Data.Greeting != "hello world" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp := call(`{}`); resp.Error.Code != ErrInvalidParameter.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrInvalidParameter.Code, resp.Error.Code)
+	}
+	if resp := call(`{"Name":"error"}`); resp.Error.Code != ErrFailedOperation.Code || resp.Data != nil {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	info, _ := svc.ActionInfo("Greet")
+	if info.RequestType != reflect.TypeOf(Request{}) || info.ResponseType != reflect.TypeOf(Response{}) ||
+		info.Description != "greet" {
+		t.Errorf("unexpected action info: %+v", info)
+	}
+}
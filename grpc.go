@@ -0,0 +1,152 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// The gRPC status codes defined by the gRPC specification,
+// which are the same as those of google.golang.org/grpc/codes.
+const (
+	grpcOK                 uint32 = 0
+	grpcCanceled           uint32 = 1
+	grpcUnknown            uint32 = 2
+	grpcInvalidArgument    uint32 = 3
+	grpcDeadlineExceeded   uint32 = 4
+	grpcNotFound           uint32 = 5
+	grpcAlreadyExists      uint32 = 6
+	grpcPermissionDenied   uint32 = 7
+	grpcResourceExhausted  uint32 = 8
+	grpcFailedPrecondition uint32 = 9
+	grpcAborted            uint32 = 10
+	grpcOutOfRange         uint32 = 11
+	grpcUnimplemented      uint32 = 12
+	grpcInternal           uint32 = 13
+	grpcUnavailable        uint32 = 14
+	grpcDataLoss           uint32 = 15
+	grpcUnauthenticated    uint32 = 16
+)
+
+var (
+	grpcLock  sync.RWMutex
+	grpcCodes = map[string]uint32{
+		ErrInvalidAction.Code:         grpcUnimplemented,
+		ErrUnsupportedOperation.Code:  grpcUnimplemented,
+		ErrMethodNotAllowed.Code:      grpcUnimplemented,
+		ErrResourceInUse.Code:         grpcFailedPrecondition,
+		ErrResourceInsufficient.Code:  grpcResourceExhausted,
+		ErrRequestEntityTooLarge.Code: grpcResourceExhausted,
+	}
+)
+
+// RegisterGRPCCode registers the gRPC status code of the error code,
+// which takes precedence over the mapping by the HTTP status code.
+func RegisterGRPCCode(code string, grpcCode uint32) {
+	if code == "" {
+		panic("RegisterGRPCCode: the error code must not be empty")
+	}
+
+	grpcLock.Lock()
+	grpcCodes[code] = grpcCode
+	grpcLock.Unlock()
+}
+
+// GRPCCode returns the gRPC status code of the error, such as 3 for
+// ErrInvalidParameter, 5 for ErrNotFound and 13 for ErrServerError,
+// which is looked up by the error code registered by RegisterGRPCCode,
+// then mapped from the HTTP status code of the error, or registered
+// by RegisterError.
+//
+// Return 0 if err is nil, or 2 if it is not Error.
+func GRPCCode(err error) uint32 {
+	var e Error
+	switch _err := err.(type) {
+	case nil:
+		return grpcOK
+	case Error:
+		e = _err
+	case interface{ CodeError() Error }:
+		e = _err.CodeError()
+	default:
+		switch err {
+		case context.Canceled:
+			return grpcCanceled
+		case context.DeadlineExceeded:
+			return grpcDeadlineExceeded
+		default:
+			return grpcUnknown
+		}
+	}
+
+	grpcLock.RLock()
+	code, ok := grpcCodes[e.Code]
+	grpcLock.RUnlock()
+	if ok {
+		return code
+	}
+
+	status := e.Status
+	if status == 0 {
+		info, _ := DefaultErrorRegistry.Lookup(e.Code)
+		status = info.Status
+	}
+	return grpcCodeFromStatus(status)
+}
+
+func grpcCodeFromStatus(status int) uint32 {
+	switch status {
+	case http.StatusOK:
+		return grpcOK
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return grpcInvalidArgument
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusConflict:
+		return grpcAborted
+	case http.StatusPreconditionFailed:
+		return grpcFailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return grpcOutOfRange
+	case http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case StatusClientClosedRequest:
+		return grpcCanceled
+	case http.StatusNotImplemented:
+		return grpcUnimplemented
+	case http.StatusServiceUnavailable:
+		return grpcUnavailable
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	}
+
+	if status >= 500 {
+		return grpcInternal
+	}
+	return grpcUnknown
+}
+
+func (c *Context) setGRPCCodeHeader(code uint32) {
+	if !c.res.Wrote {
+		c.res.Header().Set("X-Grpc-Code", strconv.FormatUint(uint64(code), 10))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGRPCCode(t *testing.T) {
+	RegisterGRPCCode("AccountLocked", grpcFailedPrecondition)
+	defer func() {
+		grpcLock.Lock()
+		delete(grpcCodes, "AccountLocked")
+		grpcLock.Unlock()
+	}()
+
+	for _, test := range []struct {
+		err  error
+		code uint32
+	}{
+		{nil, 0},
+		{errors.New("error"), 2},
+		{context.Canceled, 1},
+		{context.DeadlineExceeded, 4},
+		{ErrInvalidParameter.WithMessage("missing id"), 3},
+		{ErrInvalidAction, 12},
+		{ErrNotFound, 5},
+		{ErrResourceNotFound, 5},
+		{ErrUnauthorized, 16},
+		{ErrAuthFailureTokenExpired, 16},
+		{ErrForbidden, 7},
+		{ErrConflict, 10},
+		{ErrThrottling, 8},
+		{ErrQuotaExceeded, 8},
+		{ErrServerError, 13},
+		{ErrServiceUnavailable, 14},
+		{ErrGatewayTimeout, 4},
+		{ErrClientClosedRequest, 1},
+		{NewError("AccountLocked", "account is locked"), 9},
+		{NewError("Unregistered", "unregistered"), 2},
+		{codeError{ErrNotFound}, 5},
+	} {
+		if code := GRPCCode(test.err); code != test.code {
+			t.Errorf("%v: expect the grpc code %d, but got %d", test.err, test.code, code)
+		}
+	}
+}
+
+func TestServiceGRPCCodeHeader(t *testing.T) {
+	svc := NewService()
+	svc.GRPCCodeHeader = true
+	svc.Register("Get", func(c *Context) error { return c.Success(nil) })
+	svc.Register("Fail", func(c *Context) error { return ErrNotFound })
+
+	for action, code := range map[string]string{"Get": "0", "Fail": "5"} {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action="+action, nil))
+		if v := rec.Header().Get("X-Grpc-Code"); v != code {
+			t.Errorf("%s: expect the grpc code %s, but got '%s'", action, code, v)
+		}
+	}
+}
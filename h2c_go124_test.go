@@ -0,0 +1,89 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+// +build go1.24
+
+package httpsvc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServiceServeH2C(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	flushed := make(chan struct{})
+	svc := NewService()
+	svc.Register("Ping", func(c *Context) error {
+		if err := c.Push("/static/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("expect the error ErrNotSupported, but got %v", err)
+		}
+		return c.Success(c.Request().Proto)
+	})
+	svc.Register("Stream", func(c *Context) error {
+		c.Text(200, "text/plain", "chunk\n")
+		c.ResponseWriter().(http.Flusher).Flush()
+		<-flushed
+		return c.Text(200, "text/plain", "end\n")
+	})
+	go svc.Serve(ln, WithH2C())
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	baseURL := "http://" + ln.Addr().String()
+
+	var proto string
+	c := NewClient(baseURL, ClientHTTPClient(client))
+	for i := 0; i < 100; i++ {
+		if err = c.Invoke(context.Background(), "Ping", "", nil, &proto); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	} else if proto != "HTTP/2.0" {
+		t.Errorf("expect the protocol '%s', but got '%s'", "HTTP/2.0", proto)
+	}
+
+	resp, err := client.Get(baseURL + "/?Action=Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	} else if line != "chunk\n" {
+		t.Errorf("expect the flushed chunk, but got '%s'", line)
+	}
+	close(flushed)
+
+	if line, _ := reader.ReadString('\n'); strings.TrimSpace(line) != "end" {
+		t.Errorf("expect the line '%s', but got '%s'", "end", line)
+	}
+}
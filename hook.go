@@ -0,0 +1,94 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// OnRequest registers the hooks that run in turn before resolving
+// and handling the action, but after extracting the action, version
+// and request id. If a hook returns an error or panics, the later hooks
+// and the handler are skipped and the error is responded. The panic
+// is reported by Service.PanicHandler as well.
+//
+// It is safe to be called at any time, even if the service is serving.
+func (s *Service) OnRequest(hooks ...func(*Context) error) {
+	s.lock.Lock()
+	old, _ := s.reqHooks.Load().([]func(*Context) error)
+	s.reqHooks.Store(append(append([]func(*Context) error{}, old...), hooks...))
+	s.lock.Unlock()
+}
+
+// OnResponse registers the hooks that run in turn after handling
+// the action and responding, which receive the error returned
+// by the handler. A panic in a hook is reported by Service.PanicHandler
+// and does not affect the others.
+//
+// The hooks may get the final status code and response size by
+// c.StatusCode and c.ResponseSize, and check whether the header has been
+// written by c.ResponseHeaderWritten.
+//
+// It is safe to be called at any time, even if the service is serving.
+func (s *Service) OnResponse(hooks ...func(*Context, error)) {
+	s.lock.Lock()
+	old, _ := s.respHooks.Load().([]func(*Context, error))
+	s.respHooks.Store(append(append([]func(*Context, error){}, old...), hooks...))
+	s.lock.Unlock()
+}
+
+func (s *Service) runRequestHooks(c *Context) (err error) {
+	hooks, _ := s.reqHooks.Load().([]func(*Context) error)
+	for i, _len := 0, len(hooks); i < _len && err == nil; i++ {
+		err = s.runRequestHook(hooks[i], c)
+	}
+	return
+}
+
+func (s *Service) runRequestHook(hook func(*Context) error, c *Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.handlePanic(c, r)
+			err = ErrServerError.WithCauses(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return hook(c)
+}
+
+func (s *Service) runResponseHooks(c *Context, err error) {
+	hooks, _ := s.respHooks.Load().([]func(*Context, error))
+	for i, _len := 0, len(hooks); i < _len; i++ {
+		s.runResponseHook(hooks[i], c, err)
+	}
+}
+
+func (s *Service) runResponseHook(hook func(*Context, error), c *Context, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.handlePanic(c, r)
+		}
+	}()
+	hook(c, err)
+}
+
+func (s *Service) handlePanic(c *Context, r interface{}) {
+	if s.PanicHandler != nil {
+		s.PanicHandler(c, r)
+	} else {
+		log.Printf("panic: action=%s, requestid=%s, panic=%v\n%s", c.Action, c.GetRequestID(), r, debug.Stack())
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceHooks(t *testing.T) {
+	var events []string
+	svc := NewService()
+	svc.PanicHandler = func(c *Context, r interface{}) {
+		events = append(events, fmt.Sprint("panic:", r))
+	}
+	svc.Register("svc", func(c *Context) error {
+		events = append(events, "handler")
+		return ErrFailedOperation
+	})
+
+	svc.OnRequest(func(c *Context) error {
+		events = append(events, "req1")
+		c.SetRespHeader("X-Server", "test")
+		return nil
+	}, func(c *Context) error {
+		events = append(events, "req2")
+		if c.GetQuery("deny") != "" {
+			return ErrUnauthorizedOperation
+		} else if c.GetQuery("panic") != "" {
+			panic("req2")
+		}
+		return nil
+	})
+
+	svc.OnResponse(func(c *Context, err error) {
+		events = append(events, "resp1")
+		panic("test")
+	}, func(c *Context, err error) {
+		if c.IsResponded() && err != nil {
+			events = append(events, "resp2:"+err.(Error).Code)
+		}
+	})
+
+	call := func(query string) (resp struct{ Error struct{ Code string } }, server string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc"+query, nil)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp, rec.Header().Get("X-Server")
+	}
+
+	if resp, server := call(""); resp.Error.Code != ErrFailedOperation.Code || server != "test" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	expect := "req1 req2 handler resp1 panic:test resp2:FailedOperation"
+	if s := strings.Join(events, " "); s != expect {
+		t.Errorf("expect events '%s', but got '%s'", expect, s)
+	}
+
+	events = nil
+	if resp, _ := call("&deny=1"); resp.Error.Code != ErrUnauthorizedOperation.Code {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	expect = "req1 req2 resp1 panic:test resp2:UnauthorizedOperation"
+	if s := strings.Join(events, " "); s != expect {
+		t.Errorf("expect events '%s', but got '%s'", expect, s)
+	}
+
+	events = nil
+	if resp, _ := call("&panic=1"); resp.Error.Code != ErrServerError.Code {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	expect = "req1 req2 panic:req2 resp1 panic:test resp2:ServerError"
+	if s := strings.Join(events, " "); s != expect {
+		t.Errorf("expect events '%s', but got '%s'", expect, s)
+	}
+}
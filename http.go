@@ -0,0 +1,41 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import "net/http"
+
+// HTTPHandler converts a http.Handler to Handler, which receives
+// the request and the response writer of the context, and always
+// returns nil, so no response envelope is appended.
+//
+// If the http handler writes nothing, the status code 200 is sent.
+func HTTPHandler(h http.Handler) Handler {
+	return func(c *Context) error {
+		h.ServeHTTP(c.res, c.req)
+		if !c.res.Wrote {
+			c.res.WriteHeader(http.StatusOK)
+		}
+		return nil
+	}
+}
+
+// RegisterHTTP registers a http.Handler as a service, such as a pprof page
+// or a file server, which is converted by HTTPHandler.
+func (s *Service) RegisterHTTP(name string, h http.Handler, mws ...Middleware) {
+	if h == nil {
+		panic("Service.RegisterHTTP: the http handler must not be empty")
+	}
+	s.Register(name, HTTPHandler(h), mws...)
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceRegisterHTTP(t *testing.T) {
+	svc := NewService()
+	svc.RegisterHTTP("hello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(201)
+		io.WriteString(w, "hello "+r.URL.Query().Get("Name"))
+	}))
+	svc.RegisterHTTP("empty", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=hello&Name=world", nil)
+	svc.ServeHTTP(rec, req)
+	if rec.Code != 201 {
+		t.Errorf("expect status code '%d', but got '%d'", 201, rec.Code)
+	} else if body := rec.Body.String(); body != "hello world" {
+		t.Errorf("expect body '%s', but got '%s'", "hello world", body)
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://127.0.0.1?Action=empty", nil)
+	svc.ServeHTTP(rec, req)
+	if rec.Code != 200 || rec.Body.Len() != 0 {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+}
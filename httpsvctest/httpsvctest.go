@@ -0,0 +1,235 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpsvctest supplies the helpers to test the handlers
+// and the middlewares of the action services.
+package httpsvctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	httpsvc "github.com/xgfone/go-http-service"
+)
+
+// CtxOption is used to configure the request of the context.
+type CtxOption func(*ctxConfig)
+
+// WithService returns a context option to set the service of the context.
+//
+// Default: httpsvc.NewService()
+func WithService(svc *httpsvc.Service) CtxOption {
+	return func(c *ctxConfig) { c.svc = svc }
+}
+
+// WithHeader returns a context option to add the request header.
+func WithHeader(key, value string) CtxOption {
+	return func(c *ctxConfig) { c.header.Add(key, value) }
+}
+
+// WithQuery returns a context option to add the query parameter.
+func WithQuery(key, value string) CtxOption {
+	return func(c *ctxConfig) { c.query.Add(key, value) }
+}
+
+// WithJSON returns a context option to set the request body to the JSON
+// of v with the header "Content-Type: application/json", which overrides
+// the body argument of NewContext.
+func WithJSON(v interface{}) CtxOption {
+	return func(c *ctxConfig) { c.json, c.hasJSON = v, true }
+}
+
+// WithRequestID returns a context option to set the request id.
+func WithRequestID(requestID string) CtxOption {
+	return func(c *ctxConfig) { c.requestID = requestID }
+}
+
+type ctxConfig struct {
+	svc       *httpsvc.Service
+	header    http.Header
+	query     url.Values
+	json      interface{}
+	hasJSON   bool
+	requestID string
+}
+
+func newConfig(opts []CtxOption) *ctxConfig {
+	conf := &ctxConfig{header: make(http.Header), query: make(url.Values)}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return conf
+}
+
+func (c *ctxConfig) newRequest(method, target string, body io.Reader) *http.Request {
+	if c.hasJSON {
+		data, err := json.Marshal(c.json)
+		if err != nil {
+			panic(err)
+		}
+		body = bytes.NewReader(data)
+		c.header.Set("Content-Type", httpsvc.MIMEApplicationJSON)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if len(c.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range c.query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	if c.requestID != "" {
+		req.Header.Set("X-Request-Id", c.requestID)
+	}
+	return req
+}
+
+// NewContext returns a new Context acquired from the service with the request
+// built by httptest.NewRequest(method, target, body) and a response recorder,
+// so the buffer pool and the other facilities of the service are available.
+//
+// It panics if failing to marshal the JSON body.
+func NewContext(method, target string, body io.Reader, opts ...CtxOption) (
+	*httpsvc.Context, *httptest.ResponseRecorder) {
+	conf := newConfig(opts)
+	if conf.svc == nil {
+		conf.svc = httpsvc.NewService()
+	}
+
+	rec := httptest.NewRecorder()
+	c := conf.svc.AcquireContext(conf.newRequest(method, target, body), rec)
+	if conf.requestID != "" {
+		c.RequestID = conf.requestID
+	}
+	return c, rec
+}
+
+// Recorded is the recorded response of the action.
+type Recorded struct {
+	Status int
+	Header http.Header
+	Body   []byte
+
+	// The fields decoded from the response envelope.
+	RequestID string
+	Error     httpsvc.Error
+	Data      json.RawMessage
+}
+
+// DecodeData decodes the data of the response envelope into v.
+func (r *Recorded) DecodeData(v interface{}) error { return json.Unmarshal(r.Data, v) }
+
+type envelope struct {
+	RequestID string `json:"RequestId"`
+	Error     struct {
+		Code      string
+		Message   string
+		Component string
+		Details   []httpsvc.ErrorDetail
+	}
+	Data json.RawMessage
+}
+
+// CallAction calls the action of the service by ServeHTTP with reqBody
+// as the JSON body by the method POST, and decodes the response envelope.
+// The service of opts is ignored.
+//
+// reqBody may be nil, a []byte or string as the raw body, or
+// any other value marshaled as JSON.
+func CallAction(svc *httpsvc.Service, action string, reqBody interface{}, opts ...CtxOption) (*Recorded, error) {
+	var body []byte
+	switch v := reqBody.(type) {
+	case nil:
+	case []byte:
+		body = v
+	case string:
+		body = []byte(v)
+	default:
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := newConfig(opts)
+	conf.header.Set("X-Action", action)
+	if conf.header.Get("Content-Type") == "" {
+		conf.header.Set("Content-Type", httpsvc.MIMEApplicationJSON)
+	}
+	req := conf.newRequest(http.MethodPost, "/", bytes.NewReader(body))
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, req)
+
+	r := &Recorded{Status: rec.Code, Header: rec.Header(), Body: rec.Body.Bytes()}
+	if bytes.HasPrefix(bytes.TrimSpace(r.Body), []byte("{")) {
+		var env envelope
+		if err := json.Unmarshal(r.Body, &env); err != nil {
+			return r, err
+		}
+		r.RequestID, r.Data = env.RequestID, env.Data
+		r.Error = httpsvc.Error{Code: env.Error.Code, Message: env.Error.Message,
+			Component: env.Error.Component, Details: env.Error.Details}
+	}
+	return r, nil
+}
+
+// AssertStatus asserts that the status code of the response is status.
+func AssertStatus(t testing.TB, r *Recorded, status int) {
+	t.Helper()
+	if r.Status != status {
+		t.Errorf("expect the status code %d, but got %d", status, r.Status)
+	}
+}
+
+// AssertErrorCode asserts that the error code of the response is code,
+// and "" means no error.
+func AssertErrorCode(t testing.TB, r *Recorded, code string) {
+	t.Helper()
+	if r.Error.Code != code {
+		t.Errorf("expect the error code '%s', but got '%s': %s", code, r.Error.Code, r.Error.Message)
+	}
+}
+
+// AssertData asserts that the data of the response is equal to expect
+// after both are converted into the JSON values.
+func AssertData(t testing.TB, r *Recorded, expect interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(expect)
+	if err != nil {
+		t.Fatalf("fail to marshal the expected data: %v", err)
+	}
+
+	var want, got interface{}
+	json.Unmarshal(data, &want)
+	if len(r.Data) > 0 {
+		if err = json.Unmarshal(r.Data, &got); err != nil {
+			t.Fatalf("fail to decode the response data: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expect the data %s, but got %s", data, r.Data)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvctest
+
+import (
+	"net/http"
+	"testing"
+
+	httpsvc "github.com/xgfone/go-http-service"
+)
+
+func TestNewContext(t *testing.T) {
+	c, rec := NewContext(http.MethodPost, "/?a=1", nil,
+		WithHeader("X-Token", "abc"), WithQuery("b", "2"),
+		WithJSON(map[string]string{"Name": "alice"}), WithRequestID("rid"))
+
+	var req struct{ Name string }
+	if err := c.Bind(&req); err != nil {
+		t.Fatal(err)
+	} else if req.Name != "alice" {
+		t.Errorf("expect the name '%s', but got '%s'", "alice", req.Name)
+	}
+
+	if v := c.GetReqHeader("X-Token"); v != "abc" {
+		t.Errorf("expect the header '%s', but got '%s'", "abc", v)
+	}
+	if q := c.Query(); q.Get("a") != "1" || q.Get("b") != "2" {
+		t.Errorf("unexpected the query: %v", q)
+	}
+	if c.RequestID != "rid" {
+		t.Errorf("expect the request id '%s', but got '%s'", "rid", c.RequestID)
+	}
+
+	buf := c.AcquireBuffer()
+	c.ReleaseBuffer(buf)
+
+	if err := c.Success("ok"); err != nil {
+		t.Fatal(err)
+	} else if body := rec.Body.String(); body != `{"RequestId":"rid","Data":"ok"}`+"\n" {
+		t.Errorf("unexpected the body: %s", body)
+	}
+}
+
+func TestCallAction(t *testing.T) {
+	svc := httpsvc.NewService()
+	svc.MapErrorStatus = true
+	svc.Register("Create", func(c *httpsvc.Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		} else if req.Name == "" {
+			return httpsvc.ErrInvalidParameter.WithMessage("missing Name")
+		}
+		return c.Success(map[string]interface{}{"Name": req.Name, "Id": 1})
+	})
+
+	r, err := CallAction(svc, "Create", map[string]string{"Name": "alice"}, WithRequestID("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertStatus(t, r, http.StatusOK)
+	AssertErrorCode(t, r, "")
+	AssertData(t, r, map[string]interface{}{"Id": 1, "Name": "alice"})
+	if r.RequestID != "abc" {
+		t.Errorf("expect the request id '%s', but got '%s'", "abc", r.RequestID)
+	}
+
+	var resp struct{ Id int }
+	if err = r.DecodeData(&resp); err != nil || resp.Id != 1 {
+		t.Errorf("unexpected the data: %+v, %v", resp, err)
+	}
+
+	if r, err = CallAction(svc, "Create", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	AssertStatus(t, r, http.StatusBadRequest)
+	AssertErrorCode(t, r, httpsvc.ErrInvalidParameter.Code)
+	AssertData(t, r, nil)
+}
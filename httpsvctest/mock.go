@@ -0,0 +1,155 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	httpsvc "github.com/xgfone/go-http-service"
+)
+
+// MockOption is used to configure the mock service.
+type MockOption func(*MockService)
+
+// MockPanicOnUnstubbed returns a mock option to panic when calling
+// the unstubbed action.
+//
+// Default: respond httpsvc.ErrInvalidAction.
+func MockPanicOnUnstubbed() MockOption {
+	return func(m *MockService) { m.panicking = true }
+}
+
+// MockService is a fake action service, which responds the stubbed
+// results of the actions and records the calls, and is safe for
+// the concurrent requests.
+type MockService struct {
+	svc       *httpsvc.Service
+	panicking bool
+
+	lock  sync.Mutex
+	stubs map[string]*MockStub
+	calls map[string][][]byte
+}
+
+// MockStub is the stubbed result of an action.
+type MockStub struct {
+	mock *MockService
+	data interface{}
+	err  error
+}
+
+// NewMockService returns a new mock service.
+func NewMockService(opts ...MockOption) *MockService {
+	m := &MockService{
+		svc:   httpsvc.NewService(),
+		stubs: make(map[string]*MockStub, 8),
+		calls: make(map[string][][]byte, 8),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// As the global middleware, it handles all the actions, registered or not.
+	m.svc.Use(func(httpsvc.Handler) httpsvc.Handler { return m.handle })
+	return m
+}
+
+// ServeHTTP implements the interface http.Handler.
+func (m *MockService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.svc.ServeHTTP(w, r)
+}
+
+// Service returns the underlying service, which may be used to configure
+// the behavior such as MapErrorStatus.
+func (m *MockService) Service() *httpsvc.Service { return m.svc }
+
+// On returns the stub of the action to set its result by Return,
+// which responds the empty data by default.
+func (m *MockService) On(action string) *MockStub {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stub, ok := m.stubs[action]
+	if !ok {
+		stub = &MockStub{mock: m}
+		m.stubs[action] = stub
+	}
+	return stub
+}
+
+// Return sets the data or error responded by the action.
+func (s *MockStub) Return(data interface{}, err error) *MockStub {
+	s.mock.lock.Lock()
+	s.data, s.err = data, err
+	s.mock.lock.Unlock()
+	return s
+}
+
+func (m *MockService) handle(c *httpsvc.Context) error {
+	body, err := c.BodyBytes()
+	if err != nil {
+		return httpsvc.ErrInvalidParameter.WithMessage(err.Error())
+	}
+
+	m.lock.Lock()
+	stub, ok := m.stubs[c.Action]
+	m.calls[c.Action] = append(m.calls[c.Action], append([]byte(nil), body...))
+	var data interface{}
+	if ok {
+		data, err = stub.data, stub.err
+	}
+	m.lock.Unlock()
+
+	if !ok {
+		if m.panicking {
+			panic(fmt.Sprintf("httpsvctest: the action '%s' is not stubbed", c.Action))
+		}
+		return httpsvc.ErrInvalidAction.WithMessage("the action '%s' is not stubbed", c.Action)
+	}
+
+	if err != nil {
+		return err
+	}
+	return c.Success(data)
+}
+
+// Calls returns the request bodies of all the calls of the action in order.
+func (m *MockService) Calls(action string) [][]byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([][]byte(nil), m.calls[action]...)
+}
+
+// DecodeCall decodes the JSON request body of the index-th call
+// of the action into v.
+func (m *MockService) DecodeCall(action string, index int, v interface{}) error {
+	calls := m.Calls(action)
+	if index < 0 || index >= len(calls) {
+		return fmt.Errorf("the action '%s' has no call %d", action, index)
+	}
+	return json.Unmarshal(calls[index], v)
+}
+
+// AssertCalled asserts that the action has been called for times.
+func (m *MockService) AssertCalled(t testing.TB, action string, times int) {
+	t.Helper()
+	if n := len(m.Calls(action)); n != times {
+		t.Errorf("expect the action '%s' to be called %d times, but got %d", action, times, n)
+	}
+}
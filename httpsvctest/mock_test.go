@@ -0,0 +1,90 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvctest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	httpsvc "github.com/xgfone/go-http-service"
+)
+
+func TestMockService(t *testing.T) {
+	mock := NewMockService()
+	mock.On("GetUser").Return(map[string]string{"Name": "alice"}, nil)
+	mock.On("DeleteUser").Return(nil, httpsvc.ErrResourceNotFound)
+
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	client := httpsvc.NewClient(server.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var user struct{ Name string }
+			err := client.Invoke(context.Background(), "GetUser", "", map[string]int{"Id": i}, &user)
+			if err != nil {
+				t.Error(err)
+			} else if user.Name != "alice" {
+				t.Errorf("expect the name '%s', but got '%s'", "alice", user.Name)
+			}
+		}(i)
+	}
+	wg.Wait()
+	mock.AssertCalled(t, "GetUser", 20)
+
+	var req struct{ Id int }
+	if err := mock.DecodeCall("GetUser", 0, &req); err != nil {
+		t.Error(err)
+	}
+	if err := mock.DecodeCall("GetUser", 20, &req); err == nil {
+		t.Error("expect the error of the out-of-range call")
+	}
+
+	err := client.Invoke(context.Background(), "DeleteUser", "", nil, nil)
+	if e, ok := err.(httpsvc.Error); !ok || !e.Is(httpsvc.ErrResourceNotFound) {
+		t.Errorf("unexpected the error: %v", err)
+	}
+	mock.AssertCalled(t, "DeleteUser", 1)
+
+	err = client.Invoke(context.Background(), "CreateUser", "", nil, nil)
+	if e, ok := err.(httpsvc.Error); !ok || !e.Is(httpsvc.ErrInvalidAction) {
+		t.Errorf("unexpected the error: %v", err)
+	}
+	mock.AssertCalled(t, "CreateUser", 1)
+
+	mock.On("DeleteUser").Return(true, nil)
+	var deleted bool
+	if err = client.Invoke(context.Background(), "DeleteUser", "", nil, &deleted); err != nil || !deleted {
+		t.Errorf("unexpected the result: %v, %v", deleted, err)
+	}
+}
+
+func TestMockServicePanicOnUnstubbed(t *testing.T) {
+	mock := NewMockService(MockPanicOnUnstubbed())
+	defer func() {
+		if recover() == nil {
+			t.Error("expect the panic for the unstubbed action")
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/?Action=Unknown", nil)
+	mock.ServeHTTP(httptest.NewRecorder(), req)
+}
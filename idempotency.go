@@ -0,0 +1,242 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyEntry is the entry of the idempotency key.
+type IdempotencyEntry struct {
+	// Completed reports whether the request has been completed.
+	// If false, the request is still in progress.
+	Completed bool
+
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore is used to store the results of the idempotent requests.
+type IdempotencyStore interface {
+	// Begin records the key as in progress with the ttl and returns true
+	// if the key does not exist, or returns the existing entry and false,
+	// which must be atomic, such as SET NX of Redis.
+	Begin(key string, ttl time.Duration) (entry IdempotencyEntry, started bool, err error)
+
+	// Complete stores the completed entry of the key with the ttl.
+	Complete(key string, entry IdempotencyEntry, ttl time.Duration) error
+
+	// Release deletes the key, so that the request can be retried.
+	Release(key string) error
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore, which cleans up
+// the expired entries periodically.
+type MemoryIdempotencyStore struct {
+	lock    sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type memoryIdempotencyEntry struct {
+	IdempotencyEntry
+	expire time.Time
+}
+
+// NewMemoryIdempotencyStore returns a new MemoryIdempotencyStore,
+// which cleans up the expired entries every interval.
+//
+// If interval is equal to or less than 0, it is 1m by default.
+func NewMemoryIdempotencyStore(interval time.Duration) *MemoryIdempotencyStore {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &MemoryIdempotencyStore{
+		entries: make(map[string]memoryIdempotencyEntry, 64),
+		stop:    make(chan struct{}),
+	}
+	go s.loop(interval)
+	return s
+}
+
+// Close stops the cleanup goroutine.
+func (s *MemoryIdempotencyStore) Close() { s.once.Do(func() { close(s.stop) }) }
+
+// Len returns the number of the stored entries.
+func (s *MemoryIdempotencyStore) Len() (n int) {
+	s.lock.Lock()
+	n = len(s.entries)
+	s.lock.Unlock()
+	return
+}
+
+func (s *MemoryIdempotencyStore) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			for key, entry := range s.entries {
+				if !now.Before(entry.expire) {
+					delete(s.entries, key)
+				}
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// Begin implements the interface IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(key string, ttl time.Duration) (
+	entry IdempotencyEntry, started bool, err error) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expire) {
+		return e.IdempotencyEntry, false, nil
+	}
+
+	s.entries[key] = memoryIdempotencyEntry{expire: now.Add(ttl)}
+	return IdempotencyEntry{}, true, nil
+}
+
+// Complete implements the interface IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(key string, entry IdempotencyEntry, ttl time.Duration) error {
+	entry.Completed = true
+	s.lock.Lock()
+	s.entries[key] = memoryIdempotencyEntry{IdempotencyEntry: entry, expire: time.Now().Add(ttl)}
+	s.lock.Unlock()
+	return nil
+}
+
+// Release implements the interface IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.lock.Lock()
+	delete(s.entries, key)
+	s.lock.Unlock()
+	return nil
+}
+
+// idempotencyKey returns the key scoped by the action, the tenant
+// and the principal.
+func idempotencyKey(c *Context, key string) string {
+	scope := c.Action
+	if c.Tenant != "" {
+		scope += "#" + c.Tenant
+	}
+	if p := c.Principal(); p != nil {
+		scope += "@" + fmt.Sprint(p)
+	}
+	return scope + ":" + key
+}
+
+// Idempotency returns a middleware to guarantee that the state-changing
+// request, whose method is not GET, HEAD or OPTIONS, carrying the header
+// "Idempotency-Key" is executed only once in ttl. The key is scoped
+// by the action, the tenant and the principal if existing.
+//
+// For the new key, the response of the handler is captured and stored
+// when it is completed. For the completed key, the stored response
+// is replayed verbatim with the header "Idempotent-Replayed: true".
+// For the key in progress, ErrConflict is responded with the status code 409.
+//
+// If the handler panics, the key is released so that it can be retried.
+func Idempotency(store IdempotencyStore, ttl time.Duration) Middleware {
+	if store == nil {
+		panic("Idempotency: the idempotency store must not be nil")
+	} else if ttl <= 0 {
+		panic("Idempotency: the ttl must be greater than 0")
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			switch c.req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			key := c.req.Header.Get("Idempotency-Key")
+			if key == "" {
+				return next(c)
+			}
+
+			key = idempotencyKey(c, key)
+			entry, started, err := store.Begin(key, ttl)
+			if err != nil {
+				return ErrServerError.WithCauses(err)
+			} else if !started {
+				return replayIdempotency(c, entry)
+			}
+
+			completed := false
+			defer func() {
+				if !completed {
+					store.Release(key)
+				}
+			}()
+
+			resp := c.ResponseWriter()
+			tee := &teeResponseWriter{ResponseWriter: resp}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			entry = IdempotencyEntry{
+				Status: c.StatusCode(),
+				Header: cloneHeader(resp.Header()),
+				Body:   tee.buf,
+			}
+			if serr := store.Complete(key, entry, ttl); serr == nil {
+				completed = true
+			}
+			return
+		}
+	}
+}
+
+func replayIdempotency(c *Context, entry IdempotencyEntry) (err error) {
+	if !entry.Completed {
+		setContentType(c.res.Header(), MIMEApplicationJSONCharsetUTF8)
+		c.res.WriteHeader(http.StatusConflict)
+		err = ErrConflict.WithMessage("the request with the same idempotency key is in progress")
+		c.Failure(err)
+		return
+	}
+
+	header := c.res.Header()
+	for k, v := range entry.Header {
+		if _, ok := header[k]; !ok {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	header.Set("Idempotent-Replayed", "true")
+	c.res.WriteHeader(entry.Status)
+	_, err = c.res.Write(entry.Body)
+	return
+}
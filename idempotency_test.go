@@ -0,0 +1,93 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	store := NewMemoryIdempotencyStore(0)
+	defer store.Close()
+
+	var calls int
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	svc := NewService()
+	svc.Use(Idempotency(store, time.Minute))
+	svc.Register("Pay", func(c *Context) error {
+		calls++
+		if c.Query().Get("Block") != "" {
+			close(entered)
+			<-release
+		}
+		if c.Query().Get("Panic") != "" {
+			panic("test")
+		}
+		c.SetRespHeader("X-Payment", "1")
+		c.WriteHeader(http.StatusCreated)
+		return c.Success(calls)
+	})
+
+	call := func(query, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?Action=Pay"+query, nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call("", "k1")
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"Data":1`) {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = call("", "k1")
+	if calls != 1 || rec.Code != http.StatusCreated || rec.Header().Get("X-Payment") != "1" ||
+		rec.Header().Get("Idempotent-Replayed") != "true" || !strings.Contains(rec.Body.String(), `"Data":1`) {
+		t.Errorf("unexpected replay: %d, %v, %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	if call("", "k2"); calls != 2 {
+		t.Errorf("expect 2 calls, but got %d", calls)
+	}
+	if call("", ""); calls != 3 {
+		t.Errorf("expect 3 calls, but got %d", calls)
+	}
+
+	done := make(chan struct{})
+	go func() { call("&Block=1", "k3"); close(done) }()
+	<-entered
+	if rec = call("", "k3"); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), ErrConflict.Code) {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	close(release)
+	<-done
+
+	func() {
+		defer func() { recover() }()
+		call("&Panic=1", "k4")
+	}()
+	if _, started, _ := store.Begin("Pay:k4", time.Minute); !started {
+		t.Errorf("the key is not released after panicking")
+	}
+}
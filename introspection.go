@@ -0,0 +1,121 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServiceInfo is the information of a registered service.
+type ServiceInfo struct {
+	Name         string
+	Aliases      []string         `json:",omitempty" xml:",omitempty"`
+	Description  string           `json:",omitempty" xml:",omitempty"`
+	Tags         []string         `json:",omitempty" xml:",omitempty"`
+	RequestType  string           `json:",omitempty" xml:",omitempty"`
+	ResponseType string           `json:",omitempty" xml:",omitempty"`
+	Deprecation  *DeprecationInfo `json:",omitempty" xml:",omitempty"`
+	Disabled     *DisabledInfo    `json:",omitempty" xml:",omitempty"`
+
+	Versions       []string `json:",omitempty" xml:",omitempty"`
+	DefaultVersion string   `json:",omitempty" xml:",omitempty"`
+}
+
+// DeprecationInfo is the information of the deprecated service.
+type DeprecationInfo struct {
+	Message string    `json:",omitempty" xml:",omitempty"`
+	Sunset  time.Time `json:",omitempty" xml:",omitempty"`
+}
+
+// DescribeServices returns the information of all the registered services,
+// including those of the mounted sub-services, sorted by the name,
+// which only contains the services whose names have the prefix
+// if it is not empty.
+func (s *Service) DescribeServices(prefix string) []ServiceInfo {
+	r := s.loadRegistry()
+	aliases := make(map[string][]string, len(r.mappings))
+	for from := range r.mappings {
+		// Resolve the mapping chain, so that A->B->C lists A as the alias of C.
+		if to, ok := r.resolve(from); ok {
+			aliases[to] = append(aliases[to], from)
+		}
+	}
+
+	keys := make([]string, 0, len(r.handlers)+len(r.versions))
+	for key := range r.handlers {
+		keys = append(keys, key)
+	}
+	for key := range r.versions {
+		if _, ok := r.handlers[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	infos := make([]ServiceInfo, 0, len(keys))
+	for _, key := range keys {
+		if info := r.actionInfo(key); strings.HasPrefix(info.Name, prefix) {
+			infos = append(infos, ServiceInfo{
+				Name:         info.Name,
+				Aliases:      aliases[key],
+				Description:  info.Description,
+				Tags:         info.Tags,
+				RequestType:  typeName(info.RequestType),
+				ResponseType: typeName(info.ResponseType),
+				Deprecation:  info.Deprecation,
+				Disabled:     info.Disabled,
+
+				Versions:       info.Versions,
+				DefaultVersion: info.DefaultVersion,
+			})
+		}
+	}
+
+	infos = append(infos, s.describeMounts(prefix)...)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	for i := range infos {
+		sort.Strings(infos[i].Aliases)
+	}
+
+	return infos
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// EnableIntrospection registers a service named name, such as
+// "DescribeServices", to return the information of all the registered
+// services, which may be filtered by the name prefix from the parameter
+// "Name".
+//
+// mws is used to guard the service, such as the authentication.
+func (s *Service) EnableIntrospection(name string, mws ...Middleware) {
+	s.RegisterWithOptions(name, func(c *Context) (err error) {
+		var req struct {
+			Name string `query:"Name" json:"Name"`
+		}
+		if err = c.Bind(&req); err != nil {
+			return
+		}
+		return c.Success(s.DescribeServices(req.Name))
+	}, WithMiddlewares(mws...),
+		WithDescription("Describe the information of all the services"))
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEnableIntrospection(t *testing.T) {
+	handler := func(c *Context) error { return nil }
+	guard := func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.GetReqHeader("X-Token") != "token" {
+				return ErrAuthFailureTokenFailure
+			}
+			return next(c)
+		}
+	}
+
+	svc := NewService()
+	svc.EnableIntrospection("DescribeServices", guard)
+	svc.RegisterWithOptions("CreateUser", handler, WithDescription("create a user"))
+	svc.Register("DeleteUser", handler)
+	svc.Mapping("RemoveUser", "DeleteUser")
+	svc.Mapping("DropUser", "RemoveUser") // Map to the alias.
+
+	call := func(query, token string) (resp struct {
+		Error Error
+		Data  []ServiceInfo
+	}) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=DescribeServices"+query, nil)
+		req.Header.Set("X-Token", token)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call("", ""); resp.Error.Code != ErrAuthFailureTokenFailure.Code {
+		t.Errorf("expect error code '%s', but got '%s'",
+			ErrAuthFailureTokenFailure.Code, resp.Error.Code)
+	}
+
+	expect := []ServiceInfo{
+		{Name: "CreateUser", Description: "create a user"},
+		{Name: "DeleteUser", Aliases: []string{"DropUser", "RemoveUser"}},
+	}
+	if resp := call("&Name=", "token"); len(resp.Data) != 3 {
+		t.Errorf("expect %d services, but got %d", 3, len(resp.Data))
+	} else if !reflect.DeepEqual(resp.Data[:2], expect) {
+		t.Errorf("expect services '%+v', but got '%+v'", expect, resp.Data[:2])
+	}
+
+	if resp := call("&Name=Delete", "token"); !reflect.DeepEqual(resp.Data, expect[1:]) {
+		t.Errorf("expect services '%+v', but got '%+v'", expect[1:], resp.Data)
+	}
+}
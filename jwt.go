@@ -0,0 +1,378 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWTClaims is the claims of the JSON Web Token.
+type JWTClaims map[string]interface{}
+
+// String returns the string value of the claim named key.
+func (c JWTClaims) String(key string) string {
+	s, _ := c[key].(string)
+	return s
+}
+
+// Subject returns the claim "sub".
+func (c JWTClaims) Subject() string { return c.String("sub") }
+
+// Time returns the time of the NumericDate claim named key, such as "exp".
+func (c JWTClaims) Time(key string) (t time.Time, ok bool) {
+	switch v := c[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return time.Unix(n, 0), true
+		}
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	}
+	return
+}
+
+// HasAudience reports whether the claim "aud" contains the audience.
+func (c JWTClaims) HasAudience(audience string) bool {
+	switch v := c["aud"].(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, aud := range v {
+			if aud == audience {
+				return true
+			}
+		}
+	case []string:
+		for _, aud := range v {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JWTClaimsFromContext returns the JWT claims stored by JWTAuth.
+func JWTClaimsFromContext(c *Context) (claims JWTClaims, ok bool) {
+	claims, ok = c.Principal().(JWTClaims)
+	return
+}
+
+// JWTOptions is the options of the JWT authentication.
+type JWTOptions struct {
+	// KeyFunc returns the key to verify the signature of the token
+	// by the algorithm and the key id from the token header, which is
+	// []byte for HMAC, *rsa.PublicKey for RSA and *ecdsa.PublicKey for ECDSA.
+	//
+	// See JWTStaticKey and JWTKeySet. It is required.
+	KeyFunc func(alg, kid string) (key interface{}, err error)
+
+	// Algorithms is the allowed signing algorithms.
+	//
+	// Default: all the supported algorithms, that's, HS256, HS384, HS512,
+	// RS256, RS384, RS512, ES256, ES384 and ES512.
+	Algorithms []string
+
+	// Issuer and Audience are used to validate the claims "iss" and "aud"
+	// if not empty.
+	Issuer   string
+	Audience string
+
+	// ClockSkew is the tolerance of the clock skew to validate
+	// the claims "exp" and "nbf".
+	ClockSkew time.Duration
+
+	// Now returns the current time.
+	//
+	// Default: time.Now
+	Now func() time.Time
+}
+
+// JWTStaticKey returns a key function to always return the key.
+func JWTStaticKey(key interface{}) func(alg, kid string) (interface{}, error) {
+	return func(string, string) (interface{}, error) { return key, nil }
+}
+
+// JWTKeySet returns a key function to look up the key by the key id.
+func JWTKeySet(keys map[string]interface{}) func(alg, kid string) (interface{}, error) {
+	return func(alg, kid string) (interface{}, error) {
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("no key '%s'", kid)
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtAlgorithm struct {
+	hash crypto.Hash
+	new  func() hash.Hash
+	kind byte // 'H', 'R' or 'E'
+	size int  // The size of r and s of ECDSA.
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {crypto.SHA256, sha256.New, 'H', 0},
+	"HS384": {crypto.SHA384, sha512.New384, 'H', 0},
+	"HS512": {crypto.SHA512, sha512.New, 'H', 0},
+	"RS256": {crypto.SHA256, sha256.New, 'R', 0},
+	"RS384": {crypto.SHA384, sha512.New384, 'R', 0},
+	"RS512": {crypto.SHA512, sha512.New, 'R', 0},
+	"ES256": {crypto.SHA256, sha256.New, 'E', 32},
+	"ES384": {crypto.SHA384, sha512.New384, 'E', 48},
+	"ES512": {crypto.SHA512, sha512.New, 'E', 66},
+}
+
+var errJWTKeyType = errors.New("the key type does not match the algorithm")
+
+func (a jwtAlgorithm) digest(data string) []byte {
+	h := a.new()
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (a jwtAlgorithm) sign(data string, key interface{}) ([]byte, error) {
+	switch a.kind {
+	case 'H':
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, errJWTKeyType
+		}
+		h := hmac.New(a.new, secret)
+		h.Write([]byte(data))
+		return h.Sum(nil), nil
+
+	case 'R':
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errJWTKeyType
+		}
+		return rsa.SignPKCS1v15(rand.Reader, priv, a.hash, a.digest(data))
+
+	default:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errJWTKeyType
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, priv, a.digest(data))
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, a.size*2)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[a.size-len(rb):a.size], rb)
+		copy(sig[a.size*2-len(sb):], sb)
+		return sig, nil
+	}
+}
+
+func (a jwtAlgorithm) verify(data string, sig []byte, key interface{}) error {
+	switch a.kind {
+	case 'H':
+		expect, err := a.sign(data, key)
+		if err != nil {
+			return err
+		} else if !hmac.Equal(sig, expect) {
+			return errors.New("signature does not match")
+		}
+		return nil
+
+	case 'R':
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errJWTKeyType
+		}
+		return rsa.VerifyPKCS1v15(pub, a.hash, a.digest(data), sig)
+
+	default:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errJWTKeyType
+		} else if len(sig) != a.size*2 {
+			return errors.New("invalid signature size")
+		}
+		r := new(big.Int).SetBytes(sig[:a.size])
+		s := new(big.Int).SetBytes(sig[a.size:])
+		if !ecdsa.Verify(pub, a.digest(data), r, s) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	}
+}
+
+// SignJWT signs the claims by the algorithm and the key, and returns
+// the JSON Web Token, which is used to mint the token for the tests.
+//
+// key is []byte for HMAC, *rsa.PrivateKey for RSA and *ecdsa.PrivateKey
+// for ECDSA. kid is the key id put into the token header if not empty.
+func SignJWT(claims JWTClaims, alg, kid string, key interface{}) (string, error) {
+	algorithm, ok := jwtAlgorithms[alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported jwt algorithm '%s'", alg)
+	}
+
+	header, err := json.Marshal(jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	data := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	sig, err := algorithm.sign(data, key)
+	if err != nil {
+		return "", err
+	}
+	return data + "." + enc.EncodeToString(sig), nil
+}
+
+// ParseJWT parses and verifies the JSON Web Token, and validates the claims.
+//
+// Return ErrAuthFailureTokenFailure if the token is malformed or the signature
+// is invalid, ErrAuthFailureTokenExpired if the token is expired,
+// ErrAuthFailureTokenNotYetValid if the token is not valid yet,
+// and ErrAuthFailureTokenInvalidClaims if the issuer or audience mismatches.
+func ParseJWT(token string, opts JWTOptions) (claims JWTClaims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token")
+	}
+
+	enc := base64.RawURLEncoding
+	var header jwtHeader
+	if data, err := enc.DecodeString(parts[0]); err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token header")
+	} else if err = json.Unmarshal(data, &header); err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token header")
+	}
+
+	algorithm, ok := jwtAlgorithms[header.Alg]
+	if !ok || (len(opts.Algorithms) > 0 && !inStrings(opts.Algorithms, header.Alg)) {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("unsupported algorithm '%s'", header.Alg)
+	}
+
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token signature")
+	}
+
+	if opts.KeyFunc == nil {
+		return nil, ErrServerError.WithMessage("no jwt key function")
+	}
+	key, err := opts.KeyFunc(header.Alg, header.Kid)
+	if err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("invalid key: %s", err.Error())
+	}
+
+	if err = algorithm.verify(parts[0]+"."+parts[1], sig, key); err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage(err.Error())
+	}
+
+	payload, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token payload")
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return nil, ErrAuthFailureTokenFailure.WithMessage("malformed token payload")
+	}
+
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+
+	if exp, ok := claims.Time("exp"); ok && now.After(exp.Add(opts.ClockSkew)) {
+		return nil, ErrAuthFailureTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(opts.ClockSkew).Before(nbf) {
+		return nil, ErrAuthFailureTokenNotYetValid
+	}
+	if opts.Issuer != "" && claims.String("iss") != opts.Issuer {
+		return nil, ErrAuthFailureTokenInvalidClaims.WithMessage("invalid issuer")
+	}
+	if opts.Audience != "" && !claims.HasAudience(opts.Audience) {
+		return nil, ErrAuthFailureTokenInvalidClaims.WithMessage("invalid audience")
+	}
+
+	return claims, nil
+}
+
+func inStrings(ss []string, s string) bool {
+	for _, _s := range ss {
+		if _s == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTAuth returns a middleware to authenticate the request by the bearer
+// JSON Web Token from the header "Authorization", and stores the claims
+// as the principal of the context, which can be acquired by c.Principal()
+// or JWTClaimsFromContext.
+//
+// Return ErrUnauthorized if no bearer token. See ParseJWT for other errors.
+func JWTAuth(opts JWTOptions) Middleware {
+	if opts.KeyFunc == nil {
+		panic("JWTAuth: the key function must not be nil")
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			auth := c.GetReqHeader("Authorization")
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+				return ErrUnauthorized.WithMessage("missing bearer token")
+			}
+
+			claims, err := ParseJWT(strings.TrimSpace(auth[7:]), opts)
+			if err != nil {
+				return err
+			}
+
+			c.SetPrincipal(claims)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	opts := JWTOptions{
+		KeyFunc: JWTKeySet(map[string]interface{}{
+			"hmac":  []byte("secret"),
+			"rsa":   &rsaKey.PublicKey,
+			"ec":    &ecKey.PublicKey,
+			"ec521": &ec521Key.PublicKey,
+		}),
+		Issuer:    "issuer",
+		Audience:  "audience",
+		ClockSkew: time.Minute,
+		Now:       func() time.Time { return now },
+	}
+
+	claims := func(exp, nbf time.Time, iss string) JWTClaims {
+		return JWTClaims{"sub": "user", "iss": iss, "aud": []string{"other", "audience"},
+			"exp": exp.Unix(), "nbf": nbf.Unix()}
+	}
+
+	valid := claims(now.Add(time.Hour), now, "issuer")
+	tests := []struct {
+		claims JWTClaims
+		alg    string
+		kid    string
+		key    interface{}
+		err    string
+	}{
+		{claims: valid, alg: "HS256", kid: "hmac", key: []byte("secret")},
+		{claims: valid, alg: "HS512", kid: "hmac", key: []byte("secret")},
+		{claims: valid, alg: "RS256", kid: "rsa", key: rsaKey},
+		{claims: valid, alg: "ES256", kid: "ec", key: ecKey},
+		{claims: valid, alg: "ES512", kid: "ec521", key: ec521Key},
+		{claims: valid, alg: "HS256", kid: "hmac", key: []byte("wrong"), err: ErrAuthFailureTokenFailure.Code},
+		{claims: valid, alg: "HS256", kid: "rsa", key: []byte("secret"), err: ErrAuthFailureTokenFailure.Code},
+		{claims: valid, alg: "HS256", kid: "none", key: []byte("secret"), err: ErrAuthFailureTokenFailure.Code},
+		{claims: claims(now.Add(-time.Second*30), now, "issuer"), alg: "HS256", kid: "hmac", key: []byte("secret")},
+		{claims: claims(now.Add(-time.Hour), now, "issuer"), alg: "HS256", kid: "hmac",
+			key: []byte("secret"), err: ErrAuthFailureTokenExpired.Code},
+		{claims: claims(now.Add(time.Hour), now.Add(time.Hour), "issuer"), alg: "HS256", kid: "hmac",
+			key: []byte("secret"), err: ErrAuthFailureTokenNotYetValid.Code},
+		{claims: claims(now.Add(time.Hour), now, "other"), alg: "HS256", kid: "hmac",
+			key: []byte("secret"), err: ErrAuthFailureTokenInvalidClaims.Code},
+	}
+
+	for i, test := range tests {
+		token, err := SignJWT(test.claims, test.alg, test.kid, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := ParseJWT(token, opts)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			} else if claims.Subject() != "user" {
+				t.Errorf("%d: expect subject '%s', but got '%s'", i, "user", claims.Subject())
+			}
+		} else if e, _ := err.(Error); e.Code != test.err {
+			t.Errorf("%d: expect error '%s', but got '%v'", i, test.err, err)
+		}
+	}
+
+	if _, err := ParseJWT("a.b", opts); err == nil {
+		t.Errorf("expect an error for the malformed token")
+	}
+
+	opts.Algorithms = []string{"RS256"}
+	token, _ := SignJWT(valid, "HS256", "hmac", []byte("secret"))
+	if _, err := ParseJWT(token, opts); err == nil {
+		t.Errorf("expect an error for the disallowed algorithm")
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	svc := NewService()
+	svc.Use(JWTAuth(JWTOptions{KeyFunc: JWTStaticKey([]byte("secret"))}))
+	svc.Register("svc", func(c *Context) error {
+		claims, _ := JWTClaimsFromContext(c)
+		return c.Success(claims.Subject())
+	})
+
+	call := func(auth string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	token, _ := SignJWT(JWTClaims{"sub": "user"}, "HS256", "", []byte("secret"))
+	if resp := call("Bearer " + token); resp.Data != "user" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp := call(""); resp.Error.Code != ErrUnauthorized.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrUnauthorized.Code, resp.Error.Code)
+	}
+	if resp := call("Bearer " + token + "x"); resp.Error.Code != ErrAuthFailureTokenFailure.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrAuthFailureTokenFailure.Code, resp.Error.Code)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type errorCatalog struct {
+	locales  []string
+	messages map[string]map[string]string // locale -> code -> message
+}
+
+// RegisterErrorMessages registers the localized messages of the error codes
+// for the locale, such as "zh-CN", which are merged into the registered ones.
+//
+// When responding the error, its message is translated into the locale
+// chosen by Context.AcceptLanguage from the registered locales, or kept
+// as it is if no localized message exists. The placeholders "{field}",
+// "{reason}" and "{value}" in the localized message are substituted
+// by the first detail of the error.
+func (s *Service) RegisterErrorMessages(locale string, msgs map[string]string) {
+	if locale == "" {
+		panic("Service.RegisterErrorMessages: the locale must not be empty")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	old, _ := s.errmsgs.Load().(*errorCatalog)
+	catalog := &errorCatalog{messages: make(map[string]map[string]string, 4)}
+	if old != nil {
+		catalog.locales = append(catalog.locales, old.locales...)
+		for l, m := range old.messages {
+			catalog.messages[l] = m
+		}
+	}
+
+	key := strings.ToLower(locale)
+	merged := make(map[string]string, len(catalog.messages[key])+len(msgs))
+	for code, msg := range catalog.messages[key] {
+		merged[code] = msg
+	}
+	for code, msg := range msgs {
+		merged[code] = msg
+	}
+	if _, ok := catalog.messages[key]; !ok {
+		catalog.locales = append(catalog.locales, locale)
+	}
+	catalog.messages[key] = merged
+	s.errmsgs.Store(catalog)
+}
+
+// localizeError returns the localized message of the error.
+func (s *Service) localizeError(c *Context, e Error) (msg string, ok bool) {
+	catalog, _ := s.errmsgs.Load().(*errorCatalog)
+	if catalog == nil {
+		return
+	}
+
+	locale := c.AcceptLanguage(catalog.locales...)
+	if locale == "" {
+		return
+	}
+
+	if msg, ok = catalog.messages[strings.ToLower(locale)][e.Code]; ok &&
+		len(e.Details) > 0 && strings.IndexByte(msg, '{') > -1 {
+		d := e.Details[0]
+		msg = strings.Replace(msg, "{field}", d.Field, -1)
+		msg = strings.Replace(msg, "{reason}", d.Reason, -1)
+		if d.Value != nil {
+			msg = strings.Replace(msg, "{value}", fmt.Sprint(d.Value), -1)
+		}
+	}
+	return
+}
+
+// AcceptLanguage returns the locale in locales best matching the request
+// header "Accept-Language" by the quality values, which matches the locale
+// case-insensitively, or by the primary language, such as "zh" for "zh-CN"
+// and vice versa.
+//
+// Return "" if no locale matches.
+func (c *Context) AcceptLanguage(locales ...string) (locale string) {
+	if len(locales) == 0 {
+		return
+	}
+
+	header := c.req.Header.Get("Accept-Language")
+	var best float64
+	for header != "" {
+		var tag string
+		if index := strings.IndexByte(header, ','); index > -1 {
+			tag, header = header[:index], header[index+1:]
+		} else {
+			tag, header = header, ""
+		}
+
+		q := 1.0
+		if index := strings.IndexByte(tag, ';'); index > -1 {
+			param := strings.TrimSpace(tag[index+1:])
+			tag = tag[:index]
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if tag = strings.TrimSpace(tag); tag == "" || tag == "*" || q <= best {
+			continue
+		}
+
+		if l := matchLocale(tag, locales); l != "" {
+			locale, best = l, q
+		}
+	}
+	return
+}
+
+func matchLocale(tag string, locales []string) (matched string) {
+	for _, locale := range locales {
+		if strings.EqualFold(tag, locale) {
+			return locale
+		} else if matched == "" && strings.EqualFold(primaryLanguage(tag), primaryLanguage(locale)) {
+			matched = locale
+		}
+	}
+	return
+}
+
+func primaryLanguage(tag string) string {
+	if index := strings.IndexByte(tag, '-'); index > -1 {
+		return tag[:index]
+	}
+	return tag
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextAcceptLanguage(t *testing.T) {
+	locales := []string{"en", "zh-CN", "fr-FR"}
+	tests := []struct {
+		header string
+		expect string
+	}{
+		{"", ""},
+		{"*", ""},
+		{"de", ""},
+		{"zh-cn", "zh-CN"},
+		{"zh", "zh-CN"},
+		{"en-US,en;q=0.9", "en"},
+		{"de;q=1, fr;q=0.5, zh-CN;q=0.8", "zh-CN"},
+		{"fr-FR;q=0.2, en;q=0.1", "fr-FR"},
+	}
+
+	svc := NewService()
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", test.header)
+		c := svc.AcquireContext(req, httptest.NewRecorder())
+		if locale := c.AcceptLanguage(locales...); locale != test.expect {
+			t.Errorf("%q: expect '%s', but got '%s'", test.header, test.expect, locale)
+		}
+		svc.ReleaseContext(c)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "de;q=1, fr;q=0.5, zh-CN;q=0.8")
+	c := svc.AcquireContext(req, httptest.NewRecorder())
+	defer svc.ReleaseContext(c)
+	if n := testing.AllocsPerRun(100, func() { c.AcceptLanguage(locales...) }); n != 0 {
+		t.Errorf("expect no allocations, but got %v", n)
+	}
+}
+
+func TestServiceRegisterErrorMessages(t *testing.T) {
+	svc := NewService()
+	svc.RegisterErrorMessages("zh-CN", map[string]string{
+		ErrInvalidParameter.Code: "参数 {field} 无效：{reason}",
+	})
+	svc.RegisterErrorMessages("zh-cn", map[string]string{
+		ErrResourceNotFound.Code: "资源不存在",
+	})
+	svc.Register("Get", func(c *Context) error {
+		return ErrInvalidParameter.WithMessage("invalid Name").
+			WithDetails(ErrorDetail{Field: "Name", Reason: "too short"})
+	})
+	svc.Register("Find", func(c *Context) error { return ErrResourceNotFound })
+	svc.Register("Fail", func(c *Context) error { return ErrServerError })
+
+	for _, test := range []struct {
+		action string
+		lang   string
+		expect string
+	}{
+		{"Get", "zh-CN,zh;q=0.9", "参数 Name 无效：too short"},
+		{"Get", "en", "invalid Name"},
+		{"Get", "", "invalid Name"},
+		{"Find", "zh", "资源不存在"},
+		{"Fail", "zh-CN", ErrServerError.Message},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+test.action, nil)
+		req.Header.Set("Accept-Language", test.lang)
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Message != test.expect {
+			t.Errorf("%s %q: expect '%s', but got '%s'", test.action, test.lang, test.expect, resp.Error.Message)
+		}
+	}
+}
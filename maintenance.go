@@ -0,0 +1,76 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+type maintenance struct {
+	message    string
+	retryAfter time.Duration
+}
+
+// SetMaintenance turns on or off the maintenance mode of the service.
+//
+// When on, all the new requests, except the services in MaintenanceAllowList,
+// are refused with ErrServiceUnavailable and the message before running
+// the request hooks and the middlewares, and the header "Retry-After"
+// is set if retryAfter is greater than 0. But the in-flight requests
+// are not affected.
+func (s *Service) SetMaintenance(on bool, message string, retryAfter time.Duration) {
+	if on {
+		s.maintenance.Store(&maintenance{message: message, retryAfter: retryAfter})
+	} else {
+		s.maintenance.Store((*maintenance)(nil))
+	}
+}
+
+// Maintenance returns the state of the maintenance mode set by SetMaintenance,
+// which may be used by the readiness check.
+func (s *Service) Maintenance() (on bool, message string, retryAfter time.Duration) {
+	if m, _ := s.maintenance.Load().(*maintenance); m != nil {
+		return true, m.message, m.retryAfter
+	}
+	return
+}
+
+func (s *Service) checkMaintenance(c *Context) error {
+	m, _ := s.maintenance.Load().(*maintenance)
+	if m == nil {
+		return nil
+	}
+
+	if len(s.MaintenanceAllowList) > 0 {
+		action := s.normalize(c.Action)
+		for _, name := range s.MaintenanceAllowList {
+			if s.normalize(name) == action {
+				return nil
+			}
+		}
+	}
+
+	if m.retryAfter > 0 {
+		seconds := int64(math.Ceil(m.retryAfter.Seconds()))
+		c.SetRespHeader("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	if m.message == "" {
+		return ErrServiceUnavailable.WithMessage("service is under maintenance")
+	}
+	return ErrServiceUnavailable.WithMessage(m.message)
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	svc := NewService()
+	svc.MaintenanceAllowList = []string{"Health"}
+	svc.Register("Health", func(c *Context) error { return c.Success("ok") })
+	svc.Register("Action", func(c *Context) error {
+		if c.Query().Get("Block") != "" {
+			close(entered)
+			<-release
+		}
+		return c.Success("done")
+	})
+
+	call := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec
+	}
+
+	inflight := make(chan *httptest.ResponseRecorder)
+	go func() { inflight <- call("Action=Action&Block=1") }()
+	<-entered
+
+	svc.SetMaintenance(true, "upgrading", time.Minute)
+	if on, msg, retry := svc.Maintenance(); !on || msg != "upgrading" || retry != time.Minute {
+		t.Errorf("unexpected maintenance: %v, %s, %s", on, msg, retry)
+	}
+
+	rec := call("Action=Action")
+	if !strings.Contains(rec.Body.String(), ErrServiceUnavailable.Code) ||
+		!strings.Contains(rec.Body.String(), "upgrading") {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	} else if retry := rec.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("expect Retry-After '60', but got '%s'", retry)
+	}
+	if rec = call("Action=Health"); !strings.Contains(rec.Body.String(), `"Data":"ok"`) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+
+	close(release)
+	if rec = <-inflight; !strings.Contains(rec.Body.String(), `"Data":"done"`) {
+		t.Errorf("the in-flight request is interrupted: %s", rec.Body.String())
+	}
+
+	svc.SetMaintenance(false, "", 0)
+	if on, _, _ := svc.Maintenance(); on {
+		t.Errorf("the service is still under maintenance")
+	}
+	if rec = call("Action=Action"); !strings.Contains(rec.Body.String(), `"Data":"done"`) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ActionInfo is the metadata of a registered service.
+type ActionInfo struct {
+	Name         string
+	Description  string
+	Tags         []string
+	RequestType  reflect.Type // The type of the request, which is not a pointer.
+	ResponseType reflect.Type // The type of the response data, which is not a pointer.
+	Deprecation  *DeprecationInfo
+	Disabled     *DisabledInfo
+
+	// Versions is the sorted versions registered by RegisterVersion,
+	// and DefaultVersion is the default one.
+	Versions       []string
+	DefaultVersion string
+}
+
+// WithRequestType returns an action option to set the type of the request
+// of the registered service, which may be a value, a pointer to the value,
+// or a reflect.Type.
+func WithRequestType(req interface{}) ActionOption {
+	typ := indirectType(req)
+	return func(a *action) { a.reqType = typ }
+}
+
+// WithResponseType returns an action option to set the type of the response
+// data of the registered service, which may be a value, a pointer to the value,
+// or a reflect.Type.
+func WithResponseType(resp interface{}) ActionOption {
+	typ := indirectType(resp)
+	return func(a *action) { a.respType = typ }
+}
+
+// WithTags returns an action option to append the tags of the registered service.
+func WithTags(tags ...string) ActionOption {
+	return func(a *action) { a.tags = append(a.tags, tags...) }
+}
+
+func indirectType(v interface{}) reflect.Type {
+	typ, ok := v.(reflect.Type)
+	if !ok {
+		if typ = reflect.TypeOf(v); typ == nil {
+			return nil
+		}
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+func (a *action) info() ActionInfo {
+	info := ActionInfo{
+		Name:         a.name,
+		Description:  a.description,
+		RequestType:  a.reqType,
+		ResponseType: a.respType,
+	}
+
+	if len(a.tags) > 0 {
+		info.Tags = append([]string{}, a.tags...)
+	}
+
+	if disabled := a.disabledInfo(); disabled != nil {
+		info.Disabled = &DisabledInfo{Reason: disabled.Reason, RetryAfter: disabled.RetryAfter}
+	}
+
+	if a.deprecation != nil {
+		info.Deprecation = &DeprecationInfo{
+			Message: a.deprecation.message,
+			Sunset:  a.deprecation.sunset,
+		}
+	}
+
+	return info
+}
+
+// ActionInfo returns the metadata of the service named name,
+// which may be an alias by Mapping.
+func (s *Service) ActionInfo(name string) (info ActionInfo, ok bool) {
+	r := s.loadRegistry()
+	var key string
+	if key, ok = r.resolve(s.normalize(name)); ok {
+		info = r.actionInfo(key)
+	}
+	return
+}
+
+// Actions returns the metadata of all the registered services sorted by the name.
+func (s *Service) Actions() []ActionInfo {
+	r := s.loadRegistry()
+	infos := make([]ActionInfo, 0, len(r.handlers)+len(r.versions))
+	for key := range r.handlers {
+		infos = append(infos, r.actionInfo(key))
+	}
+	for key := range r.versions {
+		if _, ok := r.handlers[key]; !ok {
+			infos = append(infos, r.actionInfo(key))
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// actionInfo returns the metadata of the service by the resolved key.
+// If the service is only registered with the versions, the metadata
+// comes from the default version, or the least one.
+func (r *registry) actionInfo(key string) (info ActionInfo) {
+	vs, ok := r.versions[key]
+	if !ok {
+		return r.handlers[key].info()
+	}
+
+	versions := vs.list()
+	if a, ok := r.handlers[key]; ok {
+		info = a.info()
+	} else if a, ok := vs.versions[vs.def]; ok {
+		info = a.info()
+	} else {
+		info = vs.versions[versions[0]].info()
+	}
+	info.Versions, info.DefaultVersion = versions, vs.def
+	return
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestActionInfo(t *testing.T) {
+	type Request struct{ Name string }
+	type Response struct{ ID int }
+
+	svc := NewService()
+	svc.RegisterWithOptions("CreateUser", func(c *Context) error { return nil },
+		WithDescription("create a user"), WithTags("user", "write"),
+		WithRequestType(&Request{}), WithResponseType(reflect.TypeOf(Response{})))
+	svc.Register("DeleteUser", func(c *Context) error { return nil })
+	svc.Mapping("AddUser", "CreateUser")
+
+	expect := ActionInfo{
+		Name:         "CreateUser",
+		Description:  "create a user",
+		Tags:         []string{"user", "write"},
+		RequestType:  reflect.TypeOf(Request{}),
+		ResponseType: reflect.TypeOf(Response{}),
+	}
+	for _, name := range []string{"CreateUser", "AddUser"} {
+		if info, ok := svc.ActionInfo(name); !ok {
+			t.Errorf("%s: no action info", name)
+		} else if !reflect.DeepEqual(info, expect) {
+			t.Errorf("%s: expect '%+v', but got '%+v'", name, expect, info)
+		}
+	}
+
+	if infos := svc.Actions(); len(infos) != 2 || infos[0].Name != "CreateUser" ||
+		infos[1].Name != "DeleteUser" {
+		t.Errorf("unexpected actions: %+v", infos)
+	}
+
+	if infos := svc.DescribeServices("Create"); len(infos) != 1 ||
+		infos[0].RequestType != "httpsvc.Request" || infos[0].ResponseType != "httpsvc.Response" {
+		t.Errorf("unexpected services: %+v", infos)
+	}
+
+	svc.Unregister("CreateUser")
+	if _, ok := svc.ActionInfo("AddUser"); ok {
+		t.Errorf("unexpected the action info after unregistering")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// MirroredResponse is the response captured by the Mirror middleware,
+// whose body is truncated to MirrorMaxCaptureSize.
+type MirroredResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Err     error
+	Latency time.Duration
+}
+
+// MirrorStats is the statistics of the Mirror middleware,
+// whose fields must be loaded atomically.
+type MirrorStats struct {
+	Mirrored uint64 // The number of the requests replayed against the shadow.
+	Dropped  uint64 // The number of the sampled requests dropped as all the workers are busy.
+	Panics   uint64 // The number of the panics swallowed in the shadow path.
+}
+
+// MirrorOption is used to configure the Mirror middleware.
+type MirrorOption func(*mirrorConfig)
+
+// MirrorWorkers returns a mirror option to set the maximum number
+// of the shadow requests executed concurrently. If all the workers
+// are busy, the sampled request is not mirrored.
+//
+// Default: 4
+func MirrorWorkers(workers int) MirrorOption {
+	return func(c *mirrorConfig) { c.workers = workers }
+}
+
+// MirrorTimeout returns a mirror option to set the timeout of the shadow
+// request, which is set as the deadline of the context of the request.
+//
+// Default: 0, which has no timeout.
+func MirrorTimeout(timeout time.Duration) MirrorOption {
+	return func(c *mirrorConfig) { c.timeout = timeout }
+}
+
+// MirrorMaxCaptureSize returns a mirror option to set the maximum size
+// of the response bodies of the primary and the shadow captured to compare,
+// which are truncated if exceeding it. If size is equal to or less than 0,
+// the whole bodies are captured.
+//
+// Default: 65536
+func MirrorMaxCaptureSize(size int) MirrorOption {
+	return func(c *mirrorConfig) { c.maxCapture = size }
+}
+
+// MirrorWithStats returns a mirror option to count into stats.
+func MirrorWithStats(stats *MirrorStats) MirrorOption {
+	return func(c *mirrorConfig) { c.stats = stats }
+}
+
+type mirrorConfig struct {
+	workers    int
+	timeout    time.Duration
+	maxCapture int
+	stats      *MirrorStats
+	sem        chan struct{}
+	target     Handler
+	compare    func(primary, shadow MirroredResponse)
+}
+
+// Mirror returns a middleware to mirror the requests sampled by sampler
+// to the shadow handler target, such as a rewritten one, and to call
+// compare with the captured responses of the primary and the shadow.
+//
+// The primary handler is executed as usual, then the request is replayed
+// asynchronously against target with a detached Context, which copies
+// the request, including the buffered body, and buffers the response
+// in memory, so the shadow never affects the response to the client.
+//
+// If sampler is nil, all the requests are mirrored. If compare is nil,
+// the shadow responses are discarded. The panics of target and compare
+// are swallowed and counted by MirrorStats.Panics.
+func Mirror(target Handler, sampler func(*Context) bool,
+	compare func(primary, shadow MirroredResponse), opts ...MirrorOption) Middleware {
+	if target == nil {
+		panic("Mirror: the shadow handler must not be nil")
+	}
+
+	conf := &mirrorConfig{workers: 4, maxCapture: 65536, target: target, compare: compare}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if conf.workers <= 0 {
+		conf.workers = 4
+	}
+	if conf.stats == nil {
+		conf.stats = new(MirrorStats)
+	}
+	conf.sem = make(chan struct{}, conf.workers)
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if sampler != nil && !sampler(c) {
+				return next(c)
+			}
+
+			// Reserve the worker before detaching the context, so that
+			// the request is not copied if it is dropped.
+			select {
+			case conf.sem <- struct{}{}:
+			default:
+				atomic.AddUint64(&conf.stats.Dropped, 1)
+				return next(c)
+			}
+
+			// Release the worker if not handed off to the shadow,
+			// such as the primary handler panics.
+			var handoff bool
+			defer func() {
+				if !handoff {
+					<-conf.sem
+				}
+			}()
+
+			dc, w, derr := c.detach()
+			if derr != nil {
+				return next(c)
+			}
+
+			start := time.Now()
+			resp := c.ResponseWriter()
+			tee := &teeResponseWriter{ResponseWriter: resp, max: conf.maxCapture}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			primary := MirroredResponse{
+				Status:  c.StatusCode(),
+				Header:  cloneHeader(resp.Header()),
+				Body:    tee.buf,
+				Err:     err,
+				Latency: time.Since(start),
+			}
+
+			handoff = true
+			atomic.AddUint64(&conf.stats.Mirrored, 1)
+			go conf.shadow(dc, w, primary)
+			return
+		}
+	}
+}
+
+func (c *mirrorConfig) shadow(dc *Context, w *bufferResponseWriter, primary MirroredResponse) {
+	defer func() {
+		<-c.sem
+		if r := recover(); r != nil {
+			atomic.AddUint64(&c.stats.Panics, 1)
+		}
+	}()
+
+	if c.timeout > 0 {
+		ctx, cancel := context.WithTimeout(dc.req.Context(), c.timeout)
+		defer cancel()
+		dc.req = dc.req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	err := c.target(dc)
+	if !dc.res.Wrote {
+		dc.Respond(nil, err)
+	}
+
+	if c.compare != nil {
+		body := w.body.Bytes()
+		if c.maxCapture > 0 && len(body) > c.maxCapture {
+			body = body[:c.maxCapture]
+		}
+
+		c.compare(primary, MirroredResponse{
+			Status:  dc.StatusCode(),
+			Header:  w.Header(),
+			Body:    body,
+			Err:     err,
+			Latency: time.Since(start),
+		})
+	}
+}
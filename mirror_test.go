@@ -0,0 +1,162 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	type result struct{ primary, shadow MirroredResponse }
+	results := make(chan result, 1)
+	release := make(chan struct{})
+
+	var stats MirrorStats
+	shadow := func(c *Context) error {
+		if c.Query().Get("Panic") != "" {
+			panic("shadow")
+		} else if c.Query().Get("Block") != "" {
+			<-release
+		}
+
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success("v2:" + req.Name)
+	}
+	compare := func(primary, shadow MirroredResponse) {
+		results <- result{primary, shadow}
+	}
+	sampler := func(c *Context) bool { return c.Query().Get("Skip") == "" }
+
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success("v1:" + req.Name)
+	}, Mirror(shadow, sampler, compare, MirrorWorkers(1), MirrorWithStats(&stats)))
+
+	call := func(query string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?Action=Action"+query, strings.NewReader(`{"Name":"abc"}`))
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		svc.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call(""); !strings.Contains(body, `"Data":"v1:abc"`) {
+		t.Errorf("unexpected primary response: %s", body)
+	}
+	select {
+	case r := <-results:
+		if !strings.Contains(string(r.primary.Body), `"Data":"v1:abc"`) {
+			t.Errorf("unexpected primary body: %s", r.primary.Body)
+		}
+		if r.shadow.Status != 200 || !strings.Contains(string(r.shadow.Body), `"Data":"v2:abc"`) {
+			t.Errorf("unexpected shadow response: %d, %s", r.shadow.Status, r.shadow.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the shadow response is not compared")
+	}
+
+	if body := call("&Skip=1"); !strings.Contains(body, `"Data":"v1:abc"`) {
+		t.Errorf("unexpected primary response: %s", body)
+	}
+
+	if body := call("&Panic=1"); !strings.Contains(body, `"Data":"v1:abc"`) {
+		t.Errorf("unexpected primary response: %s", body)
+	}
+	for i := 0; i < 100 && atomic.LoadUint64(&stats.Panics) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := atomic.LoadUint64(&stats.Panics); n != 1 {
+		t.Errorf("expect 1 panic, but got %d", n)
+	}
+
+	// The only worker is busy, so the next request is not mirrored.
+	call("&Block=1")
+	if body := call(""); !strings.Contains(body, `"Data":"v1:abc"`) {
+		t.Errorf("unexpected primary response: %s", body)
+	}
+	close(release)
+	<-results
+
+	if n := atomic.LoadUint64(&stats.Mirrored); n != 3 {
+		t.Errorf("expect 3 mirrored requests, but got %d", n)
+	}
+	if n := atomic.LoadUint64(&stats.Dropped); n != 1 {
+		t.Errorf("expect 1 dropped request, but got %d", n)
+	}
+
+	// The captured bodies are truncated.
+	svc.Register("Truncated", func(c *Context) error { return c.Success("v1:abc") },
+		Mirror(shadow, nil, compare, MirrorMaxCaptureSize(8)))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/?Action=Truncated", strings.NewReader(`{"Name":"abc"}`))
+	svc.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, `"Data":"v1:abc"`) {
+		t.Errorf("unexpected primary response: %s", body)
+	}
+	select {
+	case r := <-results:
+		if len(r.primary.Body) != 8 || len(r.shadow.Body) != 8 {
+			t.Errorf("expect the captured bodies to be truncated, but got '%s' and '%s'",
+				r.primary.Body, r.shadow.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the shadow response is not compared")
+	}
+}
+
+func TestMirrorPrimaryPanic(t *testing.T) {
+	var stats MirrorStats
+	done := make(chan struct{}, 1)
+	shadow := func(c *Context) error { return c.Success(nil) }
+	compare := func(primary, shadow MirroredResponse) { done <- struct{}{} }
+
+	svc := NewService()
+	svc.Use(Mirror(shadow, nil, compare, MirrorWorkers(1), MirrorWithStats(&stats)))
+	svc.Register("Panic", func(c *Context) error { panic("primary") })
+	svc.Register("Action", func(c *Context) error { return c.Success(nil) })
+
+	call := func(action string) {
+		defer func() { recover() }()
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	call("Panic")
+	call("Action")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the shadow response is not compared")
+	}
+
+	if n := atomic.LoadUint64(&stats.Mirrored); n != 1 {
+		t.Errorf("expect 1 mirrored request, but got %d", n)
+	}
+	if n := atomic.LoadUint64(&stats.Dropped); n != 0 {
+		t.Errorf("expect 0 dropped request, but got %d", n)
+	}
+}
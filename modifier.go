@@ -0,0 +1,240 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// Modifier is used to transform the string value of the struct field
+// with the struct tag "mod", such as `mod:"trim,lower"`.
+type Modifier func(s string) string
+
+var (
+	modlock   sync.Mutex
+	modifiers atomic.Value // map[string]Modifier
+	modplans  atomic.Value // *sync.Map: reflect.Type -> *modPlan
+)
+
+func init() {
+	modifiers.Store(map[string]Modifier{
+		"trim":   strings.TrimSpace,
+		"ltrim":  func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+		"rtrim":  func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+		"lower":  strings.ToLower,
+		"upper":  strings.ToUpper,
+		"title":  titleString,
+		"squish": func(s string) string { return strings.Join(strings.Fields(s), " ") },
+		"escape": html.EscapeString,
+	})
+	modplans.Store(new(sync.Map))
+}
+
+// RegisterModifier registers the modifier named name, which may override
+// the built-in ones: trim, ltrim, rtrim, lower, upper, title, squish
+// collapsing the inner whitespaces, and escape escaping the html.
+func RegisterModifier(name string, modifier Modifier) {
+	if name == "" {
+		panic("RegisterModifier: the modifier name must not be empty")
+	} else if modifier == nil {
+		panic("RegisterModifier: the modifier must not be nil")
+	}
+
+	modlock.Lock()
+	old := modifiers.Load().(map[string]Modifier)
+	mods := make(map[string]Modifier, len(old)+1)
+	for k, v := range old {
+		mods[k] = v
+	}
+	mods[name] = modifier
+	modifiers.Store(mods)
+	modplans.Store(new(sync.Map)) // The cached plans refer to the old modifiers.
+	modlock.Unlock()
+}
+
+// ModifyStruct applies the modifiers of the struct tag "mod" to the fields
+// of the struct that v points to, in turn, such as `mod:"trim,lower"`,
+// which handles the fields of string, the pointers and slices of string,
+// and the nested structs recursively.
+//
+// It is called by c.Bind after binding and before SetDefault and Validate,
+// and may also be used as the hook like SetDefault.
+//
+// It returns an error if the modifier is not registered.
+func ModifyStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("ModifyStruct: the value must be a pointer to struct")
+	}
+	return modifyStruct(rv.Elem())
+}
+
+// modifyValue is the same as ModifyStruct, but ignores the non-struct value.
+func modifyValue(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	return modifyStruct(rv.Elem())
+}
+
+func modifyStruct(v reflect.Value) error {
+	plans := modplans.Load().(*sync.Map)
+	if plan, ok := plans.Load(v.Type()); ok {
+		plan.(*modPlan).apply(v)
+		return nil
+	}
+
+	plan, err := buildModPlan(v.Type(), make(map[reflect.Type]*modPlan))
+	if err != nil {
+		return err
+	}
+
+	plans.Store(v.Type(), plan)
+	plan.apply(v)
+	return nil
+}
+
+type modPlan struct {
+	fields   []modField
+	building bool
+}
+
+type modField struct {
+	index  int
+	mods   []Modifier
+	nested *modPlan
+}
+
+func buildModPlan(t reflect.Type, plans map[reflect.Type]*modPlan) (*modPlan, error) {
+	if plan, ok := plans[t]; ok {
+		return plan, nil
+	}
+
+	plan := &modPlan{building: true}
+	plans[t] = plan
+	defer func() { plan.building = false }()
+
+	for i, _len := 0, t.NumField(); i < _len; i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // Unexported
+			continue
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+			ft = ft.Elem()
+		}
+
+		field := modField{index: i}
+		if tag := sf.Tag.Get("mod"); tag != "" && tag != "-" {
+			if ft.Kind() != reflect.String {
+				return nil, fmt.Errorf("the field '%s.%s' with the modifiers is not a string", t.Name(), sf.Name)
+			}
+
+			mods, err := lookupModifiers(tag)
+			if err != nil {
+				return nil, fmt.Errorf("the field '%s.%s': %s", t.Name(), sf.Name, err)
+			}
+			field.mods = mods
+		} else if ft.Kind() == reflect.Struct {
+			nested, err := buildModPlan(ft, plans)
+			if err != nil {
+				return nil, err
+			} else if len(nested.fields) == 0 && !nested.building {
+				continue
+			}
+			field.nested = nested
+		} else {
+			continue
+		}
+
+		plan.fields = append(plan.fields, field)
+	}
+
+	return plan, nil
+}
+
+func lookupModifiers(tag string) ([]Modifier, error) {
+	registered := modifiers.Load().(map[string]Modifier)
+	names := strings.Split(tag, ",")
+	mods := make([]Modifier, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		mod, ok := registered[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown modifier '%s'", name)
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+func (p *modPlan) apply(v reflect.Value) {
+	for i := range p.fields {
+		p.fields[i].apply(v.Field(p.fields[i].index))
+	}
+}
+
+func (f *modField) apply(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			f.apply(v.Elem())
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i, _len := 0, v.Len(); i < _len; i++ {
+			f.apply(v.Index(i))
+		}
+
+	case reflect.String:
+		if v.CanSet() {
+			s := v.String()
+			for _, mod := range f.mods {
+				s = mod(s)
+			}
+			v.SetString(s)
+		}
+
+	case reflect.Struct:
+		if f.nested != nil {
+			f.nested.apply(v)
+		}
+	}
+}
+
+// titleString upper-cases the first letter of each word.
+func titleString(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		start := unicode.IsSpace(prev)
+		prev = r
+		if start {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type modAddress struct {
+	City string `mod:"trim,title"`
+}
+
+type modNode struct {
+	Name     string `mod:"trim"`
+	Children []*modNode
+}
+
+type modRequest struct {
+	Name     string   `mod:"trim,lower"`
+	Nickname *string  `mod:"squish"`
+	Tags     []string `mod:"trim,upper"`
+	Comment  string   `mod:"escape"`
+	Raw      string
+	Slug     string `mod:"trim,slug"`
+
+	Address   modAddress
+	Addresses []*modAddress
+	Node      *modNode
+
+	unexported string `mod:"trim"`
+}
+
+func TestModifyStruct(t *testing.T) {
+	RegisterModifier("slug", func(s string) string {
+		return strings.Replace(strings.ToLower(s), " ", "-", -1)
+	})
+
+	nickname := "  a   b  c "
+	req := modRequest{
+		Name:       " Alice ",
+		Nickname:   &nickname,
+		Tags:       []string{" a ", "b "},
+		Comment:    "<b>",
+		Raw:        " raw ",
+		Slug:       " Hello World ",
+		Address:    modAddress{City: " new york "},
+		Addresses:  []*modAddress{{City: " paris"}, nil},
+		Node:       &modNode{Name: " root ", Children: []*modNode{{Name: " leaf "}}},
+		unexported: " x ",
+	}
+
+	if err := ModifyStruct(&req); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := modRequest{
+		Name:       "alice",
+		Nickname:   &nickname,
+		Tags:       []string{"A", "B"},
+		Comment:    "&lt;b&gt;",
+		Raw:        " raw ",
+		Slug:       "hello-world",
+		Address:    modAddress{City: "New York"},
+		Addresses:  []*modAddress{{City: "Paris"}, nil},
+		Node:       &modNode{Name: "root", Children: []*modNode{{Name: "leaf"}}},
+		unexported: " x ",
+	}
+	if nickname != "a b c" {
+		t.Errorf("unexpected nickname '%s'", nickname)
+	}
+	if !reflect.DeepEqual(req, expect) {
+		t.Errorf("expect %+v, but got %+v", expect, req)
+	}
+
+	if err := ModifyStruct(req); err == nil {
+		t.Errorf("expect an error for the non-pointer value")
+	}
+
+	var unknown struct {
+		Name string `mod:"trim,unknown"`
+	}
+	if err := ModifyStruct(&unknown); err == nil || !strings.Contains(err.Error(), "unknown modifier 'unknown'") {
+		t.Errorf("expect the unknown modifier error, but got %v", err)
+	}
+
+	var invalid struct {
+		Age int `mod:"trim"`
+	}
+	if err := ModifyStruct(&invalid); err == nil {
+		t.Errorf("expect an error for the non-string field")
+	}
+}
+
+func TestContextBindModifier(t *testing.T) {
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error {
+		var req struct {
+			Name string `json:"Name" mod:"trim,lower"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(req.Name)
+	})
+	svc.Register("Unknown", func(c *Context) error {
+		var req struct {
+			Name string `json:"Name" mod:"nonexistent"`
+		}
+		return c.Bind(&req)
+	})
+
+	call := func(action string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?Action="+action, strings.NewReader(`{"Name":" Bob "}`))
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		svc.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call("Action"); !strings.Contains(body, `"Data":"bob"`) {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if body := call("Unknown"); !strings.Contains(body, ErrServerError.Code) {
+		t.Errorf("unexpected response: %s", body)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"sort"
+	"strings"
+)
+
+// MountOption is used to configure the mounted sub-service.
+type MountOption func(*mount)
+
+// MountPreservePrefix returns a mount option to preserve the prefix
+// of the action name forwarded to the sub-service, which is stripped
+// by default.
+func MountPreservePrefix() MountOption {
+	return func(m *mount) { m.strip = false }
+}
+
+type mount struct {
+	prefix string
+	svc    *Service
+	strip  bool
+}
+
+// serve forwards the request to the sub-service, which uses a new context
+// acquired from the sub-service, so the buffer pool and the defaults,
+// such as Render and Binder, come from the sub-service.
+func (m mount) serve(c *Context) (err error) {
+	sc := m.svc.AcquireContext(c.req, c)
+	sc.Action, sc.Version, sc.RequestID = c.Action, c.GetVersion(), c.GetRequestID()
+	sc.Tenant = c.Tenant
+	sc.principal = c.principal
+	if m.strip {
+		sc.Action = strings.TrimPrefix(c.Action, m.prefix)
+	}
+
+	if err = m.svc.handler.Load().(Handler)(sc); !sc.IsResponded() {
+		sc.Respond(nil, err)
+	}
+	sc.endStats(err)
+
+	c.responded, c.resperr = sc.responded, sc.resperr
+	c.SetRequest(sc.req)
+	m.svc.ReleaseContext(sc)
+	return
+}
+
+// Mount mounts the sub-service under the prefix of the action name,
+// such as "billing.", that's, all the actions starting with the prefix,
+// which are not registered in the current service, will be forwarded
+// to the sub-service, which handles them by its own middlewares, mappings
+// and handlers.
+//
+// If the prefix has been mounted, override it.
+func (s *Service) Mount(prefix string, sub *Service, opts ...MountOption) {
+	if prefix == "" {
+		panic("Service.Mount: the prefix must not be empty")
+	} else if sub == nil || sub == s {
+		panic("Service.Mount: invalid sub-service")
+	}
+
+	m := mount{prefix: prefix, svc: sub, strip: true}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	mounts := make([]mount, 0, len(s.mounts)+1)
+	for _, _m := range s.mounts {
+		if _m.prefix != prefix {
+			mounts = append(mounts, _m)
+		}
+	}
+	mounts = append(mounts, m)
+
+	// Match the longest prefix firstly.
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].prefix) > len(mounts[j].prefix)
+	})
+	s.mounts = mounts
+}
+
+// Unmount unmounts the sub-service mounted under the prefix,
+// and reports whether it has been mounted.
+func (s *Service) Unmount(prefix string) (ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	mounts := make([]mount, 0, len(s.mounts))
+	for _, m := range s.mounts {
+		if m.prefix == prefix {
+			ok = true
+		} else {
+			mounts = append(mounts, m)
+		}
+	}
+	s.mounts = mounts
+	return
+}
+
+func (s *Service) getMount(name string) (m mount, ok bool) {
+	s.lock.RLock()
+	for _, _m := range s.mounts {
+		if strings.HasPrefix(name, _m.prefix) {
+			m, ok = _m, true
+			break
+		}
+	}
+	s.lock.RUnlock()
+	return
+}
+
+func (s *Service) describeMounts(prefix string) (infos []ServiceInfo) {
+	s.lock.RLock()
+	mounts := s.mounts
+	s.lock.RUnlock()
+
+	for _, m := range mounts {
+		for _, info := range m.svc.DescribeServices("") {
+			if m.strip {
+				info.Name = m.prefix + info.Name
+				for i, alias := range info.Aliases {
+					info.Aliases[i] = m.prefix + alias
+				}
+			} else if !strings.HasPrefix(info.Name, m.prefix) {
+				continue
+			}
+
+			if strings.HasPrefix(info.Name, prefix) {
+				infos = append(infos, info)
+			}
+		}
+	}
+	return
+}
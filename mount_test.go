@@ -0,0 +1,99 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceMount(t *testing.T) {
+	billing := NewService()
+	billing.NewContext = func() *Context {
+		c := NewContext()
+		c.Render = func(c *Context, r Response) error { return c.JSON(r) }
+		return c
+	}
+	billing.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetRespHeader("X-Sub", "billing")
+			return next(c)
+		}
+	})
+	billing.Register("Pay", func(c *Context) error { return c.Success("pay:" + c.Action) })
+	billing.Mapping("Charge", "Pay")
+
+	orders := NewService()
+	orders.Register("orders.List", func(c *Context) error { return c.Success("list:" + c.Action) })
+
+	root := NewService()
+	root.Register("billing.Local", func(c *Context) error { return c.Success("local") })
+	root.Mount("billing.", billing)
+	root.Mount("orders.", orders, MountPreservePrefix())
+
+	call := func(action string) (resp Response, sub string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		root.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp, rec.Header().Get("X-Sub")
+	}
+
+	if resp, sub := call("billing.Pay"); resp.Data != "pay:Pay" || sub != "billing" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp, _ := call("billing.Charge"); resp.Data != "pay:Charge" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp, sub := call("billing.Local"); resp.Data != "local" || sub != "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp, sub := call("billing.Unknown"); resp.Error.Code != ErrInvalidAction.Code || sub != "billing" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp, _ := call("orders.List"); resp.Data != "list:orders.List" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if s := billing.Stats()["Pay"]; s.Calls != 2 || s.InFlight != 0 {
+		t.Errorf("unexpected stats of the sub-service: %+v", s)
+	}
+
+	var names []string
+	for _, info := range root.DescribeServices("") {
+		names = append(names, info.Name)
+	}
+	expect := []string{"billing.Local", "billing.Pay", "orders.List"}
+	if len(names) != len(expect) {
+		t.Errorf("expect services %v, but got %v", expect, names)
+	} else {
+		for i := range expect {
+			if names[i] != expect[i] {
+				t.Errorf("expect services %v, but got %v", expect, names)
+				break
+			}
+		}
+	}
+
+	if !root.Unmount("billing.") {
+		t.Errorf("expect the prefix 'billing.' to be mounted")
+	} else if resp, _ := call("billing.Pay"); resp.Error.Code != ErrInvalidAction.Code {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,450 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Observer is used to observe the result of the request, such as metrics.
+//
+// Notice: it may be called concurrently.
+type Observer interface {
+	Observe(action, version string, status int, latency time.Duration, respSize int64)
+}
+
+// ObserverFunc is the function adapter of Observer, which is convenient
+// to wire the third-party metrics system, such as Prometheus.
+type ObserverFunc func(action, version string, status int, latency time.Duration, respSize int64)
+
+// Observe implements the interface Observer.
+func (f ObserverFunc) Observe(action, version string, status int,
+	latency time.Duration, respSize int64) {
+	f(action, version, status, latency, respSize)
+}
+
+// Observers returns a new Observer to forward the result to all observers,
+// which also implements the interface TenantObserver.
+func Observers(observers ...Observer) Observer { return multiObserver(observers) }
+
+type multiObserver []Observer
+
+func (os multiObserver) Observe(action, version string, status int,
+	latency time.Duration, respSize int64) {
+	for _, observer := range os {
+		observer.Observe(action, version, status, latency, respSize)
+	}
+}
+
+func (os multiObserver) ObserveTenant(tenant, action, version string, status int,
+	latency time.Duration, respSize int64) {
+	for _, observer := range os {
+		if o, ok := observer.(TenantObserver); ok {
+			o.ObserveTenant(tenant, action, version, status, latency, respSize)
+		} else {
+			observer.Observe(action, version, status, latency, respSize)
+		}
+	}
+}
+
+// Stats returns the runtime statistics of all the registered services,
+// which are maintained by the service itself in the request path,
+// and the keys are the original names when registering them.
+// The services registered by RegisterVersion use the keys
+// in the format "NAME@VERSION", such as "CreateUser@v2".
+//
+// Notice: the statistics of Observer, such as StatsObserver, are not
+// included, which should be got from the observer itself.
+func (s *Service) Stats() map[string]ActionStats {
+	r := s.loadRegistry()
+	stats := make(map[string]ActionStats, len(r.handlers)+len(r.versions))
+	r.rangeActions(func(a *action) { stats[a.statsKey()] = a.snapshot() })
+	return stats
+}
+
+// statsOf returns the runtime statistics of the service named key,
+// including all its versions, which has been resolved by the mappings.
+func (r *registry) statsOf(key string) map[string]ActionStats {
+	stats := make(map[string]ActionStats, 4)
+	if a, ok := r.handlers[key]; ok {
+		stats[a.statsKey()] = a.snapshot()
+	}
+	if vs, ok := r.versions[key]; ok {
+		for _, a := range vs.versions {
+			stats[a.statsKey()] = a.snapshot()
+		}
+	}
+	return stats
+}
+
+// rangeActions calls f with each of the registered actions,
+// including those registered by RegisterVersion.
+func (r *registry) rangeActions(f func(*action)) {
+	for _, a := range r.handlers {
+		f(a)
+	}
+	for _, vs := range r.versions {
+		for _, a := range vs.versions {
+			f(a)
+		}
+	}
+}
+
+// statsKey returns the key of the action in the result of Service.Stats.
+func (a *action) statsKey() string {
+	if a.version == "" {
+		return a.name
+	}
+	return a.name + "@" + a.version
+}
+
+// ResetStats resets the runtime statistics of all the registered services.
+func (s *Service) ResetStats() {
+	s.loadRegistry().rangeActions(func(a *action) {
+		a.stats.reset()
+		atomic.StoreUint64(&a.slow, 0)
+		if a.deprecation != nil {
+			atomic.StoreUint64(&a.deprecation.calls, 0)
+		}
+	})
+}
+
+// EnableStatsAction registers a service named name, such as "DescribeStats",
+// to return the runtime statistics of all the registered services,
+// which may be filtered by the service name from the parameter "Name".
+//
+// If the parameter "Reset" is true, the statistics are reset after returned,
+// which must pass resetGuards, such as the authentication and authorization.
+// If no reset guards, resetting is unsupported.
+func (s *Service) EnableStatsAction(name string, resetGuards ...Middleware) {
+	var reset Handler
+	if len(resetGuards) > 0 {
+		reset = wrapHandler(func(c *Context) error { s.ResetStats(); return nil }, resetGuards)
+	}
+
+	s.RegisterWithOptions(name, func(c *Context) (err error) {
+		var req struct {
+			Name  string `query:"Name" json:"Name"`
+			Reset bool   `query:"Reset" json:"Reset"`
+		}
+		if err = c.Bind(&req); err != nil {
+			return
+		} else if req.Reset && reset == nil {
+			return ErrUnsupportedOperation.WithMessage("resetting the stats is unsupported")
+		}
+
+		var stats map[string]ActionStats
+		if req.Name == "" {
+			stats = s.Stats()
+		} else {
+			r := s.loadRegistry()
+			key, ok := r.resolve(s.normalize(req.Name))
+			if !ok {
+				return ErrInvalidParameter.WithMessage("no service named '%s'", req.Name)
+			}
+			stats = r.statsOf(key)
+		}
+
+		if req.Reset {
+			if err = reset(c); err != nil {
+				return
+			}
+		}
+		return c.Success(stats)
+	}, WithDescription("Describe the runtime statistics of all the services"))
+}
+
+func (a *action) snapshot() ActionStats {
+	stats := a.stats.stats()
+	stats.SlowCalls = atomic.LoadUint64(&a.slow)
+	stats.Disabled = a.disabledInfo() != nil
+	if a.deprecation != nil {
+		stats.DeprecatedCalls = atomic.LoadUint64(&a.deprecation.calls)
+	}
+	return stats
+}
+
+// endStats ends the runtime statistics of the action handling the request,
+// which are begun by handleRequest when the action is found.
+func (c *Context) endStats(err error) {
+	if c.action != nil {
+		c.action.stats.end(err, c.observedStatus(), time.Since(c.start), c.res.Size)
+		c.action.stats.addReqSize(c.reqbody.n)
+	}
+}
+
+// countSlowCall increases the number of the slow calls of the action.
+func (s *Service) countSlowCall(action string) {
+	if a, ok := s.getAction(action); ok {
+		atomic.AddUint64(&a.slow, 1)
+	}
+}
+
+// LatencyBuckets is the upper bounds of the latency histogram buckets
+// used by StatsObserver.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 5,
+	time.Second * 10,
+}
+
+// ActionStats is the statistics of an action.
+type ActionStats struct {
+	Calls      uint64    // The number of the requests.
+	InFlight   int64     // The number of the requests being handled.
+	LastCalled time.Time // The time when the action is called last time.
+	RespSize   uint64    // The total size of the response bodies.
+	ReqSize    uint64    // The total size of the read request bodies.
+
+	// ErrorCount is the number of the failed requests, that's, the status
+	// code is equal to or greater than 400, or the handler returns an error.
+	//
+	// Errors is the number of the failed requests by the error code,
+	// which is only maintained by Service.
+	ErrorCount uint64
+	Errors     map[string]uint64 `json:",omitempty"`
+
+	// DeprecatedCalls is the number of the calls if the action is deprecated.
+	DeprecatedCalls uint64
+
+	// SlowCalls is the number of the slow calls counted by LogSlow.
+	SlowCalls uint64
+
+	// Disabled reports whether the action is disabled by DisableAction.
+	Disabled bool
+
+	// P50 and P95 are the upper bounds of the latency histogram buckets
+	// containing the 50th and 95th percentile. If the percentile is beyond
+	// the largest bucket, it is the max latency.
+	P50 time.Duration
+	P95 time.Duration
+	Max time.Duration
+
+	// Buckets is the number of the requests in each latency histogram
+	// bucket of LatencyBuckets, and the last is beyond the largest bucket.
+	Buckets []uint64
+}
+
+// actionStats is the statistics of an action updated by the atomic
+// operations, whose 64-bit fields must be at the beginning for alignment.
+type actionStats struct {
+	count    uint64
+	errors   uint64
+	respSize uint64
+	reqSize  uint64
+	max      int64
+	inflight int64
+	last     int64    // The unix nanoseconds of the last call.
+	codes    sync.Map // map[string]*uint64
+	buckets  []uint64 // len(LatencyBuckets)+1
+}
+
+func newActionStats() *actionStats {
+	return &actionStats{buckets: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+// begin is called when starting to handle the request.
+func (s *actionStats) begin(now time.Time) {
+	atomic.AddInt64(&s.inflight, 1)
+	atomic.StoreInt64(&s.last, now.UnixNano())
+}
+
+// end is called when finishing handling the request started by begin.
+func (s *actionStats) end(err error, status int, latency time.Duration, respSize int64) {
+	atomic.AddInt64(&s.inflight, -1)
+	if err != nil {
+		code := errorCode(err)
+		v, ok := s.codes.Load(code)
+		if !ok {
+			v, _ = s.codes.LoadOrStore(code, new(uint64))
+		}
+		atomic.AddUint64(v.(*uint64), 1)
+
+		if status < 400 {
+			atomic.AddUint64(&s.errors, 1)
+		}
+	}
+	s.observe(status, latency, respSize)
+}
+
+func (s *actionStats) observe(status int, latency time.Duration, respSize int64) {
+	atomic.AddUint64(&s.count, 1)
+	atomic.AddUint64(&s.respSize, uint64(respSize))
+	if status >= 400 {
+		atomic.AddUint64(&s.errors, 1)
+	}
+
+	for {
+		max := atomic.LoadInt64(&s.max)
+		if int64(latency) <= max || atomic.CompareAndSwapInt64(&s.max, max, int64(latency)) {
+			break
+		}
+	}
+
+	index := len(LatencyBuckets)
+	for i, bucket := range LatencyBuckets {
+		if latency <= bucket {
+			index = i
+			break
+		}
+	}
+	atomic.AddUint64(&s.buckets[index], 1)
+}
+
+func (s *actionStats) stats() ActionStats {
+	stats := ActionStats{
+		Calls:      atomic.LoadUint64(&s.count),
+		InFlight:   atomic.LoadInt64(&s.inflight),
+		ErrorCount: atomic.LoadUint64(&s.errors),
+		RespSize:   atomic.LoadUint64(&s.respSize),
+		ReqSize:    atomic.LoadUint64(&s.reqSize),
+		Max:        time.Duration(atomic.LoadInt64(&s.max)),
+	}
+
+	if last := atomic.LoadInt64(&s.last); last > 0 {
+		stats.LastCalled = time.Unix(0, last)
+	}
+
+	s.codes.Range(func(code, count interface{}) bool {
+		if stats.Errors == nil {
+			stats.Errors = make(map[string]uint64, 4)
+		}
+		stats.Errors[code.(string)] = atomic.LoadUint64(count.(*uint64))
+		return true
+	})
+
+	buckets := make([]uint64, len(s.buckets))
+	var total uint64
+	for i := range s.buckets {
+		buckets[i] = atomic.LoadUint64(&s.buckets[i])
+		total += buckets[i]
+	}
+
+	stats.Buckets = buckets
+	stats.P50 = percentile(buckets, total, 0.50, stats.Max)
+	stats.P95 = percentile(buckets, total, 0.95, stats.Max)
+	return stats
+}
+
+// reset resets all the counters except inflight, which is still maintained
+// by the requests being handled.
+func (s *actionStats) reset() {
+	atomic.StoreUint64(&s.count, 0)
+	atomic.StoreUint64(&s.errors, 0)
+	atomic.StoreUint64(&s.respSize, 0)
+	atomic.StoreUint64(&s.reqSize, 0)
+	atomic.StoreInt64(&s.max, 0)
+	atomic.StoreInt64(&s.last, 0)
+	for i := range s.buckets {
+		atomic.StoreUint64(&s.buckets[i], 0)
+	}
+	s.codes.Range(func(code, _ interface{}) bool {
+		s.codes.Delete(code)
+		return true
+	})
+}
+
+func percentile(buckets []uint64, total uint64, p float64, max time.Duration) time.Duration {
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(float64(total)*p + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+
+	var count uint64
+	for i, n := range buckets {
+		if count += n; count >= rank {
+			if i < len(LatencyBuckets) && LatencyBuckets[i] < max {
+				return LatencyBuckets[i]
+			}
+			return max
+		}
+	}
+	return max
+}
+
+// StatsObserver is an in-memory observer to aggregate the statistics
+// of the requests per action.
+type StatsObserver struct {
+	// MaxActions is the maximum number of the tracked actions, and the
+	// requests of other actions beyond it will be ignored, which is used
+	// to prevent the invalid actions from exhausting the memory.
+	//
+	// Default: 1024
+	MaxActions int
+
+	lock    sync.RWMutex
+	actions map[string]*actionStats
+}
+
+// NewStatsObserver returns a new StatsObserver.
+func NewStatsObserver() *StatsObserver {
+	return &StatsObserver{MaxActions: 1024, actions: make(map[string]*actionStats)}
+}
+
+// Observe implements the interface Observer.
+func (o *StatsObserver) Observe(action, version string, status int,
+	latency time.Duration, respSize int64) {
+	o.lock.RLock()
+	stats, ok := o.actions[action]
+	o.lock.RUnlock()
+
+	if !ok {
+		o.lock.Lock()
+		if stats, ok = o.actions[action]; !ok {
+			if len(o.actions) >= o.MaxActions {
+				o.lock.Unlock()
+				return
+			}
+
+			stats = newActionStats()
+			o.actions[action] = stats
+		}
+		o.lock.Unlock()
+	}
+
+	stats.observe(status, latency, respSize)
+}
+
+// Stats returns the statistics of all the actions.
+func (o *StatsObserver) Stats() map[string]ActionStats {
+	o.lock.RLock()
+	stats := make(map[string]ActionStats, len(o.actions))
+	for action, s := range o.actions {
+		stats[action] = s.stats()
+	}
+	o.lock.RUnlock()
+	return stats
+}
+
+// Reset clears all the statistics.
+func (o *StatsObserver) Reset() {
+	o.lock.Lock()
+	o.actions = make(map[string]*actionStats, len(o.actions))
+	o.lock.Unlock()
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatsObserver(t *testing.T) {
+	o := NewStatsObserver()
+	for i := 0; i < 90; i++ {
+		o.Observe("a", "", 200, time.Millisecond*3, 10)
+	}
+	for i := 0; i < 10; i++ {
+		o.Observe("a", "", 500, time.Millisecond*30, 10)
+	}
+
+	stats := o.Stats()["a"]
+	if stats.Calls != 100 || stats.ErrorCount != 10 || stats.RespSize != 1000 {
+		t.Errorf("unexpected stats: %+v", stats)
+	} else if stats.P50 != time.Millisecond*5 {
+		t.Errorf("expect p50 '%s', but got '%s'", time.Millisecond*5, stats.P50)
+	} else if stats.P95 != time.Millisecond*30 {
+		t.Errorf("expect p95 '%s', but got '%s'", time.Millisecond*30, stats.P95)
+	}
+
+	o.MaxActions = 1
+	o.Observe("b", "", 200, time.Millisecond, 0)
+	if _, ok := o.Stats()["b"]; ok {
+		t.Errorf("unexpected the action 'b' beyond MaxActions")
+	}
+}
+
+func TestServiceObserver(t *testing.T) {
+	svc := NewService()
+	svc.Observer = NewStatsObserver()
+	svc.Register("svc", func(c *Context) error { return c.Success("abc") })
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		req.Header.Set("X-Request-Id", "1")
+		svc.ServeHTTP(rec, req)
+	}
+
+	if stats, ok := svc.Observer.(*StatsObserver).Stats()["svc"]; !ok {
+		t.Errorf("no stats of the action 'svc'")
+	} else if stats.Calls != 3 || stats.RespSize != 3*uint64(len(`{"RequestId":"1","Data":"abc"}`+"\n")) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestServiceStats(t *testing.T) {
+	svc := NewService()
+	svc.Register("ok", func(c *Context) error { return c.Success(nil) })
+	svc.Register("fail", func(c *Context) error { return ErrFailedOperation })
+	svc.Mapping("alias", "ok")
+	svc.RegisterVersion("versioned", "v1", func(c *Context) error { return c.Success(nil) })
+	if err := svc.SetDefaultVersion("versioned", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	svc.EnableStatsAction("DescribeStats", func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.GetReqHeader("X-Admin") == "" {
+				return ErrUnauthorizedOperation
+			}
+			return next(c)
+		}
+	})
+
+	call := func(query string, admin bool) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?"+query, nil)
+		if admin {
+			req.Header.Set("X-Admin", "1")
+		}
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	start := time.Now()
+	call("Action=ok", false)
+	call("Action=alias", false)
+	call("Action=fail", false)
+	call("Action=versioned", false)
+
+	stats := svc.Stats()
+	if s := stats["ok"]; s.Calls != 2 || s.ErrorCount != 0 || s.InFlight != 0 ||
+		s.LastCalled.Before(start) || len(s.Buckets) != len(LatencyBuckets)+1 {
+		t.Errorf("unexpected stats of 'ok': %+v", s)
+	}
+	if s := stats["fail"]; s.Calls != 1 || s.ErrorCount != 1 ||
+		s.Errors[ErrFailedOperation.Code] != 1 {
+		t.Errorf("unexpected stats of 'fail': %+v", s)
+	}
+	if s := stats["versioned@v1"]; s.Calls != 1 {
+		t.Errorf("unexpected stats of 'versioned@v1': %+v", s)
+	}
+	if _, ok := stats["versioned"]; ok {
+		t.Errorf("unexpected stats of the service 'versioned' without the version")
+	}
+
+	resp := call("Action=DescribeStats&Name=fail", false)
+	if data, ok := resp.Data.(map[string]interface{}); !ok || len(data) != 1 || data["fail"] == nil {
+		t.Errorf("unexpected the stats response: %+v", resp)
+	}
+	resp = call("Action=DescribeStats&Name=versioned", false)
+	if data, ok := resp.Data.(map[string]interface{}); !ok || len(data) != 1 || data["versioned@v1"] == nil {
+		t.Errorf("unexpected the stats response: %+v", resp)
+	}
+
+	if resp = call("Action=DescribeStats&Reset=true", false); resp.Error.Code != ErrUnauthorizedOperation.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrUnauthorizedOperation.Code, resp.Error.Code)
+	} else if svc.Stats()["ok"].Calls != 2 {
+		t.Errorf("unexpected the stats to be reset")
+	}
+
+	if resp = call("Action=DescribeStats&Reset=true", true); resp.Error.Code != "" {
+		t.Error(resp.Error)
+	} else if s := svc.Stats()["ok"]; s.Calls != 0 || !s.LastCalled.IsZero() {
+		t.Errorf("expect the stats to be reset, but got %+v", s)
+	}
+}
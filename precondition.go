@@ -0,0 +1,197 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SetEntityVersion sets the response header "ETag" to the entity tag
+// of the version, which is quoted as the strong one, such as "\"v1\"",
+// unless it is an entity tag already, such as "W/\"v1\"".
+func (c *Context) SetEntityVersion(version string) {
+	c.SetRespHeader("ETag", formatETag(version))
+}
+
+// RequireIfMatch checks the precondition of the request header "If-Match"
+// against the current version of the entity, which is formatted like
+// SetEntityVersion, and the empty version means that the entity does not
+// exist. It returns ErrPreconditionFailed if not matched, or the header
+// is absent and Service.RequireIfMatch is enabled.
+//
+// Following RFC 9110, the entity tags are compared strongly, so the weak
+// ones never match, and "*" matches any existing entity.
+func (c *Context) RequireIfMatch(currentVersion string) error {
+	values := c.req.Header["If-Match"]
+	if len(values) == 0 {
+		if c.svc.RequireIfMatch {
+			return ErrPreconditionFailed.WithMessage("missing the header If-Match")
+		}
+		return nil
+	}
+
+	if !matchIfMatch(values, currentVersion) {
+		return ErrPreconditionFailed.WithMessage("the entity version does not match")
+	}
+	return nil
+}
+
+// WithIfMatch returns an action option to check the precondition
+// like c.RequireIfMatch before calling the handler, which binds
+// the request into a new value of the type set by WithRequestType,
+// then passes the pointer to it to current to load the current version
+// of the entity.
+//
+// If field is not empty, it is the name of the string field of the request,
+// which carries the expected version when the header "If-Match" is absent,
+// such as "Version" of the request body.
+func WithIfMatch(field string, current func(c *Context, req interface{}) (string, error)) ActionOption {
+	if current == nil {
+		panic("WithIfMatch: the function to get the current version must not be nil")
+	}
+
+	return WithMiddlewares(func(next Handler) Handler {
+		return func(c *Context) error {
+			var req interface{}
+			var expected string
+			if c.action != nil && c.action.reqType != nil {
+				if _, err := c.BodyBytes(); err != nil {
+					return ErrInvalidParameter.WithMessage(err.Error())
+				}
+
+				v := reflect.New(c.action.reqType)
+				if err := c.Bind(v.Interface()); err != nil {
+					return err
+				}
+				c.BodyBytes() // Rewind the body for the handler.
+
+				if field != "" {
+					f := reflect.Indirect(v).FieldByName(field)
+					if f.Kind() != reflect.String {
+						return ErrServerError.WithMessage("no string field '%s' of the request", field)
+					}
+					expected = f.String()
+				}
+				req = v.Interface()
+			}
+
+			version, err := current(c, req)
+			if err != nil {
+				return err
+			}
+
+			if expected != "" && len(c.req.Header["If-Match"]) == 0 {
+				if !matchIfMatch([]string{formatETag(expected)}, version) {
+					return ErrPreconditionFailed.WithMessage("the entity version does not match")
+				}
+			} else if err = c.RequireIfMatch(version); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	})
+}
+
+func formatETag(version string) string {
+	if strings.HasPrefix(version, `"`) || strings.HasPrefix(version, `W/"`) {
+		return version
+	}
+	return `"` + version + `"`
+}
+
+// parseETag parses the entity tag, such as "\"v1\"" or "W/\"v1\"",
+// and returns the opaque tag without the quotes.
+func parseETag(tag string) (opaque string, weak, ok bool) {
+	if strings.HasPrefix(tag, "W/") {
+		tag, weak = tag[2:], true
+	}
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return "", false, false
+	}
+
+	opaque = tag[1 : len(tag)-1]
+	return opaque, weak, strings.IndexByte(opaque, '"') < 0
+}
+
+// matchIfMatch reports whether any entity tag in the header values of
+// If-Match matches the current version by the strong comparison.
+// The malformed header never matches.
+func matchIfMatch(values []string, current string) bool {
+	if current == "" {
+		return false
+	}
+
+	opaque, weak, ok := parseETag(formatETag(current))
+	if !ok {
+		return false
+	}
+
+	for _, value := range values {
+		tags, ok := splitETags(value)
+		if !ok {
+			return false
+		}
+
+		for _, tag := range tags {
+			if tag == "*" {
+				return true
+			} else if o, w, ok := parseETag(tag); !ok {
+				return false
+			} else if !w && !weak && o == opaque {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitETags splits the comma-separated list of the entity tags,
+// which may contain the commas in the quotes.
+func splitETags(s string) (tags []string, ok bool) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return tags, true
+		}
+
+		var end int
+		if s[0] == '*' {
+			end = 1
+		} else {
+			start := 0
+			if strings.HasPrefix(s, "W/") {
+				start = 2
+			}
+			if len(s) <= start || s[start] != '"' {
+				return nil, false
+			}
+
+			index := strings.IndexByte(s[start+1:], '"')
+			if index < 0 {
+				return nil, false
+			}
+			end = start + index + 2
+		}
+
+		tags = append(tags, s[:end])
+		if s = strings.TrimLeft(s[end:], " \t"); s == "" {
+			return tags, true
+		} else if s[0] != ',' {
+			return nil, false
+		}
+		s = s[1:]
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		current string
+		match   bool
+	}{
+		{`"v1"`, "v1", true},
+		{`"v1"`, `"v1"`, true},
+		{`"v0", "v1"`, "v1", true},
+		{`"a,b", "v1"`, "v1", true},
+		{`"a,b"`, "a,b", true},
+		{`"v2"`, "v1", false},
+		{`W/"v1"`, "v1", false},
+		{`"v1"`, `W/"v1"`, false},
+		{`*`, "v1", true},
+		{`*`, "", false},
+		{`"v1"`, "", false},
+		{`v1`, "v1", false},
+		{`"v1" "v2"`, "v1", false},
+		{`"v1`, "v1", false},
+	}
+
+	for _, test := range tests {
+		if match := matchIfMatch([]string{test.header}, test.current); match != test.match {
+			t.Errorf("If-Match %s against %s: expect %v, but got %v",
+				test.header, test.current, test.match, match)
+		}
+	}
+
+	if tags, ok := splitETags(` "a", W/"b" ,* `); !ok || !reflect.DeepEqual(tags, []string{`"a"`, `W/"b"`, `*`}) {
+		t.Errorf("unexpected entity tags: %v, %v", tags, ok)
+	}
+}
+
+func TestContextRequireIfMatch(t *testing.T) {
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.Register("Update", func(c *Context) error {
+		if err := c.RequireIfMatch("v1"); err != nil {
+			return err
+		}
+		c.SetEntityVersion("v2")
+		return c.Success(nil)
+	})
+
+	call := func(ifMatch string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action=Update", nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call(`"v1"`); rec.Code != 200 || rec.Header().Get("ETag") != `"v2"` {
+		t.Errorf("unexpected response: %d, %v, %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if rec := call(`"v0"`); rec.Code != http.StatusPreconditionFailed ||
+		!strings.Contains(rec.Body.String(), ErrPreconditionFailed.Code) {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(""); rec.Code != 200 {
+		t.Errorf("expect status code 200, but got %d", rec.Code)
+	}
+
+	svc.RequireIfMatch = true
+	if rec := call(""); rec.Code != http.StatusPreconditionFailed ||
+		!strings.Contains(rec.Body.String(), "missing the header If-Match") {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWithIfMatch(t *testing.T) {
+	type request struct {
+		ID      string `json:"Id"`
+		Version string
+	}
+
+	versions := map[string]string{"a": "3"}
+	current := func(c *Context, req interface{}) (string, error) {
+		return versions[req.(*request).ID], nil
+	}
+
+	svc := NewService()
+	svc.MapErrorStatus = true
+	svc.RegisterWithOptions("Update", func(c *Context) error {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(req.ID)
+	}, WithRequestType(reflect.TypeOf(request{})), WithIfMatch("Version", current))
+
+	call := func(body, ifMatch string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?Action=Update", strings.NewReader(body))
+		req.Header.Set("Content-Type", MIMEApplicationJSON)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		body    string
+		ifMatch string
+		code    int
+	}{
+		{`{"Id":"a","Version":"3"}`, "", 200},
+		{`{"Id":"a","Version":"2"}`, "", http.StatusPreconditionFailed},
+		{`{"Id":"a","Version":"2"}`, `"3"`, 200},
+		{`{"Id":"a"}`, `"2"`, http.StatusPreconditionFailed},
+		{`{"Id":"a"}`, "", 200},
+		{`{"Id":"b"}`, "*", http.StatusPreconditionFailed},
+	}
+	for i, test := range tests {
+		rec := call(test.body, test.ifMatch)
+		if rec.Code != test.code {
+			t.Errorf("%d: expect status code %d, but got %d: %s", i, test.code, rec.Code, rec.Body.String())
+		} else if test.code == 200 && !strings.Contains(rec.Body.String(), `"Data":"a"`) {
+			t.Errorf("%d: unexpected response: %s", i, rec.Body.String())
+		}
+	}
+}
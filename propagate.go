@@ -0,0 +1,80 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultPropagateHeaders is the default headers propagated to the upstream
+// calls made on behalf of the request, which is used by OutgoingHeaders
+// if Service.PropagateHeaders is nil.
+var DefaultPropagateHeaders = []string{
+	"X-Request-Id",
+	"Traceparent",
+	"Tracestate",
+	"Baggage",
+	"X-Tenant-Id",
+}
+
+// OutgoingHeaders returns the headers that should be attached to any
+// upstream call made on behalf of the request, which are copied from
+// the request headers named by Service.PropagateHeaders, but "X-Request-Id"
+// and "X-Tenant-Id" are the request id and c.Tenant if not empty.
+//
+// The returned headers are a copy, so they are still valid after c is released.
+func (c *Context) OutgoingHeaders() http.Header {
+	names := DefaultPropagateHeaders
+	if c.svc != nil && c.svc.PropagateHeaders != nil {
+		names = c.svc.PropagateHeaders
+	}
+
+	header := make(http.Header, len(names))
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		switch {
+		case name == "X-Request-Id" && c.GetRequestID() != "":
+			header[name] = []string{c.RequestID}
+		case name == "X-Tenant-Id" && c.Tenant != "":
+			header[name] = []string{c.Tenant}
+		default:
+			if values := c.req.Header[name]; len(values) > 0 {
+				header[name] = append([]string(nil), values...)
+			}
+		}
+	}
+	return header
+}
+
+// OutgoingContext returns a copy of the request context carrying
+// the outgoing headers returned by OutgoingHeaders, which may be passed
+// to the client to attach them to the upstream call automatically.
+func (c *Context) OutgoingContext() context.Context {
+	return ContextWithOutgoingHeaders(c.req.Context(), c.OutgoingHeaders())
+}
+
+type outgoingHeadersKey struct{}
+
+// ContextWithOutgoingHeaders returns a new context carrying the outgoing headers.
+func ContextWithOutgoingHeaders(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, outgoingHeadersKey{}, header)
+}
+
+// OutgoingHeadersFromContext returns the outgoing headers carried by ctx.
+func OutgoingHeadersFromContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(outgoingHeadersKey{}).(http.Header)
+	return header
+}
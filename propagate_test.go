@@ -0,0 +1,57 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOutgoingHeaders(t *testing.T) {
+	var header, ctxHeader http.Header
+	svc := NewService()
+	svc.Register("Action", func(c *Context) error {
+		header = c.OutgoingHeaders()
+		ctxHeader = OutgoingHeadersFromContext(c.OutgoingContext())
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/?Action=Action", nil)
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.Header.Set("X-Tenant-Id", "tenant")
+	req.Header.Set("X-Other", "other")
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(header) != 3 || header.Get("X-Request-Id") == "" || header.Get("X-Tenant-Id") != "tenant" ||
+		header.Get("Traceparent") != req.Header.Get("Traceparent") {
+		t.Errorf("unexpected outgoing headers: %v", header)
+	}
+	if !reflect.DeepEqual(header, ctxHeader) {
+		t.Errorf("expect the context headers %v, but got %v", header, ctxHeader)
+	}
+
+	req.Header["Traceparent"][0] = "changed"
+	if header.Get("Traceparent") == "changed" {
+		t.Errorf("the outgoing headers are aliased")
+	}
+
+	svc.PropagateHeaders = []string{"x-other"}
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	if len(header) != 1 || header.Get("X-Other") != "other" {
+		t.Errorf("unexpected outgoing headers: %v", header)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"strings"
+)
+
+var _ http.Pusher = &responseWriter{}
+
+// Push implements the interface http.Pusher, which returns
+// http.ErrNotSupported if the underlying writer does not support it,
+// such as HTTP/1.1.
+func (r *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := r.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Push initiates an HTTP/2 server push of the target with the headers,
+// which may be a path, such as "/static/app.js", and is converted to
+// the absolute url with the scheme and host of the current request.
+//
+// It returns http.ErrNotSupported if the connection does not support
+// the server push, so the handler can degrade gracefully.
+func (c *Context) Push(target string, headers http.Header) error {
+	if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+		scheme := "http"
+		if c.req.TLS != nil {
+			scheme = "https"
+		}
+		target = scheme + "://" + c.req.Host + target
+	}
+
+	opts := &http.PushOptions{Method: http.MethodGet}
+	if len(headers) > 0 {
+		opts.Header = cloneHeader(headers)
+	}
+	return c.res.Push(target, opts)
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.14
+// +build go1.14
+
+package httpsvc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextPush(t *testing.T) {
+	type result struct {
+		proto  int
+		pusher bool
+		err    error
+	}
+
+	results := make(chan result, 1)
+	svc := NewService()
+	svc.Register("Push", func(c *Context) error {
+		_, pusher := c.ResponseWriter().(http.Pusher)
+		err := c.Push("/static/app.js", http.Header{"Accept-Encoding": {"gzip"}})
+		results <- result{proto: c.Request().ProtoMajor, pusher: pusher, err: err}
+		return nil
+	})
+
+	call := func(server *httptest.Server) result {
+		resp, err := server.Client().Get(server.URL + "/?Action=Push")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return <-results
+	}
+
+	// HTTP/2, but the Go client disables the server push.
+	server := httptest.NewUnstartedServer(svc)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	if r := call(server); r.proto != 2 || !r.pusher {
+		t.Errorf("expect the HTTP/2 pusher, but got HTTP/%d and %v", r.proto, r.pusher)
+	} else if r.err != http.ErrNotSupported {
+		t.Errorf("expect the error ErrNotSupported, but got %v", r.err)
+	}
+
+	// HTTP/1.1
+	server1 := httptest.NewServer(svc)
+	defer server1.Close()
+	if r := call(server1); r.proto != 1 || r.err != http.ErrNotSupported {
+		t.Errorf("expect ErrNotSupported for HTTP/%d, but got %v", r.proto, r.err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaPeriod is the period of the quota window.
+type QuotaPeriod uint8
+
+// Predefine some quota periods, which are computed in UTC.
+const (
+	QuotaDaily QuotaPeriod = iota
+	QuotaMonthly
+)
+
+// window returns the window containing now and the time when it is reset.
+func (p QuotaPeriod) window(now time.Time) (window string, reset time.Time) {
+	now = now.UTC()
+	year, month, day := now.Date()
+	if p == QuotaMonthly {
+		reset = time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+		return "m:" + now.Format("2006-01"), reset
+	}
+
+	reset = time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+	return "d:" + now.Format("2006-01-02"), reset
+}
+
+// QuotaLimit is the quota limit of a key.
+type QuotaLimit struct {
+	Limit  int64 // The maximum number of the requests in a window. 0 means no limit.
+	Period QuotaPeriod
+}
+
+// QuotaStore is used to count the used quota.
+type QuotaStore interface {
+	// Incr increases the used quota of the key in the window by 1
+	// and returns the increased value, which must be atomic.
+	Incr(key, window string) (used int64, err error)
+}
+
+// ErrQuotaStoreFull is returned by MemoryQuotaStore when it is full.
+var ErrQuotaStoreFull = errors.New("quota store is full")
+
+// MemoryQuotaStore is an in-memory QuotaStore, which only keeps
+// the used quota of the latest window for each key.
+//
+// The window is expected to be generated by QuotaPeriod, so it is regarded
+// as expired once a later window of the same period has been seen.
+type MemoryQuotaStore struct {
+	lock   sync.Mutex
+	max    int
+	keys   map[string]memoryQuota
+	latest map[string]string // period prefix -> latest window
+	stale  bool
+}
+
+type memoryQuota struct {
+	window string
+	used   int64
+}
+
+// NewMemoryQuotaStore returns a new MemoryQuotaStore, which stores the used
+// quota of at most maxEntries keys and cleans up the expired windows
+// when it is full.
+//
+// If maxEntries is equal to or less than 0, it is 100000 by default.
+func NewMemoryQuotaStore(maxEntries int) *MemoryQuotaStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+
+	return &MemoryQuotaStore{
+		max:    maxEntries,
+		keys:   make(map[string]memoryQuota, 64),
+		latest: make(map[string]string, 2),
+	}
+}
+
+// Len returns the number of the stored keys.
+func (s *MemoryQuotaStore) Len() (n int) {
+	s.lock.Lock()
+	n = len(s.keys)
+	s.lock.Unlock()
+	return
+}
+
+func quotaPeriodPrefix(window string) string {
+	if index := strings.IndexByte(window, ':'); index > -1 {
+		return window[:index]
+	}
+	return ""
+}
+
+func (s *MemoryQuotaStore) cleanup() {
+	for key, q := range s.keys {
+		if q.window < s.latest[quotaPeriodPrefix(q.window)] {
+			delete(s.keys, key)
+		}
+	}
+	s.stale = false
+}
+
+// Incr implements the interface QuotaStore.
+func (s *MemoryQuotaStore) Incr(key, window string) (used int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	prefix := quotaPeriodPrefix(window)
+	if latest, ok := s.latest[prefix]; !ok || window > latest {
+		s.latest[prefix] = window
+		s.stale = ok
+	}
+
+	q, ok := s.keys[key]
+	if !ok && len(s.keys) >= s.max {
+		// Only sweep when a new window has been seen since the last cleanup,
+		// so that a full store of the live windows does not sweep per request.
+		if s.stale {
+			s.cleanup()
+		}
+		if len(s.keys) >= s.max {
+			return 0, ErrQuotaStoreFull
+		}
+	}
+
+	if q.window != window {
+		q = memoryQuota{window: window}
+	}
+	q.used++
+	s.keys[key] = q
+	return q.used, nil
+}
+
+// QuotaOption is used to configure the Quota middleware.
+type QuotaOption func(*quotaConfig)
+
+// QuotaKeyFunc returns a quota option to set the function to get the key
+// of the request. If the key is empty, the request is not limited.
+//
+// Default: APIKey
+func QuotaKeyFunc(keyFunc func(*Context) string) QuotaOption {
+	return func(c *quotaConfig) { c.keyFunc = keyFunc }
+}
+
+// QuotaFailClosed returns a quota option to reject the request
+// with ErrServiceUnavailable when the quota store fails.
+//
+// Default: allow the request, that's, fail open.
+func QuotaFailClosed() QuotaOption {
+	return func(c *quotaConfig) { c.failClosed = true }
+}
+
+type quotaConfig struct {
+	keyFunc    func(*Context) string
+	failClosed bool
+}
+
+// Quota returns a middleware to limit the number of the requests per key
+// in the daily or monthly window returned by limits, which sets
+// the headers "X-Quota-Remaining" and "X-Quota-Reset", the unix timestamp
+// in seconds, on every limited response.
+//
+// The over-quota request is rejected with ErrQuotaExceeded.
+func Quota(store QuotaStore, limits func(key string) QuotaLimit, opts ...QuotaOption) Middleware {
+	if store == nil {
+		panic("Quota: the quota store must not be nil")
+	} else if limits == nil {
+		panic("Quota: the quota limits must not be nil")
+	}
+
+	conf := quotaConfig{keyFunc: APIKey}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			key := conf.keyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+
+			limit := limits(key)
+			if limit.Limit <= 0 {
+				return next(c)
+			}
+
+			window, reset := limit.Period.window(time.Now())
+			used, err := store.Incr(key, window)
+			if err != nil {
+				if conf.failClosed {
+					return ErrServiceUnavailable.WithMessage("quota is unavailable")
+				}
+				return next(c)
+			}
+
+			remaining := limit.Limit - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			c.SetRespHeader("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+			c.SetRespHeader("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+			if used > limit.Limit {
+				return ErrQuotaExceeded
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotaPeriodWindow(t *testing.T) {
+	now := time.Date(2021, 12, 31, 23, 0, 0, 0, time.UTC)
+	if window, reset := QuotaDaily.window(now); window != "d:2021-12-31" ||
+		!reset.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily window: %s, %s", window, reset)
+	}
+	if window, reset := QuotaMonthly.window(now); window != "m:2021-12" ||
+		!reset.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected monthly window: %s, %s", window, reset)
+	}
+}
+
+type failedQuotaStore struct{}
+
+func (failedQuotaStore) Incr(key, window string) (int64, error) { return 0, errors.New("test") }
+
+func TestQuota(t *testing.T) {
+	limits := func(key string) QuotaLimit {
+		if key == "vip" {
+			return QuotaLimit{}
+		}
+		return QuotaLimit{Limit: 2, Period: QuotaDaily}
+	}
+
+	svc := NewService()
+	svc.RegisterWithOptions("Action", func(c *Context) error { return nil },
+		WithMiddlewares(Quota(NewMemoryQuotaStore(0), limits)))
+	svc.RegisterWithOptions("Closed", func(c *Context) error { return nil },
+		WithMiddlewares(Quota(failedQuotaStore{}, limits, QuotaFailClosed())))
+	svc.RegisterWithOptions("Open", func(c *Context) error { return nil },
+		WithMiddlewares(Quota(failedQuotaStore{}, limits)))
+
+	call := func(action, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		req.Header.Set("X-Api-Key", key)
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, remaining := range []string{"1", "0", "0"} {
+		rec := call("Action", "user")
+		if rec.Header().Get("X-Quota-Remaining") != remaining || rec.Header().Get("X-Quota-Reset") == "" {
+			t.Errorf("%d: unexpected headers: %v", i, rec.Header())
+		}
+
+		exceeded := strings.Contains(rec.Body.String(), ErrQuotaExceeded.Code)
+		if i < 2 && exceeded {
+			t.Errorf("%d: unexpected exceeding the quota", i)
+		} else if i == 2 && !exceeded {
+			t.Errorf("%d: expect to exceed the quota: %s", i, rec.Body.String())
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := call("Action", "vip"); strings.Contains(rec.Body.String(), "Error") {
+			t.Errorf("%d: unexpected response: %s", i, rec.Body.String())
+		}
+	}
+
+	if rec := call("Closed", "user"); !strings.Contains(rec.Body.String(), ErrServiceUnavailable.Code) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+	if rec := call("Open", "user"); strings.Contains(rec.Body.String(), "Error") {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	s := NewMemoryQuotaStore(2)
+	if used, err := s.Incr("k1", "d:2021-01-01"); err != nil || used != 1 {
+		t.Errorf("unexpected result: used=%d, err=%v", used, err)
+	}
+	if used, err := s.Incr("k2", "m:2021-01"); err != nil || used != 1 {
+		t.Errorf("unexpected result: used=%d, err=%v", used, err)
+	}
+	if _, err := s.Incr("k3", "d:2021-01-01"); err != ErrQuotaStoreFull {
+		t.Errorf("expect error ErrQuotaStoreFull, but got %v", err)
+	}
+	if used, err := s.Incr("k1", "d:2021-01-01"); err != nil || used != 2 {
+		t.Errorf("unexpected result: used=%d, err=%v", used, err)
+	}
+
+	// The window of k1 is expired by the later daily window,
+	// but that of k2 is still live.
+	if used, err := s.Incr("k3", "d:2021-01-02"); err != nil || used != 1 {
+		t.Errorf("unexpected result: used=%d, err=%v", used, err)
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("expect %d keys, but got %d", 2, n)
+	}
+	if used, err := s.Incr("k2", "m:2021-01"); err != nil || used != 2 {
+		t.Errorf("unexpected result: used=%d, err=%v", used, err)
+	}
+	if _, err := s.Incr("k1", "d:2021-01-02"); err != ErrQuotaStoreFull {
+		t.Errorf("expect error ErrQuotaStoreFull, but got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rate is the number of the events allowed per second.
+type Rate float64
+
+// Every converts the minimum interval between the events to Rate.
+func Every(interval time.Duration) Rate {
+	if interval <= 0 {
+		return Rate(math.Inf(1))
+	}
+	return Rate(time.Second) / Rate(interval)
+}
+
+// RateLimitOption is used to configure the RateLimit middleware.
+type RateLimitOption func(*rateLimiter)
+
+// RateLimitMaxKeys returns a rate limit option to set the maximum number
+// of the tracked keys, and the least recently used keys will be evicted
+// when a new key is added beyond it.
+//
+// Default: 10000
+func RateLimitMaxKeys(n int) RateLimitOption {
+	if n < 1 {
+		n = 1
+	}
+	return func(l *rateLimiter) { l.maxKeys = n }
+}
+
+// RateLimitIdleTimeout returns a rate limit option to set the timeout
+// after which an idle key will be expired.
+//
+// Default: 10m
+func RateLimitIdleTimeout(timeout time.Duration) RateLimitOption {
+	return func(l *rateLimiter) { l.idleTimeout = timeout }
+}
+
+// RateLimitRemainingHeader returns a rate limit option to set the header
+// "X-RateLimit-Remaining" to the number of the remaining tokens.
+func RateLimitRemainingHeader() RateLimitOption {
+	return func(l *rateLimiter) { l.remaining = true }
+}
+
+// RateLimitTrustedProxies returns a rate limit option to set the trusted
+// proxies, such as "127.0.0.1" or "10.0.0.0/8", only from which the headers
+// "X-Forwarded-For" and "X-Real-Ip" are honoured by the default key.
+//
+// Default: no trusted proxies, that's, use the host of RemoteAddr.
+func RateLimitTrustedProxies(proxies ...string) RateLimitOption {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip == nil {
+				panic(fmt.Errorf("RateLimitTrustedProxies: invalid proxy '%s'", proxy))
+			} else if ip4 := ip.To4(); ip4 != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Errorf("RateLimitTrustedProxies: invalid proxy '%s'", proxy))
+		}
+		nets = append(nets, ipnet)
+	}
+	return func(l *rateLimiter) { l.proxies = nets }
+}
+
+// RateLimit returns a middleware to limit the rate of the requests
+// by the token bucket per key, which allows limit requests per second
+// and permits bursts of at most burst requests.
+//
+// If keyFunc is nil, use CLIENT_IP + "@" + c.Action instead, and CLIENT_IP
+// is the host of RemoteAddr, or extracted from the headers "X-Forwarded-For"
+// and "X-Real-Ip" only if RemoteAddr is one of RateLimitTrustedProxies.
+//
+// The over-limit request is rejected with ErrTooManyRequests
+// and the header "Retry-After".
+func RateLimit(limit Rate, burst int, keyFunc func(*Context) string,
+	opts ...RateLimitOption) Middleware {
+	if burst <= 0 {
+		panic("RateLimit: burst must be greater than 0")
+	}
+	l := newRateLimiter(limit, burst)
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if keyFunc == nil {
+		keyFunc = func(c *Context) string { return l.clientIP(c) + "@" + c.Action }
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			ok, remaining, wait := l.allow(keyFunc(c), time.Now())
+			if l.remaining {
+				c.SetRespHeader("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			}
+
+			if !ok {
+				seconds := int64(math.Ceil(wait.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				c.SetRespHeader("Retry-After", strconv.FormatInt(seconds, 10))
+				return ErrTooManyRequests
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// tokenBucket is the token bucket of a key implemented by GCRA,
+// the generic cell rate algorithm, so that it is updated by CAS.
+type tokenBucket struct {
+	tat  int64 // The theoretical arrival time in nanoseconds.
+	last int64 // The last used time in nanoseconds.
+}
+
+type rateLimiter struct {
+	keys     int64 // The number of the tracked keys.
+	swept    int64 // The last swept time in nanoseconds.
+	sweeping int32
+	buckets  sync.Map // map[string]*tokenBucket
+
+	interval  int64 // The emission interval of a token. 0 means no limit.
+	tolerance int64 // interval * burst
+	noRefill  bool  // The tokens are never refilled until the key is expired.
+
+	limit       Rate
+	burst       int
+	maxKeys     int
+	idleTimeout time.Duration
+	remaining   bool
+	proxies     []*net.IPNet
+}
+
+func newRateLimiter(limit Rate, burst int) *rateLimiter {
+	l := &rateLimiter{
+		limit:       limit,
+		burst:       burst,
+		maxKeys:     10000,
+		idleTimeout: time.Minute * 10,
+	}
+
+	interval := float64(time.Second) / float64(limit)
+	if limit <= 0 || interval >= float64(math.MaxInt64/int64(burst+1)) {
+		l.interval, l.tolerance, l.noRefill = 1, int64(burst), true
+	} else {
+		l.interval = int64(interval)
+		l.tolerance = l.interval * int64(burst)
+	}
+	return l
+}
+
+// clientIP returns the ip of the client, which only honours the headers
+// "X-Forwarded-For" and "X-Real-Ip" forwarded by the trusted proxies.
+//
+// For "X-Forwarded-For", the rightmost ip not being a trusted proxy
+// is the client, because the leftmost ones may be spoofed by the client.
+func (l *rateLimiter) clientIP(c *Context) string {
+	ip := remoteIP(c.req.RemoteAddr)
+	if !l.trusted(ip) {
+		return ip
+	}
+
+	if xff := c.req.Header.Get("X-Forwarded-For"); xff != "" {
+		var leftmost string
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			if forwarded := strings.TrimSpace(ips[i]); forwarded == "" {
+				continue
+			} else if !l.trusted(forwarded) {
+				return forwarded
+			} else {
+				leftmost = forwarded
+			}
+		}
+
+		// All the forwarded ips are the trusted proxies.
+		if leftmost != "" {
+			return leftmost
+		}
+	}
+
+	if xrip := strings.TrimSpace(c.req.Header.Get("X-Real-Ip")); xrip != "" {
+		return xrip
+	}
+	return ip
+}
+
+func (l *rateLimiter) trusted(ip string) bool {
+	if len(l.proxies) == 0 {
+		return false
+	}
+
+	if _ip := net.ParseIP(ip); _ip != nil {
+		for _, ipnet := range l.proxies {
+			if ipnet.Contains(_ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (l *rateLimiter) allow(key string, now time.Time) (ok bool,
+	remaining int, wait time.Duration) {
+	if l.interval == 0 {
+		return true, l.burst - 1, 0
+	}
+
+	ns := now.UnixNano()
+	b := l.bucket(key, ns)
+	atomic.StoreInt64(&b.last, ns)
+	if l.noRefill {
+		ns = 0 // Count the used tokens only.
+	}
+
+	for {
+		tat := atomic.LoadInt64(&b.tat)
+		newtat := tat
+		if newtat < ns {
+			newtat = ns
+		}
+		newtat += l.interval
+
+		if diff := newtat - ns; diff > l.tolerance {
+			if l.noRefill {
+				return false, 0, l.idleTimeout
+			}
+			return false, 0, time.Duration(diff - l.tolerance)
+		} else if atomic.CompareAndSwapInt64(&b.tat, tat, newtat) {
+			return true, int((l.tolerance - diff) / l.interval), 0
+		}
+	}
+}
+
+// bucket returns the token bucket of the key, which sweeps the keys
+// only when adding a new key, so the hot path is lock-free.
+func (l *rateLimiter) bucket(key string, now int64) *tokenBucket {
+	if v, ok := l.buckets.Load(key); ok {
+		return v.(*tokenBucket)
+	}
+
+	v, loaded := l.buckets.LoadOrStore(key, &tokenBucket{last: now})
+	if !loaded {
+		n := atomic.AddInt64(&l.keys, 1)
+		if n > int64(l.maxKeys) || now-atomic.LoadInt64(&l.swept) >= int64(l.idleTimeout) {
+			l.sweep(now)
+		}
+	}
+	return v.(*tokenBucket)
+}
+
+type rateLimitKey struct {
+	key  interface{}
+	last int64
+}
+
+// sweep removes the idle keys, then the least recently used keys exceeding
+// the maximum number, which evicts some more keys to amortize the sweeps
+// when there are a lot of the keys.
+func (l *rateLimiter) sweep(now int64) {
+	if !atomic.CompareAndSwapInt32(&l.sweeping, 0, 1) {
+		return // Another goroutine is sweeping.
+	}
+	defer atomic.StoreInt32(&l.sweeping, 0)
+	atomic.StoreInt64(&l.swept, now)
+
+	keys := make([]rateLimitKey, 0, atomic.LoadInt64(&l.keys))
+	l.buckets.Range(func(key, value interface{}) bool {
+		last := atomic.LoadInt64(&value.(*tokenBucket).last)
+		if now-last >= int64(l.idleTimeout) {
+			l.remove(key)
+		} else {
+			keys = append(keys, rateLimitKey{key: key, last: last})
+		}
+		return true
+	})
+
+	if len(keys) <= l.maxKeys {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].last < keys[j].last })
+	for _, key := range keys[:len(keys)-(l.maxKeys-l.maxKeys/16)] {
+		l.remove(key.key)
+	}
+}
+
+func (l *rateLimiter) remove(key interface{}) {
+	l.buckets.Delete(key)
+	atomic.AddInt64(&l.keys, -1)
+}
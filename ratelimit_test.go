@@ -0,0 +1,175 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(Every(time.Second), 2)
+	l.maxKeys = 2
+
+	for i, expect := range []bool{true, true, false} {
+		if ok, _, _ := l.allow("a", now); ok != expect {
+			t.Errorf("%d: expect '%v', but got '%v'", i, expect, ok)
+		}
+	}
+
+	if ok, _, wait := l.allow("a", now); ok || wait != time.Second {
+		t.Errorf("expect wait '%s', but got '%s'", time.Second, wait)
+	}
+
+	if ok, _, _ := l.allow("a", now.Add(time.Second)); !ok {
+		t.Errorf("expect the token to be refilled after 1s")
+	}
+
+	countKeys := func() (n int) {
+		l.buckets.Range(func(interface{}, interface{}) bool { n++; return true })
+		if int64(n) != atomic.LoadInt64(&l.keys) {
+			t.Errorf("expect the key count %d, but got %d", n, l.keys)
+		}
+		return
+	}
+
+	l.allow("b", now.Add(time.Second*2))
+	l.allow("c", now.Add(time.Second*3))
+	if _, ok := l.buckets.Load("a"); ok {
+		t.Errorf("expect the least recently used key 'a' to be evicted")
+	} else if n := countKeys(); n != 2 {
+		t.Errorf("expect %d keys, but got %d", 2, n)
+	}
+
+	l.allow("d", now.Add(l.idleTimeout+time.Second*4))
+	if n := countKeys(); n != 1 {
+		t.Errorf("expect the idle keys to be expired, but got %d keys", n)
+	}
+}
+
+func TestRateLimiterNoRefill(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(0, 2)
+	for i, expect := range []bool{true, true, false} {
+		if ok, _, wait := l.allow("a", now.Add(time.Minute*time.Duration(i))); ok != expect {
+			t.Errorf("%d: expect '%v', but got '%v'", i, expect, ok)
+		} else if !ok && wait != l.idleTimeout {
+			t.Errorf("%d: expect wait '%s', but got '%s'", i, l.idleTimeout, wait)
+		}
+	}
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	const burst = 100
+	l := newRateLimiter(Every(time.Hour), burst)
+	now := time.Now()
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < burst; j++ {
+				if ok, _, _ := l.allow("a", now); ok {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != burst {
+		t.Errorf("expect %d allowed requests, but got %d", burst, allowed)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	svc := NewService()
+	svc.Use(RateLimit(Every(time.Hour), 1, nil, RateLimitRemainingHeader()))
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) })
+
+	for i, expect := range []string{"", ErrTooManyRequests.Code} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Code != expect {
+			t.Errorf("%d: expect error code '%s', but got '%s'", i, expect, resp.Error.Code)
+		}
+
+		if remaining := rec.Header().Get("X-RateLimit-Remaining"); remaining != "0" {
+			t.Errorf("%d: expect remaining '0', but got '%s'", i, remaining)
+		}
+
+		retryAfter := rec.Header().Get("Retry-After")
+		if expect == "" && retryAfter != "" {
+			t.Errorf("%d: unexpected Retry-After '%s'", i, retryAfter)
+		} else if expect != "" && retryAfter != fmt.Sprint(3600) {
+			t.Errorf("%d: expect Retry-After '3600', but got '%s'", i, retryAfter)
+		}
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	svc := NewService()
+	svc.Use(RateLimit(Every(time.Hour), 1, nil, RateLimitTrustedProxies("10.0.0.0/8", "127.0.0.1")))
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) })
+
+	call := func(remoteAddr, xff string) string {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		req.RemoteAddr = remoteAddr
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Error.Code
+	}
+
+	// The spoofed X-Forwarded-For from the untrusted client is ignored.
+	if code := call("1.1.1.1:1234", "2.2.2.2"); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+	if code := call("1.1.1.1:1234", "3.3.3.3"); code != ErrTooManyRequests.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrTooManyRequests.Code, code)
+	}
+
+	// The client behind the trusted proxies cannot spoof the leftmost ip.
+	if code := call("127.0.0.1:1234", "4.4.4.4, 5.5.5.5, 10.0.0.1"); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+	if code := call("127.0.0.1:1234", "6.6.6.6, 5.5.5.5, 10.0.0.1"); code != ErrTooManyRequests.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrTooManyRequests.Code, code)
+	}
+	if code := call("127.0.0.1:1234", "7.7.7.7"); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ServiceState is the lifecycle state of the service.
+type ServiceState int32
+
+// Predefine some service states.
+const (
+	StateReady    ServiceState = iota // Ready to serve the traffic.
+	StateStarting                     // Waiting for Warmup.
+	StateNotReady                     // Not ready by SetReady(false).
+	StateLameDuck                     // Shutting down, but still serving.
+	StateDraining                     // Refusing the new requests and draining.
+	StateStopped                      // All the in-flight requests are drained.
+)
+
+// String returns the string representation of the state.
+func (s ServiceState) String() string {
+	switch s {
+	case StateReady:
+		return "ready"
+	case StateStarting:
+		return "starting"
+	case StateNotReady:
+		return "notready"
+	case StateLameDuck:
+		return "lameduck"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current state of the service.
+func (s *Service) State() ServiceState { return ServiceState(atomic.LoadInt32(&s.state)) }
+
+// transit changes the state from one of the states to the new state,
+// and reports whether it is changed.
+func (s *Service) transit(to ServiceState, from ...ServiceState) bool {
+	for {
+		current := atomic.LoadInt32(&s.state)
+		matched := false
+		for _, state := range from {
+			if int32(state) == current {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		} else if atomic.CompareAndSwapInt32(&s.state, current, int32(to)) {
+			return true
+		}
+	}
+}
+
+// AddWarmup adds the warm-up function executed by Warmup, such as
+// to fill the caches, and the service is not ready until Warmup succeeds.
+func (s *Service) AddWarmup(fn func(ctx context.Context) error) {
+	if fn == nil {
+		panic("Service.AddWarmup: the warm-up function must not be nil")
+	}
+
+	s.lock.Lock()
+	s.warmups = append(s.warmups, fn)
+	s.lock.Unlock()
+	s.transit(StateStarting, StateReady)
+}
+
+// Warmup executes the warm-up functions added by AddWarmup in turn,
+// which should be called before serving, then the service becomes ready
+// if all of them succeed. Or, return the first error and keep not ready.
+func (s *Service) Warmup(ctx context.Context) error {
+	s.lock.RLock()
+	warmups := s.warmups
+	s.lock.RUnlock()
+
+	for _, warmup := range warmups {
+		if err := warmup(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.transit(StateReady, StateStarting)
+	return nil
+}
+
+// SetReady sets the service to be ready or not, which is consulted
+// by the readiness service registered by EnableReadinessAction.
+//
+// It is ignored and returns false after Shutdown is called.
+func (s *Service) SetReady(ready bool) bool {
+	if ready {
+		return s.transit(StateReady, StateReady, StateStarting, StateNotReady)
+	}
+	return s.transit(StateNotReady, StateReady, StateStarting, StateNotReady)
+}
+
+// EnableReadinessAction registers a service named name, such as "Ready",
+// to report the state of the service, which returns ErrServiceUnavailable
+// unless the state is StateReady.
+func (s *Service) EnableReadinessAction(name string) {
+	s.RegisterWithOptions(name, func(c *Context) error {
+		if state := s.State(); state != StateReady {
+			return ErrServiceUnavailable.WithMessage("service is %s", state)
+		}
+		return c.Success(map[string]string{"State": StateReady.String()})
+	}, WithDescription("Report the readiness of the service"))
+}
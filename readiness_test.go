@@ -0,0 +1,126 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServiceReadiness(t *testing.T) {
+	svc := NewService()
+	svc.EnableReadinessAction("Ready")
+	svc.Register("Ping", func(c *Context) error { return c.Success("pong") })
+
+	call := func(action string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	expect := func(state ServiceState, code string) {
+		t.Helper()
+		if s := svc.State(); s != state {
+			t.Errorf("expect state '%s', but got '%s'", state, s)
+		}
+		if resp := call("Ready"); resp.Error.Code != code {
+			t.Errorf("expect error code '%s', but got '%s'", code, resp.Error.Code)
+		}
+	}
+
+	expect(StateReady, "")
+
+	warmed := false
+	svc.AddWarmup(func(ctx context.Context) error { return errors.New("cold") })
+	expect(StateStarting, ErrServiceUnavailable.Code)
+	if err := svc.Warmup(context.Background()); err == nil || err.Error() != "cold" {
+		t.Errorf("expect the warm-up error, but got %v", err)
+	}
+	expect(StateStarting, ErrServiceUnavailable.Code)
+
+	svc.warmups = svc.warmups[:0]
+	svc.AddWarmup(func(ctx context.Context) error { warmed = true; return nil })
+	if err := svc.Warmup(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if !warmed {
+		t.Errorf("the warm-up function is not executed")
+	}
+	expect(StateReady, "")
+
+	svc.SetReady(false)
+	expect(StateNotReady, ErrServiceUnavailable.Code)
+	svc.SetReady(true)
+	expect(StateReady, "")
+
+	svc.LameDuckDelay = time.Millisecond * 100
+	shutdown := make(chan error)
+	go func() { shutdown <- svc.Shutdown(context.Background()) }()
+	time.Sleep(time.Millisecond * 20)
+
+	expect(StateLameDuck, ErrServiceUnavailable.Code)
+	if resp := call("Ping"); resp.Data != "pong" {
+		t.Errorf("expect to serve in the lame-duck mode, but got '%+v'", resp)
+	}
+	if svc.SetReady(true) {
+		t.Errorf("expect SetReady to be ignored after Shutdown")
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	}
+	expect(StateStopped, ErrServiceUnavailable.Code)
+}
+
+func TestServiceReadinessConcurrent(t *testing.T) {
+	svc := NewService()
+	svc.EnableReadinessAction("Ready")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				svc.SetReady((i+j)%2 == 0)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=Ready", nil)
+				svc.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}()
+	}
+
+	shutdown := make(chan error)
+	go func() { shutdown <- svc.Shutdown(context.Background()) }()
+	wg.Wait()
+
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	} else if state := svc.State(); state != StateStopped {
+		t.Errorf("expect state '%s', but got '%s'", StateStopped, state)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordEntry is the recorded exchange of a request and its response.
+type RecordEntry struct {
+	Time     time.Time
+	Request  RecordedRequest
+	Response RecordedResponse
+}
+
+// RecordedRequest is the recorded request.
+type RecordedRequest struct {
+	Method    string
+	URL       string
+	Header    http.Header
+	Action    string
+	Version   string `json:",omitempty"`
+	Body      string `json:",omitempty"`
+	Truncated bool   `json:",omitempty"`
+}
+
+// RecordedResponse is the recorded response.
+type RecordedResponse struct {
+	Status    int
+	Header    http.Header
+	Body      string        `json:",omitempty"`
+	Truncated bool          `json:",omitempty"`
+	Latency   time.Duration `json:",omitempty"`
+}
+
+// RecordWriter is used to write the records.
+type RecordWriter interface {
+	WriteRecord(rec *RecordEntry) error
+}
+
+// NewJSONLinesRecordWriter returns a new RecordWriter, which serializes
+// each record as a JSON line and writes it into w.
+//
+// It is safe to be used by multiple goroutines.
+func NewJSONLinesRecordWriter(w io.Writer) RecordWriter {
+	return &jsonLinesRecordWriter{enc: json.NewEncoder(w)}
+}
+
+type jsonLinesRecordWriter struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+func (w *jsonLinesRecordWriter) WriteRecord(rec *RecordEntry) (err error) {
+	w.lock.Lock()
+	err = w.enc.Encode(rec)
+	w.lock.Unlock()
+	return
+}
+
+// RecordOption is used to configure the Record middleware.
+type RecordOption func(*recordConfig)
+
+// RecordSampleRate returns a record option to set the rate in [0, 1]
+// of the requests to be recorded.
+//
+// Default: 1
+func RecordSampleRate(rate float64) RecordOption {
+	return func(c *recordConfig) { c.rate = rate }
+}
+
+// RecordMaxBodySize returns a record option to set the maximum size
+// of the request and response bodies recorded, which are truncated
+// and marked as Truncated if exceeding it. 0 means no limit.
+//
+// Default: 65536
+func RecordMaxBodySize(size int) RecordOption {
+	return func(c *recordConfig) { c.body.maxBody = size }
+}
+
+// RecordRedactHeaders returns a record option to redact the values
+// of the given request and response headers, such as "Authorization".
+func RecordRedactHeaders(names ...string) RecordOption {
+	return func(c *recordConfig) {
+		for _, name := range names {
+			c.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+		}
+	}
+}
+
+// RecordRedactKeys returns a record option to redact the values of the given
+// keys, which are matched case-insensitively, in the JSON request
+// and response bodies, such as "Password".
+func RecordRedactKeys(keys ...string) RecordOption {
+	return func(c *recordConfig) {
+		for _, key := range keys {
+			c.body.redacts[strings.ToLower(key)] = struct{}{}
+		}
+	}
+}
+
+type recordConfig struct {
+	rate    float64
+	body    auditConfig
+	headers map[string]struct{}
+}
+
+func (c *recordConfig) redactHeader(h http.Header) http.Header {
+	h = cloneHeader(h)
+	for name := range c.headers {
+		if values, ok := h[name]; ok {
+			for i := range values {
+				values[i] = "***"
+			}
+		}
+	}
+	return h
+}
+
+func (c *recordConfig) redactBody(data []byte) (body string, truncated bool) {
+	maxBody := c.body.maxBody
+	truncated = maxBody > 0 && len(data) > maxBody
+	if len(c.body.redacts) == 0 {
+		if truncated {
+			data = data[:maxBody]
+		}
+		return string(data), truncated
+	}
+
+	// Redact the whole body before truncating it.
+	redactor := c.body
+	redactor.maxBody = 0
+	body = redactor.redact(data)
+	if truncated = maxBody > 0 && len(body) > maxBody; truncated {
+		body = body[:maxBody]
+	}
+	return
+}
+
+// Record returns a middleware to record each sampled request and its response
+// into w, which may be replayed by Replay for the regression testing.
+//
+// The configured headers and body fields are redacted before being written.
+// If the handler has not responded, the middleware will respond
+// by c.Respond before recording.
+func Record(w RecordWriter, opts ...RecordOption) Middleware {
+	if w == nil {
+		panic("Record: the record writer must not be nil")
+	}
+
+	conf := recordConfig{rate: 1, headers: make(map[string]struct{})}
+	conf.body = auditConfig{maxBody: 65536, redacts: make(map[string]struct{})}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			if conf.rate < 1 && (conf.rate <= 0 || rand.Float64() >= conf.rate) {
+				return next(c)
+			}
+
+			start := time.Now()
+			reqBody, _ := c.BodyBytes()
+
+			// Capture the whole body to redact it and mark it as truncated.
+			resp := c.ResponseWriter()
+			tee := &teeResponseWriter{ResponseWriter: resp}
+			if len(conf.body.redacts) == 0 && conf.body.maxBody > 0 {
+				tee.max = conf.body.maxBody + 1
+			}
+			c.SetResponseWriter(tee)
+			defer c.SetResponseWriter(resp)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			rec := RecordEntry{Time: start}
+			rec.Request.Method = c.req.Method
+			rec.Request.URL = c.req.URL.RequestURI()
+			rec.Request.Header = conf.redactHeader(c.req.Header)
+			rec.Request.Action = c.Action
+			rec.Request.Version = c.GetVersion()
+			rec.Request.Body, rec.Request.Truncated = conf.redactBody(reqBody)
+			rec.Response.Status = c.StatusCode()
+			rec.Response.Header = conf.redactHeader(resp.Header())
+			rec.Response.Body, rec.Response.Truncated = conf.redactBody(tee.buf)
+			rec.Response.Latency = time.Since(start)
+
+			w.WriteRecord(&rec)
+			return
+		}
+	}
+}
+
+// ReplayReport is the report of Replay.
+type ReplayReport struct {
+	Total      int
+	Matched    int
+	Mismatches []ReplayMismatch
+}
+
+// ReplayMismatch is the mismatch between the recorded response
+// and the replayed one.
+type ReplayMismatch struct {
+	Index   int // The index of the record, starting with 0.
+	Action  string
+	Request RecordedRequest
+	Diffs   []string
+}
+
+// replayIgnoredHeaders is the set of the response headers,
+// which vary with each request and are not compared.
+var replayIgnoredHeaders = map[string]struct{}{
+	"Date":           {},
+	"Content-Length": {},
+	"X-Request-Id":   {},
+}
+
+// Replay reads the records written by NewJSONLinesRecordWriter from r,
+// feeds the recorded requests back through svc.ServeHTTP one by one,
+// and diffs the responses against the recorded ones.
+//
+// The redacted headers, the truncated bodies and the top-level field
+// "RequestId" of the JSON response bodies are not compared.
+func Replay(r io.Reader, svc *Service) (report ReplayReport, err error) {
+	dec := json.NewDecoder(r)
+	for index := 0; ; index++ {
+		var rec RecordEntry
+		if err = dec.Decode(&rec); err == io.EOF {
+			return report, nil
+		} else if err != nil {
+			return report, fmt.Errorf("invalid record %d: %s", index, err)
+		}
+
+		req := httptest.NewRequest(rec.Request.Method, rec.Request.URL,
+			strings.NewReader(rec.Request.Body))
+		for key, values := range rec.Request.Header {
+			req.Header[key] = values
+		}
+
+		resp := httptest.NewRecorder()
+		svc.ServeHTTP(resp, req)
+
+		report.Total++
+		if diffs := diffRecordedResponse(rec.Response, resp); len(diffs) == 0 {
+			report.Matched++
+		} else {
+			report.Mismatches = append(report.Mismatches, ReplayMismatch{
+				Index:   index,
+				Action:  rec.Request.Action,
+				Request: rec.Request,
+				Diffs:   diffs,
+			})
+		}
+	}
+}
+
+func diffRecordedResponse(expect RecordedResponse, resp *httptest.ResponseRecorder) (diffs []string) {
+	if expect.Status != resp.Code {
+		diffs = append(diffs, fmt.Sprintf("status: expect %d, but got %d", expect.Status, resp.Code))
+	}
+
+	keys := make([]string, 0, len(expect.Header))
+	for key := range expect.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := replayIgnoredHeaders[key]; ok {
+			continue
+		}
+
+		values := expect.Header[key]
+		if len(values) > 0 && values[0] == "***" {
+			continue
+		}
+		if got := resp.Header()[key]; !reflect.DeepEqual(values, got) {
+			diffs = append(diffs, fmt.Sprintf("header %s: expect %q, but got %q", key, values, got))
+		}
+	}
+
+	if expect.Truncated {
+		return
+	}
+
+	var ev, gv interface{}
+	body := resp.Body.Bytes()
+	if json.Unmarshal([]byte(expect.Body), &ev) == nil && json.Unmarshal(body, &gv) == nil {
+		if m, ok := ev.(map[string]interface{}); ok {
+			delete(m, "RequestId")
+		}
+		if m, ok := gv.(map[string]interface{}); ok {
+			delete(m, "RequestId")
+		}
+		diffJSON("", ev, gv, &diffs)
+	} else if expect.Body != string(body) {
+		diffs = append(diffs, fmt.Sprintf("body: expect %q, but got %q", expect.Body, body))
+	}
+	return
+}
+
+func diffJSON(ptr string, expect, got interface{}, diffs *[]string) {
+	em, eok := expect.(map[string]interface{})
+	gm, gok := got.(map[string]interface{})
+	if eok && gok {
+		keys := make([]string, 0, len(em)+len(gm))
+		for key := range em {
+			keys = append(keys, key)
+		}
+		for key := range gm {
+			if _, ok := em[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			p := ptr + "/" + escapePointer(key)
+			ev, eok := em[key]
+			gv, gok := gm[key]
+			switch {
+			case !gok:
+				*diffs = append(*diffs, "body "+p+": missing")
+			case !eok:
+				*diffs = append(*diffs, "body "+p+": unexpected")
+			default:
+				diffJSON(p, ev, gv, diffs)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(expect, got) {
+		e, _ := json.Marshal(expect)
+		g, _ := json.Marshal(got)
+		*diffs = append(*diffs, fmt.Sprintf("body %s: expect %s, but got %s", ptrOrRoot(ptr), e, g))
+	}
+}
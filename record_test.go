@@ -0,0 +1,97 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	svc := NewService()
+	svc.Use(Record(NewJSONLinesRecordWriter(buf), RecordMaxBodySize(100),
+		RecordRedactHeaders("Authorization"), RecordRedactKeys("password")))
+
+	version := "v1"
+	svc.Register("Login", func(c *Context) error {
+		var req struct{ User, Password string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(map[string]string{"User": req.User, "Version": version})
+	})
+	svc.Register("Large", func(c *Context) error {
+		return c.Success(strings.Repeat("a", 128))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/?Action=Login",
+		strings.NewReader(`{"User":"abc","Password":"123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?Action=Large", nil))
+
+	records := buf.String()
+	if strings.Contains(records, `\"123\"`) || strings.Contains(records, "Bearer") {
+		t.Errorf("not redacted: %s", records)
+	}
+
+	var rec RecordEntry
+	if err := json.Unmarshal([]byte(strings.SplitN(records, "\n", 2)[0]), &rec); err != nil {
+		t.Fatal(err)
+	} else if rec.Request.Action != "Login" || rec.Response.Status != 200 ||
+		rec.Request.Body != `{"Password":"***","User":"abc"}` {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	report, err := Replay(strings.NewReader(records), svc)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Total != 2 || report.Matched != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	version = "v2"
+	report, err = Replay(strings.NewReader(records), svc)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Total != 2 || report.Matched != 1 || len(report.Mismatches) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	} else if diffs := report.Mismatches[0].Diffs; !reflect.DeepEqual(diffs,
+		[]string{`body /Data/Version: expect "v1", but got "v2"`}) {
+		t.Errorf("unexpected diffs: %v", diffs)
+	}
+
+	if _, err = Replay(strings.NewReader("{"), svc); err == nil {
+		t.Errorf("expect an error, but got nil")
+	}
+}
+
+func TestRecordSampleRate(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	svc := NewService()
+	svc.Use(Record(NewJSONLinesRecordWriter(buf), RecordSampleRate(0)))
+	svc.Register("Action", func(c *Context) error { return nil })
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	if buf.Len() != 0 {
+		t.Errorf("unexpected record: %s", buf.String())
+	}
+}
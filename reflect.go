@@ -0,0 +1,132 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// StructReport is the report of RegisterStruct.
+type StructReport struct {
+	// Registered is the mapping from the method name to the action name.
+	Registered map[string]string
+
+	// Skipped is the mapping from the method name to the reason
+	// why it is skipped.
+	Skipped map[string]string
+}
+
+// RegisterStruct discovers the exported methods of svcImpl, and registers
+// each as a service named prefix+MethodName, whose signature must be
+//
+//	func(*Context) error
+//	func(*Context, *XxxRequest) (*XxxResponse, error)
+//
+// For the latter, the request is bound into a new XxxRequest by c.Bind,
+// and the response is responded by c.Respond. And the types of the request
+// and response are registered as the metadata.
+//
+// If svcImpl implements the interface { ActionNames() map[string]string },
+// it is used to override the action name of the method, and the method
+// mapped to "" or "-" is skipped.
+//
+// The methods with other signatures are skipped with the reason
+// in the returned report.
+func (s *Service) RegisterStruct(prefix string, svcImpl interface{},
+	opts ...ActionOption) (report StructReport) {
+	var names map[string]string
+	if v, ok := svcImpl.(interface{ ActionNames() map[string]string }); ok {
+		names = v.ActionNames()
+	}
+
+	report.Registered = make(map[string]string)
+	report.Skipped = make(map[string]string)
+
+	value := reflect.ValueOf(svcImpl)
+	vtype := value.Type()
+	for i, _len := 0, vtype.NumMethod(); i < _len; i++ {
+		method := vtype.Method(i)
+		if method.Name == "ActionNames" {
+			continue
+		}
+
+		name := prefix + method.Name
+		if names != nil {
+			if _name, ok := names[method.Name]; ok {
+				if _name == "" || _name == "-" {
+					report.Skipped[method.Name] = "ignored by ActionNames"
+					continue
+				}
+				name = prefix + _name
+			}
+		}
+
+		handler, _opts, err := methodHandler(value.Method(i))
+		if err != nil {
+			report.Skipped[method.Name] = err.Error()
+			continue
+		}
+
+		s.RegisterWithOptions(name, handler, append(_opts, opts...)...)
+		report.Registered[method.Name] = name
+	}
+
+	return
+}
+
+func methodHandler(method reflect.Value) (Handler, []ActionOption, error) {
+	mtype := method.Type()
+	if mtype.NumOut() == 1 && mtype.NumIn() == 1 {
+		if mtype.In(0) != contextType || mtype.Out(0) != errorType {
+			return nil, nil, fmt.Errorf("the signature must be func(*Context) error")
+		}
+		return method.Interface().(func(*Context) error), nil, nil
+	}
+
+	if mtype.NumIn() != 2 || mtype.NumOut() != 2 ||
+		mtype.In(0) != contextType || mtype.Out(1) != errorType {
+		return nil, nil, fmt.Errorf("the signature must be func(*Context, *Request) (*Response, error)")
+	}
+
+	reqType, respType := mtype.In(1), mtype.Out(0)
+	if reqType.Kind() != reflect.Ptr || respType.Kind() != reflect.Ptr {
+		return nil, nil, fmt.Errorf("the request and response must be pointers")
+	}
+
+	handler := func(c *Context) error {
+		req := reflect.New(reqType.Elem())
+		if err := c.Bind(req.Interface()); err != nil {
+			return err
+		}
+		c.boundReq = req.Interface()
+
+		results := method.Call([]reflect.Value{reflect.ValueOf(c), req})
+		if err, _ := results[1].Interface().(error); err != nil {
+			return c.Respond(nil, err)
+		} else if results[0].IsNil() {
+			return c.Respond(nil, nil)
+		}
+		return c.Respond(results[0].Interface(), nil)
+	}
+
+	opts := []ActionOption{WithRequestType(reqType), WithResponseType(respType)}
+	return handler, opts, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type userRequest struct{ Name string }
+type userResponse struct{ Greeting string }
+
+type userService struct{}
+
+func (userService) ActionNames() map[string]string {
+	return map[string]string{"Hello": "SayHello", "Ignored": "-"}
+}
+
+func (userService) Hello(c *Context, req *userRequest) (*userResponse, error) {
+	return &userResponse{Greeting: "hello " + req.Name}, nil
+}
+
+func (userService) Ping(c *Context) error                 { return c.Success("pong") }
+func (userService) Ignored(c *Context) error              { return nil }
+func (userService) Invalid(c *Context, name string) error { return nil }
+func (userService) NoPointer(c *Context, r userRequest) (*userResponse, error) {
+	return nil, nil
+}
+
+func TestServiceRegisterStruct(t *testing.T) {
+	svc := NewService()
+	report := svc.RegisterStruct("user.", userService{})
+
+	expect := map[string]string{"Hello": "user.SayHello", "Ping": "user.Ping"}
+	if !reflect.DeepEqual(report.Registered, expect) {
+		t.Errorf("expect registered '%v', but got '%v'", expect, report.Registered)
+	}
+	for _, name := range []string{"Ignored", "Invalid", "NoPointer"} {
+		if _, ok := report.Skipped[name]; !ok {
+			t.Errorf("expect the method '%s' to be skipped", name)
+		}
+	}
+
+	call := func(action, body string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call("user.SayHello", `{"Name":"world"}`); !reflect.DeepEqual(resp.Data,
+		map[string]interface{}{"Greeting": "hello world"}) {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp := call("user.Ping", ""); resp.Data != "pong" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if info, _ := svc.ActionInfo("user.SayHello"); info.RequestType != reflect.TypeOf(userRequest{}) {
+		t.Errorf("unexpected request type '%v'", info.RequestType)
+	}
+}
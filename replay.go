@@ -0,0 +1,187 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNonceStoreFull is returned by MemoryNonceStore when it is full.
+var ErrNonceStoreFull = errors.New("nonce store is full")
+
+// NonceStore is used to store the used nonces.
+type NonceStore interface {
+	// Seen reports whether the nonce has been seen. If not, record it
+	// with the ttl, which must be atomic.
+	Seen(nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is an in-memory NonceStore, which cleans up
+// the expired nonces periodically.
+type MemoryNonceStore struct {
+	max    int
+	lock   sync.Mutex
+	nonces map[string]time.Time
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewMemoryNonceStore returns a new MemoryNonceStore, which stores
+// at most maxEntries nonces and cleans up the expired ones every interval.
+//
+// If maxEntries is equal to or less than 0, it is 100000 by default.
+// If interval is equal to or less than 0, it is 1m by default.
+func NewMemoryNonceStore(maxEntries int, interval time.Duration) *MemoryNonceStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &MemoryNonceStore{
+		max:    maxEntries,
+		nonces: make(map[string]time.Time, 1024),
+		stop:   make(chan struct{}),
+	}
+	go s.loop(interval)
+	return s
+}
+
+// Close stops the cleanup goroutine.
+func (s *MemoryNonceStore) Close() { s.once.Do(func() { close(s.stop) }) }
+
+// Len returns the number of the stored nonces.
+func (s *MemoryNonceStore) Len() (n int) {
+	s.lock.Lock()
+	n = len(s.nonces)
+	s.lock.Unlock()
+	return
+}
+
+func (s *MemoryNonceStore) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			s.cleanup(now)
+			s.lock.Unlock()
+		}
+	}
+}
+
+func (s *MemoryNonceStore) cleanup(now time.Time) {
+	for nonce, expire := range s.nonces {
+		if !now.Before(expire) {
+			delete(s.nonces, nonce)
+		}
+	}
+}
+
+// Seen implements the interface NonceStore.
+func (s *MemoryNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if expire, ok := s.nonces[nonce]; ok && now.Before(expire) {
+		return true, nil
+	}
+
+	if len(s.nonces) >= s.max {
+		if s.cleanup(now); len(s.nonces) >= s.max {
+			return false, ErrNonceStoreFull
+		}
+	}
+
+	s.nonces[nonce] = now.Add(ttl)
+	return false, nil
+}
+
+// ReplayOption is used to configure the ReplayProtection middleware.
+type ReplayOption func(*replayConfig)
+
+// ReplayMaxSkew returns a replay option to set the maximum skew
+// between the timestamp of the request and the clock of the server.
+//
+// Default: 5m
+func ReplayMaxSkew(skew time.Duration) ReplayOption {
+	return func(c *replayConfig) { c.skew = skew }
+}
+
+type replayConfig struct {
+	skew time.Duration
+}
+
+// ReplayProtection returns a middleware to protect the request from replay,
+// which requires the header "X-Timestamp", the unix timestamp in seconds,
+// within the maximum skew, and the header "X-Nonce" not seen before.
+//
+// The expired timestamp returns ErrAuthFailureSignatureExpire,
+// and the replayed nonce returns ErrAuthFailureNonceUsed.
+//
+// It should be used after SignatureAuth, which always signs the headers
+// "X-Timestamp" and "X-Nonce", so that they cannot be replaced.
+func ReplayProtection(store NonceStore, opts ...ReplayOption) Middleware {
+	conf := replayConfig{skew: time.Minute * 5}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			ts := c.GetReqHeader("X-Timestamp")
+			if ts == "" {
+				return ErrInvalidParameter.WithMessage("missing the header X-Timestamp")
+			}
+
+			nonce := c.GetReqHeader("X-Nonce")
+			if nonce == "" {
+				return ErrInvalidParameter.WithMessage("missing the header X-Nonce")
+			}
+
+			timestamp, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return ErrInvalidParameter.WithMessage("invalid the header X-Timestamp")
+			}
+
+			skew := time.Since(time.Unix(timestamp, 0))
+			if skew < 0 {
+				skew = -skew
+			}
+			if skew > conf.skew {
+				return ErrAuthFailureSignatureExpire.WithMessage(
+					"the timestamp exceeds the maximum skew %s", conf.skew)
+			}
+
+			seen, err := store.Seen(nonce, conf.skew*2)
+			if err != nil {
+				return ErrServerError.WithCauses(err)
+			} else if seen {
+				return ErrAuthFailureNonceUsed
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore(2, time.Millisecond*10)
+	defer store.Close()
+
+	if seen, err := store.Seen("a", time.Millisecond*100); seen || err != nil {
+		t.Errorf("unexpected result: %v, %v", seen, err)
+	} else if seen, _ = store.Seen("a", time.Millisecond*100); !seen {
+		t.Errorf("expect the nonce 'a' has been seen")
+	}
+
+	store.Seen("b", time.Hour)
+	if _, err := store.Seen("c", time.Hour); err != ErrNonceStoreFull {
+		t.Errorf("expect the error '%v', but got '%v'", ErrNonceStoreFull, err)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	if n := store.Len(); n != 1 {
+		t.Errorf("expect %d nonce after cleanup, but got %d", 1, n)
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	store := NewMemoryNonceStore(0, 0)
+	defer store.Close()
+
+	svc := NewService()
+	svc.Use(ReplayProtection(store))
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) })
+
+	call := func(ts time.Time, nonce string) string {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		req.Header.Set("X-Timestamp", strconv.FormatInt(ts.Unix(), 10))
+		req.Header.Set("X-Nonce", nonce)
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Error.Code
+	}
+
+	now := time.Now()
+	if code := call(now, "n1"); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+	if code := call(now, "n1"); code != ErrAuthFailureNonceUsed.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrAuthFailureNonceUsed.Code, code)
+	}
+	if code := call(now.Add(-time.Minute*6), "n2"); code != ErrAuthFailureSignatureExpire.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrAuthFailureSignatureExpire.Code, code)
+	}
+}
+
+func TestReplayProtectionWithSignature(t *testing.T) {
+	store := NewMemoryNonceStore(0, 0)
+	defer store.Close()
+
+	lookup := func(ak string) (string, error) { return "sk", nil }
+	svc := NewService()
+	svc.Use(SignatureAuth(lookup), ReplayProtection(store))
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) })
+
+	send := func(req *http.Request) string {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Error.Code
+	}
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Nonce", "n1")
+	if err := SignRequest(req, "ak", "sk"); err != nil {
+		t.Fatal(err)
+	} else if code := send(req); code != "" {
+		t.Errorf("unexpected error code '%s'", code)
+	}
+
+	// Replay the captured request with a fresh nonce.
+	req.Header.Set("X-Nonce", "n2")
+	if code := send(req); code != ErrSignatureDoesNotMatch.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrSignatureDoesNotMatch.Code, code)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// WithResponseHeaders returns an action option to set the static response
+// headers of the registered service, which take precedence over
+// Service.StaticResponseHeaders, and the empty value removes the one
+// of the service.
+func WithResponseHeaders(headers map[string]string) ActionOption {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[http.CanonicalHeaderKey(k)] = v
+	}
+	return func(a *action) { a.headers = copied }
+}
+
+// registerStaticHeaders registers the callback before writing the header
+// to add the static and echoed response headers if configured.
+func (s *Service) registerStaticHeaders(c *Context) {
+	if len(s.StaticResponseHeaders) == 0 && len(s.EchoRequestHeaders) == 0 &&
+		atomic.LoadInt32(&s.actionHeaders) == 0 {
+		return
+	}
+
+	if c.staticfn == nil {
+		c.staticfn = c.writeStaticHeaders
+	}
+	c.res.before = append(c.res.before, c.staticfn)
+}
+
+// writeStaticHeaders adds the static and echoed response headers,
+// which do not override those set by the handler.
+func (c *Context) writeStaticHeaders(int) {
+	header := c.res.Header()
+	for _, key := range c.svc.EchoRequestHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if values := c.req.Header[key]; len(values) > 0 && len(header[key]) == 0 {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+
+	var overrides map[string]string
+	if c.action != nil {
+		overrides = c.action.headers
+	}
+
+	for key, value := range overrides {
+		if value != "" && len(header[key]) == 0 {
+			header[key] = []string{value}
+		}
+	}
+
+	for key, value := range c.svc.StaticResponseHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if _, ok := overrides[key]; !ok && len(header[key]) == 0 {
+			header[key] = []string{value}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceStaticResponseHeaders(t *testing.T) {
+	svc := NewService()
+	svc.StaticResponseHeaders = map[string]string{"x-service-name": "user", "X-Region": "us-east-1"}
+	svc.EchoRequestHeaders = []string{"X-Correlation-Id"}
+	svc.RegisterHTTP("Raw", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("raw"))
+	}))
+	svc.RegisterWithOptions("Override", func(c *Context) error {
+		c.SetRespHeader("X-Service-Name", "handler")
+		return c.Success(nil)
+	}, WithResponseHeaders(map[string]string{"x-region": "eu-west-1", "X-Service-Name": "override"}))
+	svc.RegisterWithOptions("Remove", func(c *Context) error { return c.Success(nil) },
+		WithResponseHeaders(map[string]string{"X-Region": ""}))
+
+	serve := func(action string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		req.Header.Set("X-Correlation-Id", "cid")
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		if values := rec.Header()["X-Correlation-Id"]; len(values) > 0 {
+			values[0] = "changed"
+			if v := req.Header.Get("X-Correlation-Id"); v != "cid" {
+				t.Errorf("the request header is aliased: %s", v)
+			}
+			values[0] = "cid"
+		}
+		return rec.Header()
+	}
+
+	expect := func(action string, header http.Header, key, value string) {
+		if v := header.Get(key); v != value {
+			t.Errorf("%s: expect the header %s '%s', but got '%s'", action, key, value, v)
+		}
+	}
+
+	header := serve("Raw")
+	expect("Raw", header, "X-Service-Name", "user")
+	expect("Raw", header, "X-Region", "us-east-1")
+	expect("Raw", header, "X-Correlation-Id", "cid")
+
+	header = serve("Override")
+	expect("Override", header, "X-Service-Name", "handler")
+	expect("Override", header, "X-Region", "eu-west-1")
+
+	header = serve("Remove")
+	expect("Remove", header, "X-Service-Name", "user")
+	expect("Remove", header, "X-Region", "")
+
+	header = serve("Unknown")
+	expect("Unknown", header, "X-Service-Name", "user")
+	expect("Unknown", header, "X-Correlation-Id", "cid")
+}
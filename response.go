@@ -15,17 +15,43 @@
 package httpsvc
 
 import (
+	"bufio"
+	"bytes"
 	"io"
+	"net"
 	"net/http"
+	"sync"
 )
 
 // ResponseWriter is the proxy of http.ResponseWriter.
 type responseWriter struct {
 	http.ResponseWriter
 
-	Size   int64
-	Wrote  bool
-	Status int
+	Size     int64
+	Wrote    bool
+	Status   int
+	Hijacked bool
+
+	// Err is the first error returned by writing the body, such as
+	// the client has gone away.
+	Err error
+
+	capture *bytes.Buffer // The captured body, which is nil if not capturing.
+	limit   int           // The maximum size of the captured body, 0 means no limit.
+	before  []func(status int)
+
+	max int64 // The maximum size of the body, 0 means no limit.
+
+	snapshot bool        // Indicate whether to snapshot the header when written.
+	sent     http.Header // The snapshot of the written header.
+
+	// superfluous is called when WriteHeader is called again with
+	// a different status code, which is kept when resetting.
+	superfluous func(code int)
+
+	// copybufs is the pool of *[]byte used as the scratch space of ReadFrom,
+	// which is kept when resetting. If nil, allocate a new one.
+	copybufs *sync.Pool
 }
 
 // newResponse returns a new responseWriter.
@@ -35,9 +61,25 @@ func newResponseWriter(w http.ResponseWriter) *responseWriter {
 
 // WriteHeader implements http.ResponseWriter#WriteHeader().
 func (r *responseWriter) WriteHeader(code int) {
+	if !r.Wrote {
+		r.writeHeader(code)
+	} else if code != r.Status && r.superfluous != nil {
+		r.superfluous(code)
+	}
+}
+
+// writeHeader is the same as WriteHeader, but does not report
+// the superfluous call, which is used to write the default status code.
+func (r *responseWriter) writeHeader(code int) {
 	if !r.Wrote {
 		r.Wrote = true
 		r.Status = code
+		for i := len(r.before) - 1; i >= 0; i-- {
+			r.before[i](code)
+		}
+		if r.snapshot {
+			r.sent = cloneHeader(r.ResponseWriter.Header())
+		}
 		r.ResponseWriter.WriteHeader(code)
 	}
 }
@@ -48,9 +90,21 @@ func (r *responseWriter) Write(b []byte) (n int, err error) {
 		return
 	}
 
-	r.WriteHeader(http.StatusOK)
+	r.writeHeader(http.StatusOK)
+	exceeded := r.exceed(int64(len(b)))
+	if exceeded {
+		b = b[:r.max-r.Size]
+	}
+
 	n, err = r.ResponseWriter.Write(b)
+	r.recordError(err)
 	r.Size += int64(n)
+	if r.capture != nil {
+		r.captureBytes(b[:n])
+	}
+	if exceeded && err == nil {
+		err = ErrResponseTooLarge
+	}
 	return
 }
 
@@ -60,16 +114,187 @@ func (r *responseWriter) WriteString(s string) (n int, err error) {
 		return
 	}
 
-	r.WriteHeader(http.StatusOK)
+	r.writeHeader(http.StatusOK)
+	exceeded := r.exceed(int64(len(s)))
+	if exceeded {
+		s = s[:r.max-r.Size]
+	}
+
 	n, err = io.WriteString(r.ResponseWriter, s)
+	r.recordError(err)
 	r.Size += int64(n)
+	if r.capture != nil {
+		r.captureString(s[:n])
+	}
+	if exceeded && err == nil {
+		err = ErrResponseTooLarge
+	}
+	return
+}
+
+// recordError records the first write error except http.ErrHandlerTimeout,
+// which is caused by the Timeout middleware instead of the client.
+func (r *responseWriter) recordError(err error) {
+	if err != nil && r.Err == nil && err != http.ErrHandlerTimeout {
+		r.Err = err
+	}
+}
+
+func (r *responseWriter) captureBytes(b []byte) {
+	if r.limit > 0 {
+		if n := r.limit - r.capture.Len(); n < len(b) {
+			if n <= 0 {
+				return
+			}
+			b = b[:n]
+		}
+	}
+	r.capture.Write(b)
+}
+
+func (r *responseWriter) captureString(s string) {
+	if r.limit > 0 {
+		if n := r.limit - r.capture.Len(); n < len(s) {
+			if n <= 0 {
+				return
+			}
+			s = s[:n]
+		}
+	}
+	r.capture.WriteString(s)
+}
+
+// captureWriter is used to capture the body read by ReadFrom.
+type captureWriter struct{ *responseWriter }
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	w.captureBytes(p)
+	return len(p), nil
+}
+
+// ReadFrom implements the interface io.ReaderFrom, which delegates
+// to the underlying writer if it implements io.ReaderFrom, so that
+// the sendfile optimization of net/http may be used for *os.File.
+// Or, the body is copied with the scratch space from the pool of the service.
+//
+// Notice: the error of the underlying io.ReaderFrom is not recorded as Err,
+// because it may be caused by reading src.
+func (r *responseWriter) ReadFrom(src io.Reader) (n int64, err error) {
+	r.writeHeader(http.StatusOK)
+	if r.max > 0 {
+		// Write by Write to truncate the body at the limit.
+		return io.Copy(limitWriter{r}, src)
+	}
+	if r.capture != nil {
+		src = io.TeeReader(src, captureWriter{r})
+	}
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else if r.copybufs == nil {
+		n, err = io.Copy(recordWriter{r}, src)
+	} else {
+		buf := r.copybufs.Get().(*[]byte)
+		defer r.copybufs.Put(buf)
+		n, err = io.CopyBuffer(recordWriter{r}, src, *buf)
+	}
+	r.Size += n
+	return
+}
+
+// exceed reports whether the body exceeds the limit after writing n bytes.
+func (r *responseWriter) exceed(n int64) bool { return r.max > 0 && r.Size+n > r.max }
+
+// limitWriter writes by responseWriter.Write, which hides io.ReaderFrom.
+type limitWriter struct{ r *responseWriter }
+
+func (w limitWriter) Write(p []byte) (int, error) { return w.r.Write(p) }
+
+// recordWriter writes into the underlying writer and records the write error,
+// which also hides the optional interfaces, such as io.ReaderFrom,
+// to avoid the recursion of io.Copy.
+type recordWriter struct{ r *responseWriter }
+
+func (w recordWriter) Write(p []byte) (n int, err error) {
+	n, err = w.r.ResponseWriter.Write(p)
+	w.r.recordError(err)
+	return
+}
+
+// Unwrap returns the underlying response writer, which is used
+// by http.ResponseController.
+func (r *responseWriter) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Flush implements the interface http.Flusher, which writes the header
+// with the default status code 200 if not written, then flushes
+// the underlying writer if it supports.
+func (r *responseWriter) Flush() { r.FlushError() }
+
+// FlushError is the same as Flush, but returns http.ErrNotSupported
+// if the underlying writer does not support it, which is used
+// by http.ResponseController.
+func (r *responseWriter) FlushError() error {
+	r.writeHeader(http.StatusOK)
+	switch w := r.ResponseWriter.(type) {
+	case interface{ FlushError() error }:
+		return w.FlushError()
+	case http.Flusher:
+		w.Flush()
+		return nil
+	default:
+		return http.ErrNotSupported
+	}
+}
+
+// Hijack implements the interface http.Hijacker, which returns
+// http.ErrNotSupported if the underlying writer does not support it.
+//
+// After hijacked, the response is marked as written.
+func (r *responseWriter) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	if conn, rw, err = hijacker.Hijack(); err == nil {
+		r.Wrote, r.Hijacked = true, true
+	}
 	return
 }
 
 // Reset resets the response to the initialized and returns itself.
 func (r *responseWriter) Reset(w http.ResponseWriter) {
-	*r = responseWriter{ResponseWriter: w, Status: http.StatusOK}
+	*r = responseWriter{
+		ResponseWriter: w,
+		Status:         http.StatusOK,
+		superfluous:    r.superfluous,
+		copybufs:       r.copybufs,
+	}
 }
 
 // SetWriter resets the writer to w and return itself.
 func (r *responseWriter) SetWriter(w http.ResponseWriter) { r.ResponseWriter = w }
+
+// bufferResponseWriter is a http.ResponseWriter to buffer the response
+// in memory instead of sending it to the client.
+type bufferResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferResponseWriter() *bufferResponseWriter {
+	return &bufferResponseWriter{header: make(http.Header, 4)}
+}
+
+func (w *bufferResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
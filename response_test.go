@@ -0,0 +1,493 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterHijack(t *testing.T) {
+	hijacked := make(chan bool, 1)
+	svc := NewService()
+	svc.Register("Hijack", func(c *Context) error {
+		conn, rw, err := c.Hijack()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		hijacked <- c.IsHijacked() && c.IsResponded()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 6\r\nConnection: close\r\n\r\nraw ok")
+		return rw.Flush()
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /?Action=Hijack HTTP/1.1\r\nHost: " + u.Host + "\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 16)
+	n, _ := resp.Body.Read(buf)
+	if body := string(buf[:n]); body != "raw ok" {
+		t.Errorf("expect the body 'raw ok', but got '%s'", body)
+	}
+	if !<-hijacked {
+		t.Errorf("the response is not marked as hijacked")
+	}
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Hijack", nil))
+	if !strings.Contains(rec.Body.String(), ErrServerError.Code) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+type readerFromWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (w *readerFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return w.ResponseRecorder.Body.ReadFrom(r)
+}
+
+func TestResponseWriterReadFrom(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newResponseWriter(rec)
+	if n, err := w.ReadFrom(strings.NewReader("abc")); err != nil || n != 3 {
+		t.Errorf("unexpected result: %d, %v", n, err)
+	} else if !w.Wrote || w.Size != 3 || rec.Body.String() != "abc" {
+		t.Errorf("unexpected response: %v, %d, %s", w.Wrote, w.Size, rec.Body.String())
+	}
+
+	rfw := &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}
+	w = newResponseWriter(rfw)
+	if n, err := w.ReadFrom(strings.NewReader("abcd")); err != nil || n != 4 {
+		t.Errorf("unexpected result: %d, %v", n, err)
+	} else if !rfw.readFrom || w.Size != 4 || rfw.Body.String() != "abcd" {
+		t.Errorf("unexpected response: %v, %d, %s", rfw.readFrom, w.Size, rfw.Body.String())
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.txt")
+	if err = ioutil.WriteFile(path, []byte("0123456789"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewService()
+	svc.Register("File", func(c *Context) error { return c.File(filepath.Join(dir, c.Query().Get("Name"))) })
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?Action=File&Name=test.txt", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	svc.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=File&Name=missing.txt", nil))
+	if !strings.Contains(rec.Body.String(), ErrResourceNotFound.Code) {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func BenchmarkContextStreamFile(b *testing.B) {
+	f, err := ioutil.TempFile("", "httpsvc")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.Write(bytes.Repeat([]byte("a"), 64*1024))
+
+	svc := NewService()
+	rfw := &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}
+	rfw.Body.Grow(64 * 1024)
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), rfw)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, io.SeekStart)
+		rfw.Body.Reset()
+		c.res.Reset(rfw)
+		c.Stream(200, "text/plain", f)
+	}
+}
+
+// readerOnly hides the optional interfaces of io.Reader, such as io.WriterTo.
+type readerOnly struct{ io.Reader }
+
+func BenchmarkContextStreamReader(b *testing.B) {
+	data := bytes.Repeat([]byte("a"), 64*1024)
+	reader := bytes.NewReader(data)
+	var src io.Reader = readerOnly{reader}
+
+	svc := NewService()
+	w := discardResponseWriter{http.Header{}}
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), w)
+	stream := func() {
+		reader.Reset(data)
+		c.res.Reset(w)
+		c.Stream(200, "text/plain", src)
+	}
+
+	if n := testing.AllocsPerRun(100, stream); n != 0 {
+		b.Fatalf("expect no allocation, but got %v", n)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stream()
+	}
+}
+
+func TestContextCaptureResponse(t *testing.T) {
+	var captured, uncaptured string
+	svc := NewService()
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.CapturedResponse() != nil {
+				t.Errorf("unexpected captured response")
+			}
+
+			if c.Query().Get("Capture") != "" {
+				c.CaptureResponse(8)
+				c.CaptureResponse(16)
+			}
+			err := next(c)
+			if c.Query().Get("Capture") != "" {
+				captured = string(c.CapturedResponse())
+			} else {
+				uncaptured = string(c.CapturedResponse())
+			}
+			return err
+		}
+	})
+	svc.Register("Action", func(c *Context) error {
+		c.WriteString("0123456789")
+		c.Write([]byte("abcdefghij"))
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action&Capture=1", nil))
+	if captured != "0123456789abcdef" || rec.Body.String() != "0123456789abcdefghij" {
+		t.Errorf("unexpected captured response '%s' for the body '%s'", captured, rec.Body.String())
+	}
+
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	if uncaptured != "" {
+		t.Errorf("unexpected captured response '%s'", uncaptured)
+	}
+
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.CaptureResponse(0)
+	c.Stream(200, "text/plain", io.LimitReader(strings.NewReader("stream"), 6))
+	if body := string(c.CapturedResponse()); body != "stream" {
+		t.Errorf("expect the captured response 'stream', but got '%s'", body)
+	}
+	svc.ReleaseContext(c)
+}
+
+func TestContextBeforeWriteHeader(t *testing.T) {
+	var order []string
+	var panicValue interface{}
+
+	svc := NewService()
+	svc.PanicHandler = func(c *Context, r interface{}) { panicValue = r }
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.BeforeWriteHeader(func(status int) {
+				order = append(order, "first")
+				c.SetRespHeader("X-Status", strconv.Itoa(status))
+			})
+			c.BeforeWriteHeader(func(int) { panic("test") })
+			c.BeforeWriteHeader(func(int) { order = append(order, "last") })
+			return next(c)
+		}
+	})
+	svc.Register("Action", func(c *Context) error {
+		c.WriteHeader(http.StatusCreated)
+		c.WriteHeader(http.StatusInternalServerError)
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Status") != "201" {
+		t.Errorf("unexpected response: %d, %v", rec.Code, rec.Header())
+	}
+	if strings.Join(order, ",") != "last,first" {
+		t.Errorf("unexpected order of the callbacks: %v", order)
+	}
+	if panicValue != "test" {
+		t.Errorf("expect the panic 'test', but got %v", panicValue)
+	}
+}
+
+func TestServiceOnSuperfluousWrite(t *testing.T) {
+	var attempts []int
+	var stack []byte
+	svc := NewService()
+	svc.OnSuperfluousWrite = func(c *Context, status int, s []byte) {
+		attempts, stack = append(attempts, status), s
+	}
+	svc.Register("Action", func(c *Context) error {
+		c.WriteHeader(http.StatusAccepted)
+		c.WriteHeader(http.StatusAccepted) // The same status is not reported.
+		if status, wrote := c.WroteStatus(); !wrote || status != http.StatusAccepted {
+			t.Errorf("unexpected wrote status: %d, %v", status, wrote)
+		}
+
+		c.Success("ok") // The default status 200 of JSON is not reported.
+		c.WriteHeader(http.StatusInternalServerError)
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expect the status code %d, but got %d", http.StatusAccepted, rec.Code)
+	}
+	if len(attempts) != 1 || attempts[0] != http.StatusInternalServerError {
+		t.Errorf("unexpected superfluous writes: %v", attempts)
+	} else if !bytes.Contains(stack, []byte("TestServiceOnSuperfluousWrite")) {
+		t.Errorf("unexpected stack: %s", stack)
+	}
+}
+
+func TestContextJSONDirect(t *testing.T) {
+	svc := NewService()
+	rec := httptest.NewRecorder()
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	defer svc.ReleaseContext(c)
+
+	if err := c.JSONDirect(http.StatusCreated, map[string]int{"Id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expect the status code %d, but got %d", http.StatusCreated, rec.Code)
+	} else if ct := rec.Header().Get("Content-Type"); ct != MIMEApplicationJSONCharsetUTF8 {
+		t.Errorf("unexpected the content type '%s'", ct)
+	} else if body := rec.Body.String(); body != "{\"Id\":1}\n" {
+		t.Errorf("unexpected the body '%s'", body)
+	} else if c.ResponseSize() != int64(len(body)) {
+		t.Errorf("expect the response size %d, but got %d", len(body), c.ResponseSize())
+	}
+}
+
+func TestContextRespondEnvelope(t *testing.T) {
+	svc := NewService()
+	respond := func(requestID string, data interface{}, err error) string {
+		rec := httptest.NewRecorder()
+		c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		defer svc.ReleaseContext(c)
+
+		c.RequestID = requestID
+		c.Respond(data, err)
+		return rec.Body.String()
+	}
+
+	for _, test := range []struct {
+		RequestID string
+		Data      interface{}
+		Error     error
+		Expect    string
+	}{
+		{"", nil, nil, "{}\n"},
+		{"abc", nil, nil, "{\"RequestId\":\"abc\"}\n"},
+		{"a\"<b>", nil, nil, "{\"RequestId\":\"a\\\"\\u003cb\\u003e\"}\n"},
+		{"abc", 123, nil, "{\"RequestId\":\"abc\",\"Data\":123}\n"},
+		{"abc", nil, ErrConflict, "{\"RequestId\":\"abc\",\"Error\":{\"Code\":\"Conflict\",\"Message\":\"request conflicts\"}}\n"},
+	} {
+		if body := respond(test.RequestID, test.Data, test.Error); body != test.Expect {
+			t.Errorf("expect the body '%s', but got '%s'", test.Expect, body)
+		}
+	}
+}
+
+func TestContextRespondSplicedRequestID(t *testing.T) {
+	svc := NewService()
+	for _, id := range []string{
+		"abc", `a"b`, `a\b`, "a/b", "中文ID", "a b c", "<a&b>", "a\nb\r\tc", "a\u2028b\u2029",
+		"a\x01b", "a\xffb", // Fall back to the json encoder.
+	} {
+		rec := httptest.NewRecorder()
+		c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.RequestID = id
+		c.Success(nil)
+		svc.ReleaseContext(c)
+
+		buf := bytes.NewBuffer(nil)
+		json.NewEncoder(buf).Encode(jsonResponse{RequestID: id})
+		if expect := buf.String(); rec.Body.String() != expect {
+			t.Errorf("%q: expect the body '%s', but got '%s'", id, expect, rec.Body.String())
+		}
+	}
+}
+
+func TestContextRespondOnce(t *testing.T) {
+	var errs []error
+	svc := NewService()
+	svc.OnSuperfluousError = func(c *Context, err error) { errs = append(errs, err) }
+
+	var second error
+	svc.Register("ErrorAfterSuccess", func(c *Context) error {
+		c.Success("ok")
+		return ErrFailedOperation
+	})
+	svc.Register("FailureAfterSuccess", func(c *Context) error {
+		c.Success("ok")
+		second = c.Failure(ErrConflict)
+		return second
+	})
+	svc.Register("MiddlewareWrites", func(c *Context) error {
+		return c.Success("handler")
+	}, func(next Handler) Handler {
+		return func(c *Context) error {
+			c.Text(http.StatusOK, "text/plain", "middleware")
+			return next(c)
+		}
+	})
+	serve := func(action string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action="+action, nil))
+		return rec
+	}
+
+	rec := serve("ErrorAfterSuccess")
+	if body := rec.Body.String(); !strings.Contains(body, `"ok"`) || strings.Contains(body, "FailedOperation") {
+		t.Errorf("unexpected the response body: %s", body)
+	}
+	if len(errs) != 1 || errs[0].(Error).Code != ErrFailedOperation.Code {
+		t.Errorf("unexpected the superfluous errors: %v", errs)
+	}
+
+	errs = nil
+	serve("FailureAfterSuccess")
+	if second != ErrAlreadyResponded {
+		t.Errorf("expect the error ErrAlreadyResponded, but got %v", second)
+	}
+	if len(errs) != 1 || errs[0].(Error).Code != ErrConflict.Code {
+		t.Errorf("unexpected the superfluous errors: %v", errs)
+	}
+
+	errs = nil
+	if body := serve("MiddlewareWrites").Body.String(); body != "middleware" {
+		t.Errorf("unexpected the response body: %s", body)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected the superfluous errors: %v", errs)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expect a panic")
+			} else if s := fmt.Sprint(r); !strings.HasPrefix(s, "Context.MustNotHaveResponded:") {
+				t.Errorf("unexpected the panic: %s", s)
+			}
+		}()
+		c := NewContext()
+		c.res.Reset(httptest.NewRecorder())
+		c.res.WriteHeader(http.StatusOK)
+		c.MustNotHaveResponded()
+	}()
+}
+
+func TestContextSentHeaders(t *testing.T) {
+	var sent http.Header
+	svc := NewService()
+	svc.OnResponse(func(c *Context, err error) { sent = c.SentHeaders() })
+	svc.Register("Action", func(c *Context) error {
+		c.AddRespHeader("X-Values", "a")
+		c.AddRespHeader("X-Values", "b")
+		c.SetRespHeader("X-Deleted", "v")
+		c.DelRespHeader("X-Deleted")
+		c.Success(nil)
+		c.SetRespHeader("X-After", "v")
+		return nil
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+		return rec
+	}
+
+	if rec := serve(); len(rec.Header()["X-Values"]) != 2 || rec.Header().Get("X-Deleted") != "" {
+		t.Errorf("unexpected the response headers: %v", rec.Header())
+	} else if sent != nil {
+		t.Errorf("expect no snapshot, but got %v", sent)
+	}
+
+	svc.SnapshotSentHeaders = true
+	serve()
+	if values := sent["X-Values"]; len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("unexpected the sent headers: %v", sent)
+	} else if sent.Get("X-After") != "" {
+		t.Errorf("unexpected the header set after written: %v", sent)
+	}
+
+	svc.SnapshotSentHeaders = false
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SentHeaders()
+			return next(c)
+		}
+	})
+	sent = nil
+	serve()
+	if len(sent["X-Values"]) != 2 {
+		t.Errorf("unexpected the sent headers: %v", sent)
+	}
+}
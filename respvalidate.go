@@ -0,0 +1,186 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// WithResponseSchema returns an action option to set the JSON Schema
+// of the response data, which is used to validate the response
+// when enabling Service.ValidateResponses. It panics if the schema is invalid.
+func WithResponseSchema(schema []byte) ActionOption {
+	s, err := CompileJSONSchema(schema)
+	if err != nil {
+		panic(fmt.Errorf("WithResponseSchema: %s", err))
+	}
+	return func(a *action) { a.respSchema = s }
+}
+
+// checkResponse is called by Respond before encoding the successful response
+// when enabling ValidateResponses, which returns a non-empty error only if
+// the response is invalid and StrictResponseValidation is enabled.
+func (s *Service) checkResponse(c *Context, data interface{}) (e Error) {
+	a := c.action
+	if a.respSchema == nil && a.respType == nil {
+		return
+	}
+
+	mismatches := diffResponse(a, data)
+	if len(mismatches) == 0 {
+		return
+	}
+
+	if s.OnInvalidResponse != nil {
+		s.OnInvalidResponse(c, mismatches)
+	} else {
+		log.Printf("invalid response of the action '%s': %s", a.name,
+			strings.Join(mismatches, "; "))
+	}
+
+	if s.StrictResponseValidation {
+		e = ErrServerError.WithMessage("invalid response: %s", strings.Join(mismatches, "; "))
+	}
+	return
+}
+
+func diffResponse(a *action, data interface{}) (mismatches []string) {
+	if a.respSchema == nil && indirectType(data) == a.respType {
+		return nil // Fast path: the same type as the registered.
+	}
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return []string{"cannot encode the data: " + err.Error()}
+	}
+
+	var v interface{}
+	json.Unmarshal(buf, &v)
+
+	if a.respSchema != nil {
+		for _, violation := range a.respSchema.ValidateValue(v) {
+			mismatches = append(mismatches, violation.String())
+		}
+	}
+	if a.respType != nil {
+		diffType(a.respType, v, "", &mismatches)
+	}
+	return
+}
+
+// diffType compares the JSON value with the fields of the struct type,
+// and appends the unexpected and missing fields.
+func diffType(t reflect.Type, v interface{}, ptr string, mismatches *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		if v != nil {
+			*mismatches = append(*mismatches, fmt.Sprintf("%s: expect an object, but got %s",
+				ptrOrRoot(ptr), jsonType(v)))
+		}
+		return
+	}
+
+	fields := jsonFields(t)
+	names := make([]string, 0, len(m)+len(fields))
+	for name := range m {
+		names = append(names, name)
+	}
+	for name := range fields {
+		if _, ok := m[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := ptr + "/" + escapePointer(name)
+		field, expected := fields[name]
+		value, exists := m[name]
+		switch {
+		case !expected:
+			*mismatches = append(*mismatches, p+": unexpected field")
+		case !exists:
+			if !field.omitempty {
+				*mismatches = append(*mismatches, p+": missing field")
+			}
+		default:
+			diffType(field.typ, value, p, mismatches)
+		}
+	}
+}
+
+func ptrOrRoot(ptr string) string {
+	if ptr == "" {
+		return "/"
+	}
+	return ptr
+}
+
+type jsonField struct {
+	typ       reflect.Type
+	omitempty bool
+}
+
+// jsonFields returns the JSON fields of the struct type, which handles
+// the struct tag "json" and the embedded structs.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField, t.NumField())
+	for i, _len := 0, t.NumField(); i < _len; i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if index := strings.IndexByte(tag, ','); index >= 0 {
+			name, opts = tag[:index], tag[index:]
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for n, f := range jsonFields(ft) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = f
+				}
+			}
+			continue
+		} else if sf.PkgPath != "" { // Unexported
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = jsonField{typ: sf.Type, omitempty: strings.Contains(opts, ",omitempty")}
+	}
+	return fields
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testRespBase struct {
+	ID string `json:"Id"`
+}
+
+type testResp struct {
+	testRespBase
+	Name  string
+	Note  string `json:",omitempty"`
+	Inner struct {
+		Value int
+	}
+	Ignore string `json:"-"`
+}
+
+func TestValidateResponses(t *testing.T) {
+	var mismatches []string
+	svc := NewService()
+	svc.ValidateResponses = true
+	svc.OnInvalidResponse = func(c *Context, ms []string) { mismatches = ms }
+
+	svc.RegisterWithOptions("Typed", func(c *Context) error {
+		return c.Success(testResp{Name: "abc"})
+	}, WithResponseType(testResp{}))
+	svc.RegisterWithOptions("Map", func(c *Context) error {
+		return c.Success(map[string]interface{}{"Id": "1", "Extra": 1, "Inner": map[string]interface{}{}})
+	}, WithResponseType(testResp{}))
+	svc.RegisterWithOptions("Schema", func(c *Context) error {
+		return c.Success(map[string]interface{}{"Name": 1})
+	}, WithResponseSchema([]byte(`{"type":"object","required":["Name"],"properties":{"Name":{"type":"string"}}}`)))
+
+	call := func(action string) *httptest.ResponseRecorder {
+		mismatches = nil
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if call("Typed"); mismatches != nil {
+		t.Errorf("unexpected mismatches: %v", mismatches)
+	}
+
+	rec := call("Map")
+	expect := []string{"/Extra: unexpected field", "/Inner/Value: missing field", "/Name: missing field"}
+	if !reflect.DeepEqual(mismatches, expect) {
+		t.Errorf("expect mismatches %v, but got %v", expect, mismatches)
+	} else if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"Extra":1`) {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	call("Schema")
+	expect = []string{"/Name: expect type string, but got number"}
+	if !reflect.DeepEqual(mismatches, expect) {
+		t.Errorf("expect mismatches %v, but got %v", expect, mismatches)
+	}
+
+	svc.StrictResponseValidation = true
+	rec = call("Map")
+	if rec.Code != 500 || !strings.Contains(rec.Body.String(), "invalid response") ||
+		strings.Contains(rec.Body.String(), "Extra\":1") {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	svc.ValidateResponses = false
+	if rec = call("Map"); mismatches != nil || rec.Code != 200 {
+		t.Errorf("unexpected validation: %d, %v", rec.Code, mismatches)
+	}
+}
@@ -0,0 +1,620 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithRequestSchema returns an action option to validate the JSON request
+// body against the JSON Schema before calling the handler, which is compiled
+// once when calling it and panics if the schema is invalid.
+//
+// The empty body is validated as the empty object "{}". All the violations
+// are aggregated into ErrInvalidParameter with the JSON pointers.
+//
+// See CompileJSONSchema for the supported keywords.
+func WithRequestSchema(schema []byte) ActionOption {
+	s, err := CompileJSONSchema(schema)
+	if err != nil {
+		panic(fmt.Errorf("WithRequestSchema: %s", err))
+	}
+	return func(a *action) { a.reqSchema = s }
+}
+
+func (s *Service) validateRequestSchema(c *Context, schema *JSONSchema) error {
+	body, err := c.BodyBytes()
+	if err != nil {
+		return ErrInvalidParameter.WithMessage(err.Error())
+	} else if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	if violations := schema.Validate(body); len(violations) > 0 {
+		details := make([]ErrorDetail, len(violations))
+		for i, v := range violations {
+			details[i] = ErrorDetail{Field: v.Pointer, Reason: v.Message}
+		}
+
+		err := ErrInvalidParameter.WithMessage(joinViolations(violations))
+		err.Details = details
+		return err
+	}
+	return nil
+}
+
+func joinViolations(violations []SchemaViolation) string {
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		msgs[i] = v.String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SchemaViolation is a violation of the JSON Schema.
+type SchemaViolation struct {
+	Pointer string // The JSON pointer of the invalid value, such as "/a/0".
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	if v.Pointer == "" {
+		return "/: " + v.Message
+	}
+	return v.Pointer + ": " + v.Message
+}
+
+// JSONSchema is the compiled JSON Schema.
+type JSONSchema struct{ root *schemaNode }
+
+// CompileJSONSchema compiles the JSON Schema, which supports the keywords:
+//
+//	type, enum, const, properties, required, additionalProperties,
+//	minProperties, maxProperties, items, minItems, maxItems, uniqueItems,
+//	minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum,
+//	exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not, and $ref
+//	referring to the local JSON pointer, such as "#/definitions/name"
+//	or "#/$defs/name".
+//
+// Other keywords are ignored.
+func CompileJSONSchema(schema []byte) (*JSONSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(schema, &raw); err != nil {
+		return nil, fmt.Errorf("invalid json schema: %s", err)
+	}
+
+	c := schemaCompiler{root: raw, refs: make(map[string]*schemaNode)}
+	root, err := c.compile(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchema{root: root}, nil
+}
+
+// Validate validates the JSON data, and returns all the violations.
+func (s *JSONSchema) Validate(data []byte) []SchemaViolation {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []SchemaViolation{{Message: "invalid json: " + err.Error()}}
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue validates the value decoded from JSON by encoding/json,
+// and returns all the violations.
+func (s *JSONSchema) ValidateValue(v interface{}) (violations []SchemaViolation) {
+	s.root.validate(v, "", &violations)
+	return
+}
+
+type schemaNode struct {
+	always *bool // For the boolean schema.
+
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties    map[string]*schemaNode
+	required      []string
+	additional    *schemaNode
+	minProperties int
+	maxProperties int
+
+	items       *schemaNode
+	minItems    int
+	maxItems    int
+	uniqueItems bool
+
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       float64
+
+	allOf []*schemaNode
+	anyOf []*schemaNode
+	oneOf []*schemaNode
+	not   *schemaNode
+	ref   *schemaNode
+}
+
+type schemaCompiler struct {
+	root interface{}
+	refs map[string]*schemaNode
+}
+
+func (c *schemaCompiler) compile(raw interface{}, path string) (*schemaNode, error) {
+	switch v := raw.(type) {
+	case bool:
+		return &schemaNode{always: &v}, nil
+	case map[string]interface{}:
+		return c.compileObject(v, path)
+	default:
+		return nil, fmt.Errorf("%s: the schema must be an object or boolean", path)
+	}
+}
+
+func (c *schemaCompiler) compileObject(m map[string]interface{}, path string) (n *schemaNode, err error) {
+	n = &schemaNode{maxProperties: -1, maxItems: -1, maxLength: -1}
+
+	if ref, ok := m["$ref"]; ok {
+		s, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/$ref: must be a string", path)
+		} else if n.ref, err = c.resolve(s); err != nil {
+			return nil, fmt.Errorf("%s/$ref: %s", path, err)
+		}
+	}
+
+	switch v := m["type"].(type) {
+	case nil:
+	case string:
+		n.types = []string{v}
+	case []interface{}:
+		for _, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/type: must be a string or string array", path)
+			}
+			n.types = append(n.types, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s/type: must be a string or string array", path)
+	}
+	for _, t := range n.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s/type: unknown type '%s'", path, t)
+		}
+	}
+
+	if v, ok := m["enum"]; ok {
+		if n.enum, ok = v.([]interface{}); !ok {
+			return nil, fmt.Errorf("%s/enum: must be an array", path)
+		}
+	}
+	n.constant, n.hasConst = m["const"]
+
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", path)
+		}
+		n.properties = make(map[string]*schemaNode, len(props))
+		for name, prop := range props {
+			p := path + "/properties/" + escapePointer(name)
+			if n.properties[name], err = c.compile(prop, p); err != nil {
+				return
+			}
+		}
+	}
+
+	if v, ok := m["required"]; ok {
+		required, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be a string array", path)
+		}
+		for _, r := range required {
+			s, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be a string array", path)
+			}
+			n.required = append(n.required, s)
+		}
+	}
+
+	if n.additional, err = c.compileOptional(m, "additionalProperties", path); err != nil {
+		return
+	} else if n.items, err = c.compileOptional(m, "items", path); err != nil {
+		return
+	} else if n.not, err = c.compileOptional(m, "not", path); err != nil {
+		return
+	}
+
+	if n.allOf, err = c.compileArray(m, "allOf", path); err != nil {
+		return
+	} else if n.anyOf, err = c.compileArray(m, "anyOf", path); err != nil {
+		return
+	} else if n.oneOf, err = c.compileArray(m, "oneOf", path); err != nil {
+		return
+	}
+
+	ints := []struct {
+		key string
+		dst *int
+	}{
+		{"minProperties", &n.minProperties},
+		{"maxProperties", &n.maxProperties},
+		{"minItems", &n.minItems},
+		{"maxItems", &n.maxItems},
+		{"minLength", &n.minLength},
+		{"maxLength", &n.maxLength},
+	}
+	for _, i := range ints {
+		if v, ok := m[i.key]; ok {
+			f, ok := v.(float64)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return nil, fmt.Errorf("%s/%s: must be a non-negative integer", path, i.key)
+			}
+			*i.dst = int(f)
+		}
+	}
+
+	floats := []struct {
+		key string
+		dst **float64
+	}{
+		{"minimum", &n.minimum},
+		{"maximum", &n.maximum},
+		{"exclusiveMinimum", &n.exclusiveMinimum},
+		{"exclusiveMaximum", &n.exclusiveMaximum},
+	}
+	for _, f := range floats {
+		if v, ok := m[f.key]; ok {
+			number, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: must be a number", path, f.key)
+			}
+			*f.dst = &number
+		}
+	}
+
+	if v, ok := m["multipleOf"]; ok {
+		if n.multipleOf, ok = v.(float64); !ok || n.multipleOf <= 0 {
+			return nil, fmt.Errorf("%s/multipleOf: must be a positive number", path)
+		}
+	}
+
+	if v, ok := m["uniqueItems"]; ok {
+		if n.uniqueItems, ok = v.(bool); !ok {
+			return nil, fmt.Errorf("%s/uniqueItems: must be a boolean", path)
+		}
+	}
+
+	if v, ok := m["pattern"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", path)
+		} else if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %s", path, err)
+		}
+	}
+
+	return n, nil
+}
+
+func (c *schemaCompiler) compileOptional(m map[string]interface{}, key, path string) (*schemaNode, error) {
+	if v, ok := m[key]; ok {
+		return c.compile(v, path+"/"+key)
+	}
+	return nil, nil
+}
+
+func (c *schemaCompiler) compileArray(m map[string]interface{}, key, path string) (nodes []*schemaNode, err error) {
+	v, ok := m[key]
+	if !ok {
+		return
+	}
+
+	values, ok := v.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("%s/%s: must be a non-empty array", path, key)
+	}
+
+	nodes = make([]*schemaNode, len(values))
+	for i, value := range values {
+		if nodes[i], err = c.compile(value, path+"/"+key+"/"+strconv.Itoa(i)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// resolve resolves the local reference, such as "#/definitions/name".
+func (c *schemaCompiler) resolve(ref string) (*schemaNode, error) {
+	if n, ok := c.refs[ref]; ok {
+		return n, nil
+	} else if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only support the local reference, but got '%s'", ref)
+	}
+
+	raw := c.root
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = unescapePointer(token)
+			switch v := raw.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if raw, ok = v[token]; !ok {
+					return nil, fmt.Errorf("unresolved reference '%s'", ref)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(v) {
+					return nil, fmt.Errorf("unresolved reference '%s'", ref)
+				}
+				raw = v[i]
+			default:
+				return nil, fmt.Errorf("unresolved reference '%s'", ref)
+			}
+		}
+	}
+
+	// Register the placeholder in advance to support the recursive reference.
+	n := new(schemaNode)
+	c.refs[ref] = n
+	compiled, err := c.compile(raw, ref)
+	if err != nil {
+		delete(c.refs, ref)
+		return nil, err
+	}
+	*n = *compiled
+	return n, nil
+}
+
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+func unescapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~1", "/", -1), "~0", "~", -1)
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (n *schemaNode) matchType(v interface{}) bool {
+	if len(n.types) == 0 {
+		return true
+	}
+
+	vtype := jsonType(v)
+	for _, t := range n.types {
+		if t == vtype {
+			return true
+		} else if t == "integer" && vtype == "number" {
+			if f := v.(float64); f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n *schemaNode) valid(v interface{}) bool {
+	var violations []SchemaViolation
+	n.validate(v, "", &violations)
+	return len(violations) == 0
+}
+
+func (n *schemaNode) validate(v interface{}, ptr string, vs *[]SchemaViolation) {
+	add := func(format string, args ...interface{}) {
+		*vs = append(*vs, SchemaViolation{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n.always != nil {
+		if !*n.always {
+			add("is not allowed")
+		}
+		return
+	}
+
+	if n.ref != nil {
+		n.ref.validate(v, ptr, vs)
+	}
+
+	if !n.matchType(v) {
+		add("expect type %s, but got %s", strings.Join(n.types, " or "), jsonType(v))
+		return
+	}
+
+	if n.hasConst && !reflect.DeepEqual(v, n.constant) {
+		add("must be equal to the constant %v", n.constant)
+	}
+
+	if len(n.enum) > 0 {
+		var found bool
+		for _, e := range n.enum {
+			if reflect.DeepEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %v", n.enum)
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		n.validateObject(value, ptr, vs, add)
+	case []interface{}:
+		n.validateArray(value, ptr, vs, add)
+	case string:
+		if length := utf8.RuneCountInString(value); length < n.minLength {
+			add("the length must be at least %d", n.minLength)
+		} else if n.maxLength >= 0 && length > n.maxLength {
+			add("the length must be at most %d", n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(value) {
+			add("must match the pattern '%s'", n.pattern.String())
+		}
+	case float64:
+		if n.minimum != nil && value < *n.minimum {
+			add("must be >= %v", *n.minimum)
+		}
+		if n.maximum != nil && value > *n.maximum {
+			add("must be <= %v", *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && value <= *n.exclusiveMinimum {
+			add("must be > %v", *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && value >= *n.exclusiveMaximum {
+			add("must be < %v", *n.exclusiveMaximum)
+		}
+		if n.multipleOf > 0 {
+			if q := value / n.multipleOf; math.Abs(q-math.Floor(q+0.5)) > 1e-9 {
+				add("must be a multiple of %v", n.multipleOf)
+			}
+		}
+	}
+
+	for _, s := range n.allOf {
+		s.validate(v, ptr, vs)
+	}
+
+	if len(n.anyOf) > 0 {
+		var ok bool
+		for _, s := range n.anyOf {
+			if ok = s.valid(v); ok {
+				break
+			}
+		}
+		if !ok {
+			add("must match at least one schema of anyOf")
+		}
+	}
+
+	if len(n.oneOf) > 0 {
+		var count int
+		for _, s := range n.oneOf {
+			if s.valid(v) {
+				count++
+			}
+		}
+		if count != 1 {
+			add("must match exactly one schema of oneOf, but matched %d", count)
+		}
+	}
+
+	if n.not != nil && n.not.valid(v) {
+		add("must not match the schema of not")
+	}
+}
+
+func (n *schemaNode) validateObject(value map[string]interface{}, ptr string,
+	vs *[]SchemaViolation, add func(string, ...interface{})) {
+	for _, name := range n.required {
+		if _, ok := value[name]; !ok {
+			*vs = append(*vs, SchemaViolation{
+				Pointer: ptr + "/" + escapePointer(name),
+				Message: "is required",
+			})
+		}
+	}
+
+	if len(value) < n.minProperties {
+		add("must have at least %d properties", n.minProperties)
+	} else if n.maxProperties >= 0 && len(value) > n.maxProperties {
+		add("must have at most %d properties", n.maxProperties)
+	}
+
+	// Sort the names to make the violations stable.
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := ptr + "/" + escapePointer(name)
+		if s, ok := n.properties[name]; ok {
+			s.validate(value[name], p, vs)
+		} else if n.additional != nil {
+			if n.additional.always != nil && !*n.additional.always {
+				*vs = append(*vs, SchemaViolation{Pointer: p, Message: "is not allowed"})
+			} else {
+				n.additional.validate(value[name], p, vs)
+			}
+		}
+	}
+}
+
+func (n *schemaNode) validateArray(value []interface{}, ptr string,
+	vs *[]SchemaViolation, add func(string, ...interface{})) {
+	if len(value) < n.minItems {
+		add("must have at least %d items", n.minItems)
+	} else if n.maxItems >= 0 && len(value) > n.maxItems {
+		add("must have at most %d items", n.maxItems)
+	}
+
+	if n.uniqueItems {
+	loop:
+		for i := 1; i < len(value); i++ {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					add("the items must be unique, but %d and %d are equal", j, i)
+					break loop
+				}
+			}
+		}
+	}
+
+	if n.items != nil {
+		for i, item := range value {
+			n.items.validate(item, ptr+"/"+strconv.Itoa(i), vs)
+		}
+	}
+}
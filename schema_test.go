@@ -0,0 +1,147 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testUserSchema = `{
+	"type": "object",
+	"required": ["Name", "Age"],
+	"additionalProperties": false,
+	"properties": {
+		"Name": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[a-z]+$"},
+		"Age":  {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"Role": {"enum": ["admin", "user"]},
+		"Tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2, "uniqueItems": true},
+		"Friend": {"$ref": "#/definitions/friend"}
+	},
+	"definitions": {
+		"friend": {
+			"type": "object",
+			"properties": {"Name": {"type": "string"}, "Friend": {"$ref": "#/definitions/friend"}},
+			"required": ["Name"]
+		}
+	}
+}`
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := CompileJSONSchema([]byte(testUserSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		data   string
+		expect []string
+	}{
+		{`{"Name":"abc","Age":18,"Role":"admin","Tags":["a","b"],"Friend":{"Name":"x","Friend":{"Name":"y"}}}`, nil},
+		{`{"Age":1.5}`, []string{"/Name: is required", "/Age: expect type integer, but got number"}},
+		{`{"Name":"ABC","Age":150,"Extra":1}`, []string{"/Age: must be < 150", "/Extra: is not allowed",
+			"/Name: must match the pattern '^[a-z]+$'"}},
+		{`{"Name":"a","Age":1,"Role":"root","Tags":["a","a","b"]}`, []string{"/Role: must be one of [admin user]",
+			"/Tags: must have at most 2 items", "/Tags: the items must be unique, but 0 and 1 are equal"}},
+		{`{"Name":"a","Age":1,"Friend":{"Friend":{}}}`, []string{"/Friend/Name: is required",
+			"/Friend/Friend/Name: is required"}},
+		{`[]`, []string{"/: expect type object, but got array"}},
+	}
+
+	for i, test := range tests {
+		violations := schema.Validate([]byte(test.data))
+		msgs := make([]string, len(violations))
+		for j, v := range violations {
+			msgs[j] = v.String()
+		}
+		if strings.Join(msgs, "\n") != strings.Join(test.expect, "\n") {
+			t.Errorf("%d: expect violations %q, but got %q", i, test.expect, msgs)
+		}
+	}
+
+	combine, err := CompileJSONSchema([]byte(`{
+		"anyOf": [{"type": "string"}, {"type": "number", "multipleOf": 0.5}],
+		"not": {"const": "x"},
+		"oneOf": [{"type": "string"}, {"type": "number", "minimum": 0}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for data, valid := range map[string]bool{`"a"`: true, `1.5`: true, `1.2`: false,
+		`"x"`: false, `-1`: false, `true`: false} {
+		if ok := len(combine.Validate([]byte(data))) == 0; ok != valid {
+			t.Errorf("%s: expect valid '%v', but got '%v'", data, valid, ok)
+		}
+	}
+
+	for _, invalid := range []string{`1`, `{"type":"int"}`, `{"$ref":"#/none"}`,
+		`{"$ref":"http://example.com/schema"}`, `{"pattern":"["}`, `{"minLength":-1}`, `{"anyOf":[]}`} {
+		if _, err := CompileJSONSchema([]byte(invalid)); err == nil {
+			t.Errorf("%s: expect a compilation error", invalid)
+		}
+	}
+}
+
+func TestWithRequestSchema(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expect a panic for the invalid schema")
+			}
+		}()
+		WithRequestSchema([]byte(`{"type":1}`))
+	}()
+
+	svc := NewService()
+	svc.RegisterWithOptions("svc", func(c *Context) (err error) {
+		var req struct{ Name string }
+		if err = c.Bind(&req); err == nil {
+			err = c.Success(req.Name)
+		}
+		return
+	}, WithRequestSchema([]byte(testUserSchema)))
+
+	call := func(body string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action=svc", strings.NewReader(body))
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call(`{"Name":"abc","Age":1}`); resp.Data != "abc" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	resp := call("")
+	if expect := "/Name: is required; /Age: is required"; resp.Error.Code != ErrInvalidParameter.Code ||
+		resp.Error.Message != expect {
+		t.Errorf("expect error message '%s', but got '%s'", expect, resp.Error.Message)
+	}
+	if details := resp.Error.Details; len(details) != 2 ||
+		details[0] != (ErrorDetail{Field: "/Name", Reason: "is required"}) {
+		t.Errorf("unexpected the error details: %+v", details)
+	}
+
+	svc.DisableSchemaValidation = true
+	if resp := call(`{"Name":"ABC"}`); resp.Data != "ABC" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ServeOption is used to configure the http server of the service.
+type ServeOption func(*serveConfig)
+
+// WithServerTimeouts returns a serve option to set the read, write and idle
+// timeouts of the http server, and 0 means no timeout.
+//
+// Default: 60s, 0, 120s, and the read header timeout is 10s.
+func WithServerTimeouts(read, write, idle time.Duration) ServeOption {
+	return func(c *serveConfig) { c.read, c.write, c.idle = read, write, idle }
+}
+
+// WithSocketMode returns a serve option to set the file mode
+// of the unix socket.
+//
+// Default: 0660
+func WithSocketMode(mode os.FileMode) ServeOption {
+	return func(c *serveConfig) { c.mode = mode }
+}
+
+// WithTLS returns a serve option to serve HTTPS with the certificate
+// and key files.
+func WithTLS(certFile, keyFile string) ServeOption {
+	return func(c *serveConfig) { c.certFile, c.keyFile = certFile, keyFile }
+}
+
+// WithTLSConfig returns a serve option to serve HTTPS with the tls config,
+// which should contain the certificates, or be used with WithTLS.
+func WithTLSConfig(config *tls.Config) ServeOption {
+	return func(c *serveConfig) { c.tlsConfig = config }
+}
+
+// WithSignalShutdown returns a serve option to shut down the service and
+// the http server gracefully in the grace period when receiving the signal
+// SIGTERM or SIGINT, that's, the new requests are refused and the in-flight
+// requests are drained by Service.Shutdown.
+func WithSignalShutdown(grace time.Duration) ServeOption {
+	return func(c *serveConfig) { c.signal, c.grace = true, grace }
+}
+
+// WithH2C returns a serve option to serve HTTP/2 in cleartext, that's, h2c,
+// besides HTTP/1.1, which is ignored when serving HTTPS.
+//
+// If wrap is given, it is used to wrap the handler of the http server,
+// such as the one based on golang.org/x/net/http2/h2c. Or, the support
+// of the standard library is used, which requires Go 1.24.
+func WithH2C(wrap ...func(http.Handler) http.Handler) ServeOption {
+	return func(c *serveConfig) {
+		c.h2c = true
+		if len(wrap) > 0 {
+			c.h2cWrap = wrap[0]
+		}
+	}
+}
+
+type serveConfig struct {
+	read, write, idle time.Duration
+	mode              os.FileMode
+
+	certFile  string
+	keyFile   string
+	tlsConfig *tls.Config
+
+	signal bool
+	grace  time.Duration
+
+	h2c     bool
+	h2cWrap func(http.Handler) http.Handler
+}
+
+func (c *serveConfig) isTLS() bool { return c.certFile != "" || c.tlsConfig != nil }
+
+func newServeConfig(opts []ServeOption) *serveConfig {
+	c := &serveConfig{read: time.Minute, idle: 2 * time.Minute, mode: 0660}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListenAndServe listens on addr and serves the service by Serve.
+//
+// addr may be a TCP address, such as ":80", or a unix socket address,
+// such as "unix:///path/to.sock", whose stale file is removed.
+func (s *Service) ListenAndServe(addr string, opts ...ServeOption) error {
+	conf := newServeConfig(opts)
+	ln, err := listen(addr, conf.mode)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln, conf)
+}
+
+// Serve serves the service on the listener by a http server, which returns
+// nil after the graceful shutdown by the option WithSignalShutdown.
+func (s *Service) Serve(ln net.Listener, opts ...ServeOption) error {
+	return s.serve(ln, newServeConfig(opts))
+}
+
+func (s *Service) serve(ln net.Listener, conf *serveConfig) (err error) {
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       conf.read,
+		WriteTimeout:      conf.write,
+		IdleTimeout:       conf.idle,
+		TLSConfig:         conf.tlsConfig,
+	}
+
+	if conf.h2c && !conf.isTLS() {
+		if conf.h2cWrap != nil {
+			server.Handler = conf.h2cWrap(server.Handler)
+		} else if err = enableH2C(server); err != nil {
+			ln.Close()
+			return
+		}
+	}
+
+	var shutdown chan error
+	if conf.signal {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		defer signal.Stop(signals)
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		shutdown = make(chan error, 1)
+		go func() {
+			select {
+			case <-stop:
+				shutdown <- nil
+			case <-signals:
+				ctx, cancel := context.WithTimeout(context.Background(), conf.grace)
+				defer cancel()
+
+				err := s.Shutdown(ctx)
+				if serr := server.Shutdown(ctx); err == nil {
+					err = serr
+				}
+				shutdown <- err
+			}
+		}()
+	}
+
+	if conf.isTLS() {
+		err = server.ServeTLS(ln, conf.certFile, conf.keyFile)
+	} else {
+		err = server.Serve(ln)
+	}
+
+	if err == http.ErrServerClosed && shutdown != nil {
+		err = <-shutdown
+	} else if err == http.ErrServerClosed {
+		err = nil
+	}
+	return
+}
+
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	const prefix = "unix://"
+	if !strings.HasPrefix(addr, prefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := addr[len(prefix):]
+	if path == "" {
+		return nil, errors.New("missing the path of the unix socket")
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("the unix socket '" + path + "' is in use")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
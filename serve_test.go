@@ -0,0 +1,100 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newServeTestService() *Service {
+	svc := NewService()
+	svc.Register("Ping", func(c *Context) error { return c.Success("pong") })
+	return svc
+}
+
+func waitServing(t *testing.T, client *Client) {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp string
+		if err = client.Invoke(context.Background(), "Ping", "", nil, &resp); err == nil {
+			if resp != "pong" {
+				t.Fatalf("expect '%s', but got '%s'", "pong", resp)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(err)
+}
+
+func TestServiceServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go newServeTestService().Serve(ln, WithServerTimeouts(time.Second, time.Second, time.Second))
+	waitServing(t, NewClient("http://"+ln.Addr().String()))
+}
+
+func TestServiceServeTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.StartTLS()
+	config, client := ts.TLS, ts.Client()
+	ts.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go newServeTestService().Serve(ln, WithTLSConfig(config))
+	waitServing(t, NewClient("https://"+ln.Addr().String(), ClientHTTPClient(client)))
+}
+
+func TestServiceServeH2CWrap(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	wrap := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-H2c", "wrapped")
+			h.ServeHTTP(w, r)
+		})
+	}
+	go newServeTestService().Serve(ln, WithH2C(wrap))
+
+	baseURL := "http://" + ln.Addr().String()
+	waitServing(t, NewClient(baseURL))
+
+	resp, err := http.Get(baseURL + "/?Action=Ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if v := resp.Header.Get("X-H2c"); v != "wrapped" {
+		t.Errorf("expect the wrapped handler, but got '%s'", v)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package httpsvc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServiceListenAndServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Leave a stale socket file.
+	path := filepath.Join(dir, "svc.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	svc := newServeTestService()
+	svc.Register("Slow", func(c *Context) error {
+		time.Sleep(100 * time.Millisecond)
+		return c.Success("done")
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.ListenAndServe("unix://"+path, WithSocketMode(0600),
+			WithSignalShutdown(time.Second))
+	}()
+
+	client := NewClient("http://unix/", ClientHTTPClient(&http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}))
+	waitServing(t, client)
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("expect the socket mode %o, but got %o", 0600, mode)
+	}
+
+	if err := svc.ListenAndServe("unix://" + path); err == nil {
+		t.Error("expect the error of the socket in use")
+	}
+
+	slow := make(chan error, 1)
+	go func() {
+		var resp string
+		slow <- client.Invoke(context.Background(), "Slow", "", nil, &resp)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected the error after the graceful shutdown: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the service is not shut down")
+	}
+
+	if err := <-slow; err != nil {
+		t.Errorf("the in-flight request is not drained: %v", err)
+	}
+}
@@ -16,9 +16,16 @@
 package httpsvc
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Handler is the handler of the service.
@@ -27,49 +34,486 @@ type Handler func(*Context) error
 // Middleware is the handler middleware.
 type Middleware func(Handler) Handler
 
+// maxMappingDepth is the maximum length of the mapping chain.
+const maxMappingDepth = 8
+
+// ActionOption is used to configure the service when registering it.
+type ActionOption func(*action)
+
+// WithMiddlewares returns an action option to append the middlewares
+// that only act on the registered service.
+func WithMiddlewares(mws ...Middleware) ActionOption {
+	return func(a *action) { a.mws = append(a.mws, mws...) }
+}
+
+// WithDescription returns an action option to set the description
+// of the registered service.
+func WithDescription(desc string) ActionOption {
+	return func(a *action) { a.description = desc }
+}
+
+type action struct {
+	slow uint64 // The number of the slow calls, which must be 64-bit aligned.
+
+	name    string       // The original name when registering.
+	version string       // The version by RegisterVersion, which may be empty.
+	handler Handler      // The original handler not wrapped by any middleware.
+	mws     []Middleware // The middlewares passed when registering.
+	extra   []Middleware // The middlewares appended by UseFor.
+	vmws    []Middleware // The middlewares of the version by UseForVersion.
+	dryRun  Handler      // The handler of the dry-run request.
+	headers map[string]string
+	maxReq  int64        // The maximum size of the request body.
+	maxResp int64        // The maximum size of the response body.
+	wrapped atomic.Value // Handler, wrapped by mws, extra and vmws.
+
+	timeout     time.Duration
+	description string
+	tags        []string
+	reqType     reflect.Type
+	respType    reflect.Type
+	auth        authMode
+	deprecation *deprecation
+	stats       *actionStats
+	tenantReq   bool
+	reqSchema   *JSONSchema
+	respSchema  *JSONSchema
+	disabled    atomic.Value // *DisabledInfo
+}
+
+func newAction(name string, handler Handler, opts []ActionOption) *action {
+	a := &action{name: name, handler: handler, stats: newActionStats()}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.wrap()
+	return a
+}
+
+// wrap rebuilds the wrapped handler from the original, so the result is
+// always the same however many times it is called.
+func (a *action) wrap() {
+	handler := a.handler
+	if dryRun := a.dryRun; dryRun != nil {
+		handler = func(c *Context) error {
+			if c.DryRun {
+				return dryRun(c)
+			}
+			return a.handler(c)
+		}
+	}
+	a.wrapped.Store(wrapHandler(wrapHandler(wrapHandler(handler, a.mws), a.extra), a.vmws))
+}
+
+func wrapHandler(handler Handler, mws []Middleware) Handler {
+	for _len := len(mws) - 1; _len >= 0; _len-- {
+		handler = mws[_len](handler)
+	}
+	return handler
+}
+
 // Service is used to manager the services.
 type Service struct {
+	// The 64-bit atomic fields must be first to be 64-bit aligned
+	// on the 32-bit platforms.
+	inflight int64
+	bufstats BufferStats
+
 	// NewContext is used to create the context.
 	//
 	// Default: NewContext
 	NewContext func() *Context
 
-	// GetAction is used to acquire the name of the service.
+	// GetAction is used to acquire the name of the service,
+	// which takes precedence over ActionExtractors.
 	//
-	// Default: r.Header.Get("X-Action") or r.URL.Query().Get("Action")
+	// Default: nil
 	GetAction func(r *http.Request) (action string)
 
-	// GetVersion is used to acquire the version of the requested service api.
+	// GetVersion is used to acquire the version of the requested service api,
+	// which takes precedence over VersionExtractors.
 	//
-	// Default: r.Header.Get("X-Version")
+	// Default: nil
 	GetVersion func(r *http.Request) (version string)
 
-	// GetRequestID is used to acquire the id of the request.
+	// GetRequestID is used to acquire the id of the request,
+	// which takes precedence over RequestIDExtractors.
 	//
-	// Default: r.Header.Get("X-Request-Id")
+	// Default: nil
 	GetRequestID func(r *http.Request) (requestID string)
 
-	mws     []Middleware
-	handler Handler
-	ctxpool sync.Pool
-	bufpool sync.Pool
+	// GetTenant is used to acquire the tenant of the request.
+	//
+	// Default: r.Header.Get("X-Tenant-Id")
+	GetTenant func(r *http.Request) (tenant string)
+
+	// ActionExtractors, VersionExtractors and RequestIDExtractors are used
+	// to extract the action, version and request id from the request,
+	// which are evaluated in turn until one returns a non-empty value
+	// or an error, which is responded.
+	//
+	// Default:
+	//   ActionExtractors:    FromHeader("X-Action"), FromQuery("Action")
+	//   VersionExtractors:   FromHeader("X-Version")
+	//   RequestIDExtractors: FromHeader("X-Request-Id")
+	ActionExtractors    []Extractor
+	VersionExtractors   []Extractor
+	RequestIDExtractors []Extractor
+
+	// ActionBodyField is the name of the top-level field of the JSON request
+	// body, from which the action is extracted by FromJSONBodyField when
+	// the default ActionExtractors yield no action.
+	//
+	// It is only used when both GetAction and ActionExtractors are nil.
+	//
+	// Default: ""
+	ActionBodyField string
+
+	// GenerateRequestID is used to generate a new request id
+	// when no request id is acquired from the request.
+	//
+	// Default: a random hex string with 32 characters
+	GenerateRequestID func() (requestID string)
+
+	// RequestIDResponseHeader is the name of the response header,
+	// into which the request id is echoed back to the client.
+	//
+	// Default: "", which does not echo the request id.
+	RequestIDResponseHeader string
+
+	// StaticResponseHeaders is the headers added to every response,
+	// such as "X-Service-Name", unless they have been set by the handler,
+	// which may be overridden by the action option WithResponseHeaders.
+	//
+	// EchoRequestHeaders is the names of the request headers echoed back
+	// in the response, such as "X-Correlation-Id".
+	//
+	// Notice: they should be set before serving.
+	//
+	// Default: nil
+	StaticResponseHeaders map[string]string
+	EchoRequestHeaders    []string
+
+	// NormalizeAction is used to normalize the name of the service
+	// when registering, mapping, unregistering and looking up it,
+	// so that the different names, such as "createuser" and "CreateUser",
+	// can match the same service.
+	//
+	// Notice: it should be set before registering any service.
+	//
+	// Default: nil, but NormalizeActionLower if CaseInsensitiveAction is true.
+	NormalizeAction func(name string) string
+
+	// CaseInsensitiveAction indicates whether to match the name
+	// of the service case-insensitively, which is only used
+	// when NormalizeAction is nil.
+	//
+	// Notice: it should be set before registering any service.
+	CaseInsensitiveAction bool
+
+	// ActionNameValidator is used to validate the name of the service
+	// when registering and mapping it, and the invalid name panics.
+	//
+	// Default: nil, which uses ValidateActionName.
+	ActionNameValidator func(name string) error
 
-	lock     sync.RWMutex
-	handlers map[string]Handler
+	// GetDryRun is used to decide whether the request is a dry run,
+	// which is set into Context.DryRun.
+	//
+	// Default: nil, which uses DefaultGetDryRun.
+	GetDryRun func(r *http.Request) bool
+
+	// Authenticate is used to authenticate the request after resolving
+	// the action and before calling the handler, and the returned principal
+	// is stored into the context, which can be acquired by c.Principal().
+	//
+	// By default, or for the service registered with WithAuthRequired,
+	// the request is aborted if it returns an error, or ErrUnauthorized
+	// if the principal is nil. For the service registered with
+	// WithAuthOptional, the error is ignored and the principal may be nil.
+	//
+	// Default: nil
+	Authenticate func(c *Context) (principal interface{}, err error)
+
+	// OnDeprecatedCall is called when calling the deprecated service
+	// registered with Deprecated, which may be used to log it.
+	//
+	// Default: nil
+	OnDeprecatedCall func(c *Context, message string)
+
+	// DisableSchemaValidation is used to disable the validation
+	// of the request by the JSON Schema registered by WithRequestSchema,
+	// such as in production for performance.
+	DisableSchemaValidation bool
+
+	// ValidateResponses is used to validate the successful response data
+	// against the type registered by WithResponseType or the schema
+	// registered by WithResponseSchema, which is designed for development.
+	//
+	// The mismatches are passed to OnInvalidResponse, or logged by default.
+	// If StrictResponseValidation is true, the response is turned into
+	// the error ErrServerError with the status code 500 instead.
+	ValidateResponses        bool
+	StrictResponseValidation bool
+	OnInvalidResponse        func(c *Context, mismatches []string)
+
+	// ErrorHandler is used to handle the error returned by the handler
+	// when nothing has been responded, and the error passed to Respond,
+	// such as logging it, setting the headers or translating it,
+	// which should respond the error by c.Failure or DefaultErrorHandler.
+	//
+	// If the status code has been written, the headers cannot be changed,
+	// which may be checked by c.ResponseHeaderWritten.
+	//
+	// Default: nil, that's, DefaultErrorHandler.
+	ErrorHandler func(c *Context, err error)
+
+	// Observer is used to observe the result of each request
+	// at the end of ServeHTTP.
+	//
+	// Default: nil
+	Observer Observer
+
+	// Audit is called in a new goroutine with the audit record of each
+	// request, which is filled by the Audit middleware.
+	//
+	// Default: nil
+	Audit func(rec AuditRecord)
+
+	// AsyncExecutor is used to execute the jobs of the asynchronous
+	// services registered by RegisterAsync.
+	//
+	// Default: nil, which is created when calling RegisterAsync first.
+	AsyncExecutor *AsyncExecutor
+
+	// EventQueueSize and EventWorkers are the size of the queue and
+	// the number of the goroutines to dispatch the action events
+	// registered by OnActionSuccess and OnActionFailure, which must be
+	// set before registering the first event hook.
+	//
+	// Default: 1024 and 1
+	EventQueueSize int
+	EventWorkers   int
+
+	// EventOverflow is the policy when the event queue is full.
+	//
+	// Default: EventDrop
+	EventOverflow EventOverflowPolicy
+
+	// OnEventDropped is called when the action event is dropped.
+	//
+	// Default: nil
+	OnEventDropped func(ev ActionEvent)
+
+	// EventDrainTimeout is the maximum duration that Shutdown waits for
+	// the queued action events to be dispatched after all the in-flight
+	// requests finish. The events still left in the queue are dropped.
+	//
+	// Default: 0, which is 5s.
+	EventDrainTimeout time.Duration
+
+	// PanicHandler is called when recovering a panic, such as in the callback
+	// registered by Context.BeforeWriteHeader, the hooks and the event hooks.
+	// For the event hooks, c has no request and response since the request
+	// has been finished.
+	//
+	// Default: log the panic and stack by the standard logger.
+	PanicHandler func(c *Context, panicValue interface{})
+
+	// OnSuperfluousWrite is called with the stack when WriteHeader is called
+	// again with a different status code after the response header is written,
+	// which is ignored and is usually a bug.
+	//
+	// Default: nil
+	OnSuperfluousWrite func(c *Context, attemptedStatus int, stack []byte)
+
+	// SnapshotSentHeaders indicates whether to snapshot the response headers
+	// of every request when written, which is returned by Context.SentHeaders
+	// for the hooks, such as OnResponse and the auditing.
+	//
+	// Default: false
+	SnapshotSentHeaders bool
+
+	// OnSuperfluousError is called with the error returned by the handler
+	// or passed to Context.Respond after the response has been sent,
+	// which cannot be responded any more.
+	//
+	// Default: log the error by the standard logger.
+	OnSuperfluousError func(c *Context, err error)
+
+	// PropagateHeaders is the names of the headers propagated to the upstream
+	// calls made on behalf of the request, which is used by OutgoingHeaders.
+	//
+	// Default: nil, which uses DefaultPropagateHeaders
+	PropagateHeaders []string
+
+	// MaintenanceAllowList is the names of the services allowed to be called
+	// in the maintenance mode set by SetMaintenance, such as "Health".
+	//
+	// Default: nil
+	MaintenanceAllowList []string
+
+	// LameDuckDelay is the delay in the lame-duck mode by Shutdown before
+	// refusing the new requests, during which the service is not ready.
+	//
+	// Default: 0
+	LameDuckDelay time.Duration
+
+	// PropagateDeadline is used to derive the deadline of the request
+	// from the remaining budget of the caller in milliseconds carried by
+	// the request header DeadlineHeader, which is clamped to
+	// MaxPropagatedTimeout if greater than 0. If the deadline passes,
+	// ErrGatewayTimeout is responded like the Timeout middleware.
+	//
+	// Default: false, DefaultDeadlineHeader, 0
+	PropagateDeadline    bool
+	DeadlineHeader       string
+	MaxPropagatedTimeout time.Duration
+
+	// DebugErrors is used to render the message of the cause of the error
+	// set by Error.WithCause as the field "Debug" of the error, which may
+	// leak the internal details and is designed for development.
+	//
+	// Default: false
+	DebugErrors bool
+
+	// RenderRetriable is used to render the field "Retriable" of the error,
+	// which changes the wire format of the error and is disabled by default.
+	//
+	// Default: false
+	RenderRetriable bool
+
+	// GRPCCodeHeader is used to set the response header "X-Grpc-Code"
+	// to the gRPC status code of the response by GRPCCode, such as
+	// for the gateway converting the responses into gRPC.
+	//
+	// Default: false
+	GRPCCodeHeader bool
+
+	// ErrorRegistry is the registry of the error codes of the service,
+	// which takes precedence over DefaultErrorRegistry to look up
+	// the status code and the default message of the responded error.
+	//
+	// Default: nil
+	ErrorRegistry *ErrorRegistry
+
+	// MapErrorStatus is used to respond the error with its status code,
+	// such as 404 for ErrInvalidAction, instead of 200, unless the status
+	// code has been written.
+	//
+	// If the error has no status code, it is looked up from ErrorRegistry
+	// and DefaultErrorRegistry by the error code.
+	//
+	// Default: false
+	MapErrorStatus bool
+
+	// If LazyVersion or LazyRequestID is true, the version or the request id
+	// is not extracted before handling the request, but on the first call
+	// of c.GetVersion or c.GetRequestID, which saves the work if they are
+	// never used. In this case, the extraction error is ignored,
+	// and the fields c.Version and c.RequestID are empty until computed.
+	//
+	// LazyRequestID is ignored if RequestIDResponseHeader is set.
+	//
+	// Default: false
+	LazyVersion   bool
+	LazyRequestID bool
+
+	// RequireVersion is used to reject the request without the version
+	// by ErrInvalidVersion if the requested service has been registered
+	// with the versions by RegisterVersion but no default version.
+	//
+	// Default: false, which falls back to the service without the version.
+	RequireVersion bool
+
+	// RequireIfMatch is used to reject the request without the header
+	// "If-Match" by ErrPreconditionFailed in c.RequireIfMatch.
+	//
+	// Default: false
+	RequireIfMatch bool
+
+	// BufferInitialSize is the initial capacity of the buffer allocated
+	// by the buffer pool, such as for c.JSON.
+	//
+	// Default: 2048
+	BufferInitialSize int
+
+	// BufferMaxRecycleSize is the maximum capacity of the buffer returned
+	// into the pool. The larger one is discarded so that a huge response
+	// does not pin the memory permanently.
+	//
+	// Default: 0, which means no limit.
+	BufferMaxRecycleSize int
+
+	closed        int32
+	state         int32        // ServiceState
+	actionHeaders int32        // Whether any service has WithResponseHeaders.
+	maintenance   atomic.Value // *maintenance
+
+	reqHooks  atomic.Value // []func(*Context) error
+	respHooks atomic.Value // []func(*Context, error)
+	errmsgs   atomic.Value // *errorCatalog
+	events    atomic.Value // *eventRegistry
+
+	mws      []Middleware
+	handler  atomic.Value // Handler
+	tenants  atomic.Value // map[string]Handler
+	tmws     map[string][]Middleware
+	vmws     map[string][]Middleware
+	ctxpool  sync.Pool
+	bufpool  sync.Pool
+	copypool sync.Pool // *[]byte
+
+	// registry is replaced as a whole on changing with lock held,
+	// so the lookup in the request path needs no lock.
+	registry atomic.Value // *registry
+
+	lock    sync.RWMutex
+	mounts  []mount
+	warmups []func(context.Context) error
+}
+
+// registry is the immutable snapshot of the services and the mappings
+// of the names, keyed by the normalized names.
+type registry struct {
+	handlers map[string]*action
 	mappings map[string]string
+	versions map[string]*versionSet
+}
+
+// copy returns a copy of the registry, which may be modified.
+func (r *registry) copy() *registry {
+	nr := &registry{
+		handlers: make(map[string]*action, len(r.handlers)+1),
+		mappings: make(map[string]string, len(r.mappings)+1),
+		versions: make(map[string]*versionSet, len(r.versions)),
+	}
+	for k, v := range r.handlers {
+		nr.handlers[k] = v
+	}
+	for k, v := range r.mappings {
+		nr.mappings[k] = v
+	}
+	for k, v := range r.versions {
+		nr.versions[k] = v
+	}
+	return nr
 }
 
+func (s *Service) loadRegistry() *registry { return s.registry.Load().(*registry) }
+
 // NewService returns a new Service.
 func NewService() *Service {
-	s := &Service{
-		handlers: make(map[string]Handler),
+	s := &Service{}
+	s.registry.Store(&registry{
+		handlers: make(map[string]*action),
 		mappings: make(map[string]string),
-	}
+		versions: make(map[string]*versionSet),
+	})
 
-	s.handler = s.handleRequest
-	s.bufpool.New = func() interface{} {
-		return bytes.NewBuffer(make([]byte, 0, 2048))
-	}
+	s.handler.Store(Handler(s.serveTenant))
+	s.bufpool.New = s.newBuffer
+	s.copypool.New = s.newCopyBuffer
 	s.ctxpool.New = func() interface{} {
 		var ctx *Context
 		if s.NewContext != nil {
@@ -78,16 +522,192 @@ func NewService() *Service {
 			ctx = NewContext()
 		}
 		ctx.svc = s
+		ctx.res.copybufs = &s.copypool
 		return ctx
 	}
 
 	return s
 }
 
+// Clone returns a new service, which copies the configurations, the hooks,
+// and the snapshot of the registered services, the mappings, the mounts
+// and the middlewares, but has the independent pools and statistics.
+//
+// The clone is isolated from the original, that's, the middlewares, hooks,
+// services, mappings and mounts added to one after cloning do not affect
+// the other. But the mounted sub-services and AsyncExecutor are shared.
+func (s *Service) Clone() *Service {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ns := NewService()
+	ns.NewContext = s.NewContext
+	ns.GetAction = s.GetAction
+	ns.GetVersion = s.GetVersion
+	ns.GetRequestID = s.GetRequestID
+	ns.GetTenant = s.GetTenant
+	ns.ActionExtractors = append([]Extractor(nil), s.ActionExtractors...)
+	ns.VersionExtractors = append([]Extractor(nil), s.VersionExtractors...)
+	ns.RequestIDExtractors = append([]Extractor(nil), s.RequestIDExtractors...)
+	ns.ActionBodyField = s.ActionBodyField
+	ns.GenerateRequestID = s.GenerateRequestID
+	ns.RequestIDResponseHeader = s.RequestIDResponseHeader
+	ns.EchoRequestHeaders = append([]string(nil), s.EchoRequestHeaders...)
+	if s.StaticResponseHeaders != nil {
+		ns.StaticResponseHeaders = make(map[string]string, len(s.StaticResponseHeaders))
+		for k, v := range s.StaticResponseHeaders {
+			ns.StaticResponseHeaders[k] = v
+		}
+	}
+	ns.NormalizeAction = s.NormalizeAction
+	ns.CaseInsensitiveAction = s.CaseInsensitiveAction
+	ns.ActionNameValidator = s.ActionNameValidator
+	ns.GetDryRun = s.GetDryRun
+	ns.DisableSchemaValidation = s.DisableSchemaValidation
+	ns.ValidateResponses = s.ValidateResponses
+	ns.StrictResponseValidation = s.StrictResponseValidation
+	ns.OnInvalidResponse = s.OnInvalidResponse
+	ns.Authenticate = s.Authenticate
+	ns.OnDeprecatedCall = s.OnDeprecatedCall
+	ns.Observer = s.Observer
+	ns.Audit = s.Audit
+	ns.AsyncExecutor = s.AsyncExecutor
+	ns.EventQueueSize = s.EventQueueSize
+	ns.EventWorkers = s.EventWorkers
+	ns.EventOverflow = s.EventOverflow
+	ns.OnEventDropped = s.OnEventDropped
+	ns.EventDrainTimeout = s.EventDrainTimeout
+	ns.PanicHandler = s.PanicHandler
+	ns.ErrorHandler = s.ErrorHandler
+	ns.OnSuperfluousWrite = s.OnSuperfluousWrite
+	ns.OnSuperfluousError = s.OnSuperfluousError
+	ns.SnapshotSentHeaders = s.SnapshotSentHeaders
+	ns.BufferInitialSize = s.BufferInitialSize
+	ns.BufferMaxRecycleSize = s.BufferMaxRecycleSize
+	ns.LazyVersion = s.LazyVersion
+	ns.RequireVersion = s.RequireVersion
+	ns.RequireIfMatch = s.RequireIfMatch
+	ns.MapErrorStatus = s.MapErrorStatus
+	ns.DebugErrors = s.DebugErrors
+	ns.ErrorRegistry = s.ErrorRegistry
+	ns.GRPCCodeHeader = s.GRPCCodeHeader
+	ns.RenderRetriable = s.RenderRetriable
+	ns.LazyRequestID = s.LazyRequestID
+	ns.MaintenanceAllowList = append([]string(nil), s.MaintenanceAllowList...)
+	ns.LameDuckDelay = s.LameDuckDelay
+	ns.PropagateDeadline = s.PropagateDeadline
+	ns.DeadlineHeader = s.DeadlineHeader
+	ns.MaxPropagatedTimeout = s.MaxPropagatedTimeout
+	ns.warmups = append([]func(context.Context) error(nil), s.warmups...)
+	if len(ns.warmups) > 0 {
+		ns.state = int32(StateStarting)
+	}
+	if s.PropagateHeaders != nil {
+		ns.PropagateHeaders = append([]string{}, s.PropagateHeaders...)
+	}
+
+	// The hook lists are copy-on-write, so they can be shared.
+	if hooks, ok := s.reqHooks.Load().([]func(*Context) error); ok {
+		ns.reqHooks.Store(hooks)
+	}
+	if hooks, ok := s.respHooks.Load().([]func(*Context, error)); ok {
+		ns.respHooks.Store(hooks)
+	}
+	if catalog, ok := s.errmsgs.Load().(*errorCatalog); ok {
+		ns.errmsgs.Store(catalog)
+	}
+	if events, ok := s.events.Load().(*eventRegistry); ok {
+		ns.events.Store(events)
+	}
+
+	r := s.loadRegistry().copy()
+	for key, a := range r.handlers {
+		r.handlers[key] = a.clone()
+	}
+	for key, vs := range r.versions {
+		r.versions[key] = vs.clone()
+	}
+	ns.registry.Store(r)
+	ns.actionHeaders = atomic.LoadInt32(&s.actionHeaders)
+	ns.mounts = append([]mount(nil), s.mounts...)
+
+	ns.mws = append([]Middleware(nil), s.mws...)
+	ns.handler.Store(wrapHandler(ns.serveTenant, ns.mws))
+	if len(s.vmws) > 0 {
+		ns.vmws = make(map[string][]Middleware, len(s.vmws))
+		for version, mws := range s.vmws {
+			ns.vmws[version] = mws
+		}
+	}
+	if len(s.tmws) > 0 {
+		ns.tmws = make(map[string][]Middleware, len(s.tmws))
+		handlers := make(map[string]Handler, len(s.tmws))
+		for tenant, mws := range s.tmws {
+			ns.tmws[tenant] = mws
+			handlers[tenant] = wrapHandler(ns.handleRequest, mws)
+		}
+		ns.tenants.Store(handlers)
+	}
+
+	return ns
+}
+
+// clone returns a copy of the action with the independent statistics.
+func (a *action) clone() *action {
+	na := &action{
+		name:    a.name,
+		version: a.version,
+		handler: a.handler,
+		mws:     a.mws,
+		extra:   a.extra,
+		vmws:    a.vmws,
+		dryRun:  a.dryRun,
+		headers: a.headers,
+		maxReq:  a.maxReq,
+		maxResp: a.maxResp,
+
+		timeout:     a.timeout,
+		description: a.description,
+		tags:        a.tags,
+		reqType:     a.reqType,
+		respType:    a.respType,
+		auth:        a.auth,
+		stats:       newActionStats(),
+		tenantReq:   a.tenantReq,
+		reqSchema:   a.reqSchema,
+		respSchema:  a.respSchema,
+	}
+
+	if d := a.deprecation; d != nil {
+		na.deprecation = &deprecation{message: d.message, sunset: d.sunset, warning: d.warning}
+	}
+	if info := a.disabledInfo(); info != nil {
+		na.disabled.Store(info)
+	}
+	na.wrapped.Store(a.wrapped.Load())
+	return na
+}
+
+// NormalizeActionLower is the default normalizer of the service name,
+// which trims the whitespaces and converts it to lower case.
+func NormalizeActionLower(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (s *Service) normalize(name string) string {
+	if s.NormalizeAction != nil {
+		return s.NormalizeAction(name)
+	} else if s.CaseInsensitiveAction {
+		return NormalizeActionLower(name)
+	}
+	return name
+}
+
 // AcquireContext acquires a Context from the pool.
 func (s *Service) AcquireContext(r *http.Request, w http.ResponseWriter) *Context {
 	c := s.ctxpool.Get().(*Context)
 	c.SetReqResp(r, w)
+	c.res.snapshot = s.SnapshotSentHeaders
 	return c
 }
 
@@ -98,50 +718,169 @@ func (s *Service) ReleaseContext(c *Context) {
 }
 
 // Use registers the global middlewares that apply to all the services.
+//
+// It is safe to be called at any time, even if the service is serving,
+// and the new handler chain only acts on the requests coming later.
 func (s *Service) Use(mws ...Middleware) {
-	s.mws = append(s.mws, mws...)
-	s.handler = s.handleRequest
-	for _len := len(s.mws) - 1; _len >= 0; _len-- {
-		s.handler = s.mws[_len](s.handler)
-	}
+	s.lock.Lock()
+	s.mws = append(append([]Middleware{}, s.mws...), mws...)
+	s.handler.Store(wrapHandler(s.serveTenant, s.mws))
+	s.lock.Unlock()
 }
 
 // Register registers a service with the name and the handler.
 func (s *Service) Register(name string, handler Handler, mws ...Middleware) {
+	s.RegisterWithOptions(name, handler, WithMiddlewares(mws...))
+}
+
+// RegisterWithOptions registers a service with the name, the handler
+// and the options.
+func (s *Service) RegisterWithOptions(name string, handler Handler, opts ...ActionOption) {
 	if name == "" {
 		panic("Service.Register: the service name must not be empty")
 	} else if handler == nil {
 		panic("Service.Register: the service handler must not be empty")
 	}
+	s.validateName("Service.Register", name)
 
-	for _len := len(mws) - 1; _len >= 0; _len-- {
-		handler = mws[_len](handler)
+	key := s.normalize(name)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.loadRegistry()
+	if a, ok := r.handlers[key]; ok && a.name != name {
+		panic(fmt.Errorf("Service.Register: the service '%s' conflicts with '%s'",
+			name, a.name))
+	} else if vs, ok := r.versions[key]; ok && vs.name != name {
+		panic(fmt.Errorf("Service.Register: the service '%s' conflicts with '%s'",
+			name, vs.name))
+	}
+
+	a := newAction(name, handler, opts)
+	if len(a.headers) > 0 {
+		atomic.StoreInt32(&s.actionHeaders, 1)
+	}
+
+	r = r.copy()
+	r.handlers[key] = a
+	s.registry.Store(r)
+}
+
+// UseFor appends the middlewares to the registered service named name,
+// which only act on this service and are applied outside the middlewares
+// passed when registering it.
+//
+// Return an error if the service does not exist.
+func (s *Service) UseFor(name string, mws ...Middleware) (err error) {
+	s.lock.Lock()
+	if a, ok := s.loadRegistry().handlers[s.normalize(name)]; ok {
+		a.extra = append(append([]Middleware{}, a.extra...), mws...)
+		a.wrap()
+	} else {
+		err = fmt.Errorf("no service named '%s'", name)
 	}
+	s.lock.Unlock()
+	return
+}
 
+// ResetMiddlewares removes all the middlewares appended by UseFor
+// from the service named name, that's, restore it to the registered one.
+//
+// Return an error if the service does not exist.
+func (s *Service) ResetMiddlewares(name string) (err error) {
 	s.lock.Lock()
-	s.handlers[name] = handler
+	if a, ok := s.loadRegistry().handlers[s.normalize(name)]; ok {
+		a.extra = nil
+		a.wrap()
+	} else {
+		err = fmt.Errorf("no service named '%s'", name)
+	}
 	s.lock.Unlock()
+	return
 }
 
-// Unregister unregisters the service by the name.
-func (s *Service) Unregister(name string) {
+// Unregister unregisters the service by the name, including all its versions
+// registered by RegisterVersion, and returns the original handler
+// registered by Register, which may be registered again later.
+//
+// ok is false if the service does not exist. But handler is nil
+// if the service is only registered with the versions.
+func (s *Service) Unregister(name string) (handler Handler, ok bool) {
 	if name == "" {
 		panic("Service.Unregister: the service name must not be empty")
 	}
 
+	key := s.normalize(name)
 	s.lock.Lock()
-	delete(s.handlers, name)
-	s.lock.Unlock()
+	defer s.lock.Unlock()
+
+	r := s.loadRegistry()
+	a, aok := r.handlers[key]
+	_, vok := r.versions[key]
+	if ok = aok || vok; ok {
+		r = r.copy()
+		delete(r.handlers, key)
+		delete(r.versions, key)
+		s.registry.Store(r)
+	}
+	if aok {
+		handler = a.handler
+	}
+	return
 }
 
-// Services returns the names of all the services.
-func (s *Service) Services() (names []string) {
+// UnregisterPrefix unregisters all the services whose names have the prefix,
+// which are the original names when registering them, and returns
+// the number of the unregistered services.
+func (s *Service) UnregisterPrefix(prefix string) (n int) {
 	s.lock.Lock()
-	names = make([]string, 0, len(s.handlers))
-	for name := range s.handlers {
-		names = append(names, name)
+	defer s.lock.Unlock()
+
+	r := s.loadRegistry().copy()
+	for key, vs := range r.versions {
+		if strings.HasPrefix(vs.name, prefix) {
+			if _, ok := r.handlers[key]; !ok {
+				n++
+			}
+			delete(r.versions, key)
+		}
 	}
+	for key, a := range r.handlers {
+		if strings.HasPrefix(a.name, prefix) {
+			delete(r.handlers, key)
+			n++
+		}
+	}
+
+	if n > 0 {
+		s.registry.Store(r)
+	}
+	return
+}
+
+// UnregisterAll unregisters all the services and removes all the mappings.
+func (s *Service) UnregisterAll() {
+	s.lock.Lock()
+	s.registry.Store(&registry{
+		handlers: make(map[string]*action),
+		mappings: make(map[string]string),
+		versions: make(map[string]*versionSet),
+	})
 	s.lock.Unlock()
+}
+
+// Services returns the names of all the services, which are the original
+// names when registering them.
+func (s *Service) Services() (names []string) {
+	r := s.loadRegistry()
+	names = make([]string, 0, len(r.handlers)+len(r.versions))
+	for _, a := range r.handlers {
+		names = append(names, a.name)
+	}
+	for key, vs := range r.versions {
+		if _, ok := r.handlers[key]; !ok {
+			names = append(names, vs.name)
+		}
+	}
 	return
 }
 
@@ -149,78 +888,335 @@ func (s *Service) Services() (names []string) {
 // fromName is the alias of the name of the service named toName,
 // and when calling the service named fromName, it will be forwarded
 // to the service named toName to handle.
+//
+// toName may also be an alias, but the mapping chain must not be a cycle
+// and its length must not exceed 8. Or panic.
 func (s *Service) Mapping(fromName, toName string) {
 	if fromName == "" || toName == "" {
 		panic("Service.Mapping: the service name must not be empty")
 	}
+	s.validateName("Service.Mapping", fromName)
+	s.validateName("Service.Mapping", toName)
+
+	from, to := s.normalize(fromName), s.normalize(toName)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.loadRegistry()
+	var depth int
+	for name, ok := to, true; ok; name, ok = r.mappings[name] {
+		if name == from {
+			panic(fmt.Errorf("Service.Mapping: the mapping from '%s' to '%s' forms a cycle",
+				fromName, toName))
+		} else if depth++; depth > maxMappingDepth {
+			panic(fmt.Errorf("Service.Mapping: the mapping chain from '%s' is too deep",
+				fromName))
+		}
+	}
+
+	r = r.copy()
+	r.mappings[from] = to
+	s.registry.Store(r)
+}
 
+// RemoveMapping removes the mapping from fromName added by Mapping,
+// and returns false if it does not exist.
+func (s *Service) RemoveMapping(fromName string) (ok bool) {
+	from := s.normalize(fromName)
 	s.lock.Lock()
-	s.mappings[fromName] = toName
+	r := s.loadRegistry()
+	if _, ok = r.mappings[from]; ok {
+		r = r.copy()
+		delete(r.mappings, from)
+		s.registry.Store(r)
+	}
 	s.lock.Unlock()
+	return
 }
 
-// Mappings returns the mapping of the names of all the services.
+// ResolveAction resolves the name, which may be an alias by Mapping,
+// and returns the name of the service where it lands finally.
+func (s *Service) ResolveAction(name string) (final string, ok bool) {
+	if a, _ok := s.getAction(name); _ok {
+		final, ok = a.name, true
+	}
+	return
+}
+
+// Mappings returns the mapping of the names of all the services,
+// which have been normalized by NormalizeAction.
 func (s *Service) Mappings() map[string]string {
-	s.lock.RLock()
-	mappings := make(map[string]string, len(s.mappings))
-	for k, v := range s.mappings {
+	r := s.loadRegistry()
+	mappings := make(map[string]string, len(r.mappings))
+	for k, v := range r.mappings {
 		mappings[k] = v
 	}
-	s.lock.RUnlock()
 	return mappings
 }
 
-func (s *Service) getHandler(name string) (handler Handler, ok bool) {
-	s.lock.RLock()
-	if handler, ok = s.handlers[name]; !ok {
-		if name, ok = s.mappings[name]; ok {
-			handler, ok = s.handlers[name]
-		}
+// lookupAction looks up the action by the normalized name.
+func (r *registry) lookupAction(name string) (a *action, ok bool) {
+	if name, ok = r.resolve(name); ok {
+		a, ok = r.handlers[name]
 	}
-	s.lock.RUnlock()
 	return
 }
 
+// resolve follows the mappings of the normalized name and returns the name
+// of the service without or with the versions where it lands finally.
+func (r *registry) resolve(name string) (final string, ok bool) {
+	for depth := 0; depth <= maxMappingDepth; depth++ {
+		if _, ok = r.handlers[name]; ok {
+			return name, true
+		} else if _, ok = r.versions[name]; ok {
+			return name, true
+		} else if name, ok = r.mappings[name]; !ok {
+			return
+		}
+	}
+	return "", false
+}
+
+func (s *Service) getAction(name string) (a *action, ok bool) {
+	return s.loadRegistry().lookupAction(s.normalize(name))
+}
+
+// InFlight returns the number of the requests being handled.
+func (s *Service) InFlight() int { return int(atomic.LoadInt64(&s.inflight)) }
+
+// Shutdown flips the service into the lame-duck mode, that's, not ready but
+// still serving, and waits for LameDuckDelay, so that the load balancer
+// can stop sending the new requests. Then it flips the service into
+// the draining mode, that's, all the new requests will be refused with
+// ErrServiceUnavailable, and waits for all the in-flight requests to finish
+// until ctx is done. At last, it waits for the queued action events
+// to be dispatched until EventDrainTimeout or ctx is done.
+func (s *Service) Shutdown(ctx context.Context) error {
+	if s.transit(StateLameDuck, StateReady, StateStarting, StateNotReady) && s.LameDuckDelay > 0 {
+		timer := time.NewTimer(s.LameDuckDelay)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	atomic.StoreInt32(&s.closed, 1)
+	s.transit(StateDraining, StateLameDuck)
+
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		if atomic.LoadInt64(&s.inflight) <= 0 {
+			s.drainEvents(ctx)
+			s.transit(StateStopped, StateDraining)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.drainEvents(ctx)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // ServeHTTP implements the interface http.Handler.
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+
 	c := s.AcquireContext(r, w)
-	s.HandleRequest(c)
+	s.registerStaticHeaders(c)
+	if atomic.LoadInt32(&s.closed) == 1 {
+		c.SetRespHeader("Retry-After", "5")
+		c.Failure(ErrServiceUnavailable.WithMessage("service is shutting down"))
+	} else if s.Observer == nil {
+		s.HandleRequest(c)
+	} else {
+		start := time.Now()
+		s.HandleRequest(c)
+		s.observe(c, time.Since(start))
+	}
 	s.ReleaseContext(c)
 }
 
 // HandleRequest is the same as ServeHTTP, but uses Context
 // instead of http.ResponseWriter and http.Request.
 func (s *Service) HandleRequest(c *Context) (err error) {
+	var herr error
+	if !c.extracted {
+		herr = s.extract(c)
+	}
+	if !c.DryRun {
+		c.DryRun = s.isDryRun(c.req)
+	}
+	if c.RequestID == "" && c.lazy&lazyRequestID == 0 {
+		c.RequestID = s.newRequestID()
+	}
+
+	if s.RequestIDResponseHeader != "" {
+		c.res.Header().Set(s.RequestIDResponseHeader, c.RequestID)
+	}
+
+	if herr == nil {
+		herr = s.checkMaintenance(c)
+	}
+	if herr == nil {
+		herr = s.runRequestHooks(c)
+	}
+	if herr == nil {
+		if handler := s.handler.Load().(Handler); s.PropagateDeadline {
+			herr = s.handleWithDeadline(c, handler)
+		} else {
+			herr = handler(c)
+		}
+	}
+
+	if err = herr; !c.res.Wrote || needRespondError(c, herr) {
+		err = c.Respond(nil, herr)
+	} else if herr != nil && !c.resperr && herr != ErrAlreadyResponded {
+		c.superfluousError(herr)
+	}
+
+	c.endStats(herr)
+	s.runResponseHooks(c, herr)
+	s.emitEvent(c, herr)
+	return
+}
+
+// DefaultErrorHandler is the default error handler, which responds the error
+// as the error envelope by c.Failure.
+func DefaultErrorHandler(c *Context, err error) { c.Failure(err) }
+
+// needRespondError reports whether the error should be responded though
+// the response header has been written, that's, the handler only writes
+// the header without the body and returns an error, such as WriteHeader(202).
+// So the error is responded with the written status code.
+//
+// But if the written status code does not allow the body, such as 204 and 304,
+// the error cannot be responded, which is only reported to the statistics,
+// the observer and the OnResponse hooks.
+func needRespondError(c *Context, err error) bool {
+	return err != nil && c.res.Size == 0 && !c.res.Hijacked && bodyAllowedForStatus(c.res.Status)
+}
+
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status < 200:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+var (
+	defaultActionExtractors    = []Extractor{FromHeader("X-Action"), FromQuery("Action")}
+	defaultVersionExtractors   = []Extractor{FromHeader("X-Version")}
+	defaultRequestIDExtractors = []Extractor{FromHeader("X-Request-Id")}
+)
+
+func (s *Service) extract(c *Context) (err error) {
 	if s.GetAction != nil {
 		c.Action = s.GetAction(c.req)
-	} else if c.Action = c.GetReqHeader("X-Action"); c.Action == "" {
-		c.Action = c.GetQuery("Action")
+	} else if len(s.ActionExtractors) > 0 {
+		c.Action, err = extract(c, s.ActionExtractors)
+	} else if c.Action, err = extract(c, defaultActionExtractors); c.Action == "" &&
+		err == nil && s.ActionBodyField != "" {
+		c.Action, err = FromJSONBodyField(s.ActionBodyField)(c)
+	}
+
+	if err == nil {
+		if s.LazyVersion {
+			c.lazy |= lazyVersion
+		} else {
+			c.Version, err = s.extractVersion(c)
+		}
 	}
 
+	if err == nil {
+		if s.LazyRequestID && s.RequestIDResponseHeader == "" {
+			c.lazy |= lazyRequestID
+		} else {
+			c.RequestID, err = s.extractRequestID(c)
+		}
+	}
+
+	if err == nil {
+		if s.GetTenant != nil {
+			c.Tenant = s.GetTenant(c.req)
+		} else {
+			c.Tenant = c.GetReqHeader("X-Tenant-Id")
+		}
+	}
+
+	return
+}
+
+func (s *Service) extractVersion(c *Context) (version string, err error) {
 	if s.GetVersion != nil {
-		c.Version = s.GetVersion(c.req)
+		version = s.GetVersion(c.req)
+	} else if len(s.VersionExtractors) > 0 {
+		version, err = extract(c, s.VersionExtractors)
 	} else {
-		c.Version = c.GetReqHeader("X-Version")
+		version, err = extract(c, defaultVersionExtractors)
 	}
+	return
+}
 
+func (s *Service) extractRequestID(c *Context) (requestID string, err error) {
 	if s.GetRequestID != nil {
-		c.RequestID = s.GetRequestID(c.req)
+		requestID = s.GetRequestID(c.req)
+	} else if len(s.RequestIDExtractors) > 0 {
+		requestID, err = extract(c, s.RequestIDExtractors)
 	} else {
-		c.RequestID = c.GetReqHeader("X-Request-Id")
+		requestID, err = extract(c, defaultRequestIDExtractors)
 	}
+	return
+}
 
-	if err = s.handler(c); !c.res.Wrote {
-		err = c.Respond(nil, err)
+func (s *Service) newRequestID() string {
+	if s.GenerateRequestID != nil {
+		return s.GenerateRequestID()
 	}
+	return generateRequestID()
+}
 
-	return
+func generateRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
 }
 
 func (s *Service) handleRequest(c *Context) (err error) {
 	if c.Action == "" {
 		err = ErrInvalidAction.WithMessage("no action")
-	} else if handler, ok := s.getHandler(c.Action); ok {
-		err = handler(c)
+	} else if a, handler, verr := s.lookupHandler(c); verr != nil {
+		err = verr
+	} else if a != nil {
+		c.action, c.start = a, time.Now()
+		a.stats.begin(c.start)
+		if info := a.disabledInfo(); info != nil {
+			err = s.handleDisabled(c, info)
+		} else if err = c.limitSize(a); err != nil {
+		} else if a.tenantReq && c.Tenant == "" {
+			err = ErrMissingTenant
+		} else if err = s.authenticate(c, a.auth); err == nil {
+			if a.deprecation != nil {
+				s.handleDeprecation(c, a.deprecation)
+			}
+			if a.reqSchema != nil && !s.DisableSchemaValidation {
+				err = s.validateRequestSchema(c, a.reqSchema)
+			}
+			if err == nil {
+				err = handler(c)
+			}
+		}
+	} else if m, ok := s.getMount(c.Action); ok {
+		err = m.serve(c)
 	} else {
 		err = ErrInvalidAction.WithMessage("invalid action '%s'", c.Action)
 	}
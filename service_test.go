@@ -16,8 +16,12 @@ package httpsvc
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -53,3 +57,390 @@ func TestService(t *testing.T) {
 		t.Errorf("unexpect response '%+v'", result)
 	}
 }
+
+func TestServiceUseFor(t *testing.T) {
+	tag := func(s string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				c.SetRespHeader("X-Tag", c.Header().Get("X-Tag")+s)
+				return next(c)
+			}
+		}
+	}
+
+	svc := NewService()
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) }, tag("r"))
+
+	call := func() string {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		svc.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Tag")
+	}
+
+	if err := svc.UseFor("nosvc", tag("a")); err == nil {
+		t.Errorf("expect an error for the non-existing service, but got nil")
+	}
+
+	if err := svc.UseFor("svc", tag("a")); err != nil {
+		t.Fatal(err)
+	} else if tags := call(); tags != "ar" {
+		t.Errorf("expect tags '%s', but got '%s'", "ar", tags)
+	}
+
+	if err := svc.UseFor("svc", tag("b")); err != nil {
+		t.Fatal(err)
+	} else if tags := call(); tags != "abr" {
+		t.Errorf("expect tags '%s', but got '%s'", "abr", tags)
+	}
+
+	if err := svc.ResetMiddlewares("svc"); err != nil {
+		t.Fatal(err)
+	} else if tags := call(); tags != "r" {
+		t.Errorf("expect tags '%s', but got '%s'", "r", tags)
+	}
+}
+
+func TestServiceUseConcurrently(t *testing.T) {
+	var count int32
+	counter := func(next Handler) Handler {
+		return func(c *Context) error {
+			atomic.AddInt32(&count, 1)
+			return next(c)
+		}
+	}
+
+	svc := NewService()
+	svc.Register("svc", func(c *Context) error { return c.Success(nil) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rec := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+				svc.ServeHTTP(rec, req)
+				if rec.Code != 200 {
+					t.Errorf("expect status code '%d', but got '%d'", 200, rec.Code)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		svc.Use(counter)
+	}
+	wg.Wait()
+
+	atomic.StoreInt32(&count, 0)
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+	svc.ServeHTTP(rec, req)
+	if n := atomic.LoadInt32(&count); n != 10 {
+		t.Errorf("expect %d middlewares to be called, but got %d", 10, n)
+	}
+}
+
+func TestServiceRequestID(t *testing.T) {
+	svc := NewService()
+	svc.RequestIDResponseHeader = "X-Request-Id"
+	svc.Register("svc", func(c *Context) error { return c.Text(200, "text/plain", "") })
+	svc.Register("json", func(c *Context) error { return c.Success(nil) })
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+	svc.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-Id"); len(id) != 32 {
+		t.Errorf("expect a generated request id, but got '%s'", id)
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://127.0.0.1?Action=json", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	svc.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-Id"); id != "abc" {
+		t.Errorf("expect the request id '%s', but got '%s'", "abc", id)
+	}
+
+	svc.GenerateRequestID = func() string { return "xyz" }
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://127.0.0.1?Action=json", nil)
+	svc.ServeHTTP(rec, req)
+
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if resp.RequestID != "xyz" || rec.Header().Get("X-Request-Id") != "xyz" {
+		t.Errorf("expect the request id '%s', but got '%s'", "xyz", resp.RequestID)
+	}
+}
+
+func TestServiceCaseInsensitiveAction(t *testing.T) {
+	svc := NewService()
+	svc.CaseInsensitiveAction = true
+	svc.Register("CreateUser", func(c *Context) error { return c.Success(c.Action) })
+	svc.Mapping("AddUser", "createUser")
+
+	for _, action := range []string{"createuser", "CREATEUSER", "adduser", "AddUser"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1", nil)
+		req.Header.Set("X-Action", " "+action)
+		svc.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.Error.Code != "" {
+			t.Errorf("%s: unexpected error: %v", action, resp.Error)
+		}
+	}
+
+	if names := svc.Services(); len(names) != 1 || names[0] != "CreateUser" {
+		t.Errorf("expect the services '%v', but got '%v'", []string{"CreateUser"}, names)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expect a panic for the conflicted service name")
+			}
+		}()
+		svc.Register("createuser", func(c *Context) error { return nil })
+	}()
+
+	svc.Unregister("CREATEUSER")
+	if names := svc.Services(); len(names) != 0 {
+		t.Errorf("expect no services, but got '%v'", names)
+	}
+}
+
+func TestServiceMappingChain(t *testing.T) {
+	svc := NewService()
+	svc.Register("c", func(c *Context) error { return nil })
+	svc.Register("b2", func(c *Context) error { return nil })
+	svc.Mapping("a", "b")
+	svc.Mapping("b", "c")
+	svc.Mapping("b2", "c") // b2 is registered directly, so it takes precedence.
+	svc.Mapping("x", "y")
+
+	for name, expect := range map[string]string{"a": "c", "b": "c", "c": "c", "b2": "b2"} {
+		if final, ok := svc.ResolveAction(name); !ok || final != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", name, expect, final)
+		}
+	}
+
+	if final, ok := svc.ResolveAction("x"); ok {
+		t.Errorf("unexpected the final action '%s'", final)
+	}
+
+	for _, mapping := range [][2]string{{"c", "a"}, {"d", "d"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect a panic for the cycle mapping '%v'", mapping)
+				}
+			}()
+			svc.Mapping(mapping[0], mapping[1])
+		}()
+	}
+
+	for i := 0; i < maxMappingDepth; i++ {
+		svc.Mapping(fmt.Sprint("n", i+1), fmt.Sprint("n", i))
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expect a panic for the too deep mapping chain")
+			}
+		}()
+		svc.Mapping("n9", "n8")
+	}()
+}
+
+func TestServiceRespondAfterWriteHeader(t *testing.T) {
+	var size int64
+	var written bool
+	svc := NewService()
+	svc.OnResponse(func(c *Context, err error) {
+		size, written = c.ResponseSize(), c.ResponseHeaderWritten()
+	})
+	svc.Register("Action", func(c *Context) error {
+		status := http.StatusAccepted
+		if c.Query().Get("NoContent") != "" {
+			status = http.StatusNoContent
+		}
+		c.WriteHeader(status)
+		return ErrFailedOperation
+	})
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expect the status code %d, but got %d", http.StatusAccepted, rec.Code)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Error.Code != ErrFailedOperation.Code {
+		t.Errorf("expect the error code '%s', but got '%s'", ErrFailedOperation.Code, resp.Error.Code)
+	}
+	if !written || size != int64(rec.Body.Len()) {
+		t.Errorf("unexpected the response: written=%v, size=%d", written, size)
+	}
+
+	rec = httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Action&NoContent=1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expect the status code %d, but got %d", http.StatusNoContent, rec.Code)
+	} else if rec.Body.Len() != 0 {
+		t.Errorf("unexpected the response body: %s", rec.Body.String())
+	}
+	if !written || size != 0 {
+		t.Errorf("unexpected the response: written=%v, size=%d", written, size)
+	}
+
+	if stats := svc.Stats()["Action"]; stats.Errors[ErrFailedOperation.Code] != 2 {
+		t.Errorf("expect two errors, but got %v", stats.Errors)
+	}
+}
+
+func TestServiceLazyExtraction(t *testing.T) {
+	var extracted int
+	svc := NewService()
+	svc.LazyVersion = true
+	svc.LazyRequestID = true
+	svc.GetVersion = func(r *http.Request) string { extracted++; return r.Header.Get("X-Version") }
+	svc.Register("Text", func(c *Context) error { return c.Text(200, "text/plain", "ok") })
+	svc.Register("Echo", func(c *Context) error {
+		if c.Version != "" || c.RequestID != "" {
+			t.Errorf("unexpected the eager extraction: version=%s, requestid=%s", c.Version, c.RequestID)
+		}
+		return c.Text(200, "text/plain", c.GetVersion()+":"+c.GetRequestID())
+	})
+
+	call := func(action string) string {
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		req.Header.Set("X-Version", "v1")
+		req.Header.Set("X-Request-Id", "abc")
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := call("Text"); body != "ok" {
+		t.Errorf("unexpected the body '%s'", body)
+	} else if extracted != 0 {
+		t.Errorf("unexpected the version is extracted %d times", extracted)
+	}
+
+	if body := call("Echo"); body != "v1:abc" {
+		t.Errorf("unexpected the body '%s'", body)
+	} else if extracted != 1 {
+		t.Errorf("expect the version is extracted once, but got %d", extracted)
+	}
+
+	svc.Register("Success", func(c *Context) error { return c.Success(nil) })
+	if body := call("Success"); body != "{\"RequestId\":\"abc\"}\n" {
+		t.Errorf("unexpected the body '%s'", body)
+	}
+}
+
+func TestServiceErrorHandler(t *testing.T) {
+	var handled []string
+	svc := NewService()
+	svc.ErrorHandler = func(c *Context, err error) {
+		handled = append(handled, c.Action)
+		if e, ok := err.(Error); ok && e.Code == ErrThrottling.Code {
+			c.SetRespHeader("Retry-After", "3")
+		}
+		DefaultErrorHandler(c, err)
+	}
+	svc.Register("Throttle", func(c *Context) error { return ErrThrottling })
+	svc.Register("Failure", func(c *Context) error { return c.Failure(ErrConflict) })
+	svc.Register("Written", func(c *Context) error {
+		c.Text(http.StatusOK, "text/plain", "done")
+		return ErrServerError
+	})
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Throttle", nil))
+	var resp Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Error.Code != ErrThrottling.Code || rec.Header().Get("Retry-After") != "3" {
+		t.Errorf("unexpected the response: %v %s", rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Failure", nil))
+	resp = Response{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Error.Code != ErrConflict.Code {
+		t.Errorf("unexpected the response: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=Written", nil))
+	if body := rec.Body.String(); body != "done" {
+		t.Errorf("the responded body is changed: %s", body)
+	}
+
+	if len(handled) != 2 || handled[0] != "Throttle" || handled[1] != "Failure" {
+		t.Errorf("unexpected the handled errors: %v", handled)
+	}
+}
+
+func TestServiceUnregister(t *testing.T) {
+	svc := NewService()
+	svc.Register("GetUser", func(c *Context) error { return c.Success("v1") })
+	svc.Register("user.Create", func(c *Context) error { return nil })
+	svc.Register("user.Delete", func(c *Context) error { return nil })
+	svc.RegisterVersion("user.List", "v1", func(c *Context) error { return nil })
+	svc.Mapping("DescribeUser", "GetUser")
+
+	if _, ok := svc.Unregister("GetUsr"); ok {
+		t.Error("expect no service to be unregistered")
+	}
+
+	// Swap the handler temporarily.
+	handler, ok := svc.Unregister("GetUser")
+	if !ok || handler == nil {
+		t.Fatal("expect the unregistered handler")
+	}
+	svc.Register("GetUser", func(c *Context) error { return c.Success("canary") })
+	svc.Unregister("GetUser")
+	svc.Register("GetUser", handler)
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=DescribeUser", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"v1"`) {
+		t.Errorf("unexpected the response: %s", body)
+	}
+
+	if n := svc.UnregisterPrefix("user."); n != 3 {
+		t.Errorf("expect %d unregistered services, but got %d", 3, n)
+	} else if names := svc.Services(); len(names) != 1 || names[0] != "GetUser" {
+		t.Errorf("unexpected the services: %v", names)
+	}
+
+	if !svc.RemoveMapping("DescribeUser") {
+		t.Error("expect the mapping to be removed")
+	} else if svc.RemoveMapping("DescribeUser") {
+		t.Error("unexpected the mapping to be removed again")
+	} else if _, ok := svc.ResolveAction("DescribeUser"); ok {
+		t.Error("unexpected the removed mapping")
+	}
+
+	for i := 0; i < 100; i++ {
+		svc.Register(fmt.Sprint("Action", i), func(c *Context) error { return nil })
+		svc.Mapping(fmt.Sprint("Alias", i), fmt.Sprint("Action", i))
+	}
+	svc.UnregisterAll()
+	if r := svc.loadRegistry(); len(r.handlers) != 0 || len(r.mappings) != 0 || len(r.versions) != 0 {
+		t.Errorf("unexpected the registry: %d, %d, %d", len(r.handlers), len(r.mappings), len(r.versions))
+	} else if len(svc.Stats()) != 0 {
+		t.Errorf("unexpected the stats: %v", svc.Stats())
+	}
+}
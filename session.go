@@ -0,0 +1,464 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionStore is used to store the sessions.
+type SessionStore interface {
+	// Get returns the id and values of the session by the cookie value.
+	// If the session does not exist or has expired, return nil values.
+	Get(cookie string) (id string, values map[string]interface{}, err error)
+
+	// Save saves the values of the session, and returns the cookie value.
+	Save(id string, values map[string]interface{}) (cookie string, err error)
+
+	// Delete deletes the session by the id.
+	Delete(id string) error
+}
+
+// Session is the session of the request, which is acquired by c.Session().
+//
+// Notice: it is not thread-safe.
+type Session struct {
+	id      string
+	oldID   string
+	values  map[string]interface{}
+	isNew   bool
+	changed bool
+	deleted bool
+}
+
+func newSession(id string, values map[string]interface{}, isNew bool) *Session {
+	if values == nil {
+		values = make(map[string]interface{}, 4)
+	}
+	return &Session{id: id, values: values, isNew: isNew}
+}
+
+// ID returns the id of the session.
+func (s *Session) ID() string { return s.id }
+
+// IsNew reports whether the session is new.
+func (s *Session) IsNew() bool { return s.isNew }
+
+// Changed reports whether the session has been changed.
+func (s *Session) Changed() bool { return s.changed }
+
+// Get returns the value of the key.
+func (s *Session) Get(key string) interface{} { return s.values[key] }
+
+// Set sets the value of the key.
+func (s *Session) Set(key string, value interface{}) {
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete deletes the key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Len returns the number of the values.
+func (s *Session) Len() int { return len(s.values) }
+
+// Clear clears all the values.
+func (s *Session) Clear() {
+	if len(s.values) > 0 {
+		s.values = make(map[string]interface{}, 4)
+		s.changed = true
+	}
+}
+
+// RegenerateID regenerates the id of the session and deletes the old one
+// from the store, which should be called when the privilege changes,
+// such as login, to protect from the session fixation.
+func (s *Session) RegenerateID() {
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = generateRequestID()
+	s.changed = true
+}
+
+// Destroy deletes the session from the store and expires the cookie.
+func (s *Session) Destroy() {
+	s.deleted = true
+	s.changed = true
+}
+
+// SessionOption is used to configure the Sessions middleware.
+type SessionOption func(*sessionConfig)
+
+// SessionCookieName returns a session option to set the name of the cookie.
+//
+// Default: "session"
+func SessionCookieName(name string) SessionOption {
+	return func(c *sessionConfig) { c.name = name }
+}
+
+// SessionMaxAge returns a session option to set the max age of the cookie.
+//
+// Default: 0, that's, the cookie is deleted when the browser is closed.
+func SessionMaxAge(maxAge time.Duration) SessionOption {
+	return func(c *sessionConfig) { c.maxAge = maxAge }
+}
+
+// SessionCookie returns a session option to customize the cookie
+// before it is set, such as Domain, Secure and SameSite.
+//
+// Default: Path is "/", and HttpOnly is true.
+func SessionCookie(customize func(*http.Cookie)) SessionOption {
+	return func(c *sessionConfig) { c.customize = customize }
+}
+
+type sessionConfig struct {
+	name      string
+	maxAge    time.Duration
+	customize func(*http.Cookie)
+	store     SessionStore
+}
+
+// Sessions returns a middleware to load the session from the cookie
+// by store, which can be acquired by c.Session(). If the session is changed,
+// it is saved and the cookie is set before the response header is written.
+//
+// Notice: if failing to save the session, the cookie is not changed.
+func Sessions(store SessionStore, opts ...SessionOption) Middleware {
+	if store == nil {
+		panic("Sessions: the session store must not be nil")
+	}
+
+	conf := &sessionConfig{name: "session", store: store}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			var sess *Session
+			if cookie, _ := c.req.Cookie(conf.name); cookie != nil && cookie.Value != "" {
+				if id, values, err := store.Get(cookie.Value); err == nil && values != nil {
+					sess = newSession(id, values, false)
+				}
+			}
+			if sess == nil {
+				sess = newSession(generateRequestID(), nil, true)
+			}
+
+			resp := c.ResponseWriter()
+			sw := &sessionResponseWriter{ResponseWriter: resp, conf: conf, sess: sess}
+			c.SetResponseWriter(sw)
+			c.session = sess
+			defer func() {
+				c.SetResponseWriter(resp)
+				c.session = nil
+			}()
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+			return
+		}
+	}
+}
+
+// sessionResponseWriter commits the session before writing the header.
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	conf *sessionConfig
+	sess *Session
+	done bool
+}
+
+// Unwrap returns the underlying response writer.
+func (w *sessionResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *sessionResponseWriter) WriteHeader(code int) {
+	if !w.done {
+		w.done = true
+		w.conf.commit(w.ResponseWriter.Header(), w.sess)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionResponseWriter) Write(p []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (c *sessionConfig) commit(header http.Header, sess *Session) {
+	if !sess.changed {
+		return
+	}
+
+	if sess.oldID != "" {
+		c.store.Delete(sess.oldID)
+	}
+
+	cookie := &http.Cookie{Name: c.name, Path: "/", HttpOnly: true}
+	if sess.deleted {
+		c.store.Delete(sess.id)
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(1, 0)
+	} else {
+		value, err := c.store.Save(sess.id, sess.values)
+		if err != nil {
+			return
+		}
+
+		cookie.Value = value
+		if c.maxAge > 0 {
+			cookie.MaxAge = int(c.maxAge / time.Second)
+			cookie.Expires = time.Now().Add(c.maxAge)
+		}
+	}
+
+	if c.customize != nil {
+		c.customize(cookie)
+	}
+	if v := cookie.String(); v != "" {
+		header.Add("Set-Cookie", v)
+	}
+}
+
+// Session returns the session of the request. If not using the middleware
+// Sessions, return nil.
+func (c *Context) Session() *Session { return c.session }
+
+// MemorySessionStore is an in-memory SessionStore, which expires
+// the session after ttl since it is accessed last time.
+type MemorySessionStore struct {
+	ttl      time.Duration
+	lock     sync.Mutex
+	sessions map[string]memorySession
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type memorySession struct {
+	values map[string]interface{}
+	expire time.Time
+}
+
+// NewMemorySessionStore returns a new MemorySessionStore, which keeps
+// the session for ttl and cleans up the expired ones every interval.
+//
+// If ttl is equal to or less than 0, it is 30m by default.
+// If interval is equal to or less than 0, it is 1m by default.
+func NewMemorySessionStore(ttl, interval time.Duration) *MemorySessionStore {
+	if ttl <= 0 {
+		ttl = time.Minute * 30
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &MemorySessionStore{
+		ttl:      ttl,
+		sessions: make(map[string]memorySession, 64),
+		stop:     make(chan struct{}),
+	}
+	go s.loop(interval)
+	return s
+}
+
+// Close stops the cleanup goroutine.
+func (s *MemorySessionStore) Close() { s.once.Do(func() { close(s.stop) }) }
+
+// Len returns the number of the stored sessions.
+func (s *MemorySessionStore) Len() (n int) {
+	s.lock.Lock()
+	n = len(s.sessions)
+	s.lock.Unlock()
+	return
+}
+
+func (s *MemorySessionStore) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			for id, sess := range s.sessions {
+				if !now.Before(sess.expire) {
+					delete(s.sessions, id)
+				}
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// Get implements the interface SessionStore, which returns the copy
+// of the values and refreshes the expiration of the session.
+func (s *MemorySessionStore) Get(id string) (string, map[string]interface{}, error) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || !now.Before(sess.expire) {
+		return id, nil, nil
+	}
+
+	sess.expire = now.Add(s.ttl)
+	s.sessions[id] = sess
+	return id, copySessionValues(sess.values), nil
+}
+
+// Save implements the interface SessionStore, which returns id as the cookie.
+func (s *MemorySessionStore) Save(id string, values map[string]interface{}) (string, error) {
+	sess := memorySession{values: copySessionValues(values), expire: time.Now().Add(s.ttl)}
+	s.lock.Lock()
+	s.sessions[id] = sess
+	s.lock.Unlock()
+	return id, nil
+}
+
+// Delete implements the interface SessionStore.
+func (s *MemorySessionStore) Delete(id string) error {
+	s.lock.Lock()
+	delete(s.sessions, id)
+	s.lock.Unlock()
+	return nil
+}
+
+func copySessionValues(values map[string]interface{}) map[string]interface{} {
+	newvalues := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		newvalues[k] = v
+	}
+	return newvalues
+}
+
+// CookieSessionStore is a SessionStore to store all the session data
+// into the cookie, which is encrypted and authenticated by AES-GCM.
+//
+// Notice: the values are encoded by JSON, so the numbers are decoded
+// as float64.
+type CookieSessionStore struct {
+	ttl   time.Duration
+	aeads []cipher.AEAD
+}
+
+type cookieSession struct {
+	ID     string                 `json:"i"`
+	Values map[string]interface{} `json:"v"`
+	Expire int64                  `json:"e,omitempty"`
+}
+
+// NewCookieSessionStore returns a new CookieSessionStore, whose session
+// expires after ttl since it is saved last time if ttl is greater than 0.
+//
+// keys are the AES keys, whose size must be 16, 24 or 32. The first key
+// is used to encrypt the session, and all the keys are tried to decrypt it,
+// so the new key should be put at first to rotate the keys.
+func NewCookieSessionStore(ttl time.Duration, keys ...[]byte) (*CookieSessionStore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no session key")
+	}
+
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session key %d: %s", i, err)
+		}
+		if aeads[i], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CookieSessionStore{ttl: ttl, aeads: aeads}, nil
+}
+
+// Get implements the interface SessionStore.
+func (s *CookieSessionStore) Get(cookie string) (string, map[string]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, aead := range s.aeads {
+		size := aead.NonceSize()
+		if len(data) < size {
+			break
+		}
+
+		plain, err := aead.Open(nil, data[:size], data[size:], nil)
+		if err != nil {
+			continue
+		}
+
+		var sess cookieSession
+		if err = json.Unmarshal(plain, &sess); err != nil {
+			return "", nil, err
+		} else if sess.Expire > 0 && time.Now().Unix() >= sess.Expire {
+			return sess.ID, nil, nil
+		}
+		return sess.ID, sess.Values, nil
+	}
+
+	return "", nil, errors.New("invalid session cookie")
+}
+
+// Save implements the interface SessionStore, which returns the encrypted
+// session data as the cookie.
+func (s *CookieSessionStore) Save(id string, values map[string]interface{}) (string, error) {
+	sess := cookieSession{ID: id, Values: values}
+	if s.ttl > 0 {
+		sess.Expire = time.Now().Add(s.ttl).Unix()
+	}
+
+	plain, err := json.Marshal(sess)
+	if err != nil {
+		return "", err
+	}
+
+	aead := s.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	data := aead.Seal(nonce, nonce, plain, nil)
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Delete implements the interface SessionStore, which does nothing
+// since the session is only stored in the cookie.
+func (s *CookieSessionStore) Delete(id string) error { return nil }
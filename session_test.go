@@ -0,0 +1,128 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newSessionTestService(store SessionStore) *Service {
+	svc := NewService()
+	svc.Use(Sessions(store, SessionCookieName("sid")))
+	svc.Register("Login", func(c *Context) error {
+		sess := c.Session()
+		sess.RegenerateID()
+		sess.Set("user", "abc")
+		return c.Success(nil)
+	})
+	svc.Register("Get", func(c *Context) error {
+		user, _ := c.Session().Get("user").(string)
+		return c.Success(user)
+	})
+	svc.Register("Logout", func(c *Context) error {
+		c.Session().Destroy()
+		return nil
+	})
+	return svc
+}
+
+func callSession(t *testing.T, svc *Service, action string, cookie *http.Cookie) (*http.Cookie, string) {
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+	req.Header.Set("X-Request-Id", "1")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	svc.ServeHTTP(rec, req)
+
+	var newCookie *http.Cookie
+	if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+		newCookie = cookies[0]
+	}
+	return newCookie, rec.Body.String()
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	svc := newSessionTestService(store)
+
+	if cookie, _ := callSession(t, svc, "Get", nil); cookie != nil {
+		t.Errorf("unexpected the cookie for the unchanged session: %v", cookie)
+	}
+
+	cookie, _ := callSession(t, svc, "Login", nil)
+	if cookie == nil || cookie.Name != "sid" || !cookie.HttpOnly {
+		t.Fatalf("unexpected cookie: %v", cookie)
+	}
+
+	if newCookie, body := callSession(t, svc, "Get", cookie); newCookie != nil {
+		t.Errorf("unexpected the cookie for the unchanged session: %v", newCookie)
+	} else if expect := `{"RequestId":"1","Data":"abc"}` + "\n"; body != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, body)
+	}
+
+	newCookie, _ := callSession(t, svc, "Login", cookie)
+	if newCookie == nil || newCookie.Value == cookie.Value {
+		t.Errorf("expect the regenerated session, but got %v", newCookie)
+	}
+
+	if expired, _ := callSession(t, svc, "Logout", newCookie); expired == nil || expired.MaxAge >= 0 {
+		t.Errorf("expect the expired cookie, but got %v", expired)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore(time.Minute, time.Minute)
+	defer store.Close()
+	testSessionStore(t, store)
+	if n := store.Len(); n != 0 {
+		t.Errorf("expect no sessions, but got %d", n)
+	}
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte("a"), 16), bytes.Repeat([]byte("b"), 32)
+	store, err := NewCookieSessionStore(time.Minute, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+
+	cookie, err := store.Save("id", map[string]interface{}{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewCookieSessionStore(time.Minute, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, values, err := rotated.Get(cookie); err != nil || id != "id" || values["k"] != "v" {
+		t.Errorf("unexpected session: %v, %v, %v", id, values, err)
+	}
+
+	tampered := []byte(cookie)
+	tampered[len(tampered)-2] ^= 1
+	if _, values, err := rotated.Get(string(tampered)); err == nil || values != nil {
+		t.Errorf("expect an error for the tampered cookie")
+	}
+
+	if _, err = NewCookieSessionStore(0, []byte("short")); err == nil {
+		t.Errorf("expect an error for the invalid key")
+	}
+}
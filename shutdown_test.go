@@ -0,0 +1,72 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServiceShutdown(t *testing.T) {
+	started := make(chan struct{})
+	svc := NewService()
+	svc.Register("slow", func(c *Context) error {
+		close(started)
+		time.Sleep(time.Millisecond * 100)
+		return c.Success("slow")
+	})
+
+	call := func() (resp Response, retryAfter string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=slow", nil)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Error(err)
+		}
+		return resp, rec.Header().Get("Retry-After")
+	}
+
+	slow := make(chan Response)
+	go func() { resp, _ := call(); slow <- resp }()
+	<-started
+
+	if n := svc.InFlight(); n != 1 {
+		t.Errorf("expect %d in-flight request, but got %d", 1, n)
+	}
+
+	shutdown := make(chan error)
+	go func() { shutdown <- svc.Shutdown(context.Background()) }()
+	time.Sleep(time.Millisecond * 20)
+
+	if resp, retryAfter := call(); resp.Error.Code != ErrServiceUnavailable.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrServiceUnavailable.Code, resp.Error.Code)
+	} else if retryAfter == "" {
+		t.Errorf("expect the header Retry-After")
+	}
+
+	if resp := <-slow; resp.Data != "slow" {
+		t.Errorf("expect the slow request to finish, but got '%+v'", resp)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	} else if n := svc.InFlight(); n != 0 {
+		t.Errorf("expect no in-flight requests, but got %d", n)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SigOption is used to configure the request signature.
+type SigOption func(*sigConfig)
+
+// SigSignedHeaders returns a signature option to set the request headers
+// to be signed, which are case-insensitive. The headers "X-Action"
+// and "X-Version" are always signed, since they select the handler,
+// and so are "X-Timestamp" and "X-Nonce" used by ReplayProtection,
+// or the captured request may be replayed with a fresh nonce.
+//
+// Default: Host
+func SigSignedHeaders(headers ...string) SigOption {
+	return func(c *sigConfig) { c.setHeaders(headers) }
+}
+
+// SigHash returns a signature option to set the hash algorithm of HMAC,
+// whose name is used as the prefix of the signature header.
+//
+// Default: "HMAC-SHA256", sha256.New
+func SigHash(name string, newHash func() hash.Hash) SigOption {
+	return func(c *sigConfig) { c.name, c.hash = name, newHash }
+}
+
+// SigHashSHA512 is equal to SigHash("HMAC-SHA512", sha512.New).
+func SigHashSHA512() SigOption { return SigHash("HMAC-SHA512", sha512.New) }
+
+type sigConfig struct {
+	name    string
+	hash    func() hash.Hash
+	headers []string // The sorted lower-case header names.
+}
+
+// sigRequiredHeaders are the lower-case headers always signed.
+var sigRequiredHeaders = []string{"x-action", "x-nonce", "x-timestamp", "x-version"}
+
+func newSigConfig(opts []SigOption) *sigConfig {
+	c := &sigConfig{name: "HMAC-SHA256", hash: sha256.New}
+	c.setHeaders([]string{"host"})
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *sigConfig) setHeaders(headers []string) {
+	c.headers = make([]string, 0, len(headers)+len(sigRequiredHeaders))
+	seen := make(map[string]struct{}, cap(c.headers))
+	for _, hs := range [][]string{sigRequiredHeaders, headers} {
+		for _, header := range hs {
+			header = strings.ToLower(strings.TrimSpace(header))
+			if _, ok := seen[header]; !ok && header != "" {
+				seen[header] = struct{}{}
+				c.headers = append(c.headers, header)
+			}
+		}
+	}
+	sort.Strings(c.headers)
+}
+
+func (c *sigConfig) sign(secret string, req *http.Request, body []byte) string {
+	canonical := CanonicalRequest(req, c.headers, body)
+	mac := hmac.New(c.hash, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanonicalRequest returns the canonical form of the request to be signed,
+// which is composed of the lines as follow:
+//
+//	METHOD
+//	ESCAPED_PATH
+//	SORTED_QUERY              // "k1=v1&k2=v2", sorted by the key and value
+//	header1:trimmed_value1    // the signed headers sorted by the lower-case name
+//	header2:trimmed_value2
+//	header1;header2           // the lower-case names of the signed headers
+//	HEX(SHA256(BODY))
+//
+// The multiple values of a header are joined by ",", and the header "host"
+// is acquired from req.Host.
+func CanonicalRequest(req *http.Request, signedHeaders []string, body []byte) string {
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	buf.WriteString(req.Method)
+	buf.WriteByte('\n')
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	buf.WriteString(path)
+	buf.WriteByte('\n')
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for j, value := range values {
+			if i > 0 || j > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(url.QueryEscape(key))
+			buf.WriteByte('=')
+			buf.WriteString(url.QueryEscape(value))
+		}
+	}
+	buf.WriteByte('\n')
+
+	for _, header := range signedHeaders {
+		var value string
+		if header == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			value = strings.Join(req.Header[http.CanonicalHeaderKey(header)], ",")
+		}
+
+		buf.WriteString(header)
+		buf.WriteByte(':')
+		buf.WriteString(strings.TrimSpace(value))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(strings.Join(signedHeaders, ";"))
+	buf.WriteByte('\n')
+
+	sum := sha256.Sum256(body)
+	buf.WriteString(hex.EncodeToString(sum[:]))
+	return buf.String()
+}
+
+// SignRequest signs the request by HMAC with the access key id and secret,
+// and sets the header "Authorization" with the format:
+//
+//	HMAC-SHA256 Credential=ACCESS_KEY_ID, Signature=HEX_SIGNATURE
+//
+// The body of the request will be read and reset so that it can be sent.
+func SignRequest(req *http.Request, accessKeyID, secret string, opts ...SigOption) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	newSigConfig(opts).authorize(req, accessKeyID, secret, body)
+	return nil
+}
+
+func (c *sigConfig) authorize(req *http.Request, accessKeyID, secret string, body []byte) {
+	req.Header.Set("Authorization", c.name+" Credential="+accessKeyID+
+		", Signature="+c.sign(secret, req, body))
+}
+
+func parseSignature(value, algorithm string) (accessKeyID, signature string, err error) {
+	if !strings.HasPrefix(value, algorithm+" ") {
+		return "", "", errors.New("unsupported signature algorithm")
+	}
+
+	for _, part := range strings.Split(value[len(algorithm)+1:], ",") {
+		part = strings.TrimSpace(part)
+		if index := strings.IndexByte(part, '='); index > 0 {
+			switch part[:index] {
+			case "Credential":
+				accessKeyID = part[index+1:]
+			case "Signature":
+				signature = part[index+1:]
+			}
+		}
+	}
+
+	if accessKeyID == "" || signature == "" {
+		err = errors.New("invalid signature format")
+	}
+	return
+}
+
+// SignatureAuth returns a middleware to verify the signature of the request
+// signed by SignRequest, which is acquired from the header "Authorization"
+// or "X-Signature", and lookupSecret is used to look up the secret
+// by the access key id. If the secret is empty, the access key id
+// is considered to be invalid.
+//
+// The request body is buffered by c.BodyBytes, so the handler can still
+// bind the request.
+func SignatureAuth(lookupSecret func(accessKeyID string) (secret string, err error),
+	opts ...SigOption) Middleware {
+	conf := newSigConfig(opts)
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			value := c.GetReqHeader("Authorization")
+			if value == "" {
+				if value = c.GetReqHeader("X-Signature"); value == "" {
+					return ErrAuthFailureSignatureFailure.WithMessage("missing signature")
+				}
+			}
+
+			accessKeyID, signature, err := parseSignature(value, conf.name)
+			if err != nil {
+				return ErrAuthFailureSignatureFailure.WithMessage(err.Error())
+			}
+
+			secret, err := lookupSecret(accessKeyID)
+			if err != nil || secret == "" {
+				return ErrAuthFailureSignatureFailure.WithMessage("invalid access key id")
+			}
+
+			body, err := c.BodyBytes()
+			if err != nil {
+				return ErrInvalidParameter.WithMessage(err.Error())
+			}
+
+			expected := conf.sign(secret, c.req, body)
+			if !hmac.Equal([]byte(expected), []byte(signature)) {
+				return ErrSignatureDoesNotMatch
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com/a%20b?b=2&a=3&a=1&c", nil)
+	req.Header.Set("X-Test", " abc ")
+
+	expect := strings.Join([]string{
+		"POST",
+		"/a%20b",
+		"a=1&a=3&b=2&c=",
+		"host:example.com",
+		"x-test:abc",
+		"host;x-test",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}, "\n")
+	if s := CanonicalRequest(req, []string{"host", "x-test"}, nil); s != expect {
+		t.Errorf("expect canonical request:\n%s\nbut got:\n%s", expect, s)
+	}
+}
+
+func TestSignatureAuth(t *testing.T) {
+	lookup := func(ak string) (string, error) {
+		switch ak {
+		case "ak":
+			return "sk", nil
+		case "unknown":
+			return "", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	opts := []SigOption{SigSignedHeaders("Host", "X-Timestamp"), SigHashSHA512()}
+	svc := NewService()
+	svc.Use(SignatureAuth(lookup, opts...))
+	svc.Register("svc", func(c *Context) error {
+		var req struct{ Name string }
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.Success(req.Name)
+	})
+	svc.Register("Read", func(c *Context) error { return c.Success("read") })
+	svc.Register("Delete", func(c *Context) error { return c.Success("delete") })
+
+	send := func(req *http.Request) (resp Response) {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// The action in the header is always signed.
+	req := httptest.NewRequest("POST", "http://127.0.0.1", nil)
+	req.Header.Set("X-Action", "Read")
+	if err := SignRequest(req, "ak", "sk", opts...); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Action", "Delete")
+	if resp := send(req); resp.Error.Code != ErrSignatureDoesNotMatch.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrSignatureDoesNotMatch.Code, resp.Error.Code)
+	}
+
+	call := func(ak, sk string, tamper bool) (resp Response) {
+		req := httptest.NewRequest("POST", "http://127.0.0.1?Action=svc",
+			strings.NewReader(`{"Name":"abc"}`))
+		req.Header.Set("X-Timestamp", "1234567890")
+		if err := SignRequest(req, ak, sk, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if tamper {
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"Name":"xyz"}`))
+		}
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call("ak", "sk", false); resp.Error.Code != "" || resp.Data != "abc" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if resp := call("ak", "xx", false); resp.Error.Code != ErrSignatureDoesNotMatch.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrSignatureDoesNotMatch.Code, resp.Error.Code)
+	}
+
+	if resp := call("ak", "sk", true); resp.Error.Code != ErrSignatureDoesNotMatch.Code {
+		t.Errorf("expect error code '%s', but got '%s'", ErrSignatureDoesNotMatch.Code, resp.Error.Code)
+	}
+
+	if resp := call("xx", "sk", false); resp.Error.Code != ErrAuthFailureSignatureFailure.Code {
+		t.Errorf("expect error code '%s', but got '%s'",
+			ErrAuthFailureSignatureFailure.Code, resp.Error.Code)
+	}
+
+	// The empty secret of the unknown access key id is rejected.
+	if resp := call("unknown", "", false); resp.Error.Code != ErrAuthFailureSignatureFailure.Code {
+		t.Errorf("expect error code '%s', but got '%s'",
+			ErrAuthFailureSignatureFailure.Code, resp.Error.Code)
+	}
+}
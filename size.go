@@ -0,0 +1,102 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrResponseTooLarge is returned by writing the response body
+// when it exceeds the limit set by WithMaxResponseBytes.
+var ErrResponseTooLarge = errors.New("the response body exceeds the limit")
+
+// errRequestTooLarge is the same as the error of http.MaxBytesReader,
+// so it is converted into ErrRequestEntityTooLarge by Context.Bind.
+var errRequestTooLarge = errors.New("http: request body too large")
+
+// WithMaxRequestBytes returns an action option to limit the size
+// of the request body of the registered service, which is rejected
+// with ErrRequestEntityTooLarge by the Content-Length, or reading
+// the body returns an error once exceeding the limit.
+func WithMaxRequestBytes(n int64) ActionOption {
+	return func(a *action) { a.maxReq = n }
+}
+
+// WithMaxResponseBytes returns an action option to limit the size
+// of the response body of the registered service.
+//
+// If the body is buffered and exceeds the limit before the header is sent,
+// such as by Context.JSON, it is not sent and ErrResponseTooLarge is returned,
+// which is responded as the error instead. Or, the body is truncated
+// at the limit, and the writes, such as by Context.Stream, return
+// ErrResponseTooLarge to abort the copy. But the error response
+// by Context.Respond is not limited.
+func WithMaxResponseBytes(n int64) ActionOption {
+	return func(a *action) { a.maxResp = n }
+}
+
+// sizeReader counts the size of the request body and limits it.
+type sizeReader struct {
+	io.ReadCloser
+	n     int64
+	limit int64
+}
+
+func (r *sizeReader) Read(p []byte) (n int, err error) {
+	if r.limit > 0 {
+		if r.n >= r.limit {
+			// Probe whether the body has more data than the limit.
+			var b [1]byte
+			if n, _ = r.ReadCloser.Read(b[:]); n > 0 {
+				return 0, errRequestTooLarge
+			}
+			return 0, io.EOF
+		} else if remaining := r.limit - r.n; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// limitSize counts the size of the request body and sets the limits
+// of the request and the response of the action.
+func (c *Context) limitSize(a *action) error {
+	if a.maxReq > 0 && c.req.ContentLength > a.maxReq {
+		return ErrRequestEntityTooLarge.WithMessage(
+			"the request body must not exceed %d bytes", a.maxReq)
+	}
+
+	if c.req.Body != nil {
+		c.reqbody = sizeReader{ReadCloser: c.req.Body, limit: a.maxReq}
+		c.req.Body = &c.reqbody
+	}
+	c.res.max = a.maxResp
+	return nil
+}
+
+// RequestSize returns the number of the bytes of the read request body,
+// which is only counted after the action is resolved.
+func (c *Context) RequestSize() int64 { return c.reqbody.n }
+
+func (s *actionStats) addReqSize(n int64) {
+	if n > 0 {
+		atomic.AddUint64(&s.reqSize, uint64(n))
+	}
+}
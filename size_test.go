@@ -0,0 +1,90 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceSizeLimits(t *testing.T) {
+	var streamErr error
+	svc := NewService()
+	svc.RegisterWithOptions("Upload", func(c *Context) error {
+		body, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return ErrRequestEntityTooLarge.WithMessage(err.Error())
+		}
+		return c.Success(len(body))
+	}, WithMaxRequestBytes(32))
+	svc.RegisterWithOptions("Describe", func(c *Context) error {
+		return c.Success(strings.Repeat("a", 64))
+	}, WithMaxResponseBytes(64))
+	svc.RegisterWithOptions("Download", func(c *Context) error {
+		streamErr = c.Stream(200, "text/plain", strings.NewReader(strings.Repeat("b", 100)))
+		return nil
+	}, WithMaxResponseBytes(64))
+
+	serve := func(action, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/?Action="+action, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+			req.Body = ioutil.NopCloser(req.Body)
+		}
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+	errorCode := func(rec *httptest.ResponseRecorder) string {
+		var resp struct{ Error struct{ Code string } }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body.String())
+		}
+		return resp.Error.Code
+	}
+
+	body := strings.Repeat("x", 33)
+	for _, chunked := range []bool{false, true} {
+		if code := errorCode(serve("Upload", body, chunked)); code != ErrRequestEntityTooLarge.Code {
+			t.Errorf("chunked=%v: expect the error '%s', but got '%s'", chunked, ErrRequestEntityTooLarge.Code, code)
+		}
+	}
+	if code := errorCode(serve("Upload", strings.Repeat("x", 32), true)); code != "" {
+		t.Errorf("unexpected the error '%s'", code)
+	}
+
+	if code := errorCode(serve("Describe", "", false)); code != ErrServerError.Code {
+		t.Errorf("expect the error '%s', but got '%s'", ErrServerError.Code, code)
+	}
+
+	rec := serve("Download", "", false)
+	if rec.Body.Len() != 64 {
+		t.Errorf("expect the truncated body with %d bytes, but got %d", 64, rec.Body.Len())
+	} else if streamErr != ErrResponseTooLarge {
+		t.Errorf("expect the error ErrResponseTooLarge, but got %v", streamErr)
+	}
+
+	stats := svc.Stats()
+	if s := stats["Upload"]; s.ReqSize != 32+32 {
+		t.Errorf("unexpected the request size: %d", s.ReqSize)
+	}
+	if s := stats["Download"]; s.RespSize != 64 {
+		t.Errorf("unexpected the response size: %d", s.RespSize)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlowLogOption is used to configure the LogSlow middleware.
+type SlowLogOption func(*slowLogger)
+
+// SlowLogBodyDump returns a slow log option to dump the request body
+// up to maxSize bytes.
+func SlowLogBodyDump(maxSize int) SlowLogOption {
+	return func(l *slowLogger) { l.bodyDump = maxSize }
+}
+
+// SlowLogStillRunning returns a slow log option to log a warning
+// when the request is still running at the threshold, then every interval
+// until it finishes, which is used to catch the hanging requests.
+func SlowLogStillRunning(interval time.Duration) SlowLogOption {
+	return func(l *slowLogger) { l.interval = interval }
+}
+
+type slowLogger struct {
+	logger    *slog.Logger
+	threshold time.Duration
+	interval  time.Duration
+	bodyDump  int
+}
+
+// LogSlow returns a middleware to log the request whose handler exceeds
+// the threshold, which contains the action, version, request id, client ip,
+// latency and status code, and counts the slow calls per action,
+// which can be acquired by Service.Stats.
+func LogSlow(threshold time.Duration, logger *slog.Logger, opts ...SlowLogOption) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	l := &slowLogger{logger: logger, threshold: threshold}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			var body []byte
+			if l.bodyDump > 0 {
+				body, _ = c.BodyBytes()
+				if len(body) > l.bodyDump {
+					body = body[:l.bodyDump]
+				}
+			}
+
+			attrs := []slog.Attr{
+				slog.String("action", c.Action),
+				slog.String("version", c.GetVersion()),
+				slog.String("requestid", c.GetRequestID()),
+				slog.String("clientip", c.ClientIP()),
+			}
+			if l.bodyDump > 0 {
+				attrs = append(attrs, slog.String("body", string(body)))
+			}
+
+			start := time.Now()
+			if l.interval > 0 {
+				done := make(chan struct{})
+				defer close(done)
+				go l.watch(c.req.Context(), start, attrs, done)
+			}
+
+			err = next(c)
+			if latency := time.Since(start); latency > l.threshold {
+				c.svc.countSlowCall(c.Action)
+				attrs = append(attrs,
+					slog.Duration("latency", latency),
+					slog.Int("status", c.StatusCode()))
+				if err != nil {
+					attrs = append(attrs, slog.String("err", err.Error()))
+				}
+				l.logger.LogAttrs(c.req.Context(), slog.LevelWarn, "slow request", attrs...)
+			}
+			return
+		}
+	}
+}
+
+func (l *slowLogger) watch(ctx context.Context, start time.Time,
+	attrs []slog.Attr, done <-chan struct{}) {
+	timer := time.NewTimer(l.threshold)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+			_attrs := append(attrs[:len(attrs):len(attrs)],
+				slog.Duration("elapsed", time.Since(start)))
+			l.logger.LogAttrs(ctx, slog.LevelWarn, "request still running", _attrs...)
+			timer.Reset(l.interval)
+		}
+	}
+}
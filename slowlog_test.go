@@ -0,0 +1,84 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestLogSlow(t *testing.T) {
+	buf := new(syncBuffer)
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+
+	svc := NewService()
+	svc.Use(LogSlow(time.Millisecond*20, logger, SlowLogBodyDump(3),
+		SlowLogStillRunning(time.Millisecond*20)))
+	svc.Register("fast", func(c *Context) error { return c.Success(nil) })
+	svc.Register("slow", func(c *Context) error {
+		time.Sleep(time.Millisecond * 70)
+		return c.Success(nil)
+	})
+
+	for _, action := range []string{"fast", "slow", "slow"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://127.0.0.1?Action="+action, strings.NewReader("abcdef"))
+		svc.ServeHTTP(rec, req)
+	}
+
+	logs := buf.String()
+	if strings.Contains(logs, "action=fast") {
+		t.Errorf("unexpected the fast request log: %s", logs)
+	}
+	if n := strings.Count(logs, `msg="slow request"`); n != 2 {
+		t.Errorf("expect %d slow logs, but got %d: %s", 2, n, logs)
+	}
+	if !strings.Contains(logs, `msg="request still running"`) {
+		t.Errorf("expect the still running log: %s", logs)
+	}
+	if !strings.Contains(logs, "body=abc ") {
+		t.Errorf("expect the truncated body: %s", logs)
+	}
+
+	if stats := svc.Stats(); stats["slow"].SlowCalls != 2 || stats["fast"].SlowCalls != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import "time"
+
+// TenantObserver is an optional interface of Observer, which is used
+// to observe the result of the request with the tenant instead of Observe.
+type TenantObserver interface {
+	ObserveTenant(tenant, action, version string, status int,
+		latency time.Duration, respSize int64)
+}
+
+// WithTenantRequired returns an action option to reject the request
+// without the tenant with ErrMissingTenant.
+func WithTenantRequired() ActionOption {
+	return func(a *action) { a.tenantReq = true }
+}
+
+// UseForTenant registers the middlewares that only apply to the requests
+// of the tenant, which run after the global middlewares registered by Use.
+//
+// It is safe to be called at any time, even if the service is serving.
+func (s *Service) UseForTenant(tenant string, mws ...Middleware) {
+	if tenant == "" {
+		panic("Service.UseForTenant: the tenant must not be empty")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.tmws == nil {
+		s.tmws = make(map[string][]Middleware, 4)
+	}
+	s.tmws[tenant] = append(append([]Middleware{}, s.tmws[tenant]...), mws...)
+
+	handlers := make(map[string]Handler, len(s.tmws))
+	for tenant, mws := range s.tmws {
+		handlers[tenant] = wrapHandler(s.handleRequest, mws)
+	}
+	s.tenants.Store(handlers)
+}
+
+func (s *Service) serveTenant(c *Context) error {
+	if c.Tenant != "" {
+		if handlers, _ := s.tenants.Load().(map[string]Handler); handlers != nil {
+			if handler, ok := handlers[c.Tenant]; ok {
+				return handler(c)
+			}
+		}
+	}
+	return s.handleRequest(c)
+}
+
+func (s *Service) observe(c *Context, latency time.Duration) {
+	if o, ok := s.Observer.(TenantObserver); ok {
+		o.ObserveTenant(c.Tenant, c.Action, c.GetVersion(), c.observedStatus(), latency, c.res.Size)
+	} else {
+		s.Observer.Observe(c.Action, c.GetVersion(), c.observedStatus(), latency, c.res.Size)
+	}
+}
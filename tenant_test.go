@@ -0,0 +1,88 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tenantObserver []string
+
+func (o *tenantObserver) Observe(action, version string, status int,
+	latency time.Duration, respSize int64) {
+	*o = append(*o, ":"+action)
+}
+
+func (o *tenantObserver) ObserveTenant(tenant, action, version string,
+	status int, latency time.Duration, respSize int64) {
+	*o = append(*o, tenant+":"+action)
+}
+
+func TestServiceTenant(t *testing.T) {
+	var observer tenantObserver
+	var order []string
+
+	svc := NewService()
+	svc.Observer = Observers(&observer)
+	svc.Use(func(next Handler) Handler {
+		return func(c *Context) error { order = append(order, "global"); return next(c) }
+	})
+	svc.UseForTenant("t1", func(next Handler) Handler {
+		return func(c *Context) error { order = append(order, "t1"); return next(c) }
+	})
+	svc.RegisterWithOptions("svc", func(c *Context) error {
+		order = append(order, "handler")
+		return c.Success(c.Tenant)
+	}, WithTenantRequired())
+
+	call := func(tenant string) (resp Response) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=svc", nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-Id", tenant)
+		}
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if resp := call("t1"); resp.Data != "t1" {
+		t.Errorf("unexpected response: %+v", resp)
+	} else if expect := "global,t1,handler"; strings.Join(order, ",") != expect {
+		t.Errorf("expect order '%s', but got '%s'", expect, strings.Join(order, ","))
+	}
+
+	order = order[:0]
+	if resp := call("t2"); resp.Data != "t2" {
+		t.Errorf("unexpected response: %+v", resp)
+	} else if expect := "global,handler"; strings.Join(order, ",") != expect {
+		t.Errorf("expect order '%s', but got '%s'", expect, strings.Join(order, ","))
+	}
+
+	if resp := call(""); resp.Error.Code != ErrMissingTenant.Code {
+		t.Errorf("expect error '%s', but got '%s'", ErrMissingTenant.Code, resp.Error.Code)
+	}
+
+	if expect := "t1:svc,t2:svc,:svc"; strings.Join(observer, ",") != expect {
+		t.Errorf("expect observed '%s', but got '%s'", expect, strings.Join(observer, ","))
+	}
+}
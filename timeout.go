@@ -0,0 +1,168 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WithTimeout returns an action option to override the timeout duration
+// of the Timeout middleware for the registered service.
+func WithTimeout(timeout time.Duration) ActionOption {
+	return func(a *action) { a.timeout = timeout }
+}
+
+// Timeout returns a middleware to enforce that the handler must respond
+// in the timeout duration, which may be overridden by WithTimeout
+// when registering the service.
+//
+// The handler is still run in the calling goroutine with a request context
+// having the deadline. If the handler has not responded when the deadline
+// passes, the ErrGatewayTimeout response is sent, and all the later writes
+// of the handler will be discarded and return http.ErrHandlerTimeout.
+//
+// Notice: the timeout response is always rendered by JSON, not Context.Render.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			d := timeout
+			if a, ok := c.svc.getAction(c.Action); ok && a.timeout > 0 {
+				d = a.timeout
+			}
+			if d <= 0 {
+				return next(c)
+			}
+			return c.runTimeout(d, next)
+		}
+	}
+}
+
+// runTimeout runs next with the deadline of the timeout duration d,
+// and responds ErrGatewayTimeout only once if next has not responded.
+func (c *Context) runTimeout(d time.Duration, next Handler) (err error) {
+	req, resp := c.req, c.res.ResponseWriter
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	defer cancel()
+
+	tw := newTimeoutWriter(resp)
+	c.SetReqResp(req.WithContext(ctx), tw)
+	defer c.SetReqResp(req, resp)
+
+	done := make(chan struct{})
+	requestID, status := c.GetRequestID(), http.StatusOK
+	if c.svc.MapErrorStatus {
+		status = ErrGatewayTimeout.Status
+	}
+	timer := time.AfterFunc(d, func() {
+		tw.timeout(requestID, status, c.svc.RenderRetriable)
+		close(done)
+	})
+
+	err = next(c)
+	if !timer.Stop() {
+		<-done
+	}
+
+	if atomic.LoadInt32(&tw.claimed) == claimedByTimeout {
+		c.res.Wrote, c.responded, c.resperr = true, true, true
+		c.res.Status = tw.status
+		c.res.Size = tw.size
+		err = ErrGatewayTimeout
+	}
+
+	return
+}
+
+const (
+	claimedByHandler int32 = iota + 1
+	claimedByTimeout
+)
+
+// timeoutWriter is used to guarantee that only one of the handler
+// and the timeout sends the response.
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	header  http.Header // Only used by the handler.
+	claimed int32
+	status  int
+	size    int64
+}
+
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	header := make(http.Header, len(w.Header()))
+	for k, v := range w.Header() {
+		header[k] = v
+	}
+	return &timeoutWriter{ResponseWriter: w, header: header}
+}
+
+func (w *timeoutWriter) claim(by int32) bool {
+	return atomic.CompareAndSwapInt32(&w.claimed, 0, by)
+}
+
+func (w *timeoutWriter) Header() http.Header { return w.header }
+
+// Unwrap returns the underlying response writer.
+func (w *timeoutWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.claim(claimedByHandler) {
+		header := w.ResponseWriter.Header()
+		for k := range header {
+			if _, ok := w.header[k]; !ok {
+				delete(header, k)
+			}
+		}
+		for k, v := range w.header {
+			header[k] = v
+		}
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	// Send the implicit 200 like http.ResponseWriter if no WriteHeader.
+	if atomic.LoadInt32(&w.claimed) == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if atomic.LoadInt32(&w.claimed) != claimedByHandler {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *timeoutWriter) timeout(requestID string, status int, retriable bool) {
+	if !w.claim(claimedByTimeout) {
+		return
+	}
+
+	err := ErrGatewayTimeout
+	err.Retriable = retriable
+	buf := bytes.NewBuffer(nil)
+	json.NewEncoder(buf).Encode(jsonResponse{RequestID: requestID, Error: &err})
+
+	w.status = status
+	setContentType(w.ResponseWriter.Header(), MIMEApplicationJSONCharsetUTF8)
+	w.ResponseWriter.WriteHeader(w.status)
+	n, _ := w.ResponseWriter.Write(buf.Bytes())
+	w.size = int64(n)
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	slow := func(c *Context) error {
+		select {
+		case <-c.Request().Context().Done():
+		case <-time.After(time.Second):
+		}
+		time.Sleep(time.Millisecond * 10)
+		return c.Success("slow")
+	}
+
+	writeErrs := make(chan error, 1)
+	svc := NewService()
+	svc.Use(Timeout(time.Millisecond * 20))
+	svc.Register("fast", func(c *Context) error { return c.Success("fast") })
+	svc.Register("slow", func(c *Context) error {
+		err := slow(c)
+		writeErrs <- err
+		return err
+	})
+	svc.RegisterWithOptions("override", func(c *Context) error {
+		time.Sleep(time.Millisecond * 50)
+		return c.Success("override")
+	}, WithTimeout(time.Second))
+
+	call := func(action string) (resp struct {
+		Error Error
+		Data  string
+	}) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1?Action="+action, nil)
+		svc.ServeHTTP(rec, req)
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response by json: %v", err)
+		}
+		return
+	}
+
+	if resp := call("fast"); resp.Data != "fast" || resp.Error.Code != "" {
+		t.Errorf("unexpected response '%+v'", resp)
+	}
+
+	if resp := call("slow"); resp.Error.Code != ErrGatewayTimeout.Code {
+		t.Errorf("expect the error code '%s', but got '%s'",
+			ErrGatewayTimeout.Code, resp.Error.Code)
+	} else if err := <-writeErrs; err != http.ErrHandlerTimeout {
+		t.Errorf("expect the error '%v', but got '%v'", http.ErrHandlerTimeout, err)
+	}
+
+	if resp := call("override"); resp.Data != "override" || resp.Error.Code != "" {
+		t.Errorf("unexpected response '%+v'", resp)
+	}
+}
+
+func TestTimeoutWriterWriteWithoutWriteHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newTimeoutWriter(rec)
+	w.Header().Set("X-Handler", "1")
+
+	if n, err := w.Write([]byte("abc")); err != nil || n != 3 {
+		t.Fatalf("expect to write %d bytes, but got %d: %v", 3, n, err)
+	}
+	w.timeout("rid", http.StatusOK, false)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "abc" {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	} else if v := rec.Header().Get("X-Handler"); v != "1" {
+		t.Errorf("expect the header 'X-Handler' to be '1', but got '%s'", v)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute is the key-value attribute of the span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr is a convenient function to return a new Attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a tracing span, such as the span of OpenTelemetry.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer is used to start the tracing span, which may be adapted
+// to OpenTelemetry or others.
+//
+// The remote parent span extracted from the request is stored into ctx,
+// which can be acquired by RemoteSpanFromContext.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// SpanContext is the W3C trace context propagated by the request headers
+// "traceparent" and "tracestate".
+type SpanContext struct {
+	TraceID    string // 32 lower hex characters
+	SpanID     string // 16 lower hex characters
+	Flags      byte
+	TraceState string
+}
+
+// IsValid reports whether the span context is valid.
+func (sc SpanContext) IsValid() bool { return sc.TraceID != "" && sc.SpanID != "" }
+
+// Sampled reports whether the sampled flag is set.
+func (sc SpanContext) Sampled() bool { return sc.Flags&0x01 == 1 }
+
+type remoteSpanKey struct{}
+
+// ContextWithRemoteSpan returns a new context with the remote span context.
+func ContextWithRemoteSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanKey{}, sc)
+}
+
+// RemoteSpanFromContext returns the remote span context from ctx.
+func RemoteSpanFromContext(ctx context.Context) (sc SpanContext, ok bool) {
+	sc, ok = ctx.Value(remoteSpanKey{}).(SpanContext)
+	return
+}
+
+// ParseTraceParent parses the W3C traceparent header,
+// such as "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(traceparent string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isLowerHex(traceID) || isZeroHex(traceID) ||
+		len(spanID) != 16 || !isLowerHex(spanID) || isZeroHex(spanID) ||
+		len(flags) != 2 || !isLowerHex(flags) || !isLowerHex(parts[0]) {
+		return
+	}
+
+	f, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Flags: f[0]}, true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroHex(s string) bool { return strings.Trim(s, "0") == "" }
+
+// Tracing returns a middleware to start a span named after the action
+// for each request by tracer, which is the child of the remote span
+// extracted from the headers "traceparent" and "tracestate".
+//
+// The context of the request is replaced with the one returned by tracer,
+// so the outgoing calls of the handler by c.Request().Context() inherit it.
+// The span is ended after responding with the attributes, such as action,
+// version, request id, status and latency.
+func Tracing(tracer Tracer) Middleware {
+	if tracer == nil {
+		panic("Tracing: the tracer must not be nil")
+	}
+
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			ctx := c.req.Context()
+			if sc, ok := ParseTraceParent(c.GetReqHeader("traceparent")); ok {
+				sc.TraceState = c.GetReqHeader("tracestate")
+				ctx = ContextWithRemoteSpan(ctx, sc)
+			}
+
+			start := time.Now()
+			ctx, span := tracer.Start(ctx, c.Action)
+			c.req = c.req.WithContext(ctx)
+
+			if err = next(c); !c.IsResponded() {
+				c.Respond(nil, err)
+			}
+
+			span.SetAttributes(
+				Attr("action", c.Action),
+				Attr("version", c.GetVersion()),
+				Attr("requestid", c.GetRequestID()),
+				Attr("status", c.StatusCode()),
+				Attr("latency", time.Since(start)),
+			)
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+			return
+		}
+	}
+}
+
+// NoopTracer is a tracer that does nothing.
+var NoopTracer Tracer = noopTracer{}
+
+type noopTracer struct{}
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// RecordedSpan is the span recorded by RecordingTracer.
+type RecordedSpan struct {
+	Name       string
+	Parent     SpanContext // The remote parent span context if exists.
+	Attributes map[string]interface{}
+	Errors     []error
+	Ended      bool
+}
+
+// RecordingTracer is a tracer to record all the spans in memory,
+// which is used to assert the spans in the tests.
+type RecordingTracer struct {
+	lock  sync.Mutex
+	spans []*recordingSpan
+}
+
+// NewRecordingTracer returns a new RecordingTracer.
+func NewRecordingTracer() *RecordingTracer { return &RecordingTracer{} }
+
+// Start implements the interface Tracer.
+func (t *RecordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordingSpan{span: RecordedSpan{Name: name, Attributes: map[string]interface{}{}}}
+	span.span.Parent, _ = RemoteSpanFromContext(ctx)
+
+	t.lock.Lock()
+	t.spans = append(t.spans, span)
+	t.lock.Unlock()
+	return ctx, span
+}
+
+// Spans returns the copies of all the recorded spans.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	spans := make([]RecordedSpan, len(t.spans))
+	for i, span := range t.spans {
+		spans[i] = span.snapshot()
+	}
+	return spans
+}
+
+// Reset clears all the recorded spans.
+func (t *RecordingTracer) Reset() {
+	t.lock.Lock()
+	t.spans = nil
+	t.lock.Unlock()
+}
+
+type recordingSpan struct {
+	lock sync.Mutex
+	span RecordedSpan
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.lock.Lock()
+	for _, attr := range attrs {
+		s.span.Attributes[attr.Key] = attr.Value
+	}
+	s.lock.Unlock()
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.lock.Lock()
+	s.span.Errors = append(s.span.Errors, err)
+	s.lock.Unlock()
+}
+
+func (s *recordingSpan) End() {
+	s.lock.Lock()
+	s.span.Ended = true
+	s.lock.Unlock()
+}
+
+func (s *recordingSpan) snapshot() RecordedSpan {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	span := s.span
+	span.Errors = append([]error(nil), s.span.Errors...)
+	span.Attributes = make(map[string]interface{}, len(s.span.Attributes))
+	for k, v := range s.span.Attributes {
+		span.Attributes[k] = v
+	}
+	return span
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type ctxKey struct{}
+
+type valueTracer struct{ *RecordingTracer }
+
+func (t valueTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := t.RecordingTracer.Start(ctx, name)
+	return context.WithValue(ctx, ctxKey{}, name), span
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":     false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":     false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":     false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7":        false,
+	}
+
+	for traceparent, expect := range tests {
+		if _, ok := ParseTraceParent(traceparent); ok != expect {
+			t.Errorf("%s: expect '%v', but got '%v'", traceparent, expect, ok)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := NewRecordingTracer()
+	svc := NewService()
+	svc.Use(Tracing(valueTracer{tracer}))
+	svc.Register("ok", func(c *Context) error {
+		return c.Success(c.Request().Context().Value(ctxKey{}))
+	})
+	svc.Register("fail", func(c *Context) error { return ErrFailedOperation })
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1?Action=ok", nil)
+	req.Header.Set("X-Request-Id", "1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "k=v")
+	svc.ServeHTTP(rec, req)
+	if expect := `{"RequestId":"1","Data":"ok"}` + "\n"; rec.Body.String() != expect {
+		t.Errorf("expect the response '%s', but got '%s'", expect, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://127.0.0.1?Action=fail", nil)
+	svc.ServeHTTP(rec, req)
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect %d spans, but got %d", 2, len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "ok" || !span.Ended || len(span.Errors) != 0 {
+		t.Errorf("unexpected span: %+v", span)
+	} else if span.Parent.SpanID != "00f067aa0ba902b7" || !span.Parent.Sampled() ||
+		span.Parent.TraceState != "k=v" {
+		t.Errorf("unexpected the parent span: %+v", span.Parent)
+	} else if span.Attributes["requestid"] != "1" || span.Attributes["status"] != 200 {
+		t.Errorf("unexpected attributes: %+v", span.Attributes)
+	}
+
+	if span = spans[1]; span.Name != "fail" || span.Parent.IsValid() ||
+		len(span.Errors) != 1 || !span.Ended {
+		t.Errorf("unexpected span: %+v", span)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package httpsvc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResponseController(t *testing.T) {
+	errs := make(chan []error, 1)
+	svc := NewService()
+	svc.Use(Audit()) // Wrap the response writer by the middleware.
+	svc.Register("Action", func(c *Context) error {
+		rc := http.NewResponseController(c)
+		deadline := time.Now().Add(time.Second)
+		errs <- []error{
+			rc.SetReadDeadline(deadline),
+			rc.SetWriteDeadline(deadline),
+			rc.EnableFullDuplex(),
+			rc.Flush(),
+		}
+		_, err := c.WriteString("ok")
+		return err
+	})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?Action=Action")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("expect the body 'ok', but got '%s'", body)
+	}
+	for i, err := range <-errs {
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+	}
+
+	c := svc.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	defer svc.ReleaseContext(c)
+	c.SetResponseWriter(struct{ http.ResponseWriter }{httptest.NewRecorder()})
+	if err := http.NewResponseController(c).Flush(); err != http.ErrNotSupported {
+		t.Errorf("expect the error ErrNotSupported, but got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// versionSet is the immutable set of the versions of a service.
+type versionSet struct {
+	name     string // The original name when registering.
+	def      string // The default version.
+	versions map[string]*action
+}
+
+func (vs *versionSet) copy() *versionSet {
+	nvs := &versionSet{name: vs.name, def: vs.def}
+	nvs.versions = make(map[string]*action, len(vs.versions)+1)
+	for version, a := range vs.versions {
+		nvs.versions[version] = a
+	}
+	return nvs
+}
+
+func (vs *versionSet) clone() *versionSet {
+	nvs := vs.copy()
+	for version, a := range vs.versions {
+		nvs.versions[version] = a.clone()
+	}
+	return nvs
+}
+
+// list returns the sorted versions.
+func (vs *versionSet) list() []string {
+	versions := make([]string, 0, len(vs.versions))
+	for version := range vs.versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// RegisterVersion registers the handler of the service named name
+// for the version, which is called when the request has the version,
+// such as the header "X-Version".
+//
+// The request with a version not registered, or without the version
+// and the default version set by SetDefaultVersion, falls back to
+// the service registered by Register with the same name. If it does not
+// exist, the request is rejected with ErrInvalidVersion.
+func (s *Service) RegisterVersion(name, version string, handler Handler, opts ...ActionOption) {
+	if name == "" {
+		panic("Service.RegisterVersion: the service name must not be empty")
+	} else if version == "" {
+		panic("Service.RegisterVersion: the service version must not be empty")
+	} else if handler == nil {
+		panic("Service.RegisterVersion: the service handler must not be empty")
+	}
+	s.validateName("Service.RegisterVersion", name)
+
+	key := s.normalize(name)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.loadRegistry()
+	if a, ok := r.handlers[key]; ok && a.name != name {
+		panic(fmt.Errorf("Service.RegisterVersion: the service '%s' conflicts with '%s'",
+			name, a.name))
+	}
+
+	vs, ok := r.versions[key]
+	if !ok {
+		vs = &versionSet{name: name}
+	} else if vs.name != name {
+		panic(fmt.Errorf("Service.RegisterVersion: the service '%s' conflicts with '%s'",
+			name, vs.name))
+	}
+
+	a := newAction(name, handler, opts)
+	a.version, a.vmws = version, s.vmws[version]
+	a.wrap()
+	if len(a.headers) > 0 {
+		atomic.StoreInt32(&s.actionHeaders, 1)
+	}
+
+	vs = vs.copy()
+	vs.versions[version] = a
+
+	r = r.copy()
+	r.versions[key] = vs
+	s.registry.Store(r)
+}
+
+// SetDefaultVersion sets the default version of the service named name,
+// which is used when the request has no version. If version is empty,
+// clear the default version.
+//
+// Return an error if the version of the service has not been registered.
+func (s *Service) SetDefaultVersion(name, version string) error {
+	key := s.normalize(name)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.loadRegistry()
+	vs, ok := r.versions[key]
+	if !ok {
+		return fmt.Errorf("no versioned service named '%s'", name)
+	} else if _, ok = vs.versions[version]; !ok && version != "" {
+		return fmt.Errorf("no version '%s' of the service '%s'", version, name)
+	}
+
+	vs = vs.copy()
+	vs.def = version
+
+	r = r.copy()
+	r.versions[key] = vs
+	s.registry.Store(r)
+	return nil
+}
+
+// UseForVersion appends the middlewares to all the services registered
+// with the version by RegisterVersion, including those registered later,
+// which only act on the requests resolved to the version and are applied
+// outside the middlewares of the service.
+func (s *Service) UseForVersion(version string, mws ...Middleware) {
+	if version == "" {
+		panic("Service.UseForVersion: the version must not be empty")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.vmws == nil {
+		s.vmws = make(map[string][]Middleware, 4)
+	}
+	s.vmws[version] = append(append([]Middleware{}, s.vmws[version]...), mws...)
+
+	for _, vs := range s.loadRegistry().versions {
+		if a, ok := vs.versions[version]; ok {
+			a.vmws = s.vmws[version]
+			a.wrap()
+		}
+	}
+}
+
+// Versions returns the sorted versions registered by RegisterVersion
+// and the default version of the service named name, which may be
+// an alias by Mapping.
+func (s *Service) Versions(name string) (versions []string, defaultVersion string) {
+	r := s.loadRegistry()
+	if key, ok := r.resolve(s.normalize(name)); ok {
+		if vs, ok := r.versions[key]; ok {
+			versions, defaultVersion = vs.list(), vs.def
+		}
+	}
+	return
+}
+
+// lookupHandler looks up the action to handle the request by the action
+// and the version, which returns (nil, nil, nil) if not found.
+func (s *Service) lookupHandler(c *Context) (a *action, handler Handler, err error) {
+	r := s.loadRegistry()
+	key, ok := r.resolve(s.normalize(c.Action))
+	if !ok {
+		return
+	}
+
+	a = r.handlers[key]
+	if vs, ok := r.versions[key]; ok {
+		version := c.GetVersion()
+		if version == "" && vs.def != "" {
+			version, c.Version = vs.def, vs.def
+		}
+
+		if va, ok := vs.versions[version]; ok {
+			a = va
+		} else if a == nil || (version == "" && s.RequireVersion) {
+			return nil, nil, invalidVersion(c.Action, version, vs.list())
+		}
+	}
+
+	if a != nil {
+		handler = a.wrapped.Load().(Handler)
+	}
+	return
+}
+
+func invalidVersion(action, version string, versions []string) Error {
+	supported := strings.Join(versions, ", ")
+	if version == "" {
+		return ErrInvalidVersion.WithMessage("missing the version of the action '%s', supported versions: %s",
+			action, supported)
+	}
+	return ErrInvalidVersion.WithMessage("invalid version '%s' of the action '%s', supported versions: %s",
+		version, action, supported)
+}
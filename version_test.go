@@ -0,0 +1,128 @@
+// Copyright 2021 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceRegisterVersion(t *testing.T) {
+	handler := func(result string) Handler {
+		return func(c *Context) error { return c.Success(result + "@" + c.GetVersion()) }
+	}
+
+	svc := NewService()
+	svc.Register("GetUser", handler("base"))
+	svc.RegisterVersion("GetUser", "2023-01-01", handler("v1"))
+	svc.RegisterVersion("ListUsers", "2023-01-01", handler("v1"))
+	svc.Mapping("DescribeUser", "GetUser")
+	svc.Mapping("DescribeUsers", "ListUsers")
+
+	var calls []string
+	svc.UseForVersion("2024-01-01", func(next Handler) Handler {
+		return func(c *Context) error {
+			calls = append(calls, c.Action)
+			return next(c)
+		}
+	})
+	svc.RegisterVersion("GetUser", "2024-01-01", handler("v2"))
+	svc.RegisterVersion("ListUsers", "2024-01-01", handler("v2"))
+
+	call := func(action, version string) (data string, code string) {
+		req := httptest.NewRequest(http.MethodGet, "/?Action="+action, nil)
+		if version != "" {
+			req.Header.Set("X-Version", version)
+		}
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+
+		var resp struct {
+			Error *Error
+			Data  string
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		return resp.Data, code
+	}
+
+	tests := []struct {
+		action  string
+		version string
+		data    string
+		code    string
+	}{
+		{"GetUser", "2023-01-01", "v1@2023-01-01", ""},
+		{"DescribeUser", "2024-01-01", "v2@2024-01-01", ""},
+		{"GetUser", "2099-01-01", "base@2099-01-01", ""},
+		{"GetUser", "", "base@", ""},
+		{"DescribeUsers", "2023-01-01", "v1@2023-01-01", ""},
+		{"ListUsers", "2099-01-01", "", ErrInvalidVersion.Code},
+		{"ListUsers", "", "", ErrInvalidVersion.Code},
+	}
+	for _, test := range tests {
+		if data, code := call(test.action, test.version); data != test.data || code != test.code {
+			t.Errorf("%s@%s: expect '%s' and '%s', but got '%s' and '%s'",
+				test.action, test.version, test.data, test.code, data, code)
+		}
+	}
+	if len(calls) != 1 || calls[0] != "DescribeUser" {
+		t.Errorf("unexpected the calls of the version middleware: %v", calls)
+	}
+
+	if err := svc.SetDefaultVersion("ListUsers", "2099-01-01"); err == nil {
+		t.Error("expect an error for the unregistered version")
+	} else if err = svc.SetDefaultVersion("DescribeUsers", "2024-01-01"); err == nil {
+		t.Error("expect an error for the alias")
+	} else if err = svc.SetDefaultVersion("ListUsers", "2024-01-01"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := call("DescribeUsers", ""); data != "v2@2024-01-01" {
+		t.Errorf("expect the default version, but got '%s'", data)
+	}
+
+	svc.RequireVersion = true
+	if _, code := call("GetUser", ""); code != ErrInvalidVersion.Code {
+		t.Errorf("expect the error '%s', but got '%s'", ErrInvalidVersion.Code, code)
+	}
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?Action=GetUser", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "supported versions: 2023-01-01, 2024-01-01") {
+		t.Errorf("unexpected the response: %s", body)
+	}
+
+	if versions, def := svc.Versions("DescribeUsers"); len(versions) != 2 || def != "2024-01-01" {
+		t.Errorf("unexpected the versions: %v, %s", versions, def)
+	}
+	if info, ok := svc.ActionInfo("ListUsers"); !ok || info.Name != "ListUsers" || len(info.Versions) != 2 {
+		t.Errorf("unexpected the action info: %+v", info)
+	}
+	if infos := svc.DescribeServices(""); len(infos) != 2 || infos[1].DefaultVersion != "2024-01-01" {
+		t.Errorf("unexpected the services: %+v", infos)
+	}
+
+	svc.Unregister("ListUsers")
+	if _, ok := svc.ActionInfo("ListUsers"); ok {
+		t.Error("expect the versioned service to be unregistered")
+	}
+}